@@ -22,7 +22,7 @@ require (
 	github.com/fogleman/gg v1.3.0
 	github.com/garyburd/go-oauth v0.0.0-20180319155456-bca2e7f09a17 // indirect
 	github.com/getsentry/raven-go v0.1.0
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/gorilla/feeds v1.1.1
 	github.com/gorilla/mux v1.7.3
@@ -42,7 +42,7 @@ require (
 	github.com/stripe/stripe-go v62.10.0+incompatible
 	github.com/turnage/graw v0.0.0-20190218184947-3295929039f6
 	github.com/turnage/redditproto v0.0.0-20151223012412-afedf1b6eddb // indirect
-	golang.org/x/image v0.0.0-20200430140353-33d19683fad8 // indirect
+	golang.org/x/image v0.0.0-20200430140353-33d19683fad8
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45 // indirect
 	gopkg.in/russross/blackfriday.v2 v2.0.0
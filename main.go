@@ -9,6 +9,7 @@ import (
 	"github.com/0x13a/golang.cafe/pkg/email"
 	"github.com/0x13a/golang.cafe/pkg/handler"
 	"github.com/0x13a/golang.cafe/pkg/ipgeolocation"
+	"github.com/0x13a/golang.cafe/pkg/mediastore"
 	"github.com/0x13a/golang.cafe/pkg/server"
 	"github.com/0x13a/golang.cafe/pkg/template"
 
@@ -21,7 +22,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to load config: %+v", err)
 	}
-	conn, err := database.GetDbConn(cfg.DatabaseURL)
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
 	if err != nil {
 		log.Fatalf("unable to connect to postgres: %v", err)
 	}
@@ -35,10 +36,15 @@ func main() {
 	}
 	defer ipGeolocation.Close()
 	sessionStore := sessions.NewCookieStore(cfg.SessionKey)
+	stores := database.NewStores(database.NewPostgresStore(conn))
+	stores.Media, err = mediastore.New(cfg.MediaStorage, cfg, conn)
+	if err != nil {
+		log.Fatalf("unable to create %s media store: %v", cfg.MediaStorage, err)
+	}
 
 	svr := server.NewServer(
 		cfg,
-		conn,
+		stores,
 		mux.NewRouter(),
 		template.NewTemplate(),
 		emailClient,
@@ -104,6 +110,9 @@ func main() {
 	// submit job post
 	svr.RegisterRoute("/x/s", handler.SubmitJobPostPageHandler(svr), []string{"POST"})
 
+	// suggest skills for a job post
+	svr.RegisterRoute("/x/skills/extract", handler.ExtractSkillsHandler(svr), []string{"POST"})
+
 	// re-submit job post payment for upsell
 	svr.RegisterRoute("/x/s/upsell", handler.SubmitJobPostPaymentUpsellPageHandler(svr), []string{"POST"})
 
@@ -116,6 +125,11 @@ func main() {
 	// retrieve media file
 	svr.RegisterRoute("/x/s/m/{id}", handler.RetrieveMediaPageHandler(svr), []string{"GET"})
 
+	// retrieve meta image of salary, landing and news pages
+	svr.RegisterRoute("/x/s/m/meta/salary/{location}", handler.RetrieveSalaryMetaImageHandler(svr), []string{"GET"})
+	svr.RegisterRoute("/x/s/m/meta/jobs", handler.RetrieveLandingMetaImageHandler(svr), []string{"GET"})
+	svr.RegisterRoute("/x/s/m/meta/news/{id}", handler.RetrieveNewsMetaImageHandler(svr), []string{"GET"})
+
 	// retrieve meta image media file
 	svr.RegisterRoute("/x/s/m/meta/{id}", handler.RetrieveMediaMetaPageHandler(svr), []string{"GET"})
 
@@ -131,6 +145,10 @@ func main() {
 	// view job by slug
 	svr.RegisterRoute("/job/{slug}", handler.JobBySlugPageHandler(svr), []string{"GET"})
 
+	// company profile pages
+	svr.RegisterRoute("/company/{slug}", handler.CompanyPageHandler(svr), []string{"GET"})
+	svr.RegisterRoute("/companies", handler.CompaniesPageHandler(svr), []string{"GET"})
+
 	//
 	// auth routes
 	//
@@ -160,8 +178,11 @@ func main() {
 	// @private: view edit job by token
 	svr.RegisterRoute("/edit/{token}", handler.EditJobViewPageHandler(svr), []string{"GET"})
 
-	// @private: disapprove job by token
-	svr.RegisterRoute("/x/d", handler.DisapproveJobPageHandler(svr), []string{"POST"})
+	// @private: pause, resume or mark job as filled by token
+	svr.RegisterRoute("/x/j/status", handler.UpdateJobStatusPageHandler(svr), []string{"POST"})
+
+	// @private: renew job by token
+	svr.RegisterRoute("/x/j/renew", handler.RenewJobPageHandler(svr), []string{"POST"})
 
 	//
 	// landing page routes
@@ -211,6 +232,25 @@ func main() {
 	// @admin: list/search jobs as admin
 	svr.RegisterRoute("/manage/list", handler.ListJobsAsAdminPageHandler(svr), []string{"GET"})
 
+	// @admin: list archived jobs
+	svr.RegisterRoute("/manage/archived", handler.ListArchivedJobsPageHandler(svr), []string{"GET"})
+
+	// @admin: browse the audit log
+	svr.RegisterRoute("/manage/audit", handler.AuditLogPageHandler(svr), []string{"GET"})
+
+	// @admin: explain how listings are ranked
+	svr.RegisterRoute("/manage/ranking", handler.RankingDebugPageHandler(svr), []string{"GET"})
+
+	// @admin: listing cache hit/miss counters
+	svr.RegisterRoute("/manage/cache", handler.ListingCacheStatsHandler(svr), []string{"GET"})
+
+	// @admin: event ingester counters, including dropped events
+	svr.RegisterRoute("/manage/events", handler.EventIngesterStatsHandler(svr), []string{"GET"})
+
+	// @admin: preview the meta image of a job with every template
+	svr.RegisterRoute("/manage/meta/{token}", handler.MetaImagePreviewPageHandler(svr), []string{"GET"})
+	svr.RegisterRoute("/manage/meta/{token}/{template}", handler.MetaImagePreviewHandler(svr), []string{"GET"})
+
 	// @admin: view job as admin (alias to manage/edit/{token})
 	svr.RegisterRoute("/manage/job/{slug}", handler.ManageJobBySlugViewPageHandler(svr), []string{"GET"})
 
@@ -223,8 +263,22 @@ func main() {
 	// @admin: approve job
 	svr.RegisterRoute("/x/a", handler.ApproveJobPageHandler(svr), []string{"POST"})
 
-	// @admin: permanently delete job and all child resources (image, clickouts, edit token)
-	svr.RegisterRoute("/x/j/d", handler.PermanentlyDeleteJobByToken(svr), []string{"POST"})
+	// @admin: reject job
+	svr.RegisterRoute("/x/d", handler.DisapproveJobPageHandler(svr), []string{"POST"})
+
+	// @admin: revert job to an earlier revision
+	svr.RegisterRoute("/x/j/revert", handler.RevertJobPageHandler(svr), []string{"POST"})
 
-	log.Fatal(svr.Run())
+	// @admin: archive job, child resources are kept until the job gets purged
+	svr.RegisterRoute("/x/j/d", handler.ArchiveJobPageHandler(svr), []string{"POST"})
+
+	// @admin: restore archived job
+	svr.RegisterRoute("/x/j/restore", handler.RestoreJobPageHandler(svr), []string{"POST"})
+
+	// @admin: edit company profile
+	svr.RegisterRoute("/x/company", handler.UpdateCompanyPageHandler(svr), []string{"POST"})
+
+	if err := svr.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
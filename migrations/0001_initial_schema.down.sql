@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS meta;
+DROP TABLE IF EXISTS seo_landing_page;
+DROP TABLE IF EXISTS queue_jobs;
+DROP TABLE IF EXISTS seo_location;
+DROP TABLE IF EXISTS seo_skill;
+DROP TABLE IF EXISTS seo_salary;
+DROP TABLE IF EXISTS job_event;
+DROP TABLE IF EXISTS apply_token;
+DROP TABLE IF EXISTS purchase_event;
+DROP TABLE IF EXISTS edit_token;
+DROP TABLE IF EXISTS user_sign_on_token;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS news_comment;
+DROP TABLE IF EXISTS news;
+DROP TABLE IF EXISTS image;
+DROP TABLE IF EXISTS job;
@@ -0,0 +1,152 @@
+-- Baseline schema. Every statement is idempotent so this migration can be
+-- recorded against databases that were created before migrations existed.
+
+CREATE TABLE IF NOT EXISTS job (
+	id                    SERIAL NOT NULL,
+	job_title             VARCHAR(128) NOT NULL,
+	company               VARCHAR(128) NOT NULL,
+	company_url           VARCHAR(128) NOT NULL,
+	company_twitter       VARCHAR(128),
+	company_email         VARCHAR(128),
+	salary_range          VARCHAR(100) NOT NULL,
+	location              VARCHAR(200) NOT NULL,
+	description           TEXT NOT NULL,
+	perks                 TEXT,
+	interview_process     TEXT,
+	how_to_apply          VARCHAR(512),
+	created_at            TIMESTAMP NOT NULL,
+	approved_at           TIMESTAMP,
+	url_id                INTEGER NOT NULL,
+	slug                  VARCHAR(256),
+	salary_min            INTEGER NOT NULL DEFAULT 1,
+	salary_max            INTEGER NOT NULL DEFAULT 1,
+	salary_currency       VARCHAR(4) NOT NULL DEFAULT '$',
+	external_id           VARCHAR(28) NOT NULL,
+	ad_type               INTEGER NOT NULL DEFAULT 0,
+	company_icon_image_id VARCHAR(255) DEFAULT NULL,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS url_id_idx ON job (url_id);
+CREATE UNIQUE INDEX IF NOT EXISTS slug_idx ON job (slug);
+
+CREATE TABLE IF NOT EXISTS image (
+	id         CHAR(27) NOT NULL UNIQUE,
+	bytes      BYTEA NOT NULL,
+	media_type VARCHAR(100) NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS news (
+	id         CHAR(27) NOT NULL UNIQUE,
+	title      VARCHAR(80) NOT NULL,
+	text       TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	created_by CHAR(27) NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS news_comment (
+	id         CHAR(27) NOT NULL UNIQUE,
+	text       TEXT NOT NULL,
+	created_by CHAR(27) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	parent_id  CHAR(27) NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS news_comment_parent_id_idx ON news_comment (parent_id);
+
+CREATE TABLE IF NOT EXISTS users (
+	id         CHAR(27) NOT NULL UNIQUE,
+	email      VARCHAR(255) NOT NULL,
+	username   VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS user_sign_on_token (
+	token CHAR(27) NOT NULL UNIQUE,
+	email VARCHAR(255) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_sign_on_token_token_idx ON user_sign_on_token (token);
+
+CREATE TABLE IF NOT EXISTS edit_token (
+	token      CHAR(27) NOT NULL,
+	job_id     INTEGER NOT NULL REFERENCES job (id),
+	created_at TIMESTAMP NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS token_idx ON edit_token (token);
+
+CREATE TABLE IF NOT EXISTS purchase_event (
+	stripe_session_id VARCHAR(255) NOT NULL,
+	amount            INTEGER NOT NULL,
+	currency          CHAR(3) NOT NULL,
+	created_at        TIMESTAMP NOT NULL,
+	completed_at      TIMESTAMP DEFAULT NULL,
+	description       VARCHAR(255) NOT NULL,
+	ad_type           INTEGER NOT NULL DEFAULT 0,
+	email             VARCHAR(255) NOT NULL,
+	job_id            INTEGER NOT NULL REFERENCES job (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS purchase_event_stripe_session_id_idx ON purchase_event (stripe_session_id);
+CREATE INDEX IF NOT EXISTS purchase_event_job_id_idx ON purchase_event (job_id);
+
+CREATE TABLE IF NOT EXISTS apply_token (
+	token        CHAR(27) NOT NULL,
+	job_id       INTEGER NOT NULL REFERENCES job (id),
+	created_at   TIMESTAMP NOT NULL,
+	confirmed_at TIMESTAMP DEFAULT NULL,
+	email        VARCHAR(255) NOT NULL,
+	cv           BYTEA NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS apply_token_token_idx ON apply_token (token);
+
+CREATE TABLE IF NOT EXISTS job_event (
+	event_type VARCHAR(128) NOT NULL,
+	job_id     INTEGER NOT NULL REFERENCES job (id),
+	created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS job_idx ON job_event (job_id);
+
+CREATE TABLE IF NOT EXISTS seo_salary (
+	id       VARCHAR(255) NOT NULL,
+	location VARCHAR(255) NOT NULL,
+	currency VARCHAR(5) NOT NULL,
+	uri      VARCHAR(100) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS seo_salary_idx ON seo_salary (id);
+
+CREATE TABLE IF NOT EXISTS seo_skill (
+	name VARCHAR(255) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS seo_location (
+	name     VARCHAR(255) NOT NULL UNIQUE,
+	currency VARCHAR(4) NOT NULL DEFAULT '$',
+	country  VARCHAR(255) DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS queue_jobs (
+	id          VARCHAR(28) NOT NULL,
+	name        VARCHAR(255) NOT NULL,
+	payload     JSONB NOT NULL,
+	created_at  TIMESTAMP NOT NULL,
+	started_at  TIMESTAMP DEFAULT NULL,
+	finished_at TIMESTAMP DEFAULT NULL,
+	priority    INTEGER NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS queue_jobs_name_idx ON queue_jobs (name);
+
+CREATE TABLE IF NOT EXISTS seo_landing_page (
+	uri      VARCHAR(255) NOT NULL UNIQUE,
+	location VARCHAR(255) NOT NULL,
+	skill    VARCHAR(255) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS seo_landing_page_uri ON seo_landing_page (uri);
+
+CREATE TABLE IF NOT EXISTS meta (
+	key   VARCHAR(255) NOT NULL UNIQUE,
+	value VARCHAR(255) NOT NULL
+);
+INSERT INTO meta (key, value) VALUES ('last_sent_job_id_weekly', '0') ON CONFLICT DO NOTHING;
+INSERT INTO meta (key, value) VALUES ('last_twitted_job_id', '0') ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS job_status_transition;
+UPDATE job SET approved_at = NULL WHERE status <> 'approved';
+DROP INDEX IF EXISTS job_status_idx;
+ALTER TABLE job DROP CONSTRAINT IF EXISTS job_status_check;
+ALTER TABLE job DROP COLUMN IF EXISTS status_updated_at;
+ALTER TABLE job DROP COLUMN IF EXISTS status;
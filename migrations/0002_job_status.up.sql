@@ -0,0 +1,20 @@
+-- Explicit job lifecycle. approved_at is kept as the time the job last went
+-- live, status is the source of truth for whether it is listed.
+
+ALTER TABLE job ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'pending';
+ALTER TABLE job ADD COLUMN status_updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+UPDATE job SET status_updated_at = created_at WHERE approved_at IS NULL;
+UPDATE job SET status = 'approved', status_updated_at = approved_at WHERE approved_at IS NOT NULL;
+ALTER TABLE job ADD CONSTRAINT job_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'paused', 'expired', 'filled'));
+CREATE INDEX job_status_idx ON job (status);
+
+CREATE TABLE job_status_transition (
+	id          SERIAL NOT NULL,
+	job_id      INTEGER NOT NULL REFERENCES job (id),
+	from_status VARCHAR(16) NOT NULL,
+	to_status   VARCHAR(16) NOT NULL,
+	actor       VARCHAR(255) NOT NULL,
+	created_at  TIMESTAMP NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX job_status_transition_job_id_idx ON job_status_transition (job_id);
@@ -0,0 +1,4 @@
+ALTER TABLE purchase_event DROP COLUMN IF EXISTS renewal;
+DROP INDEX IF EXISTS job_expires_at_idx;
+ALTER TABLE job DROP COLUMN IF EXISTS expiry_warning_sent_at;
+ALTER TABLE job DROP COLUMN IF EXISTS expires_at;
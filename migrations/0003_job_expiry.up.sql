@@ -0,0 +1,9 @@
+-- Jobs expire after a configurable period (JOB_EXPIRY_DAYS). Live jobs are
+-- backfilled with the default period counted from their approval.
+
+ALTER TABLE job ADD COLUMN expires_at TIMESTAMP;
+ALTER TABLE job ADD COLUMN expiry_warning_sent_at TIMESTAMP;
+UPDATE job SET expires_at = approved_at + INTERVAL '90 days' WHERE status IN ('approved', 'paused') AND approved_at IS NOT NULL;
+CREATE INDEX job_expires_at_idx ON job (expires_at);
+
+ALTER TABLE purchase_event ADD COLUMN renewal BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,9 @@
+UPDATE job SET status = COALESCE(
+	(SELECT t.from_status FROM job_status_transition t WHERE t.job_id = job.id AND t.to_status = 'archived' ORDER BY t.id DESC LIMIT 1),
+	'rejected'
+) WHERE status = 'archived';
+DROP INDEX IF EXISTS job_archived_at_idx;
+ALTER TABLE job DROP COLUMN IF EXISTS archive_reason;
+ALTER TABLE job DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE job DROP CONSTRAINT IF EXISTS job_status_check;
+ALTER TABLE job ADD CONSTRAINT job_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'paused', 'expired', 'filled'));
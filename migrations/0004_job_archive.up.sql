@@ -0,0 +1,9 @@
+-- Deleting a job archives it instead. Archived jobs keep their child rows and
+-- can be restored to the status they had before; they are purged for good
+-- once JOB_ARCHIVE_RETENTION_DAYS have passed.
+
+ALTER TABLE job DROP CONSTRAINT job_status_check;
+ALTER TABLE job ADD CONSTRAINT job_status_check CHECK (status IN ('pending', 'approved', 'rejected', 'paused', 'expired', 'filled', 'archived'));
+ALTER TABLE job ADD COLUMN archived_at TIMESTAMP;
+ALTER TABLE job ADD COLUMN archive_reason TEXT;
+CREATE INDEX job_archived_at_idx ON job (archived_at);
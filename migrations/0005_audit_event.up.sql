@@ -0,0 +1,25 @@
+-- Append-only log of moderation and billing actions. job_id has no foreign
+-- key so events outlive purged jobs.
+
+CREATE TABLE audit_event (
+	id         SERIAL NOT NULL,
+	actor      VARCHAR(255) NOT NULL,
+	action     VARCHAR(64) NOT NULL,
+	job_id     INTEGER,
+	diff       JSONB NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (id)
+);
+CREATE INDEX audit_event_job_id_idx ON audit_event (job_id);
+CREATE INDEX audit_event_actor_idx ON audit_event (actor);
+CREATE INDEX audit_event_action_idx ON audit_event (action);
+CREATE INDEX audit_event_created_at_idx ON audit_event (created_at);
+
+CREATE FUNCTION audit_event_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_event is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_event_append_only BEFORE UPDATE OR DELETE ON audit_event
+	FOR EACH ROW EXECUTE PROCEDURE audit_event_append_only();
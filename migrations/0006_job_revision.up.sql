@@ -0,0 +1,16 @@
+-- Every edit to a job is stored as a revision holding a snapshot of the
+-- editable fields. The first revision of a job is its content before it was
+-- first edited.
+
+CREATE TABLE job_revision (
+	id             SERIAL NOT NULL,
+	job_id         INTEGER NOT NULL REFERENCES job (id),
+	revision       INTEGER NOT NULL,
+	editor         VARCHAR(255) NOT NULL,
+	changed_fields TEXT[] NOT NULL DEFAULT '{}',
+	fields         JSONB NOT NULL,
+	reverted_from  INTEGER,
+	created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (id),
+	UNIQUE (job_id, revision)
+);
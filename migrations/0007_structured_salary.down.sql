@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS job_salary_currency_code_idx;
+ALTER TABLE job DROP COLUMN equity_max;
+ALTER TABLE job DROP COLUMN equity_min;
+ALTER TABLE job DROP COLUMN equity;
+ALTER TABLE job DROP COLUMN salary_undisclosed;
+ALTER TABLE job DROP COLUMN salary_period;
+ALTER TABLE job DROP COLUMN salary_currency_code;
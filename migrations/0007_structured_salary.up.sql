@@ -0,0 +1,30 @@
+-- Jobs carry an ISO 4217 currency code next to the currency symbol, a pay
+-- period, optional equity and can leave their salary undisclosed. Existing
+-- jobs were all posted with a yearly salary in one of the currencies below,
+-- `$` being USD.
+
+ALTER TABLE job ADD COLUMN salary_currency_code CHAR(3);
+UPDATE job SET salary_currency_code = CASE salary_currency
+	WHEN '£' THEN 'GBP'
+	WHEN '€' THEN 'EUR'
+	WHEN 'A$' THEN 'AUD'
+	WHEN 'C$' THEN 'CAD'
+	WHEN 'S$' THEN 'SGD'
+	WHEN 'Fr' THEN 'CHF'
+	WHEN '₹' THEN 'INR'
+	WHEN '₽' THEN 'RUB'
+	WHEN '¥' THEN 'JPY'
+	ELSE 'USD'
+END;
+ALTER TABLE job ALTER COLUMN salary_currency_code SET NOT NULL;
+ALTER TABLE job ALTER COLUMN salary_currency_code SET DEFAULT 'USD';
+
+ALTER TABLE job ADD COLUMN salary_period VARCHAR(10) NOT NULL DEFAULT 'yearly' CONSTRAINT job_salary_period_check CHECK (salary_period IN ('hourly', 'daily', 'monthly', 'yearly'));
+ALTER TABLE job ADD COLUMN salary_undisclosed BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE job ADD COLUMN equity BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE job ADD COLUMN equity_min NUMERIC(5, 2);
+ALTER TABLE job ADD COLUMN equity_max NUMERIC(5, 2);
+
+UPDATE job SET salary_undisclosed = TRUE, salary_range = 'Salary not disclosed' WHERE salary_min = 0 AND salary_max = 0;
+
+CREATE INDEX job_salary_currency_code_idx ON job (salary_currency_code);
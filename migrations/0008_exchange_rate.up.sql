@@ -0,0 +1,11 @@
+-- Exchange rates are imported from CSV with `go run ./pkg/exchangerates`.
+-- rate is the number of currency_code units one USD buys from
+-- effective_date until the next rate for the same currency.
+
+CREATE TABLE IF NOT EXISTS exchange_rate (
+	currency_code  CHAR(3) NOT NULL,
+	rate           NUMERIC(18, 8) NOT NULL CHECK (rate > 0),
+	effective_date DATE NOT NULL,
+	created_at     TIMESTAMP NOT NULL,
+	PRIMARY KEY (currency_code, effective_date)
+);
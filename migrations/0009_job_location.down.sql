@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS job_location;
+DROP INDEX IF EXISTS job_remote_policy_idx;
+ALTER TABLE job DROP CONSTRAINT job_timezone_window_check;
+ALTER TABLE job DROP COLUMN timezone_to;
+ALTER TABLE job DROP COLUMN timezone_from;
+ALTER TABLE job DROP COLUMN remote_regions;
+ALTER TABLE job DROP COLUMN remote_policy;
@@ -0,0 +1,50 @@
+-- The free text location of a job is kept for display, the places it lists
+-- are normalised into job_location so that location filters match a city or
+-- country exactly instead of any substring. Jobs also carry a remote policy,
+-- remote jobs can be restricted to regions and to a window of UTC offsets.
+-- Existing jobs listing `Remote` or `Anywhere` become remote, without region
+-- or timezone restrictions.
+
+ALTER TABLE job ADD COLUMN remote_policy VARCHAR(10) NOT NULL DEFAULT 'onsite' CONSTRAINT job_remote_policy_check CHECK (remote_policy IN ('onsite', 'hybrid', 'remote'));
+ALTER TABLE job ADD COLUMN remote_regions TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE job ADD COLUMN timezone_from SMALLINT;
+ALTER TABLE job ADD COLUMN timezone_to SMALLINT;
+ALTER TABLE job ADD CONSTRAINT job_timezone_window_check CHECK (
+	(timezone_from IS NULL AND timezone_to IS NULL)
+	OR (timezone_from BETWEEN -12 AND 14 AND timezone_to BETWEEN -12 AND 14 AND timezone_from <= timezone_to)
+);
+
+UPDATE job SET remote_policy = 'remote' WHERE location ~* '(^|[/;|])\s*(remote|anywhere)\M';
+
+CREATE TABLE job_location (
+	id      SERIAL NOT NULL,
+	job_id  INTEGER NOT NULL REFERENCES job (id),
+	city    VARCHAR(200) NOT NULL DEFAULT '',
+	country VARCHAR(200) NOT NULL DEFAULT '',
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX job_location_job_id_idx ON job_location (job_id);
+CREATE INDEX job_location_city_idx ON job_location (LOWER(city));
+CREATE INDEX job_location_country_idx ON job_location (LOWER(country));
+CREATE INDEX job_remote_policy_idx ON job (remote_policy);
+
+-- mirrors parseJobLocations: each place is either `City, Country` or a name
+-- looked up in seo_location
+INSERT INTO job_location (job_id, city, country)
+SELECT p.job_id, COALESCE(l.name, p.city), COALESCE(NULLIF(p.country, ''), l.country, '')
+FROM (
+	SELECT t.job_id, t.n,
+		trim(CASE WHEN t.part LIKE '%,%' THEN regexp_replace(t.part, ',[^,]*$', '') ELSE t.part END) AS city,
+		trim(CASE WHEN t.part LIKE '%,%' THEN regexp_replace(t.part, '^.*,', '') ELSE '' END) AS country
+	FROM (
+		SELECT j.id AS job_id, s.n, trim(s.part) AS part
+		FROM job j, regexp_split_to_table(j.location, '[/;|]') WITH ORDINALITY AS s(part, n)
+	) t
+	WHERE t.part <> '' AND t.part !~* '^(remote|anywhere)\M'
+) p
+LEFT JOIN LATERAL (
+	SELECT name, country FROM seo_location WHERE LOWER(name) = LOWER(p.city) LIMIT 1
+) l ON TRUE
+WHERE p.city <> '' OR p.country <> ''
+ORDER BY p.job_id, p.n;
@@ -0,0 +1,13 @@
+-- Jobs are tagged with skills from the taxonomy in pkg/database/skill.go,
+-- skill landing pages and the skill filter match these tags exactly. Tags
+-- are extracted from the title and description when a job is posted or
+-- edited unless the employer picks them, existing jobs are tagged by
+-- running the jobskills command.
+
+CREATE TABLE job_skill (
+	job_id INTEGER NOT NULL REFERENCES job (id),
+	skill  VARCHAR(50) NOT NULL,
+	PRIMARY KEY (job_id, skill)
+);
+
+CREATE INDEX job_skill_skill_idx ON job_skill (skill);
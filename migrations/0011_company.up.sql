@@ -0,0 +1,27 @@
+-- Companies are stored once and jobs link to them, the company name, url and
+-- logo on the job row are kept as posted. Companies are matched by their
+-- normalised name or by the domain of their website. Existing jobs are
+-- linked, merging companies posted under slightly different names, with
+-- `go run ./pkg/jobcompanies`.
+
+CREATE TABLE company (
+	id              SERIAL NOT NULL,
+	name            VARCHAR(128) NOT NULL,
+	normalized_name VARCHAR(128) NOT NULL,
+	slug            VARCHAR(150) NOT NULL,
+	url             VARCHAR(128) NOT NULL DEFAULT '',
+	domain          VARCHAR(128) NOT NULL DEFAULT '',
+	icon_image_id   VARCHAR(255) DEFAULT NULL,
+	description     TEXT NOT NULL DEFAULT '',
+	hq              VARCHAR(128) NOT NULL DEFAULT '',
+	size            VARCHAR(20) NOT NULL DEFAULT '',
+	created_at      TIMESTAMP NOT NULL,
+	updated_at      TIMESTAMP NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT company_slug_key UNIQUE (slug)
+);
+CREATE INDEX company_normalized_name_idx ON company (normalized_name);
+CREATE INDEX company_domain_idx ON company (domain) WHERE domain <> '';
+
+ALTER TABLE job ADD COLUMN company_id INTEGER REFERENCES company (id);
+CREATE INDEX job_company_id_idx ON job (company_id);
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS job_skill_search_doc_trigger ON job_skill;
+DROP TRIGGER IF EXISTS job_search_doc_trigger ON job;
+DROP INDEX IF EXISTS job_search_doc_idx;
+ALTER TABLE job DROP COLUMN IF EXISTS search_doc;
+DROP FUNCTION IF EXISTS job_skill_search_doc_update();
+DROP FUNCTION IF EXISTS job_search_doc_update();
+DROP FUNCTION IF EXISTS job_search_doc(INTEGER, TEXT, TEXT, TEXT);
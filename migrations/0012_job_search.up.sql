@@ -0,0 +1,43 @@
+-- Jobs are searched through a stored tsvector instead of one computed for
+-- every row on every search. Words are weighted by where they appear, the
+-- title first, then the skills the job is tagged with, the company and the
+-- description. The document is rebuilt by triggers whenever one of these
+-- changes.
+
+CREATE FUNCTION job_search_doc(job_id INTEGER, title TEXT, company TEXT, description TEXT) RETURNS tsvector AS $$
+	SELECT setweight(to_tsvector('english', COALESCE(title, '')), 'A')
+		|| setweight(to_tsvector('english', COALESCE((SELECT string_agg(replace(s.skill, '-', ' '), ' ') FROM job_skill s WHERE s.job_id = $1), '')), 'B')
+		|| setweight(to_tsvector('english', COALESCE(company, '')), 'C')
+		|| setweight(to_tsvector('english', COALESCE(description, '')), 'D')
+$$ LANGUAGE SQL STABLE;
+
+CREATE FUNCTION job_search_doc_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_doc := job_search_doc(NEW.id, NEW.job_title, NEW.company, NEW.description);
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION job_skill_search_doc_update() RETURNS trigger AS $$
+DECLARE
+	changed_job_id INTEGER;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		changed_job_id := OLD.job_id;
+	ELSE
+		changed_job_id := NEW.job_id;
+	END IF;
+	UPDATE job SET search_doc = job_search_doc(id, job_title, company, description) WHERE id = changed_job_id;
+	RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE job ADD COLUMN search_doc tsvector;
+UPDATE job SET search_doc = job_search_doc(id, job_title, company, description);
+ALTER TABLE job ALTER COLUMN search_doc SET NOT NULL;
+CREATE INDEX job_search_doc_idx ON job USING GIN (search_doc);
+
+CREATE TRIGGER job_search_doc_trigger BEFORE INSERT OR UPDATE OF job_title, company, description ON job
+	FOR EACH ROW EXECUTE PROCEDURE job_search_doc_update();
+CREATE TRIGGER job_skill_search_doc_trigger AFTER INSERT OR DELETE ON job_skill
+	FOR EACH ROW EXECUTE PROCEDURE job_skill_search_doc_update();
@@ -0,0 +1,2 @@
+ALTER TABLE job_event DROP COLUMN IF EXISTS is_bot;
+ALTER TABLE job_event DROP COLUMN IF EXISTS visitor_hash;
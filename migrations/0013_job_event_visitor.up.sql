@@ -0,0 +1,7 @@
+-- Job events record who caused them so that crawlers and repeated hits can
+-- be told apart from people. visitor_hash is a salted hash of the IP address
+-- and user agent that changes every day, IP addresses are never stored.
+-- Events recorded before have no visitor and count once each.
+
+ALTER TABLE job_event ADD COLUMN visitor_hash CHAR(64);
+ALTER TABLE job_event ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS job_stats_rollup;
+DROP TABLE IF EXISTS job_stats_daily;
+DROP INDEX IF EXISTS job_event_created_at_idx;
+ALTER TABLE job_event DROP COLUMN IF EXISTS country;
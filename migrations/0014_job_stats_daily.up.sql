@@ -0,0 +1,30 @@
+-- Job stats used to be computed by grouping every event of a job by day on
+-- each dashboard load. Events are now rolled up once a day into
+-- job_stats_daily, one row per job, day and visitor country, and the stats
+-- are read from there. job_stats_rollup records the days rolled up, the
+-- events of the days after the last one are still counted live. Events of
+-- rolled up days are pruned after a retention window, a pruned day cannot be
+-- rolled up again. Applications are recorded as events when they are
+-- confirmed since apply tokens are deleted soon after.
+
+ALTER TABLE job_event ADD COLUMN country VARCHAR(2);
+CREATE INDEX job_event_created_at_idx ON job_event (created_at);
+
+CREATE TABLE job_stats_daily (
+	job_id            INTEGER NOT NULL REFERENCES job (id),
+	day               DATE NOT NULL,
+	country           VARCHAR(2) NOT NULL DEFAULT '',
+	page_views        INTEGER NOT NULL DEFAULT 0,
+	unique_page_views INTEGER NOT NULL DEFAULT 0,
+	clickouts         INTEGER NOT NULL DEFAULT 0,
+	unique_clickouts  INTEGER NOT NULL DEFAULT 0,
+	applications      INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (job_id, day, country)
+);
+CREATE INDEX job_stats_daily_day_idx ON job_stats_daily (day);
+
+CREATE TABLE job_stats_rollup (
+	day          DATE NOT NULL PRIMARY KEY,
+	rolled_up_at TIMESTAMP NOT NULL,
+	pruned_at    TIMESTAMP DEFAULT NULL
+);
@@ -0,0 +1,7 @@
+-- Media is served with the SHA-256 of its bytes as ETag so that clients can
+-- revalidate logos without downloading them again. The hash is stored next
+-- to the bytes so that conditional requests do not load them.
+
+ALTER TABLE image ADD COLUMN sha256 CHAR(64);
+UPDATE image SET sha256 = encode(sha256(bytes), 'hex');
+ALTER TABLE image ALTER COLUMN sha256 SET NOT NULL;
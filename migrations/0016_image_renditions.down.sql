@@ -0,0 +1,2 @@
+DELETE FROM image WHERE length(id) > 27;
+ALTER TABLE image ALTER COLUMN id TYPE CHAR(27);
@@ -0,0 +1,4 @@
+-- Logos are stored as a set of renditions next to the default one, under
+-- its id followed by the size and format, e.g. `<id>_64webp`.
+
+ALTER TABLE image ALTER COLUMN id TYPE VARCHAR(64);
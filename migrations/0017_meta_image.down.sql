@@ -0,0 +1,6 @@
+-- Only the images kept in the `image` table are deleted. With the fs or s3
+-- media store the generated images, the media ids starting with `meta_`, are
+-- left behind and have to be deleted from the store by hand.
+
+DELETE FROM image WHERE id IN (SELECT media_id FROM meta_image);
+DROP TABLE IF EXISTS meta_image;
@@ -0,0 +1,10 @@
+-- Open Graph images are generated once and kept in the media store under an
+-- id derived from the hash of the fields they render, `key` names the page
+-- they are for, e.g. `job/<external id>`.
+
+CREATE TABLE meta_image (
+	key          VARCHAR(128) NOT NULL PRIMARY KEY,
+	fields_hash  CHAR(64) NOT NULL,
+	media_id     VARCHAR(64) NOT NULL,
+	generated_at TIMESTAMP NOT NULL
+);
@@ -16,7 +16,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to load config %v", err)
 	}
-	conn, err := database.GetDbConn(cfg.DatabaseURL)
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
 	if err != nil {
 		log.Fatalf("unable to connect to postgres: %v", err)
 	}
@@ -41,6 +41,15 @@ func main() {
 			}
 		}
 		database.UpdateJobAdType(conn, database.JobAdBasic, j.ID)
+		err = database.RecordAuditEvent(conn, database.AuditEvent{
+			Actor:  database.ActorSystem,
+			Action: database.AuditActionJobAdType,
+			JobID:  j.ID,
+			Diff:   database.AuditDiff{}.Add("ad_type", j.AdType, int64(database.JobAdBasic)),
+		})
+		if err != nil {
+			log.Printf("unable to record audit event for job id %d: %v", j.ID, err)
+		}
 		log.Printf("demoted job id %d expired sponsored 30days pinned job ads\n", j.ID)
 	}
 
@@ -60,6 +69,15 @@ func main() {
 			}
 		}
 		database.UpdateJobAdType(conn, database.JobAdBasic, j.ID)
+		err = database.RecordAuditEvent(conn, database.AuditEvent{
+			Actor:  database.ActorSystem,
+			Action: database.AuditActionJobAdType,
+			JobID:  j.ID,
+			Diff:   database.AuditDiff{}.Add("ad_type", j.AdType, int64(database.JobAdBasic)),
+		})
+		if err != nil {
+			log.Printf("unable to record audit event for job id %d: %v", j.ID, err)
+		}
 		log.Printf("demoted job id %d expired sponsored 7days pinned job ads\n", j.ID)
 	}
 
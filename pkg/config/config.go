@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -26,8 +27,40 @@ type Config struct {
 	SentryDSN                    string
 	JobsPerPage                  int
 	SlackInviteURL               string
+	MigrationsDir                string
+	JobExpiryDays                int
+	JobExpiryWarningDays         int
+	JobRenewalPrice              int64
+	JobArchiveRetentionDays      int
+	JobEventRetentionDays        int
+	ReviewSubstantiveEdits       bool
+	RankTextWeight               float64
+	RankRecencyWeight            float64
+	RankRecencyHalfLifeDays      float64
+	RankQualityWeight            float64
+	RankPlacementWeight          float64
+	ListingCacheTTLSeconds       int
+	EventBufferSize              int
+	EventBatchSize               int
+	EventFlushIntervalSeconds    int
+	VisitorHashSalt              []byte
+	MediaStorage                 string
+	MediaDir                     string
+	MediaS3Endpoint              string
+	MediaS3Region                string
+	MediaS3Bucket                string
+	MediaS3Prefix                string
+	MediaS3AccessKeyID           string
+	MediaS3SecretAccessKey       string
 }
 
+// media storage backends, see MEDIA_STORAGE
+const (
+	MediaStoragePostgres = "postgres"
+	MediaStorageFS       = "fs"
+	MediaStorageS3       = "s3"
+)
+
 func LoadConfig() (Config, error) {
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -97,6 +130,138 @@ func LoadConfig() (Config, error) {
 	if slackInviteURL == "" {
 		return Config{}, fmt.Errorf("SLACK_INVITE_URL cannot be empty")
 	}
+	migrationsDir := os.Getenv("MIGRATIONS_DIR")
+	if migrationsDir == "" {
+		migrationsDir = "migrations"
+	}
+	jobExpiryDays := 90
+	if v := os.Getenv("JOB_EXPIRY_DAYS"); v != "" {
+		jobExpiryDays, err = strconv.Atoi(v)
+		if err != nil || jobExpiryDays < 1 {
+			return Config{}, fmt.Errorf("JOB_EXPIRY_DAYS must be a positive number of days")
+		}
+	}
+	jobExpiryWarningDays := 5
+	if v := os.Getenv("JOB_EXPIRY_WARNING_DAYS"); v != "" {
+		jobExpiryWarningDays, err = strconv.Atoi(v)
+		if err != nil || jobExpiryWarningDays < 0 {
+			return Config{}, fmt.Errorf("JOB_EXPIRY_WARNING_DAYS must be a number of days")
+		}
+	}
+	// price of a job renewal in cents, renewals are free when zero
+	var jobRenewalPrice int64
+	if v := os.Getenv("JOB_RENEWAL_PRICE"); v != "" {
+		jobRenewalPrice, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || jobRenewalPrice < 0 {
+			return Config{}, fmt.Errorf("JOB_RENEWAL_PRICE must be an amount in cents")
+		}
+	}
+	jobArchiveRetentionDays := 30
+	if v := os.Getenv("JOB_ARCHIVE_RETENTION_DAYS"); v != "" {
+		jobArchiveRetentionDays, err = strconv.Atoi(v)
+		if err != nil || jobArchiveRetentionDays < 1 {
+			return Config{}, fmt.Errorf("JOB_ARCHIVE_RETENTION_DAYS must be a positive number of days")
+		}
+	}
+	// job events are pruned once rolled up and older than this, see
+	// database.PruneJobEvents
+	jobEventRetentionDays := 90
+	if v := os.Getenv("JOB_EVENT_RETENTION_DAYS"); v != "" {
+		jobEventRetentionDays, err = strconv.Atoi(v)
+		if err != nil || jobEventRetentionDays < 1 {
+			return Config{}, fmt.Errorf("JOB_EVENT_RETENTION_DAYS must be a positive number of days")
+		}
+	}
+	// when set, changing the title, company or salary of a live job sends it
+	// back for review
+	reviewSubstantiveEdits := os.Getenv("REVIEW_SUBSTANTIVE_EDITS") == "true"
+	// weights of the signals listings are ranked by, see database.RankingWeights
+	rankWeights := map[string]float64{
+		"RANK_TEXT_WEIGHT":            2,
+		"RANK_RECENCY_WEIGHT":         1,
+		"RANK_RECENCY_HALF_LIFE_DAYS": 14,
+		"RANK_QUALITY_WEIGHT":         0.3,
+		"RANK_PLACEMENT_WEIGHT":       0.5,
+	}
+	for name := range rankWeights {
+		if v := os.Getenv(name); v != "" {
+			weight, err := strconv.ParseFloat(v, 64)
+			if err != nil || weight < 0 {
+				return Config{}, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			rankWeights[name] = weight
+		}
+	}
+	if rankWeights["RANK_RECENCY_HALF_LIFE_DAYS"] == 0 {
+		return Config{}, fmt.Errorf("RANK_RECENCY_HALF_LIFE_DAYS must be a positive number of days")
+	}
+	// listings are cached for this long unless a job changes, zero disables
+	// the cache
+	listingCacheTTLSeconds := 60
+	if v := os.Getenv("LISTING_CACHE_TTL_SECONDS"); v != "" {
+		listingCacheTTLSeconds, err = strconv.Atoi(v)
+		if err != nil || listingCacheTTLSeconds < 0 {
+			return Config{}, fmt.Errorf("LISTING_CACHE_TTL_SECONDS must be a number of seconds")
+		}
+	}
+	// page views and clickouts are buffered and saved in batches, events
+	// arriving while the buffer is full are dropped
+	eventBufferSize := 10000
+	if v := os.Getenv("EVENT_BUFFER_SIZE"); v != "" {
+		eventBufferSize, err = strconv.Atoi(v)
+		if err != nil || eventBufferSize < 1 {
+			return Config{}, fmt.Errorf("EVENT_BUFFER_SIZE must be a positive number of events")
+		}
+	}
+	eventBatchSize := 500
+	if v := os.Getenv("EVENT_BATCH_SIZE"); v != "" {
+		eventBatchSize, err = strconv.Atoi(v)
+		if err != nil || eventBatchSize < 1 {
+			return Config{}, fmt.Errorf("EVENT_BATCH_SIZE must be a positive number of events")
+		}
+	}
+	eventFlushIntervalSeconds := 5
+	if v := os.Getenv("EVENT_FLUSH_INTERVAL_SECONDS"); v != "" {
+		eventFlushIntervalSeconds, err = strconv.Atoi(v)
+		if err != nil || eventFlushIntervalSeconds < 1 {
+			return Config{}, fmt.Errorf("EVENT_FLUSH_INTERVAL_SECONDS must be a positive number of seconds")
+		}
+	}
+	// salts the daily hash of the IP address and user agent of visitors, the
+	// session key is secret enough when it is not set
+	visitorHashSalt := sessionKeyBytes
+	if v := os.Getenv("VISITOR_HASH_SALT"); v != "" {
+		visitorHashSalt = []byte(v)
+	}
+	// where uploaded media is stored, the image table by default
+	mediaStorage := MediaStoragePostgres
+	if v := os.Getenv("MEDIA_STORAGE"); v != "" {
+		mediaStorage = strings.ToLower(v)
+	}
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	mediaS3Region := os.Getenv("MEDIA_S3_REGION")
+	if mediaS3Region == "" {
+		mediaS3Region = "us-east-1"
+	}
+	mediaS3Endpoint := os.Getenv("MEDIA_S3_ENDPOINT")
+	if mediaS3Endpoint == "" {
+		mediaS3Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", mediaS3Region)
+	}
+	mediaS3Bucket := os.Getenv("MEDIA_S3_BUCKET")
+	mediaS3AccessKeyID := os.Getenv("MEDIA_S3_ACCESS_KEY_ID")
+	mediaS3SecretAccessKey := os.Getenv("MEDIA_S3_SECRET_ACCESS_KEY")
+	switch mediaStorage {
+	case MediaStoragePostgres, MediaStorageFS:
+	case MediaStorageS3:
+		if mediaS3Bucket == "" || mediaS3AccessKeyID == "" || mediaS3SecretAccessKey == "" {
+			return Config{}, fmt.Errorf("MEDIA_S3_BUCKET, MEDIA_S3_ACCESS_KEY_ID and MEDIA_S3_SECRET_ACCESS_KEY cannot be empty when MEDIA_STORAGE is s3")
+		}
+	default:
+		return Config{}, fmt.Errorf("MEDIA_STORAGE must be one of postgres, fs or s3")
+	}
 
 	return Config{
 		Port:                         port,
@@ -115,5 +280,30 @@ func LoadConfig() (Config, error) {
 		SentryDSN:                    sentryDSN,
 		JobsPerPage:                  20,
 		SlackInviteURL:               slackInviteURL,
+		MigrationsDir:                migrationsDir,
+		JobExpiryDays:                jobExpiryDays,
+		JobExpiryWarningDays:         jobExpiryWarningDays,
+		JobRenewalPrice:              jobRenewalPrice,
+		JobArchiveRetentionDays:      jobArchiveRetentionDays,
+		JobEventRetentionDays:        jobEventRetentionDays,
+		ReviewSubstantiveEdits:       reviewSubstantiveEdits,
+		RankTextWeight:               rankWeights["RANK_TEXT_WEIGHT"],
+		RankRecencyWeight:            rankWeights["RANK_RECENCY_WEIGHT"],
+		RankRecencyHalfLifeDays:      rankWeights["RANK_RECENCY_HALF_LIFE_DAYS"],
+		RankQualityWeight:            rankWeights["RANK_QUALITY_WEIGHT"],
+		RankPlacementWeight:          rankWeights["RANK_PLACEMENT_WEIGHT"],
+		ListingCacheTTLSeconds:       listingCacheTTLSeconds,
+		EventBufferSize:              eventBufferSize,
+		EventBatchSize:               eventBatchSize,
+		EventFlushIntervalSeconds:    eventFlushIntervalSeconds,
+		VisitorHashSalt:              visitorHashSalt,
+		MediaStorage:                 mediaStorage,
+		MediaDir:                     mediaDir,
+		MediaS3Endpoint:              strings.TrimSuffix(mediaS3Endpoint, "/"),
+		MediaS3Region:                mediaS3Region,
+		MediaS3Bucket:                mediaS3Bucket,
+		MediaS3Prefix:                os.Getenv("MEDIA_S3_PREFIX"),
+		MediaS3AccessKeyID:           mediaS3AccessKeyID,
+		MediaS3SecretAccessKey:       mediaS3SecretAccessKey,
 	}, nil
 }
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	AuditActionJobApprove  = "job.approve"
+	AuditActionJobReject   = "job.reject"
+	AuditActionJobStatus   = "job.status"
+	AuditActionJobExpire   = "job.expire"
+	AuditActionJobRenew    = "job.renew"
+	AuditActionJobRevert   = "job.revert"
+	AuditActionJobArchive  = "job.archive"
+	AuditActionJobRestore  = "job.restore"
+	AuditActionJobPurge    = "job.purge"
+	AuditActionJobAdType   = "job.ad_type"
+	AuditActionMediaUpdate = "media.update"
+)
+
+// AuditActions lists every action, in the order they are offered as filters
+var AuditActions = []string{
+	AuditActionJobApprove,
+	AuditActionJobReject,
+	AuditActionJobStatus,
+	AuditActionJobExpire,
+	AuditActionJobRenew,
+	AuditActionJobRevert,
+	AuditActionJobArchive,
+	AuditActionJobRestore,
+	AuditActionJobPurge,
+	AuditActionJobAdType,
+	AuditActionMediaUpdate,
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditDiff maps the name of each changed field to its before and after value
+type AuditDiff map[string]AuditChange
+
+// Add records a field change, values that did not change are skipped
+func (d AuditDiff) Add(field string, before, after interface{}) AuditDiff {
+	if reflect.DeepEqual(before, after) {
+		return d
+	}
+	d[field] = AuditChange{Before: before, After: after}
+	return d
+}
+
+type AuditEvent struct {
+	ID     int
+	Actor  string
+	Action string
+	JobID  int
+	Diff   AuditDiff
+	// ActorEmail is set when reading events recorded by a signed on user
+	ActorEmail string
+	CreatedAt  time.Time
+}
+
+type AuditFieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Changes returns the diff sorted by field name, formatted for display
+func (e AuditEvent) Changes() []AuditFieldChange {
+	changes := make([]AuditFieldChange, 0, len(e.Diff))
+	for f, c := range e.Diff {
+		changes = append(changes, AuditFieldChange{Field: f, Before: formatAuditValue(c.Before), After: formatAuditValue(c.After)})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func formatAuditValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// AuditFilter narrows down audit events, Actor matches either the recorded
+// actor or the email of the user it refers to
+type AuditFilter struct {
+	Actor  string
+	Action string
+	JobID  int
+}
+
+func RecordAuditEvent(conn *sql.DB, e AuditEvent) error {
+	return recordAuditEvent(conn, e)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordAuditEvent(conn execer, e AuditEvent) error {
+	if e.Diff == nil {
+		e.Diff = AuditDiff{}
+	}
+	diff, err := json.Marshal(e.Diff)
+	if err != nil {
+		return err
+	}
+	var jobID sql.NullInt64
+	if e.JobID != 0 {
+		jobID = sql.NullInt64{Int64: int64(e.JobID), Valid: true}
+	}
+	_, err = conn.Exec(`INSERT INTO audit_event (actor, action, job_id, diff, created_at) VALUES ($1, $2, $3, $4, NOW())`, e.Actor, e.Action, jobID, string(diff))
+	return err
+}
+
+func auditFilterWhere(f AuditFilter) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.Actor != "" {
+		args = append(args, f.Actor)
+		where = append(where, fmt.Sprintf("(a.actor = $%d OR u.email = $%d)", len(args), len(args)))
+	}
+	if f.Action != "" {
+		args = append(args, f.Action)
+		where = append(where, fmt.Sprintf("a.action = $%d", len(args)))
+	}
+	if f.JobID != 0 {
+		args = append(args, f.JobID)
+		where = append(where, fmt.Sprintf("a.job_id = $%d", len(args)))
+	}
+	if len(where) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(where, " AND "), args
+}
+
+// GetAuditEvents returns a page of audit events matching the filter, newest
+// first, and the total number of matching events
+func GetAuditEvents(conn *sql.DB, f AuditFilter, pageID, perPage int) ([]AuditEvent, int, error) {
+	var events []AuditEvent
+	where, args := auditFilterWhere(f)
+	var total int
+	if err := conn.QueryRow(`SELECT count(*) FROM audit_event a LEFT JOIN users u ON u.id = a.actor `+where, args...).Scan(&total); err != nil {
+		return events, 0, err
+	}
+	offset := (pageID - 1) * perPage
+	if offset < 0 {
+		offset = 0
+	}
+	args = append(args, perPage, offset)
+	rows, err := conn.Query(
+		fmt.Sprintf(`
+		SELECT a.id, a.actor, a.action, COALESCE(a.job_id, 0), a.diff, COALESCE(u.email, ''), a.created_at
+		FROM audit_event a
+		LEFT JOIN users u ON u.id = a.actor
+		%s
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return events, total, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEvent
+		var diff []byte
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.JobID, &diff, &e.ActorEmail, &e.CreatedAt); err != nil {
+			return events, total, err
+		}
+		if err := json.Unmarshal(diff, &e.Diff); err != nil {
+			return events, total, err
+		}
+		events = append(events, e)
+	}
+	return events, total, rows.Err()
+}
@@ -0,0 +1,379 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/gosimple/slug"
+)
+
+// Company is an employer jobs are linked to. Name, URL and IconImageID are
+// taken from the first job it posted, the rest of the profile is edited by
+// admins
+type Company struct {
+	ID          int
+	Name        string
+	Slug        string
+	URL         string
+	IconImageID string
+	Description string
+	HQ          string
+	Size        string
+	CreatedAt   time.Time
+}
+
+// CompanySizes lists the headcount ranges a company profile can show
+var CompanySizes = []string{"1-10", "11-50", "51-200", "201-500", "501-1000", "1000+"}
+
+func isCompanySize(size string) bool {
+	for _, s := range CompanySizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// CompanySummary is a company as listed in the companies directory
+type CompanySummary struct {
+	Company
+	LiveJobs  int
+	TotalJobs int
+	LastJobAt time.Time
+}
+
+// CompanyHiringYear is the number of jobs a company posted in a year
+type CompanyHiringYear struct {
+	Year int
+	Jobs int
+}
+
+// CompanyProfile is what the company page shows
+type CompanyProfile struct {
+	Company
+	LiveJobs      []*JobPost
+	PastJobs      []*JobPost
+	HiringHistory []CompanyHiringYear
+}
+
+// NewCompanyProfile splits the jobs a company posted, most recent first,
+// into live and past ones and counts them by the year they were approved
+func NewCompanyProfile(c Company, jobs []*JobPost) CompanyProfile {
+	p := CompanyProfile{Company: c}
+	byYear := make(map[int]int)
+	for _, j := range jobs {
+		if j.Status == JobStatusApproved {
+			p.LiveJobs = append(p.LiveJobs, j)
+		} else {
+			p.PastJobs = append(p.PastJobs, j)
+		}
+		postedAt := time.Unix(j.CreatedAt, 0)
+		if j.ApprovedAt != nil {
+			postedAt = *j.ApprovedAt
+		}
+		byYear[postedAt.UTC().Year()]++
+	}
+	for year, n := range byYear {
+		p.HiringHistory = append(p.HiringHistory, CompanyHiringYear{Year: year, Jobs: n})
+	}
+	sort.Slice(p.HiringHistory, func(i, j int) bool { return p.HiringHistory[i].Year > p.HiringHistory[j].Year })
+	return p
+}
+
+var (
+	companyLegalSuffixRe = regexp.MustCompile(`[\s,]+(inc|incorporated|llc|ltd|limited|gmbh|ag|bv|sa|sas|srl|plc|corp|corporation|co|oy|ab|pty)$`)
+	companyNameCharsRe   = regexp.MustCompile(`[^\pL\pN]+`)
+)
+
+// normalizeCompanyName reduces a company name to what is compared when
+// matching companies, eg. `Acme, Inc.` and `ACME` are both `acme`
+func normalizeCompanyName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(".", "", "&", " and ").Replace(name)
+	for {
+		trimmed := companyLegalSuffixRe.ReplaceAllString(name, "")
+		if trimmed == name || trimmed == "" {
+			break
+		}
+		name = trimmed
+	}
+	return companyNameCharsRe.ReplaceAllString(name, "")
+}
+
+// sharedCompanyDomains host pages of many companies, they are not used to
+// match companies
+var sharedCompanyDomains = map[string]bool{
+	"linkedin.com":        true,
+	"github.com":          true,
+	"angel.co":            true,
+	"wellfound.com":       true,
+	"twitter.com":         true,
+	"facebook.com":        true,
+	"medium.com":          true,
+	"notion.site":         true,
+	"lever.co":            true,
+	"greenhouse.io":       true,
+	"workable.com":        true,
+	"bamboohr.com":        true,
+	"breezy.hr":           true,
+	"recruitee.com":       true,
+	"smartrecruiters.com": true,
+}
+
+// companyDomain returns the domain of a company website without `www.`, it
+// is empty for urls that can not be parsed or point to a shared host
+func companyDomain(companyURL string) string {
+	companyURL = strings.TrimSpace(companyURL)
+	if companyURL == "" {
+		return ""
+	}
+	if !strings.Contains(companyURL, "://") {
+		companyURL = "http://" + companyURL
+	}
+	u, err := url.Parse(companyURL)
+	if err != nil {
+		return ""
+	}
+	domain := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if !strings.Contains(domain, ".") {
+		return ""
+	}
+	for shared := range sharedCompanyDomains {
+		if domain == shared || strings.HasSuffix(domain, "."+shared) {
+			return ""
+		}
+	}
+	return domain
+}
+
+// linkJobCompanyTx links a job to the company matching its name or website,
+// creating the company when there is none. Companies without a website or
+// logo get the ones of the job
+func linkJobCompanyTx(tx *sql.Tx, jobID int, name, companyURL, iconImageID string) error {
+	normalized := normalizeCompanyName(name)
+	domain := companyDomain(companyURL)
+	var companyID int
+	err := tx.QueryRow(
+		`SELECT id FROM company WHERE (normalized_name = $1 AND $1 <> '') OR (domain = $2 AND $2 <> '') ORDER BY normalized_name = $1 DESC, id LIMIT 1`,
+		normalized,
+		domain,
+	).Scan(&companyID)
+	switch {
+	case err == sql.ErrNoRows:
+		companySlug, err := uniqueCompanySlug(tx, name)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(
+			`INSERT INTO company (name, normalized_name, slug, url, domain, icon_image_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NOW(), NOW()) RETURNING id`,
+			strings.TrimSpace(name),
+			normalized,
+			companySlug,
+			strings.TrimSpace(companyURL),
+			domain,
+			iconImageID,
+		).Scan(&companyID)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		_, err := tx.Exec(
+			`UPDATE company SET url = CASE WHEN url = '' THEN $1 ELSE url END, domain = CASE WHEN domain = '' THEN $2 ELSE domain END, icon_image_id = COALESCE(icon_image_id, NULLIF($3, '')), updated_at = NOW() WHERE id = $4`,
+			strings.TrimSpace(companyURL),
+			domain,
+			iconImageID,
+			companyID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE job SET company_id = $1 WHERE id = $2`, companyID, jobID)
+	return err
+}
+
+// uniqueCompanySlug returns the slug of the company name, numbered when
+// another company already has it
+func uniqueCompanySlug(tx *sql.Tx, name string) (string, error) {
+	base := slug.Make(name)
+	if base == "" {
+		base = "company"
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM company WHERE slug = $1)`, candidate).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// LinkJobsToCompanies links the jobs that have no company yet, oldest
+// first so that companies keep the name they were first posted with. It
+// returns the number of jobs linked
+func LinkJobsToCompanies(conn *sql.DB) (int, error) {
+	rows, err := conn.Query(`SELECT id, company, company_url, COALESCE(company_icon_image_id, '') FROM job WHERE company_id IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return 0, err
+	}
+	type unlinked struct {
+		id                     int
+		name, url, iconImageID string
+	}
+	var jobs []unlinked
+	for rows.Next() {
+		var j unlinked
+		if err := rows.Scan(&j.id, &j.name, &j.url, &j.iconImageID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	linked := 0
+	for _, j := range jobs {
+		tx, err := conn.Begin()
+		if err != nil {
+			return linked, err
+		}
+		if err := linkJobCompanyTx(tx, j.id, j.name, j.url, j.iconImageID); err != nil {
+			tx.Rollback()
+			return linked, err
+		}
+		if err := tx.Commit(); err != nil {
+			return linked, err
+		}
+		linked++
+	}
+	return linked, nil
+}
+
+// CompanyExists reports whether a company with the same normalised name has
+// posted on the board
+func CompanyExists(db *sql.DB, company string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM company WHERE normalized_name = $1)`, normalizeCompanyName(company)).Scan(&exists)
+	return exists, err
+}
+
+const companyColumns = `c.id, c.name, c.slug, c.url, COALESCE(c.icon_image_id, ''), c.description, c.hq, c.size, c.created_at`
+
+func scanCompany(row interface{ Scan(...interface{}) error }, c *Company, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&c.ID, &c.Name, &c.Slug, &c.URL, &c.IconImageID, &c.Description, &c.HQ, &c.Size, &c.CreatedAt}, extra...)...)
+}
+
+func CompanyBySlug(conn *sql.DB, companySlug string) (Company, error) {
+	var c Company
+	err := scanCompany(conn.QueryRow(`SELECT `+companyColumns+` FROM company c WHERE c.slug = $1`, companySlug), &c)
+	return c, err
+}
+
+// GetCompanyJobs returns the jobs of a company that were ever approved, most
+// recent first
+func GetCompanyJobs(conn *sql.DB, companyID int) ([]*JobPost, error) {
+	jobs := []*JobPost{}
+	rows, err := conn.Query(`
+		SELECT id, job_title, company, company_url, salary_range, location, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, status, approved_at, remote_policy
+		FROM job
+		WHERE company_id = $1 AND approved_at IS NOT NULL
+		ORDER BY approved_at DESC`, companyID)
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		job := &JobPost{}
+		var createdAt, approvedAt time.Time
+		var companyIcon sql.NullString
+		err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &job.Status, &approvedAt, &job.RemotePolicy)
+		if err != nil {
+			return jobs, err
+		}
+		job.CompanyIconID = companyIcon.String
+		job.ApprovedAt = &approvedAt
+		job.TimeAgo = humanize.Time(createdAt.UTC())
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetCompanies returns the companies with at least one approved job, the
+// ones currently hiring first
+func GetCompanies(conn *sql.DB) ([]CompanySummary, error) {
+	var companies []CompanySummary
+	rows, err := conn.Query(`
+		SELECT ` + companyColumns + `, COUNT(*) FILTER (WHERE j.status = 'approved'), COUNT(*), MAX(j.approved_at)
+		FROM company c JOIN job j ON j.company_id = c.id
+		WHERE j.approved_at IS NOT NULL
+		GROUP BY c.id
+		ORDER BY COUNT(*) FILTER (WHERE j.status = 'approved') DESC, MAX(j.approved_at) DESC`)
+	if err != nil {
+		return companies, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s CompanySummary
+		if err := scanCompany(rows, &s.Company, &s.LiveJobs, &s.TotalJobs, &s.LastJobAt); err != nil {
+			return companies, err
+		}
+		companies = append(companies, s)
+	}
+	return companies, rows.Err()
+}
+
+// validateCompanyProfile checks the fields admins can edit
+func validateCompanyProfile(c Company) error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("company name is required")
+	}
+	if c.Size != "" && !isCompanySize(c.Size) {
+		return fmt.Errorf("invalid company size %q", c.Size)
+	}
+	return nil
+}
+
+// UpdateCompany updates the profile of the company with the given ID, its
+// slug is kept so that links to the company page do not break
+func UpdateCompany(conn *sql.DB, c Company) error {
+	if err := validateCompanyProfile(c); err != nil {
+		return err
+	}
+	res, err := conn.Exec(
+		`UPDATE company SET name = $1, normalized_name = $2, url = $3, domain = $4, description = $5, hq = $6, size = $7, updated_at = NOW() WHERE id = $8`,
+		strings.TrimSpace(c.Name),
+		normalizeCompanyName(c.Name),
+		strings.TrimSpace(c.URL),
+		companyDomain(c.URL),
+		c.Description,
+		strings.TrimSpace(c.HQ),
+		c.Size,
+		c.ID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobCursor is the position of a job in a listing ranked as of AsOf, the
+// jobs after it score lower or, on a tie, are older. The zero cursor, or one
+// with only AsOf set, starts a listing
+type JobCursor struct {
+	AsOf      time.Time
+	Score     float64
+	CreatedAt time.Time
+	ID        int
+}
+
+// ErrInvalidJobCursor is returned when a cursor cannot be decoded
+var ErrInvalidJobCursor = errors.New("invalid job cursor")
+
+// IsStart reports whether the cursor starts a listing
+func (c JobCursor) IsStart() bool {
+	return c.ID == 0
+}
+
+// asOf returns the time jobs are ranked as of, now for cursors without one
+func (c JobCursor) asOf() time.Time {
+	if c.AsOf.IsZero() {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	return c.AsOf
+}
+
+// String encodes the cursor for URLs, clients should not rely on its format
+func (c JobCursor) String() string {
+	raw := strings.Join([]string{
+		strconv.FormatInt(c.AsOf.Unix(), 10),
+		strconv.FormatFloat(c.Score, 'g', -1, 64),
+		strconv.FormatInt(c.CreatedAt.UnixNano(), 10),
+		strconv.Itoa(c.ID),
+	}, ":")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseJobCursor decodes a cursor encoded by JobCursor.String
+func ParseJobCursor(s string) (JobCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 4 {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	asOf, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	createdAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	id, err := strconv.Atoi(parts[3])
+	if err != nil || id < 0 {
+		return JobCursor{}, ErrInvalidJobCursor
+	}
+	return JobCursor{
+		AsOf:      time.Unix(asOf, 0).UTC(),
+		Score:     score,
+		CreatedAt: time.Unix(0, createdAt).UTC(),
+		ID:        id,
+	}, nil
+}
+
+// jobCursorOrder orders ranked jobs the way cursors walk them
+const jobCursorOrder = `rank_score DESC, created_at DESC, id DESC`
+
+// jobCursorWhere returns the condition matching the jobs after the cursor
+// bound to the given placeholders, and their arguments
+func jobCursorWhere(c JobCursor, param int) (string, []interface{}) {
+	return fmt.Sprintf(`(rank_score, created_at, id) < ($%d::float8, $%d::timestamp, $%d::integer)`, param, param+1, param+2),
+		[]interface{}{c.Score, c.CreatedAt.UTC().Format(sqlTimestampFormat), c.ID}
+}
+
+// after reports whether a ranked job comes after the cursor, it mirrors
+// jobCursorWhere
+func (c JobCursor) after(r JobRank, createdAt time.Time, id int) bool {
+	if c.IsStart() {
+		return true
+	}
+	if r.Score != c.Score {
+		return r.Score < c.Score
+	}
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.Before(c.CreatedAt)
+	}
+	return id < c.ID
+}
+
+// JobCursorAt returns the cursor of the nth job, counting from 1, matching
+// the filter ranked as of asOf, so that a numbered page can be read from the
+// cursor ending the previous one. Only the jobs up to the nth are numbered,
+// the cursor starts the listing over when fewer jobs match
+func JobCursorAt(conn *sql.DB, f JobFilter, w RankingWeights, asOf time.Time, n int) (JobCursor, error) {
+	if n < 1 {
+		return JobCursor{}, nil
+	}
+	f = f.normalize()
+	from, where, args := jobFilterWhere(f)
+	text := `0`
+	if f.Query != "" {
+		text = `ts_rank(search_doc, query, 32)`
+	}
+	args = append(args, n-1)
+	c := JobCursor{AsOf: asOf}
+	err := conn.QueryRow(fmt.Sprintf(`
+	SELECT rank_score, created_at, id
+	FROM (SELECT id, created_at, %s FROM %s WHERE %s) AS ranked
+	ORDER BY %s OFFSET $%d LIMIT 1`, rankingSQL(w, text, asOf), from, where, jobCursorOrder, len(args)), args...).Scan(&c.Score, &c.CreatedAt, &c.ID)
+	if err == sql.ErrNoRows {
+		return JobCursor{}, nil
+	}
+	if err != nil {
+		return JobCursor{}, err
+	}
+	return c, nil
+}
+
+// CountJobs returns the number of live jobs matching the filter
+func CountJobs(conn *sql.DB, f JobFilter) (int, error) {
+	from, where, args := jobFilterWhere(f.normalize())
+	var n int
+	err := conn.QueryRow(fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, from, where), args...).Scan(&n)
+	return n, err
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"strconv"
 	"strings"
 	"time"
 
@@ -25,22 +24,51 @@ type Job struct {
 }
 
 type JobRq struct {
-	JobTitle         string `json:"job_title"`
-	Location         string `json:"job_location"`
-	Company          string `json:"company_name"`
-	CompanyURL       string `json:"company_url"`
-	SalaryMin        string `json:"salary_min"`
-	SalaryMax        string `json:"salary_max"`
-	SalaryCurrency   string `json:"salary_currency"`
-	Description      string `json:"job_description"`
-	HowToApply       string `json:"how_to_apply"`
-	Perks            string `json:"perks"`
-	InterviewProcess string `json:"interview_process,omitempty"`
-	Email            string `json:"company_email"`
-	StripeToken      string `json:"stripe_token,omitempty"`
-	AdType           int64  `json:"ad_type"`
-	CurrencyCode     string `json:"currency_code"`
-	CompanyIconID    string `json:"company_icon_id,omitempty"`
+	JobTitle           string   `json:"job_title"`
+	Location           string   `json:"job_location"`
+	Company            string   `json:"company_name"`
+	CompanyURL         string   `json:"company_url"`
+	SalaryMin          string   `json:"salary_min"`
+	SalaryMax          string   `json:"salary_max"`
+	SalaryCurrency     string   `json:"salary_currency"`
+	SalaryCurrencyCode string   `json:"salary_currency_code"`
+	SalaryPeriod       string   `json:"salary_period"`
+	SalaryUndisclosed  bool     `json:"salary_undisclosed"`
+	Equity             bool     `json:"equity"`
+	EquityMin          string   `json:"equity_min"`
+	EquityMax          string   `json:"equity_max"`
+	RemotePolicy       string   `json:"remote_policy"`
+	RemoteRegions      []string `json:"remote_regions"`
+	TimezoneFrom       string   `json:"timezone_from"`
+	TimezoneTo         string   `json:"timezone_to"`
+	Skills             []string `json:"skills"`
+	Description        string   `json:"job_description"`
+	HowToApply         string   `json:"how_to_apply"`
+	Perks              string   `json:"perks"`
+	InterviewProcess   string   `json:"interview_process,omitempty"`
+	Email              string   `json:"company_email"`
+	StripeToken        string   `json:"stripe_token,omitempty"`
+	AdType             int64    `json:"ad_type"`
+	CurrencyCode       string   `json:"currency_code"`
+	CompanyIconID      string   `json:"company_icon_id,omitempty"`
+}
+
+// Salary validates the salary fields of the request, SalaryCurrency is the
+// currency symbol sent by clients that predate SalaryCurrencyCode
+func (j JobRq) Salary() (Salary, error) {
+	return parseSalary(j.SalaryMin, j.SalaryMax, j.SalaryCurrencyCode, j.SalaryCurrency, j.SalaryPeriod, j.SalaryUndisclosed, j.Equity, j.EquityMin, j.EquityMax)
+}
+
+// Remote validates the remote policy of the request, clients that predate
+// RemotePolicy get one from the location
+func (j JobRq) Remote() (JobRemote, error) {
+	return parseJobRemote(j.Location, j.RemotePolicy, j.RemoteRegions, j.TimezoneFrom, j.TimezoneTo)
+}
+
+// SkillTags validates the skills picked by the employer, requests without
+// skills are tagged with the ones found in the title and description
+func (j JobRq) SkillTags() ([]string, error) {
+	return parseSkills(j.Skills, j.JobTitle, j.Description)
 }
 
 type JobRqUpsell struct {
@@ -52,45 +80,98 @@ type JobRqUpsell struct {
 }
 
 type JobRqUpdate struct {
-	JobTitle         string `json:"job_title"`
-	Location         string `json:"job_location"`
-	Company          string `json:"company_name"`
-	CompanyURL       string `json:"company_url"`
-	SalaryMin        string `json:"salary_min"`
-	SalaryMax        string `json:"salary_max"`
-	SalaryCurrency   string `json:"salary_currency"`
-	Description      string `json:"job_description"`
-	HowToApply       string `json:"how_to_apply"`
-	Perks            string `json:"perks"`
-	InterviewProcess string `json:"interview_process"`
-	Email            string `json:"company_email"`
-	Token            string `json:"token"`
-	CompanyIconID    string `json:"company_icon_id,omitempty"`
+	JobTitle           string   `json:"job_title"`
+	Location           string   `json:"job_location"`
+	Company            string   `json:"company_name"`
+	CompanyURL         string   `json:"company_url"`
+	SalaryMin          string   `json:"salary_min"`
+	SalaryMax          string   `json:"salary_max"`
+	SalaryCurrency     string   `json:"salary_currency"`
+	SalaryCurrencyCode string   `json:"salary_currency_code"`
+	SalaryPeriod       string   `json:"salary_period"`
+	SalaryUndisclosed  bool     `json:"salary_undisclosed"`
+	Equity             bool     `json:"equity"`
+	EquityMin          string   `json:"equity_min"`
+	EquityMax          string   `json:"equity_max"`
+	RemotePolicy       string   `json:"remote_policy"`
+	RemoteRegions      []string `json:"remote_regions"`
+	TimezoneFrom       string   `json:"timezone_from"`
+	TimezoneTo         string   `json:"timezone_to"`
+	Skills             []string `json:"skills"`
+	Description        string   `json:"job_description"`
+	HowToApply         string   `json:"how_to_apply"`
+	Perks              string   `json:"perks"`
+	InterviewProcess   string   `json:"interview_process"`
+	Email              string   `json:"company_email"`
+	Token              string   `json:"token"`
+	CompanyIconID      string   `json:"company_icon_id,omitempty"`
+}
+
+func (j JobRqUpdate) Salary() (Salary, error) {
+	return parseSalary(j.SalaryMin, j.SalaryMax, j.SalaryCurrencyCode, j.SalaryCurrency, j.SalaryPeriod, j.SalaryUndisclosed, j.Equity, j.EquityMin, j.EquityMax)
+}
+
+func (j JobRqUpdate) Remote() (JobRemote, error) {
+	return parseJobRemote(j.Location, j.RemotePolicy, j.RemoteRegions, j.TimezoneFrom, j.TimezoneTo)
+}
+
+func (j JobRqUpdate) SkillTags() ([]string, error) {
+	return parseSkills(j.Skills, j.JobTitle, j.Description)
 }
 
 type JobPost struct {
-	ID               int
-	CreatedAt        int64
-	TimeAgo          string
-	JobTitle         string
-	Company          string
-	CompanyURL       string
-	SalaryRange      string
-	Location         string
-	JobDescription   string
-	Perks            string
-	InterviewProcess string
-	HowToApply       string
-	Slug             string
-	SalaryCurrency   string
-	AdType           int64
-	SalaryMin        int64
-	SalaryMax        int64
-	CompanyIconID    string
-	ExternalID       string
-	IsQuickApply     bool
-	ApprovedAt       *time.Time
-	CompanyEmail     string
+	ID                 int
+	CreatedAt          int64
+	TimeAgo            string
+	JobTitle           string
+	Company            string
+	CompanyURL         string
+	SalaryRange        string
+	Location           string
+	JobDescription     string
+	Perks              string
+	InterviewProcess   string
+	HowToApply         string
+	Slug               string
+	SalaryCurrency     string
+	SalaryCurrencyCode string
+	SalaryPeriod       SalaryPeriod
+	SalaryUndisclosed  bool
+	AdType             int64
+	SalaryMin          int64
+	SalaryMax          int64
+	CompanyIconID      string
+	ExternalID         string
+	IsQuickApply       bool
+	ApprovedAt         *time.Time
+	CompanyEmail       string
+	Status             JobStatus
+	ExpiresAt          *time.Time
+	RemotePolicy       RemotePolicy
+	RemoteRegions      []string
+	Timezone           TimezoneWindow
+	// Locations, Skills and CompanySlug are only loaded for the job page
+	Locations   []JobLocation
+	Skills      []string
+	CompanySlug string
+	// SearchHighlight is the escaped snippet of the description matching a
+	// search, with the matched words in <mark>
+	SearchHighlight string
+	// Rank is set for listings, it explains their order
+	Rank JobRank
+	// HTMLJobDescription, HTMLPerks and HTMLInterviewProcess are the rendered
+	// markdown of listed jobs
+	HTMLJobDescription   string
+	HTMLPerks            string
+	HTMLInterviewProcess string
+}
+
+func (j JobPost) Remote() JobRemote {
+	return JobRemote{Policy: j.RemotePolicy, Regions: j.RemoteRegions, Timezone: j.Timezone}
+}
+
+func (j JobPost) SkillTags() []Skill {
+	return skillsOf(j.Skills)
 }
 
 type JobPostForEdit struct {
@@ -103,6 +184,34 @@ type JobPostForEdit struct {
 	AdType                                                                    int64
 	CompanyIconID                                                             string
 	ExternalID                                                                string
+	Status                                                                    JobStatus
+	StatusUpdatedAt                                                           time.Time
+	ExpiresAt                                                                 pq.NullTime
+	ArchivedAt                                                                pq.NullTime
+	ArchiveReason                                                             string
+	SalaryCurrencyCode                                                        string
+	SalaryPeriod                                                              SalaryPeriod
+	SalaryUndisclosed, Equity                                                 bool
+	EquityMin, EquityMax                                                      float64
+	RemotePolicy                                                              RemotePolicy
+	RemoteRegions                                                             []string
+	Timezone                                                                  TimezoneWindow
+	Skills                                                                    []string
+}
+
+func (j JobPostForEdit) HasSkill(slug string) bool {
+	return hasSkill(j.Skills, slug)
+}
+
+// HasRemoteRegion reports whether the job is open to remote employees in
+// the region
+func (j JobPostForEdit) HasRemoteRegion(region string) bool {
+	for _, r := range j.RemoteRegions {
+		if r == region {
+			return true
+		}
+	}
+	return false
 }
 
 type ScrapedJob struct {
@@ -131,171 +240,19 @@ type SEOSkill struct {
 	Name string
 }
 
-// Table Structure:
-//
-// CREATE TABLE IF NOT EXISTS job (
-// 	id        		   SERIAL NOT NULL,
-// 	job_title          VARCHAR(128) NOT NULL,
-// 	company            VARCHAR(128) NOT NULL,
-// 	company_url        VARCHAR(128),
-// 	company_twitter    VARCHAR(128),
-// 	company_email      VARCHAR(128),
-// 	salary_range       VARCHAR(100) NOT NULL,
-// 	location           VARCHAR(200) NOT NULL,
-// 	description        TEXT NOT NULL,
-// 	perks              TEXT,
-// 	interview_process  TEXT,
-// 	how_to_apply       VARCHAR(512),
-// 	created_at         TIMESTAMP NOT NULL,
-// 	approved_at        TIMESTAMP,
-// 	url_id             INTEGER NOT NULL,
-// 	slug               VARCHAR(256),
-//  PRIMARY KEY (id)
-// );
-// CREATE UNIQUE INDEX url_id_idx on job (url_id);
-// CREATE UNIQUE INDEX slug_idx on job (slug);
-// ALTER TABLE job ADD COLUMN salary_min INTEGER NOT NULL DEFAULT 1;
-// ALTER TABLE job ADD COLUMN salary_max INTEGER NOT NULL DEFAULT 1;
-// ALTER TABLE job ADD COLUMN salary_currency VARCHAR(4) NOT NULL DEFAULT '$';
-// ALTER TABLE job ADD COLUMN external_id VARCHAR(28) NOT NULL;
-// ALTER TABLE job ADD COLUMN external_id VARCHAR(28) DROP DEFAULT;
-// ALTER TABLE job ADD COLUMN ad_type INTEGER NOT NULL DEFAULT 0;
-// ALTER TABLE job ALTER COLUMN company_url SET NOT NULL;
-// ALTER TABLE job ADD COLUMN company_icon_image_id VARCHAR(255) DEFAULT NULL;
-
-// CREATE TABLE IF NOT EXISTS image (
-// 	id CHAR(27) NOT NULL UNIQUE,
-// 	bytes BYTEA NOT NULL,
-// 	PRIMARY KEY(id)
-// )
-// ALTER TABLE image ADD COLUMN media_type VARCHAR(100) NOT NULL;
-
-// CREATE TABLE IF NOT EXISTS news (
-// 	id CHAR(27) NOT NULL UNIQUE,
-// 	title VARCHAR(80) NOT NULL,
-// 	text TEXT NOT NULL,
-// 	created_at TIMESTAMP NOT NULL,
-// 	created_by CHAR(27) NOT NULL,
-// 	PRIMARY KEY(id)
-// );
-
-// CREATE TABLE IF NOT EXISTS news_comment (
-// 	id CHAR(27) NOT NULL UNIQUE,
-// 	text TEXT NOT NULL,
-// 	created_by CHAR(27) NOT NULL,
-// 	created_at TIMESTAMP NOT NULL,
-// 	parent_id CHAR(27) NOT NULL,
-// 	PRIMARY KEY(id)
-// );
-
-// CREATE INDEX news_comment_parent_id_idx on news_comment (parent_id);
-
-// CREATE TABLE IF NOT EXISTS users (
-// 	id CHAR(27) NOT NULL UNIQUE,
-// 	email VARCHAR(255) NOT NULL,
-// 	username VARCHAR(255) NOT NULL,
-// 	created_at TIMESTAMP,
-// 	PRIMARY KEY (id)
-// );
-
-// CREATE TABLE IF NOT EXISTS user_sign_on_token (
-// 	token CHAR(27) NOT NULL UNIQUE,
-// 	email VARCHAR(255) NOT NULL
-// );
-
-// CREATE INDEX user_sign_on_token_token_idx on user_sign_on_token (token);
-
-// CREATE TABLE IF NOT EXISTS edit_token (
-//   token      CHAR(27) NOT NULL,
-//   job_id     INTEGER NOT NULL REFERENCES job (id),
-//   created_at TIMESTAMP NOT NULL
-// );
-// CREATE UNIQUE INDEX token_idx on edit_token (token);
-
-// CREATE TABLE IF NOT EXISTS purchase_event (
-// 	stripe_session_id VARCHAR(255) NOT NULL,
-//  amount INTEGER NOT NULL,
-//  currency CHAR(3) NOT NULL,
-// 	created_at TIMESTAMP NOT NULL,
-// 	completed_at TIMESTAMP DEFAULT NULL,
-//  description VARCHAR(255) NOT NULL,
-//  ad_type INTEGER NOT NULL DEFAULT 0,
-//  email VARCHAR(255) NOT NULL,
-// 	job_id INTEGER NOT NULL REFERENCES job (id)
-// );
-// CREATE UNIQUE INDEX purchase_event_stripe_session_id_idx ON purchase_event (stripe_session_id);
-// CREATE INDEX purchase_event_job_id_idx ON purchase_event (job_id);
-
-// CREATE TABLE IF NOT EXISTS apply_token (
-//   token        CHAR(27) NOT NULL,
-//   job_id       INTEGER NOT NULL REFERENCES job (id),
-//   created_at   TIMESTAMP NOT NULL,
-//   confirmed_at TIMESTAMP DEFAULT NULL,
-//   email        VARCHAR(255) NOT NULL,
-//   cv           BYTEA NOT NULL,
-// );
-// CREATE UNIQUE INDEX token_idx on apply_token (token);
-
-// CREATE TABLE IF NOT EXISTS job_event (
-// 	event_type VARCHAR(128) NOT NULL,
-// 	job_id INTEGER NOT NULL REFERENCES job (id),
-// 	created_at TIMESTAMP NOT NULL
-// );
-
-// CREATE INDEX job_idx ON job_event (job_id);
-
-// CREATE TABLE IF NOT EXISTS seo_salary (
-//  id VARCHAR(255) NOT NULL,
-//  location VARCHAR(255) NOT NULL,
-//  currency VARCHAR(5) NOT NULL,
-//  uri VARCHAR(100) NOT NULL
-// );
-
-// CREATE INDEX seo_salary_idx ON seo_salary (id);
-
-// CREATE TABLE IF NOT EXISTS seo_skill (
-//  name VARCHAR(255) NOT NULL UNIQUE
-// );
-
-// CREATE TABLE IF NOT EXISTS seo_location (
-//  name VARCHAR(255) NOT NULL UNIQUE
-// );
-// ALTER TABLE seo_location ADD COLUMN currency VARCHAR(4) NOT NULL DEFAULT '$';
-// ALTER TABLE seo_location ADD COLUMN country VARCHAR(255) DEFAULT NULL;
-
-// CREATE TABLE IF NOT EXISTS queue_jobs (
-// 	id VARCHAR(28) NOT NULL,
-// 	name VARCHAR(255) NOT NULL,
-// 	payload JSONB NOT NULL,
-// 	created_at TIMESTAMP NOT NULL,
-// 	started_at TIMESTAMP DEFAULT NULL,
-// 	finished_at TIMESTAMP DEFAULT NULL,
-//  priority INTEGER NOT NULL,
-// 	PRIMARY KEY(id)
-// );
-
-// CREATE INDEX queue_jobs_handler_idx ON queue_jobs (handler);
-
-// CREATE TABLE IF NOT EXISTS seo_landing_page (
-//  uri VARCHAR(255) NOT NULL UNIQUE,
-//  location VARCHAR(255) NOT NULL,
-//  skill VARCHAR(255) NOT NULL
-// );
-
-// CREATE INDEX seo_landing_page_uri ON seo_landing_page (uri);
-
-// CREATE TABLE IF NOT EXISTS meta (
-// 	key VARCHAR(255) NOT NULL UNIQUE,
-// 	value VARCHAR(255) NOT NULL
-// );
+// The schema is managed by versioned migration files, see the migrations
+// directory and MigrateUp. Run `migrate up` to bring a database up to date.
 
 const (
-	jobEventPageView = "page_view"
-	jobEventClickout = "clickout"
+	jobEventPageView    = "page_view"
+	jobEventClickout    = "clickout"
+	jobEventApplication = "application"
 )
 
-// GetDbConn tries to establish a connection to postgres and return the connection handler
-func GetDbConn(databaseURL string) (*sql.DB, error) {
+// GetDbConn tries to establish a connection to postgres and return the connection handler.
+// When migrationsDir is not empty it refuses to return a connection if any
+// migration in that directory has not been applied yet
+func GetDbConn(databaseURL, migrationsDir string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
 		return nil, err
@@ -304,6 +261,17 @@ func GetDbConn(databaseURL string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	if migrationsDir != "" {
+		pending, err := PendingMigrations(db, migrationsDir)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if len(pending) > 0 {
+			db.Close()
+			return nil, fmt.Errorf("%w: %d migrations to apply starting from %d_%s", ErrPendingMigrations, len(pending), pending[0].Version, pending[0].Name)
+		}
+	}
 	db.SetMaxOpenConns(20)
 	db.SetMaxIdleConns(20)
 	db.SetConnMaxLifetime(5 * time.Minute)
@@ -315,9 +283,31 @@ func CloseDbConn(conn *sql.DB) {
 	conn.Close()
 }
 
-func TrackJobView(conn *sql.DB, job *JobPost) error {
-	stmt := `INSERT INTO job_event (event_type, job_id, created_at) VALUES ($1, $2, NOW())`
-	_, err := conn.Exec(stmt, jobEventPageView, job.ID)
+// JobVisitor is who caused a job event, Hash is a salted hash of their IP
+// address and user agent that changes every day, Country the ISO code of the
+// country of their IP address
+type JobVisitor struct {
+	Hash    string
+	Bot     bool
+	Country string
+}
+
+// JobEventCount is the number of events of a job, Unique counts each visitor
+// that is not a bot once a day
+type JobEventCount struct {
+	Raw    int
+	Unique int
+}
+
+// jobEventUniqueSQL counts the visitors that are not bots of the job events
+// matching cond, events recorded before visitors were tracked count once each
+func jobEventUniqueSQL(cond string) string {
+	return fmt.Sprintf(`count(DISTINCT visitor_hash) FILTER (WHERE NOT is_bot AND %s) + count(*) FILTER (WHERE visitor_hash IS NULL AND NOT is_bot AND %s)`, cond, cond)
+}
+
+func TrackJobView(conn *sql.DB, job *JobPost, v JobVisitor) error {
+	stmt := `INSERT INTO job_event (event_type, job_id, created_at, visitor_hash, is_bot, country) VALUES ($1, $2, NOW(), NULLIF($3, ''), $4, NULLIF($5, ''))`
+	_, err := conn.Exec(stmt, jobEventPageView, job.ID, v.Hash, v.Bot, v.Country)
 	return err
 }
 
@@ -327,10 +317,14 @@ func ApplyToJob(conn *sql.DB, jobID int, cv []byte, email, token string) error {
 	return err
 }
 
+// ConfirmApplyToJob also records the application as a job event, apply
+// tokens are deleted soon after they are confirmed
 func ConfirmApplyToJob(conn *sql.DB, token string) error {
 	_, err := conn.Exec(
-		`UPDATE apply_token SET confirmed_at = NOW() WHERE token = $1`,
+		`WITH t AS (UPDATE apply_token SET confirmed_at = NOW() WHERE token = $1 AND confirmed_at IS NULL RETURNING job_id)
+		INSERT INTO job_event (event_type, job_id, created_at) SELECT $2, job_id, NOW() FROM t`,
 		token,
+		jobEventApplication,
 	)
 	return err
 }
@@ -342,7 +336,7 @@ type Applicant struct {
 
 func GetJobByApplyToken(conn *sql.DB, token string) (JobPost, Applicant, error) {
 	res := conn.QueryRow(`SELECT t.cv, t.email, j.id, j.job_title, j.company, company_url, salary_range, location, how_to_apply, slug, j.external_id
-	FROM job j JOIN apply_token t ON t.job_id = j.id AND t.token = $1 WHERE j.approved_at IS NOT NULL AND t.created_at < NOW() + INTERVAL '3 days' AND t.confirmed_at IS NULL`, token)
+	FROM job j JOIN apply_token t ON t.job_id = j.id AND t.token = $1 WHERE j.status = 'approved' AND t.created_at < NOW() + INTERVAL '3 days' AND t.confirmed_at IS NULL`, token)
 	job := JobPost{}
 	applicant := Applicant{}
 	err := res.Scan(&applicant.Cv, &applicant.Email, &job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID)
@@ -353,9 +347,9 @@ func GetJobByApplyToken(conn *sql.DB, token string) (JobPost, Applicant, error)
 	return job, applicant, nil
 }
 
-func TrackJobClickout(conn *sql.DB, jobID int) error {
-	stmt := `INSERT INTO job_event (event_type, job_id, created_at) VALUES ($1, $2, NOW())`
-	_, err := conn.Exec(stmt, jobEventClickout, jobID)
+func TrackJobClickout(conn *sql.DB, jobID int, v JobVisitor) error {
+	stmt := `INSERT INTO job_event (event_type, job_id, created_at, visitor_hash, is_bot, country) VALUES ($1, $2, NOW(), NULLIF($3, ''), $4, NULLIF($5, ''))`
+	_, err := conn.Exec(stmt, jobEventClickout, jobID, v.Hash, v.Bot, v.Country)
 	if err != nil {
 		return err
 	}
@@ -363,12 +357,14 @@ func TrackJobClickout(conn *sql.DB, jobID int) error {
 }
 
 func GetJobByExternalID(conn *sql.DB, externalID string) (JobPost, error) {
-	res := conn.QueryRow(`SELECT id, job_title, company, company_url, salary_range, location, how_to_apply, slug, external_id FROM job WHERE external_id = $1`, externalID)
+	res := conn.QueryRow(`SELECT id, job_title, company, company_url, salary_range, location, how_to_apply, slug, external_id, ad_type, company_icon_image_id FROM job WHERE external_id = $1`, externalID)
 	var job JobPost
-	err := res.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID)
+	var companyIconID sql.NullString
+	err := res.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID, &job.AdType, &companyIconID)
 	if err != nil {
 		return job, err
 	}
+	job.CompanyIconID = companyIconID.String
 
 	return job, nil
 }
@@ -396,14 +392,14 @@ func DemoteJobAdsOlderThan(conn *sql.DB, since time.Time, jobAdType JobAdType) (
 
 func GetJobsOlderThan(conn *sql.DB, since time.Time, adType JobAdType) ([]JobPost, error) {
 	var jobs []JobPost
-	rows, err := conn.Query(`SELECT id, job_title, company, company_url, company_email, salary_range, location, how_to_apply, slug, external_id, approved_at FROM job j WHERE approved_at <= $1 AND ad_type = $2`, since, adType)
+	rows, err := conn.Query(`SELECT id, job_title, company, company_url, company_email, salary_range, location, how_to_apply, slug, external_id, approved_at, status, ad_type FROM job j WHERE approved_at <= $1 AND ad_type = $2`, since, adType)
 	if err == sql.ErrNoRows {
 		return jobs, nil
 	}
 	for rows.Next() {
 		var job JobPost
 		var approvedAt sql.NullTime
-		err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.CompanyEmail, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID, &approvedAt)
+		err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.CompanyEmail, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID, &approvedAt, &job.Status, &job.AdType)
 		if err != nil {
 			return jobs, err
 		}
@@ -426,31 +422,6 @@ type SalaryDataPoint struct {
 	Max int64 `json:"max"`
 }
 
-func GetSalaryDataForLocationAndCurrency(conn *sql.DB, location, currency string) ([]SalaryDataPoint, error) {
-	var res []SalaryDataPoint
-	var rows *sql.Rows
-	rows, err := conn.Query(`
-	SELECT salary_min, salary_max
-		FROM job WHERE approved_at IS NOT NULL AND salary_currency = $1 AND location ILIKE '%' || $2 || '%'`, currency, location)
-	if err != nil {
-		return res, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		dp := SalaryDataPoint{}
-		err = rows.Scan(&dp.Min, &dp.Max)
-		if err != nil {
-			return res, err
-		}
-		res = append(res, dp)
-	}
-	err = rows.Err()
-	if err != nil {
-		return res, err
-	}
-	return res, nil
-}
-
 type SalaryTrendDataPoint struct {
 	Date string `json:"date"`
 	P10  int64  `json:"p10"`
@@ -460,31 +431,6 @@ type SalaryTrendDataPoint struct {
 	P90  int64  `json:"p90"`
 }
 
-func GetSalaryTrendsForLocationAndCurrency(conn *sql.DB, location, currency string) ([]SalaryTrendDataPoint, error) {
-	var res []SalaryTrendDataPoint
-	var rows *sql.Rows
-	rows, err := conn.Query(`
-	SELECT to_char(date_trunc('month', created_at), 'YYYY-MM-DD') as date, percentile_disc(0.10) within group (order by salary_max) as p10, percentile_disc(0.25) within group (order by salary_max) as p25, percentile_disc(0.50) within group (order by salary_max) as p50, percentile_disc(0.75) within group (order by salary_max) as p75, percentile_disc(0.90) within group (order by salary_max) as p90 FROM job WHERE approved_at IS NOT NULL AND salary_currency = $1 AND location ILIKE '%' || $2 || '%' group by date_trunc('month', created_at) order by date_trunc('month', created_at) asc`,
-		currency, location)
-	if err != nil {
-		return res, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		dp := SalaryTrendDataPoint{}
-		err = rows.Scan(&dp.Date, &dp.P10, &dp.P25, &dp.P50, &dp.P75, &dp.P90)
-		if err != nil {
-			return res, err
-		}
-		res = append(res, dp)
-	}
-	err = rows.Err()
-	if err != nil {
-		return res, err
-	}
-	return res, nil
-}
-
 func SaveSEOLandingPage(conn *sql.DB, seoLandingPage SEOLandingPage) error {
 	sqlStmt := `INSERT INTO seo_landing_page (uri, location, skill) VALUES ($1, $2, $3)`
 	_, err := conn.Exec(sqlStmt, seoLandingPage.URI, seoLandingPage.Location, seoLandingPage.Skill)
@@ -522,10 +468,6 @@ func SaveSEOLocation(conn *sql.DB, name, country, currency string) string {
 	return insert
 }
 
-func SaveSEOSkillFromCompany(conn *sql.DB) {
-	_ = conn.QueryRow(`INSERT INTO seo_skill select distinct company from job on conflict do nothing`)
-}
-
 func GetLocation(conn *sql.DB, location string) (string, string, string, error) {
 	var loc string
 	var currency string
@@ -578,12 +520,12 @@ type User struct {
 	IsAdmin            bool
 }
 type NewsItem struct {
-	ID                 string    `json:"_"`
+	ID                 string    `json:"-"`
 	Title              string    `json:"title"`
 	Text               string    `json:"text"`
-	CreatedAt          time.Time `json:"_"`
+	CreatedAt          time.Time `json:"-"`
 	CreatedAtHumanised string
-	CreatedBy          User `json:"_"`
+	CreatedBy          User `json:"-"`
 }
 
 type NewsComment struct {
@@ -628,10 +570,11 @@ func GetLatestNews(db *sql.DB, last int) ([]NewsItem, error) {
 	return news, nil
 }
 
-func CreateNewsItem(db *sql.DB, n NewsItem) error {
+// newNewsItem assigns an ID and creation time to n and sanitises its content
+func newNewsItem(n NewsItem) (NewsItem, error) {
 	newsID, err := ksuid.NewRandom()
 	if err != nil {
-		return err
+		return n, err
 	}
 	n.ID = newsID.String()
 	n.CreatedAt = time.Now()
@@ -639,7 +582,15 @@ func CreateNewsItem(db *sql.DB, n NewsItem) error {
 	n.Title = p.Sanitize(n.Title)
 	n.Text = p.Sanitize(n.Text)
 	if strings.TrimSpace(n.Text) == "" || strings.TrimSpace(n.Title) == "" {
-		return errors.New("Text and Title cannot be blank")
+		return n, errors.New("Text and Title cannot be blank")
+	}
+	return n, nil
+}
+
+func CreateNewsItem(db *sql.DB, n NewsItem) error {
+	n, err := newNewsItem(n)
+	if err != nil {
+		return err
 	}
 	if _, err := db.Exec(`INSERT INTO news (id, title, text, created_at, created_by) VALUES ($1, $2, $3, $4, $5)`, n.ID, n.Title, n.Text, n.CreatedAt, n.CreatedBy.ID); err != nil {
 		return err
@@ -648,17 +599,26 @@ func CreateNewsItem(db *sql.DB, n NewsItem) error {
 	return nil
 }
 
-func CreateNewsComment(db *sql.DB, c NewsComment) error {
-	newsID, err := ksuid.NewRandom()
+// newNewsComment assigns an ID and creation time to c and sanitises its content
+func newNewsComment(c NewsComment) (NewsComment, error) {
+	commentID, err := ksuid.NewRandom()
 	if err != nil {
-		return err
+		return c, err
 	}
-	c.ID = newsID.String()
+	c.ID = commentID.String()
 	c.CreatedAt = time.Now()
 	p := bluemonday.UGCPolicy()
 	c.Text = p.Sanitize(c.Text)
 	if strings.TrimSpace(c.Text) == "" {
-		return errors.New("Text cannot be blank")
+		return c, errors.New("Text cannot be blank")
+	}
+	return c, nil
+}
+
+func CreateNewsComment(db *sql.DB, c NewsComment) error {
+	c, err := newNewsComment(c)
+	if err != nil {
+		return err
 	}
 	// TODO: check that parent id exists
 	if _, err := db.Exec(`INSERT INTO news_comment (id, text, created_at, created_by, parent_id) VALUES ($1, $2, $3, $4, $5)`, c.ID, c.Text, c.CreatedAt, c.CreatedBy.ID, c.Parent); err != nil {
@@ -720,9 +680,13 @@ func GetNewsComments(db *sql.DB, newsID string) ([]NewsComment, error) {
 	return comments, nil
 }
 
-func SaveTokenSignOn(db *sql.DB, email, token string) error {
+func hashEmail(email string) string {
 	sha256Email := sha256.Sum256([]byte(email))
-	if _, err := db.Exec(`INSERT INTO user_sign_on_token (token, email) VALUES ($1, $2)`, token, hex.EncodeToString(sha256Email[:])); err != nil {
+	return hex.EncodeToString(sha256Email[:])
+}
+
+func SaveTokenSignOn(db *sql.DB, email, token string) error {
+	if _, err := db.Exec(`INSERT INTO user_sign_on_token (token, email) VALUES ($1, $2)`, token, hashEmail(email)); err != nil {
 		return err
 	}
 	return nil
@@ -812,92 +776,55 @@ func SaveDraft(db *sql.DB, job *JobRq) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	sqlStatement := `
-			INSERT INTO job (job_title, company, company_url, salary_range, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, company_email, ad_type, external_id)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) RETURNING id`
-	if job.CompanyIconID != "" {
-		sqlStatement = `
-			INSERT INTO job (job_title, company, company_url, salary_range, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, company_email, ad_type, company_icon_image_id, external_id)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id`
+	salary, err := job.Salary()
+	if err != nil {
+		return 0, err
 	}
-	slugTitle := slug.Make(fmt.Sprintf("%s %s %d", job.JobTitle, job.Company, time.Now().UTC().Unix()))
-	createdAt := time.Now().UTC().Unix()
-	salaryMinInt, err := strconv.Atoi(strings.TrimSpace(job.SalaryMin))
+	remote, err := job.Remote()
 	if err != nil {
 		return 0, err
 	}
-	salaryMaxInt, err := strconv.Atoi(strings.TrimSpace(job.SalaryMax))
+	skills, err := job.SkillTags()
 	if err != nil {
 		return 0, err
 	}
-	salaryRange := SalaryToSalaryRangeString(salaryMinInt, salaryMaxInt, job.SalaryCurrency)
-	var lastInsertID int
-	var res *sql.Row
+	sqlStatement := `
+			INSERT INTO job (job_title, company, company_url, salary_range, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, company_email, ad_type, external_id, salary_currency_code, salary_period, salary_undisclosed, equity, equity_min, equity_max, remote_policy, remote_regions, timezone_from, timezone_to)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28) RETURNING id`
 	if job.CompanyIconID != "" {
-		res = db.QueryRow(sqlStatement, job.JobTitle, job.Company, job.CompanyURL, salaryRange, job.SalaryMin, job.SalaryMax, job.SalaryCurrency, job.Location, job.Description, job.Perks, job.InterviewProcess, job.HowToApply, time.Unix(createdAt, 0), createdAt, slugTitle, job.Email, job.AdType, job.CompanyIconID, externalID)
-	} else {
-		res = db.QueryRow(sqlStatement, job.JobTitle, job.Company, job.CompanyURL, salaryRange, job.SalaryMin, job.SalaryMax, job.SalaryCurrency, job.Location, job.Description, job.Perks, job.InterviewProcess, job.HowToApply, time.Unix(createdAt, 0), createdAt, slugTitle, job.Email, job.AdType, externalID)
+		sqlStatement = `
+			INSERT INTO job (job_title, company, company_url, salary_range, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, company_email, ad_type, external_id, salary_currency_code, salary_period, salary_undisclosed, equity, equity_min, equity_max, remote_policy, remote_regions, timezone_from, timezone_to, company_icon_image_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29) RETURNING id`
 	}
-	res.Scan(&lastInsertID)
-	if err != nil {
-		return 0, err
+	slugTitle := slug.Make(fmt.Sprintf("%s %s %d", job.JobTitle, job.Company, time.Now().UTC().Unix()))
+	createdAt := time.Now().UTC().Unix()
+	args := []interface{}{job.JobTitle, job.Company, job.CompanyURL, salary.RangeString(), salary.Min, salary.Max, salary.CurrencySymbol(), job.Location, job.Description, job.Perks, job.InterviewProcess, job.HowToApply, time.Unix(createdAt, 0), createdAt, slugTitle, job.Email, job.AdType, externalID, salary.CurrencyCode, salary.Period, salary.Undisclosed, salary.Equity, nullEquity(salary.EquityMin), nullEquity(salary.EquityMax), remote.Policy, remoteRegionsArray(remote.Regions), remote.Timezone.nullFrom(), remote.Timezone.nullTo()}
+	if job.CompanyIconID != "" {
+		args = append(args, job.CompanyIconID)
 	}
-	return int(lastInsertID), err
-}
-
-func UpdateJob(conn *sql.DB, job *JobRqUpdate, jobID int) error {
-	salaryMinInt, err := strconv.Atoi(strings.TrimSpace(job.SalaryMin))
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	salaryMaxInt, err := strconv.Atoi(strings.TrimSpace(job.SalaryMax))
+	var lastInsertID int
+	err = tx.QueryRow(sqlStatement, args...).Scan(&lastInsertID)
 	if err != nil {
-		return err
+		tx.Rollback()
+		return 0, err
 	}
-	salaryRange := SalaryToSalaryRangeString(salaryMinInt, salaryMaxInt, job.SalaryCurrency)
-	_, err = conn.Exec(
-		`UPDATE job SET job_title = $1, company = $2, company_url = $3, salary_min = $4, salary_max = $5, salary_currency = $6, salary_range = $7, location = $8, description = $9, perks = $10, interview_process = $11, how_to_apply = $12, company_icon_image_id = $13 WHERE id = $14`,
-		job.JobTitle,
-		job.Company,
-		job.CompanyURL,
-		job.SalaryMin,
-		job.SalaryMax,
-		job.SalaryCurrency,
-		salaryRange,
-		job.Location,
-		job.Description,
-		job.Perks,
-		job.InterviewProcess,
-		job.HowToApply,
-		job.CompanyIconID,
-		jobID,
-	)
-	if err != nil {
-		return err
+	if err := replaceJobLocationsTx(tx, lastInsertID, job.Location); err != nil {
+		tx.Rollback()
+		return 0, err
 	}
-	return err
-}
-
-func ApproveJob(conn *sql.DB, jobID int) error {
-	_, err := conn.Exec(
-		`UPDATE job SET approved_at = NOW() WHERE id = $1`,
-		jobID,
-	)
-	if err != nil {
-		return err
+	if err := replaceJobSkillsTx(tx, lastInsertID, skills); err != nil {
+		tx.Rollback()
+		return 0, err
 	}
-	return err
-}
-
-func DisapproveJob(conn *sql.DB, jobID int) error {
-	_, err := conn.Exec(
-		`UPDATE job SET approved_at = NULL WHERE id = $1`,
-		jobID,
-	)
-	if err != nil {
-		return err
+	if err := linkJobCompanyTx(tx, lastInsertID, job.Company, job.CompanyURL, job.CompanyIconID); err != nil {
+		tx.Rollback()
+		return 0, err
 	}
-	return err
+	return int(lastInsertID), tx.Commit()
 }
 
 func SalaryToSalaryRangeString(salaryMin, salaryMax int, currency string) string {
@@ -922,23 +849,24 @@ func SalaryToSalaryRangeString(salaryMin, salaryMax int, currency string) string
 	return fmt.Sprintf("%s%s - %s%s", currency, salaryMinStr, currency, salaryMaxStr)
 }
 
-func CompanyExists(db *sql.DB, company string) (bool, error) {
-	var count int
-	row := db.QueryRow(`SELECT COUNT(*) as c FROM job WHERE company ILIKE '%` + company + `%'`)
-	err := row.Scan(&count)
-	if count > 0 {
-		return true, err
-	}
-
-	return false, err
+func GetViewCountForJob(conn *sql.DB, jobID int) (JobEventCount, error) {
+	return countJobEvents(conn, jobEventPageView, jobID)
 }
 
-func GetViewCountForJob(conn *sql.DB, jobID int) (int, error) {
-	var count int
-	row := conn.QueryRow(`select count(*) as c from job_event where job_event.event_type = 'page_view' and job_event.job_id = $1`, jobID)
-	err := row.Scan(&count)
+// countJobEvents adds up the rollups of a job and its events of the days not
+// rolled up yet
+func countJobEvents(conn *sql.DB, eventType string, jobID int) (JobEventCount, error) {
+	var count JobEventCount
+	columns := jobStatsColumns[eventType]
+	row := conn.QueryRow(`WITH `+jobStatsLiveSinceSQL+`
+	SELECT COALESCE(sum(raw), 0), COALESCE(sum(uniq), 0) FROM (
+		SELECT sum(`+columns[0]+`) AS raw, sum(`+columns[1]+`) AS uniq FROM job_stats_daily WHERE job_id = $2
+		UNION ALL
+		SELECT count(*), `+jobEventUniqueSQL("TRUE")+` FROM job_event, live_since WHERE event_type = $1 AND job_id = $2 AND created_at >= live_since.day
+	) c`, eventType, jobID)
+	err := row.Scan(&count.Raw, &count.Unique)
 	if err != nil {
-		return 0, err
+		return JobEventCount{}, err
 	}
 	return count, err
 }
@@ -953,6 +881,7 @@ type PurchaseEvent struct {
 	AdType          int
 	Email           string
 	JobID           int
+	IsRenewal       bool
 }
 
 func GetPurchaseEvents(conn *sql.DB, jobID int) ([]PurchaseEvent, error) {
@@ -992,9 +921,9 @@ func SaveSuccessfulPayment(conn *sql.DB, sessionID string) (int, error) {
 }
 
 func GetPurchaseEventBySessionID(conn *sql.DB, sessionID string) (PurchaseEvent, error) {
-	res := conn.QueryRow(`SELECT stripe_session_id, created_at, completed_at, email, amount, currency, description, ad_type FROM purchase_event WHERE stripe_session_id = $1`, sessionID)
+	res := conn.QueryRow(`SELECT stripe_session_id, created_at, completed_at, email, amount, currency, description, ad_type, renewal FROM purchase_event WHERE stripe_session_id = $1`, sessionID)
 	var p PurchaseEvent
-	err := res.Scan(&p.StripeSessionID, &p.CreatedAt, &p.CompletedAt, &p.Email, &p.Amount, &p.Currency, &p.Description, &p.AdType)
+	err := res.Scan(&p.StripeSessionID, &p.CreatedAt, &p.CompletedAt, &p.Email, &p.Amount, &p.Currency, &p.Description, &p.AdType, &p.IsRenewal)
 	if err != nil {
 		return p, err
 	}
@@ -1003,10 +932,10 @@ func GetPurchaseEventBySessionID(conn *sql.DB, sessionID string) (PurchaseEvent,
 }
 
 func GetJobByStripeSessionID(conn *sql.DB, sessionID string) (JobPost, error) {
-	res := conn.QueryRow(`SELECT j.id, j.job_title, j.company, j.company_url, j.salary_range, j.location, j.how_to_apply, j.slug, j.external_id, j.approved_at FROM purchase_event p LEFT JOIN job j ON p.job_id = j.id WHERE p.stripe_session_id = $1`, sessionID)
+	res := conn.QueryRow(`SELECT j.id, j.job_title, j.company, j.company_url, j.salary_range, j.location, j.how_to_apply, j.slug, j.external_id, j.approved_at, j.status, j.ad_type FROM purchase_event p LEFT JOIN job j ON p.job_id = j.id WHERE p.stripe_session_id = $1`, sessionID)
 	var job JobPost
 	var approvedAt sql.NullTime
-	err := res.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID, &approvedAt)
+	err := res.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.HowToApply, &job.Slug, &job.ExternalID, &approvedAt, &job.Status, &job.AdType)
 	if err != nil {
 		return job, err
 	}
@@ -1018,14 +947,26 @@ func GetJobByStripeSessionID(conn *sql.DB, sessionID string) (JobPost, error) {
 }
 
 type JobStat struct {
-	Date      string `json:"date"`
-	Clickouts int    `json:"clickouts"`
-	PageViews int    `json:"pageviews"`
+	Date            string `json:"date"`
+	Clickouts       int    `json:"clickouts"`
+	PageViews       int    `json:"pageviews"`
+	UniqueClickouts int    `json:"unique_clickouts"`
+	UniquePageViews int    `json:"unique_pageviews"`
+	Applications    int    `json:"applications"`
 }
 
+// GetStatsForJob reads the daily rollups of a job, the days not rolled up yet
+// are counted from its events
 func GetStatsForJob(conn *sql.DB, jobID int) ([]JobStat, error) {
 	var stats []JobStat
-	rows, err := conn.Query(`SELECT COUNT(*) FILTER (WHERE event_type = 'clickout') AS clickout, COUNT(*) FILTER (WHERE event_type = 'page_view') AS pageview, TO_CHAR(DATE_TRUNC('day', created_at), 'YYYY-MM-DD') FROM job_event WHERE job_id = $1 GROUP BY DATE_TRUNC('day', created_at) ORDER BY DATE_TRUNC('day', created_at) ASC`, jobID)
+	rows, err := conn.Query(`WITH `+jobStatsLiveSinceSQL+`
+	SELECT clickouts, page_views, unique_clickouts, unique_page_views, applications, TO_CHAR(day, 'YYYY-MM-DD') FROM (
+		SELECT day, sum(clickouts) AS clickouts, sum(page_views) AS page_views, sum(unique_clickouts) AS unique_clickouts, sum(unique_page_views) AS unique_page_views, sum(applications) AS applications
+		FROM job_stats_daily WHERE job_id = $1 GROUP BY day
+		UNION ALL
+		SELECT created_at::date, `+jobStatsCountsSQL+`
+		FROM job_event, live_since WHERE job_id = $1 AND created_at >= live_since.day GROUP BY created_at::date
+	) s ORDER BY day ASC`, jobID)
 	if err == sql.ErrNoRows {
 		return stats, nil
 	}
@@ -1034,7 +975,7 @@ func GetStatsForJob(conn *sql.DB, jobID int) ([]JobStat, error) {
 	}
 	for rows.Next() {
 		var s JobStat
-		if err := rows.Scan(&s.Clickouts, &s.PageViews, &s.Date); err != nil {
+		if err := rows.Scan(&s.Clickouts, &s.PageViews, &s.UniqueClickouts, &s.UniquePageViews, &s.Applications, &s.Date); err != nil {
 			return stats, err
 		}
 		stats = append(stats, s)
@@ -1043,23 +984,17 @@ func GetStatsForJob(conn *sql.DB, jobID int) ([]JobStat, error) {
 	return stats, nil
 }
 
-func GetClickoutCountForJob(conn *sql.DB, jobID int) (int, error) {
-	var count int
-	row := conn.QueryRow(`select count(*) as c from job_event where job_event.event_type = 'clickout' and job_event.job_id = $1`, jobID)
-	err := row.Scan(&count)
-	if err != nil {
-		return 0, err
-	}
-	return count, err
+func GetClickoutCountForJob(conn *sql.DB, jobID int) (JobEventCount, error) {
+	return countJobEvents(conn, jobEventClickout, jobID)
 }
 
 func JobPostByCreatedAt(conn *sql.DB) ([]*JobPost, error) {
 	jobs := []*JobPost{}
 	var rows *sql.Rows
 	rows, err := conn.Query(
-		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id
 		FROM job
-		WHERE approved_at IS NOT NULL
+		WHERE status = 'approved'
 		ORDER BY created_at DESC`)
 	if err != nil {
 		return jobs, err
@@ -1068,7 +1003,7 @@ func JobPostByCreatedAt(conn *sql.DB) ([]*JobPost, error) {
 		job := &JobPost{}
 		var createdAt time.Time
 		var perks, interview, companyIcon sql.NullString
-		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID)
 		if companyIcon.Valid {
 			job.CompanyIconID = companyIcon.String
 		}
@@ -1094,13 +1029,18 @@ func JobPostByCreatedAt(conn *sql.DB) ([]*JobPost, error) {
 func JobPostBySlug(conn *sql.DB, slug string) (*JobPost, error) {
 	job := &JobPost{}
 	row := conn.QueryRow(
-		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, status, expires_at, remote_policy, remote_regions, timezone_from, timezone_to, COALESCE((SELECT c.slug FROM company c WHERE c.id = job.company_id), '')
 		FROM job
-		WHERE approved_at IS NOT NULL
+		WHERE status = 'approved'
 		AND slug = $1`, slug)
 	var createdAt time.Time
 	var perks, interview, companyIcon sql.NullString
-	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+	var expiresAt sql.NullTime
+	var timezoneFrom, timezoneTo sql.NullInt64
+	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &job.Status, &expiresAt, &job.RemotePolicy, pq.Array(&job.RemoteRegions), &timezoneFrom, &timezoneTo, &job.CompanySlug)
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
 	if companyIcon.Valid {
 		job.CompanyIconID = companyIcon.String
 	}
@@ -1113,19 +1053,29 @@ func JobPostBySlug(conn *sql.DB, slug string) (*JobPost, error) {
 	if interview.Valid {
 		job.InterviewProcess = interview.String
 	}
+	job.Timezone = timezoneWindowFromNull(timezoneFrom, timezoneTo)
 	job.TimeAgo = humanize.Time(createdAt.UTC())
-	return job, nil
+	if job.Locations, err = getJobLocations(conn, job.ID); err != nil {
+		return job, err
+	}
+	job.Skills, err = getJobSkills(conn, job.ID)
+	return job, err
 }
 
 func JobPostBySlugAdmin(conn *sql.DB, slug string) (*JobPost, error) {
 	job := &JobPost{}
 	row := conn.QueryRow(
-		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, status, expires_at, remote_policy, remote_regions, timezone_from, timezone_to, COALESCE((SELECT c.slug FROM company c WHERE c.id = job.company_id), '')
 		FROM job
 		WHERE slug = $1`, slug)
 	var createdAt time.Time
 	var perks, interview, companyIcon sql.NullString
-	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+	var expiresAt sql.NullTime
+	var timezoneFrom, timezoneTo sql.NullInt64
+	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &job.Status, &expiresAt, &job.RemotePolicy, pq.Array(&job.RemoteRegions), &timezoneFrom, &timezoneTo, &job.CompanySlug)
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
 	if companyIcon.Valid {
 		job.CompanyIconID = companyIcon.String
 	}
@@ -1138,21 +1088,31 @@ func JobPostBySlugAdmin(conn *sql.DB, slug string) (*JobPost, error) {
 	if interview.Valid {
 		job.InterviewProcess = interview.String
 	}
+	job.Timezone = timezoneWindowFromNull(timezoneFrom, timezoneTo)
 	job.TimeAgo = humanize.Time(createdAt.UTC())
-	return job, nil
+	if job.Locations, err = getJobLocations(conn, job.ID); err != nil {
+		return job, err
+	}
+	job.Skills, err = getJobSkills(conn, job.ID)
+	return job, err
 }
 
 func JobPostByIDForEdit(conn *sql.DB, jobID int) (*JobPostForEdit, error) {
-	job := &JobPostForEdit{}
+	job := &JobPostForEdit{ID: jobID}
 	row := conn.QueryRow(
-		`SELECT job_title, company, company_email, company_url, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, slug, approved_at, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT job_title, company, company_email, company_url, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, slug, approved_at, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, status, status_updated_at, expires_at, archived_at, COALESCE(archive_reason, ''), equity, COALESCE(equity_min, 0), COALESCE(equity_max, 0), remote_policy, remote_regions, timezone_from, timezone_to
 		FROM job
 		WHERE id = $1`, jobID)
 	var perks, interview, companyURL, companyIconID sql.NullString
-	err := row.Scan(&job.JobTitle, &job.Company, &job.CompanyEmail, &companyURL, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &job.CreatedAt, &job.Slug, &job.ApprovedAt, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIconID, &job.ExternalID)
+	var timezoneFrom, timezoneTo sql.NullInt64
+	err := row.Scan(&job.JobTitle, &job.Company, &job.CompanyEmail, &companyURL, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &job.CreatedAt, &job.Slug, &job.ApprovedAt, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIconID, &job.ExternalID, &job.Status, &job.StatusUpdatedAt, &job.ExpiresAt, &job.ArchivedAt, &job.ArchiveReason, &job.Equity, &job.EquityMin, &job.EquityMax, &job.RemotePolicy, pq.Array(&job.RemoteRegions), &timezoneFrom, &timezoneTo)
 	if err != nil {
 		return job, err
 	}
+	job.Timezone = timezoneWindowFromNull(timezoneFrom, timezoneTo)
+	if job.Skills, err = getJobSkills(conn, job.ID); err != nil {
+		return job, err
+	}
 	if companyIconID.Valid {
 		job.CompanyIconID = companyIconID.String
 	}
@@ -1173,14 +1133,19 @@ func JobPostByIDForEdit(conn *sql.DB, jobID int) (*JobPostForEdit, error) {
 func JobPostByExternalIDForEdit(conn *sql.DB, externalID string) (*JobPostForEdit, error) {
 	job := &JobPostForEdit{}
 	row := conn.QueryRow(
-		`SELECT id, job_title, company, company_email, company_url, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, slug, approved_at, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT id, job_title, company, company_email, company_url, salary_min, salary_max, salary_currency, location, description, perks, interview_process, how_to_apply, created_at, slug, approved_at, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, status, status_updated_at, expires_at, archived_at, COALESCE(archive_reason, ''), equity, COALESCE(equity_min, 0), COALESCE(equity_max, 0), remote_policy, remote_regions, timezone_from, timezone_to
 		FROM job
 		WHERE external_id = $1`, externalID)
 	var perks, interview, companyURL, companyIconID sql.NullString
-	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyEmail, &companyURL, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &job.CreatedAt, &job.Slug, &job.ApprovedAt, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIconID, &job.ExternalID)
+	var timezoneFrom, timezoneTo sql.NullInt64
+	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyEmail, &companyURL, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &job.CreatedAt, &job.Slug, &job.ApprovedAt, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIconID, &job.ExternalID, &job.Status, &job.StatusUpdatedAt, &job.ExpiresAt, &job.ArchivedAt, &job.ArchiveReason, &job.Equity, &job.EquityMin, &job.EquityMax, &job.RemotePolicy, pq.Array(&job.RemoteRegions), &timezoneFrom, &timezoneTo)
 	if err != nil {
 		return job, err
 	}
+	job.Timezone = timezoneWindowFromNull(timezoneFrom, timezoneTo)
+	if job.Skills, err = getJobSkills(conn, job.ID); err != nil {
+		return job, err
+	}
 	if companyIconID.Valid {
 		job.CompanyIconID = companyIconID.String
 	}
@@ -1201,13 +1166,13 @@ func JobPostByExternalIDForEdit(conn *sql.DB, externalID string) (*JobPostForEdi
 func JobPostByURLID(conn *sql.DB, URLID int64) (*JobPost, error) {
 	job := &JobPost{}
 	row := conn.QueryRow(
-		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
+		`SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id
 		FROM job
-		WHERE approved_at IS NOT NULL
+		WHERE status = 'approved'
 		AND url_id = $1`, URLID)
 	var createdAt time.Time
 	var perks, interview, companyIcon sql.NullString
-	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+	err := row.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID)
 	if err != nil {
 		return job, err
 	}
@@ -1224,52 +1189,12 @@ func JobPostByURLID(conn *sql.DB, URLID int64) (*JobPost, error) {
 	return job, nil
 }
 
-func DeleteJobCascade(conn *sql.DB, jobID int) error {
-	if _, err := conn.Exec(
-		`DELETE FROM image WHERE id IN (SELECT company_icon_image_id FROM job WHERE id = $1)`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	if _, err := conn.Exec(
-		`DELETE FROM edit_token WHERE job_id = $1`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	if _, err := conn.Exec(
-		`DELETE FROM apply_token WHERE job_id = $1`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	if _, err := conn.Exec(
-		`DELETE FROM job_event WHERE job_id = $1`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	if _, err := conn.Exec(
-		`DELETE FROM purchase_event WHERE job_id = $1`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	if _, err := conn.Exec(
-		`DELETE FROM job WHERE id = $1`,
-		jobID,
-	); err != nil {
-		return err
-	}
-	return nil
-}
-
 func GetPendingJobs(conn *sql.DB) ([]*JobPost, error) {
 	jobs := []*JobPost{}
 	var rows *sql.Rows
 	rows, err := conn.Query(`
-	SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-		FROM job WHERE approved_at IS NULL`)
+	SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id
+		FROM job WHERE status = 'pending'`)
 	if err == sql.ErrNoRows {
 		return jobs, nil
 	}
@@ -1281,7 +1206,7 @@ func GetPendingJobs(conn *sql.DB) ([]*JobPost, error) {
 		job := &JobPost{}
 		var createdAt time.Time
 		var perks, interview, companyIcon sql.NullString
-		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID)
 		if companyIcon.Valid {
 			job.CompanyIconID = companyIcon.String
 		}
@@ -1304,12 +1229,15 @@ func GetPendingJobs(conn *sql.DB) ([]*JobPost, error) {
 	return jobs, nil
 }
 
-func GetPinnedJobs(conn *sql.DB) ([]*JobPost, error) {
+// GetPinnedJobs returns the live pinned jobs ranked by the blend of signals
+// weighted by w
+func GetPinnedJobs(conn *sql.DB, w RankingWeights) ([]*JobPost, error) {
 	jobs := []*JobPost{}
 	var rows *sql.Rows
 	rows, err := conn.Query(`
-	SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-		FROM job WHERE approved_at IS NOT NULL AND ad_type IN (2, 3)`)
+	SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, ` + rankingSQL(w, `0`, time.Now()) + `
+		FROM job WHERE status = 'approved' AND ad_type IN (2, 3)
+		ORDER BY rank_score DESC, created_at DESC`)
 	if err != nil {
 		return jobs, err
 	}
@@ -1318,7 +1246,7 @@ func GetPinnedJobs(conn *sql.DB) ([]*JobPost, error) {
 		job := &JobPost{}
 		var createdAt time.Time
 		var perks, interview, companyIcon sql.NullString
-		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &job.Rank.Text, &job.Rank.Recency, &job.Rank.Quality, &job.Rank.Placement, &job.Rank.Score)
 		if companyIcon.Valid {
 			job.CompanyIconID = companyIcon.String
 		}
@@ -1341,47 +1269,6 @@ func GetPinnedJobs(conn *sql.DB) ([]*JobPost, error) {
 	return jobs, nil
 }
 
-func JobsByQuery(conn *sql.DB, location, tag string, pageId, jobsPerPage int) ([]*JobPost, int, error) {
-	jobs := []*JobPost{}
-	var rows *sql.Rows
-	offset := pageId*jobsPerPage - jobsPerPage
-	// replace `|` with white space
-	// remove double white spaces
-	// join with `|` for ps query
-	tag = strings.Join(strings.Fields(strings.ReplaceAll(tag, "|", " ")), "|")
-	rows, err := getQueryForArgs(conn, location, tag, offset, jobsPerPage)
-	if err != nil {
-		return jobs, 0, err
-	}
-	defer rows.Close()
-	var fullRowsCount int
-	for rows.Next() {
-		job := &JobPost{}
-		var createdAt time.Time
-		var perks, interview, companyIcon sql.NullString
-		err = rows.Scan(&fullRowsCount, &job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
-		if companyIcon.Valid {
-			job.CompanyIconID = companyIcon.String
-		}
-		if perks.Valid {
-			job.Perks = perks.String
-		}
-		if interview.Valid {
-			job.InterviewProcess = interview.String
-		}
-		job.TimeAgo = humanize.Time(createdAt.UTC())
-		if err != nil {
-			return jobs, fullRowsCount, err
-		}
-		jobs = append(jobs, job)
-	}
-	err = rows.Err()
-	if err != nil {
-		return jobs, fullRowsCount, err
-	}
-	return jobs, fullRowsCount, nil
-}
-
 func TokenByJobID(conn *sql.DB, jobID int) (string, error) {
 	tokenRow := conn.QueryRow(
 		`SELECT token
@@ -1413,48 +1300,6 @@ func SaveTokenForJob(conn *sql.DB, token string, jobID int) error {
 	return err
 }
 
-func getQueryForArgs(conn *sql.DB, location, tag string, offset, max int) (*sql.Rows, error) {
-	if tag == "" && location == "" {
-		return conn.Query(`
-		SELECT count(*) OVER() AS full_count, id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-		FROM job
-		WHERE approved_at IS NOT NULL
-		AND ad_type not in (2, 3)
-		ORDER BY created_at DESC LIMIT $2 OFFSET $1`, offset, max)
-	}
-	if tag == "" && location != "" {
-		return conn.Query(`
-		SELECT count(*) OVER() AS full_count, id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-		FROM job
-		WHERE approved_at IS NOT NULL
-		AND ad_type not in (2, 3)
-		AND location ILIKE '%' || $1 || '%'
-		ORDER BY created_at DESC LIMIT $3 OFFSET $2`, location, offset, max)
-	}
-	if tag != "" && location == "" {
-		return conn.Query(`
-	SELECT count(*) OVER() AS full_count, id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-	FROM
-	(
-		SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id, to_tsvector(job_title) || to_tsvector(company) || to_tsvector(description) AS doc
-		FROM job WHERE approved_at IS NOT NULL AND ad_type not in (2, 3)
-	) AS job_
-	WHERE job_.doc @@ to_tsquery($1)
-	ORDER BY ts_rank(job_.doc, to_tsquery($1)) DESC, created_at DESC LIMIT $3 OFFSET $2`, tag, offset, max)
-	}
-
-	return conn.Query(`
-	SELECT count(*) OVER() AS full_count, id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id
-	FROM
-	(
-		SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, company_icon_image_id, external_id, to_tsvector(job_title) || to_tsvector(company) || to_tsvector(description) AS doc
-		FROM job WHERE approved_at IS NOT NULL AND ad_type not in (2, 3)
-	) AS job_
-	WHERE job_.doc @@ to_tsquery($1)
-	AND location ILIKE '%' || $2 || '%'
-	ORDER BY ts_rank(job_.doc, to_tsquery($1)) DESC, created_at DESC LIMIT $4 OFFSET $3`, tag, location, offset, max)
-}
-
 func GetValue(conn *sql.DB, key string) (string, error) {
 	res := conn.QueryRow(`SELECT value FROM meta WHERE key = $1`, key)
 	var val string
@@ -1473,14 +1318,14 @@ func SetValue(conn *sql.DB, key, val string) error {
 func GetLastNJobs(conn *sql.DB, max int) ([]*JobPost, error) {
 	var jobs []*JobPost
 	var rows *sql.Rows
-	rows, err := conn.Query(`SELECT id, job_title, description, company, salary_range, location, slug, salary_currency, company_icon_image_id, external_id, approved_at  FROM job WHERE approved_at IS NOT NULL ORDER BY approved_at DESC LIMIT $1`, max)
+	rows, err := conn.Query(`SELECT id, job_title, description, company, salary_range, location, slug, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, approved_at  FROM job WHERE status = 'approved' ORDER BY approved_at DESC LIMIT $1`, max)
 	if err != nil {
 		return jobs, err
 	}
 	for rows.Next() {
 		job := &JobPost{}
 		var companyIcon sql.NullString
-		err := rows.Scan(&job.ID, &job.JobTitle, &job.JobDescription, &job.Company, &job.SalaryRange, &job.Location, &job.Slug, &job.SalaryCurrency, &companyIcon, &job.ExternalID, &job.ApprovedAt)
+		err := rows.Scan(&job.ID, &job.JobTitle, &job.JobDescription, &job.Company, &job.SalaryRange, &job.Location, &job.Slug, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &job.ApprovedAt)
 		if companyIcon.Valid {
 			job.CompanyIconID = companyIcon.String
 		}
@@ -1495,14 +1340,14 @@ func GetLastNJobs(conn *sql.DB, max int) ([]*JobPost, error) {
 func GetLastNJobsFromID(conn *sql.DB, max, jobID int) ([]*JobPost, error) {
 	var jobs []*JobPost
 	var rows *sql.Rows
-	rows, err := conn.Query(`SELECT id, job_title, company, salary_range, location, slug, salary_currency, company_icon_image_id, external_id  FROM job WHERE id > $1 AND approved_at IS NOT NULL LIMIT $2`, jobID, max)
+	rows, err := conn.Query(`SELECT id, job_title, company, salary_range, location, slug, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id  FROM job WHERE id > $1 AND status = 'approved' LIMIT $2`, jobID, max)
 	if err != nil {
 		return jobs, err
 	}
 	for rows.Next() {
 		job := &JobPost{}
 		var companyIcon sql.NullString
-		err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.SalaryRange, &job.Location, &job.Slug, &job.SalaryCurrency, &companyIcon, &job.ExternalID)
+		err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.SalaryRange, &job.Location, &job.Slug, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID)
 		if companyIcon.Valid {
 			job.CompanyIconID = companyIcon.String
 		}
@@ -1521,9 +1366,24 @@ func CleanupExpiredApplyTokens(conn *sql.DB) error {
 	return err
 }
 
+func JobIDByCompanyIconID(conn *sql.DB, mediaID string) (int, error) {
+	var jobID int
+	err := conn.QueryRow(`SELECT id FROM job WHERE company_icon_image_id = $1 ORDER BY id DESC LIMIT 1`, mediaID).Scan(&jobID)
+	return jobID, err
+}
+
 type Media struct {
 	Bytes     []byte
 	MediaType string
+	// SHA256 is the hex encoded hash of Bytes, set by the stores
+	SHA256 string
+}
+
+// MediaHash returns the hex encoded SHA-256 of media bytes, media is served
+// with it as ETag
+func MediaHash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
 }
 
 func SaveMedia(conn *sql.DB, media Media) (string, error) {
@@ -1531,7 +1391,7 @@ func SaveMedia(conn *sql.DB, media Media) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	_, err = conn.Exec(`INSERT INTO image (id, bytes, media_type) VALUES ($1, $2, $3)`, mediaID.String(), media.Bytes, media.MediaType)
+	_, err = conn.Exec(`INSERT INTO image (id, bytes, media_type, sha256) VALUES ($1, $2, $3, $4)`, mediaID.String(), media.Bytes, media.MediaType, MediaHash(media.Bytes))
 	if err != nil {
 		return "", err
 	}
@@ -1539,19 +1399,56 @@ func SaveMedia(conn *sql.DB, media Media) (string, error) {
 }
 
 func UpdateMedia(conn *sql.DB, media Media, mediaID string) error {
-	_, err := conn.Exec(`UPDATE image SET bytes = $1, media_type = $2 WHERE id = $3`, media.Bytes, media.MediaType, mediaID)
+	_, err := conn.Exec(`UPDATE image SET bytes = $1, media_type = $2, sha256 = $3 WHERE id = $4`, media.Bytes, media.MediaType, MediaHash(media.Bytes), mediaID)
+	return err
+}
+
+// PutMedia saves media under the given id, replacing the media already there
+func PutMedia(conn *sql.DB, mediaID string, media Media) error {
+	_, err := conn.Exec(`INSERT INTO image (id, bytes, media_type, sha256) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id) DO UPDATE SET bytes = EXCLUDED.bytes, media_type = EXCLUDED.media_type, sha256 = EXCLUDED.sha256`, mediaID, media.Bytes, media.MediaType, MediaHash(media.Bytes))
 	return err
 }
 
 func GetMediaByID(conn *sql.DB, mediaID string) (Media, error) {
 	var m Media
 	row := conn.QueryRow(
-		`SELECT bytes, media_type 
+		`SELECT bytes, media_type, sha256
 		FROM image
 		WHERE id = $1`, mediaID)
-	err := row.Scan(&m.Bytes, &m.MediaType)
+	err := row.Scan(&m.Bytes, &m.MediaType, &m.SHA256)
 	if err != nil {
 		return Media{}, err
 	}
 	return m, nil
 }
+
+// GetMediaHash returns the SHA256 of media without loading its bytes
+func GetMediaHash(conn *sql.DB, mediaID string) (string, error) {
+	var hash string
+	err := conn.QueryRow(`SELECT sha256 FROM image WHERE id = $1`, mediaID).Scan(&hash)
+	return hash, err
+}
+
+func DeleteMedia(conn *sql.DB, mediaID string) error {
+	_, err := conn.Exec(`DELETE FROM image WHERE id = $1`, mediaID)
+	return err
+}
+
+// GetMediaIDs returns the ids of every media, in the order they were saved
+func GetMediaIDs(conn *sql.DB) ([]string, error) {
+	var ids []string
+	rows, err := conn.Query(`SELECT id FROM image ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobEvent is a page view or clickout of a job
+type JobEvent struct {
+	Type      string
+	JobID     int
+	Visitor   JobVisitor
+	CreatedAt time.Time
+}
+
+// SaveJobEvents inserts a batch of events in one statement, events of jobs
+// purged in the meantime are skipped
+func SaveJobEvents(conn *sql.DB, events []JobEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	types := make([]string, len(events))
+	jobIDs := make([]int64, len(events))
+	createdAt := make([]string, len(events))
+	visitors := make([]string, len(events))
+	bots := make([]bool, len(events))
+	countries := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+		jobIDs[i] = int64(e.JobID)
+		createdAt[i] = e.CreatedAt.UTC().Format(sqlTimestampFormat)
+		visitors[i] = e.Visitor.Hash
+		bots[i] = e.Visitor.Bot
+		countries[i] = e.Visitor.Country
+	}
+	_, err := conn.Exec(`
+	INSERT INTO job_event (event_type, job_id, created_at, visitor_hash, is_bot, country)
+	SELECT e.event_type, e.job_id, e.created_at, NULLIF(e.visitor_hash, ''), e.is_bot, NULLIF(e.country, '')
+	FROM unnest($1::text[], $2::integer[], $3::timestamp[], $4::text[], $5::boolean[], $6::text[]) AS e(event_type, job_id, created_at, visitor_hash, is_bot, country)
+	WHERE EXISTS (SELECT 1 FROM job WHERE job.id = e.job_id)`, pq.StringArray(types), pq.Int64Array(jobIDs), pq.StringArray(createdAt), pq.StringArray(visitors), pq.BoolArray(bots), pq.StringArray(countries))
+	return err
+}
+
+// EventIngesterStats counts the events handled by an ingester since it
+// started. Dropped events arrived while the buffer was full, failed ones were
+// in a batch that could not be saved
+type EventIngesterStats struct {
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"`
+	Saved    int64 `json:"saved"`
+	Failed   int64 `json:"failed"`
+	Pending  int   `json:"pending"`
+}
+
+// EventIngester tracks job events off the request path: they are buffered
+// and saved in batches when the batch is full or every interval, whichever
+// comes first. Reads go straight to the underlying store
+type EventIngester struct {
+	EventStore
+	saver     func([]JobEvent) error
+	onError   func(error)
+	events    chan JobEvent
+	batchSize int
+	interval  time.Duration
+	mu        sync.RWMutex
+	closed    bool
+	done      chan struct{}
+	enqueued  int64
+	dropped   int64
+	saved     int64
+	failed    int64
+}
+
+// NewEventIngester starts an ingester saving the events of s, at most
+// bufferSize events wait to be saved, onError is called with the errors of
+// the batches that could not be
+func NewEventIngester(s EventStore, bufferSize, batchSize int, interval time.Duration, onError func(error)) *EventIngester {
+	i := &EventIngester{
+		EventStore: s,
+		saver:      s.SaveJobEvents,
+		onError:    onError,
+		events:     make(chan JobEvent, bufferSize),
+		batchSize:  batchSize,
+		interval:   interval,
+		done:       make(chan struct{}),
+	}
+	go i.run()
+	return i
+}
+
+func (i *EventIngester) TrackJobView(job *JobPost, v JobVisitor) error {
+	i.enqueue(JobEvent{Type: jobEventPageView, JobID: job.ID, Visitor: v, CreatedAt: time.Now()})
+	return nil
+}
+
+func (i *EventIngester) TrackJobClickout(jobID int, v JobVisitor) error {
+	i.enqueue(JobEvent{Type: jobEventClickout, JobID: jobID, Visitor: v, CreatedAt: time.Now()})
+	return nil
+}
+
+// SaveJobEvents queues events to be saved with the next batch
+func (i *EventIngester) SaveJobEvents(events []JobEvent) error {
+	for _, e := range events {
+		i.enqueue(e)
+	}
+	return nil
+}
+
+// enqueue never blocks, events are dropped when the buffer is full or the
+// ingester is closed
+func (i *EventIngester) enqueue(e JobEvent) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.closed {
+		atomic.AddInt64(&i.dropped, 1)
+		return
+	}
+	select {
+	case i.events <- e:
+		atomic.AddInt64(&i.enqueued, 1)
+	default:
+		atomic.AddInt64(&i.dropped, 1)
+	}
+}
+
+func (i *EventIngester) run() {
+	defer close(i.done)
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	batch := make([]JobEvent, 0, i.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := i.saver(batch); err != nil {
+			atomic.AddInt64(&i.failed, int64(len(batch)))
+			if i.onError != nil {
+				i.onError(err)
+			}
+		} else {
+			atomic.AddInt64(&i.saved, int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-i.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= i.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close stops accepting events and returns once the buffered ones are saved
+func (i *EventIngester) Close() {
+	i.mu.Lock()
+	if !i.closed {
+		i.closed = true
+		close(i.events)
+	}
+	i.mu.Unlock()
+	<-i.done
+}
+
+func (i *EventIngester) Stats() EventIngesterStats {
+	return EventIngesterStats{
+		Enqueued: atomic.LoadInt64(&i.enqueued),
+		Dropped:  atomic.LoadInt64(&i.dropped),
+		Saved:    atomic.LoadInt64(&i.saved),
+		Failed:   atomic.LoadInt64(&i.failed),
+		Pending:  len(i.events),
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExchangeRateBaseCurrency is the currency every rate is quoted against
+const ExchangeRateBaseCurrency = "USD"
+
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// ExchangeRate is the number of CurrencyCode units one USD buys from
+// EffectiveDate until the next rate for the same currency
+type ExchangeRate struct {
+	CurrencyCode  string
+	Rate          float64
+	EffectiveDate time.Time
+}
+
+// ExchangeRates converts amounts between currencies using the rate in
+// effect on a given date
+type ExchangeRates struct {
+	byCurrency map[string][]ExchangeRate
+}
+
+func NewExchangeRates(rates []ExchangeRate) ExchangeRates {
+	byCurrency := make(map[string][]ExchangeRate)
+	for _, r := range rates {
+		byCurrency[r.CurrencyCode] = append(byCurrency[r.CurrencyCode], r)
+	}
+	for _, rs := range byCurrency {
+		sort.Slice(rs, func(i, j int) bool {
+			return rs[i].EffectiveDate.Before(rs[j].EffectiveDate)
+		})
+	}
+	return ExchangeRates{byCurrency: byCurrency}
+}
+
+// rateAt returns the rate in effect on the given date, dates before the
+// first known rate use that one
+func (e ExchangeRates) rateAt(currencyCode string, at time.Time) (float64, error) {
+	if currencyCode == ExchangeRateBaseCurrency {
+		return 1, nil
+	}
+	rs := e.byCurrency[currencyCode]
+	if len(rs) == 0 {
+		return 0, fmt.Errorf("%w for %s", ErrNoExchangeRate, currencyCode)
+	}
+	i := sort.Search(len(rs), func(i int) bool {
+		return rs[i].EffectiveDate.After(at)
+	})
+	if i == 0 {
+		return rs[0].Rate, nil
+	}
+	return rs[i-1].Rate, nil
+}
+
+// Convert converts an amount from one ISO 4217 currency to another at the
+// rates in effect on the given date
+func (e ExchangeRates) Convert(amount float64, from, to string, at time.Time) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, err := e.rateAt(from, at)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := e.rateAt(to, at)
+	if err != nil {
+		return 0, err
+	}
+	return amount / fromRate * toRate, nil
+}
+
+// SaveExchangeRates inserts rates, replacing existing ones for the same
+// currency and effective date
+func SaveExchangeRates(conn *sql.DB, rates []ExchangeRate) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range rates {
+		_, err := tx.Exec(
+			`INSERT INTO exchange_rate (currency_code, rate, effective_date, created_at) VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (currency_code, effective_date) DO UPDATE SET rate = EXCLUDED.rate, created_at = NOW()`,
+			r.CurrencyCode,
+			r.Rate,
+			r.EffectiveDate,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func GetExchangeRates(conn *sql.DB) ([]ExchangeRate, error) {
+	var rates []ExchangeRate
+	rows, err := conn.Query(`SELECT currency_code, rate, effective_date FROM exchange_rate ORDER BY currency_code, effective_date`)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ExchangeRate
+		if err := rows.Scan(&r.CurrencyCode, &r.Rate, &r.EffectiveDate); err != nil {
+			return rates, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// NormalizeSalaries converts salary samples to a single currency at the rate
+// in effect when each job was posted. Samples in currencies without a rate
+// are skipped and counted
+func (e ExchangeRates) NormalizeSalaries(samples []SalarySample, currencyCode string) ([]SalarySample, int) {
+	var res []SalarySample
+	skipped := 0
+	for _, s := range samples {
+		min, err := e.Convert(float64(s.Min), s.CurrencyCode, currencyCode, s.CreatedAt)
+		if err != nil {
+			skipped++
+			continue
+		}
+		max, err := e.Convert(float64(s.Max), s.CurrencyCode, currencyCode, s.CreatedAt)
+		if err != nil {
+			skipped++
+			continue
+		}
+		res = append(res, SalarySample{Min: int64(min + 0.5), Max: int64(max + 0.5), CurrencyCode: currencyCode, CreatedAt: s.CreatedAt})
+	}
+	return res, skipped
+}
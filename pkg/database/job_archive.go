@@ -0,0 +1,196 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type JobArchiveRq struct {
+	Token  string `json:"token"`
+	Reason string `json:"reason"`
+}
+
+type ArchivedJob struct {
+	ID            int
+	JobTitle      string
+	Company       string
+	Slug          string
+	Token         string
+	ArchivedAt    time.Time
+	ArchiveReason string
+}
+
+// ArchiveJob takes a job off the site without deleting anything. The status
+// it had is kept in the transition log so RestoreJob can put it back
+func ArchiveJob(conn *sql.DB, jobID int, reason, actor string) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	var from JobStatus
+	if err := tx.QueryRow(`SELECT status FROM job WHERE id = $1 FOR UPDATE`, jobID).Scan(&from); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if from == JobStatusArchived {
+		tx.Rollback()
+		return fmt.Errorf("%w: job id %d is already archived", ErrInvalidJobStatusTransition, jobID)
+	}
+	if _, err := tx.Exec(
+		`UPDATE job SET status = $1, status_updated_at = NOW(), archived_at = NOW(), archive_reason = $2 WHERE id = $3`,
+		JobStatusArchived,
+		reason,
+		jobID,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertJobStatusTransitionTx(tx, jobID, from, JobStatusArchived, actor); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreJob moves an archived job back to the status it had before being
+// archived and returns it
+func RestoreJob(conn *sql.DB, jobID int, actor string) (JobStatus, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return "", err
+	}
+	var status JobStatus
+	if err := tx.QueryRow(`SELECT status FROM job WHERE id = $1 FOR UPDATE`, jobID).Scan(&status); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if status != JobStatusArchived {
+		tx.Rollback()
+		return "", fmt.Errorf("%w: job id %d is not archived", ErrInvalidJobStatusTransition, jobID)
+	}
+	to := JobStatusPending
+	err = tx.QueryRow(
+		`SELECT from_status FROM job_status_transition WHERE job_id = $1 AND to_status = $2 ORDER BY id DESC LIMIT 1`,
+		jobID,
+		JobStatusArchived,
+	).Scan(&to)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return "", err
+	}
+	if _, err := tx.Exec(
+		`UPDATE job SET status = $1, status_updated_at = NOW(), archived_at = NULL, archive_reason = NULL WHERE id = $2`,
+		to,
+		jobID,
+	); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if err := insertJobStatusTransitionTx(tx, jobID, JobStatusArchived, to, actor); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return to, tx.Commit()
+}
+
+func GetArchivedJobs(conn *sql.DB) ([]ArchivedJob, error) {
+	var jobs []ArchivedJob
+	rows, err := conn.Query(`
+	SELECT j.id, j.job_title, j.company, j.slug, COALESCE(t.token, ''), j.archived_at, COALESCE(j.archive_reason, '')
+	FROM job j
+	LEFT JOIN edit_token t ON t.job_id = j.id
+	WHERE j.status = 'archived'
+	ORDER BY j.archived_at DESC`)
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var j ArchivedJob
+		if err := rows.Scan(&j.ID, &j.JobTitle, &j.Company, &j.Slug, &j.Token, &j.ArchivedAt, &j.ArchiveReason); err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJobsToPurge returns the ids of jobs archived before the given time
+func GetJobsToPurge(conn *sql.DB, before time.Time) ([]int, error) {
+	var ids []int
+	rows, err := conn.Query(`SELECT id FROM job WHERE status = 'archived' AND archived_at < $1`, before)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PurgeJob permanently deletes an archived job and all its child rows
+// (edit and apply tokens, events, purchases, status transitions, revisions,
+// locations, skills and the meta image record) in a single transaction,
+// recording it in the audit log. Its logo and meta image are left to the
+// caller to delete from the MediaStore
+func PurgeJob(conn *sql.DB, jobID int, actor string) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	var status JobStatus
+	var jobTitle, company, slug, reason string
+	if err := tx.QueryRow(
+		`SELECT status, job_title, company, slug, COALESCE(archive_reason, '') FROM job WHERE id = $1 FOR UPDATE`,
+		jobID,
+	).Scan(&status, &jobTitle, &company, &slug, &reason); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if status != JobStatusArchived {
+		tx.Rollback()
+		return fmt.Errorf("%w: cannot purge %s job id %d", ErrInvalidJobStatusTransition, status, jobID)
+	}
+	stmts := []string{
+		`UPDATE company SET icon_image_id = NULL WHERE icon_image_id IN (SELECT company_icon_image_id FROM job WHERE id = $1)`,
+		`DELETE FROM edit_token WHERE job_id = $1`,
+		`DELETE FROM apply_token WHERE job_id = $1`,
+		`DELETE FROM job_event WHERE job_id = $1`,
+		`DELETE FROM job_stats_daily WHERE job_id = $1`,
+		`DELETE FROM purchase_event WHERE job_id = $1`,
+		`DELETE FROM job_status_transition WHERE job_id = $1`,
+		`DELETE FROM job_revision WHERE job_id = $1`,
+		`DELETE FROM job_location WHERE job_id = $1`,
+		`DELETE FROM job_skill WHERE job_id = $1`,
+		`DELETE FROM meta_image WHERE key = (SELECT 'job/' || external_id FROM job WHERE id = $1)`,
+		`DELETE FROM job WHERE id = $1`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, jobID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err = recordAuditEvent(tx, AuditEvent{
+		Actor:  actor,
+		Action: AuditActionJobPurge,
+		JobID:  jobID,
+		Diff: AuditDiff{}.
+			Add("status", status, nil).
+			Add("job_title", jobTitle, nil).
+			Add("company", company, nil).
+			Add("slug", slug, nil).
+			Add("archive_reason", reason, nil),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
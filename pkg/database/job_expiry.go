@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// SetJobExpiry sets when a live job expires and resets the expiry warning
+func SetJobExpiry(conn *sql.DB, jobID int, expiresAt time.Time) error {
+	_, err := conn.Exec(`UPDATE job SET expires_at = $1, expiry_warning_sent_at = NULL WHERE id = $2`, expiresAt, jobID)
+	return err
+}
+
+// RenewJob extends a live, paused or expired job until expiresAt. Expired
+// jobs go back to approved
+func RenewJob(conn *sql.DB, jobID int, expiresAt time.Time, actor string) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	var status JobStatus
+	if err := tx.QueryRow(`SELECT status FROM job WHERE id = $1 FOR UPDATE`, jobID).Scan(&status); err != nil {
+		tx.Rollback()
+		return err
+	}
+	switch status {
+	case JobStatusApproved, JobStatusPaused:
+	case JobStatusExpired:
+		if err := transitionJobStatusTx(tx, jobID, status, JobStatusApproved, actor); err != nil {
+			tx.Rollback()
+			return err
+		}
+	default:
+		tx.Rollback()
+		return fmt.Errorf("%w: cannot renew %s job id %d", ErrInvalidJobStatusTransition, status, jobID)
+	}
+	if _, err := tx.Exec(`UPDATE job SET expires_at = $1, expiry_warning_sent_at = NULL WHERE id = $2`, expiresAt, jobID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ScheduleMissingJobExpiry gives live jobs without an expiry date one, counted
+// from their approval
+func ScheduleMissingJobExpiry(conn *sql.DB, expiryDays int) (int, error) {
+	res := conn.QueryRow(`WITH rows AS (UPDATE job SET expires_at = approved_at + $1 * INTERVAL '1 day' WHERE status IN ('approved', 'paused') AND expires_at IS NULL AND approved_at IS NOT NULL RETURNING 1) SELECT count(*) as c FROM rows;`, expiryDays)
+	var affected int
+	err := res.Scan(&affected)
+	return affected, err
+}
+
+func getJobsForExpiry(conn *sql.DB, query string, args ...interface{}) ([]JobPost, error) {
+	var jobs []JobPost
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var job JobPost
+		var expiresAt time.Time
+		if err := rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyEmail, &job.Slug, &job.Status, &expiresAt); err != nil {
+			return jobs, err
+		}
+		job.ExpiresAt = &expiresAt
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJobsToWarnBeforeExpiry returns live jobs expiring before the given time
+// that have not been warned yet
+func GetJobsToWarnBeforeExpiry(conn *sql.DB, before time.Time) ([]JobPost, error) {
+	return getJobsForExpiry(
+		conn,
+		`SELECT id, job_title, company, company_email, slug, status, expires_at FROM job WHERE status IN ('approved', 'paused') AND expires_at > NOW() AND expires_at <= $1 AND expiry_warning_sent_at IS NULL`,
+		before,
+	)
+}
+
+func MarkJobExpiryWarningSent(conn *sql.DB, jobID int) error {
+	_, err := conn.Exec(`UPDATE job SET expiry_warning_sent_at = NOW() WHERE id = $1`, jobID)
+	return err
+}
+
+// GetJobsToExpire returns live or paused jobs past their expiry date
+func GetJobsToExpire(conn *sql.DB) ([]JobPost, error) {
+	return getJobsForExpiry(
+		conn,
+		`SELECT id, job_title, company, company_email, slug, status, expires_at FROM job WHERE status IN ('approved', 'paused') AND expires_at <= NOW()`,
+	)
+}
+
+var similarJobsWordRe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// similarJobsQuery turns a job title into an OR tsquery, e.g. "Senior Go
+// Engineer" becomes "senior|go|engineer"
+func similarJobsQuery(title string) string {
+	return strings.Join(strings.Fields(similarJobsWordRe.ReplaceAllString(strings.ToLower(title), " ")), "|")
+}
+
+// GetSimilarLiveJobs returns live jobs that best match the title of the given
+// job, most recent first when nothing matches
+func GetSimilarLiveJobs(conn *sql.DB, job *JobPost, max int) ([]*JobPost, error) {
+	jobs := []*JobPost{}
+	var rows *sql.Rows
+	var err error
+	tag := similarJobsQuery(job.JobTitle)
+	if tag == "" {
+		rows, err = conn.Query(`
+		SELECT id, job_title, company, salary_range, location, slug, created_at, company_icon_image_id, external_id
+		FROM job
+		WHERE status = 'approved' AND id <> $1
+		ORDER BY created_at DESC LIMIT $2`, job.ID, max)
+	} else {
+		rows, err = conn.Query(`
+		SELECT id, job_title, company, salary_range, location, slug, created_at, company_icon_image_id, external_id
+		FROM job
+		WHERE status = 'approved' AND id <> $1
+		ORDER BY ts_rank(search_doc, to_tsquery('english', $3)) DESC, created_at DESC LIMIT $2`, job.ID, max, tag)
+	}
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		j := &JobPost{}
+		var createdAt time.Time
+		var companyIcon sql.NullString
+		if err := rows.Scan(&j.ID, &j.JobTitle, &j.Company, &j.SalaryRange, &j.Location, &j.Slug, &createdAt, &companyIcon, &j.ExternalID); err != nil {
+			return jobs, err
+		}
+		if companyIcon.Valid {
+			j.CompanyIconID = companyIcon.String
+		}
+		j.TimeAgo = humanize.Time(createdAt.UTC())
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func InitiateRenewalPaymentEvent(conn *sql.DB, sessionID string, amount int64, currency string, description string, email string, jobID int) error {
+	stmt := `INSERT INTO purchase_event (stripe_session_id, amount, currency, description, ad_type, email, job_id, created_at, renewal) SELECT $1, $2, $3, $4, ad_type, $5, id, NOW(), TRUE FROM job WHERE id = $6`
+	_, err := conn.Exec(stmt, sessionID, amount, currency, description, email, jobID)
+	return err
+}
@@ -0,0 +1,550 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// URL parameters of the job filters, facet links toggle them on landing
+// page URLs
+const (
+	JobFilterParamSalary     = "salary"
+	JobFilterParamCurrency   = "currency"
+	JobFilterParamRemote     = "remote"
+	JobFilterParamPosted     = "posted"
+	JobFilterParamQuickApply = "quick_apply"
+	JobFilterParamSponsored  = "sponsored"
+	JobFilterParamCompany    = "company"
+	JobFilterParamSkill      = "skill"
+)
+
+// JobFilter narrows down live jobs. Query is a web search, or a skill when it
+// names one. SalaryMin is a yearly amount in SalaryCurrencyCode, which
+// defaults to USD, jobs paying up to at least that much match. PostedWithin
+// is a number of days, Company the slug of a company and Skills the slugs
+// of skills jobs must all be tagged with
+type JobFilter struct {
+	Location           string
+	Query              string
+	SalaryMin          int
+	SalaryCurrencyCode string
+	RemotePolicy       RemotePolicy
+	PostedWithin       int
+	QuickApply         bool
+	Sponsored          bool
+	Company            string
+	Skills             []string
+}
+
+// jobFacetSalaries are the yearly salary floors offered as refinements
+var jobFacetSalaries = []int{50000, 80000, 100000, 120000, 150000, 200000}
+
+// jobFacetPostedWithin are the recency refinements, in days
+var jobFacetPostedWithin = []int{1, 7, 14, 30}
+
+// jobFacetMaxValues caps the companies and skills offered as refinements
+const jobFacetMaxValues = 10
+
+// quickApplyPattern matches the how to apply of jobs applied to through the
+// site, it is the email validation used when rendering job listings
+const quickApplyPattern = "^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"
+
+var quickApplyRe = regexp.MustCompile(quickApplyPattern)
+
+// ParseJobFilter reads the refinements of a landing page URL, invalid values
+// are ignored. Location and Query come from the landing page itself
+func ParseJobFilter(v url.Values) JobFilter {
+	var f JobFilter
+	if min, err := strconv.Atoi(v.Get(JobFilterParamSalary)); err == nil && min > 0 {
+		f.SalaryMin = min
+	}
+	if code := strings.ToUpper(v.Get(JobFilterParamCurrency)); IsSalaryCurrencyCode(code) {
+		f.SalaryCurrencyCode = code
+	}
+	if p := RemotePolicy(v.Get(JobFilterParamRemote)); p.Valid() {
+		f.RemotePolicy = p
+	}
+	if days, err := strconv.Atoi(v.Get(JobFilterParamPosted)); err == nil && days > 0 {
+		f.PostedWithin = days
+	}
+	f.QuickApply = v.Get(JobFilterParamQuickApply) == "1"
+	f.Sponsored = v.Get(JobFilterParamSponsored) == "1"
+	f.Company = strings.ToLower(strings.TrimSpace(v.Get(JobFilterParamCompany)))
+	for _, slug := range v[JobFilterParamSkill] {
+		if _, ok := SkillBySlug(slug); ok && !hasSkill(f.Skills, slug) {
+			f.Skills = append(f.Skills, slug)
+		}
+	}
+	return f
+}
+
+// Values returns the refinements of the filter as URL parameters, skills
+// are in taxonomy order so that a set of refinements has a single URL
+func (f JobFilter) Values() url.Values {
+	v := url.Values{}
+	if f.SalaryMin > 0 {
+		v.Set(JobFilterParamSalary, strconv.Itoa(f.SalaryMin))
+		if f.SalaryCurrencyCode != "" && f.SalaryCurrencyCode != defaultSalaryCurrencyCode {
+			v.Set(JobFilterParamCurrency, f.SalaryCurrencyCode)
+		}
+	}
+	if f.RemotePolicy != "" {
+		v.Set(JobFilterParamRemote, string(f.RemotePolicy))
+	}
+	if f.PostedWithin > 0 {
+		v.Set(JobFilterParamPosted, strconv.Itoa(f.PostedWithin))
+	}
+	if f.QuickApply {
+		v.Set(JobFilterParamQuickApply, "1")
+	}
+	if f.Sponsored {
+		v.Set(JobFilterParamSponsored, "1")
+	}
+	if f.Company != "" {
+		v.Set(JobFilterParamCompany, f.Company)
+	}
+	skills := append([]string{}, f.Skills...)
+	sort.Slice(skills, func(i, j int) bool { return skillIndex(skills[i]) < skillIndex(skills[j]) })
+	for _, s := range skills {
+		v.Add(JobFilterParamSkill, s)
+	}
+	return v
+}
+
+// Key identifies the jobs the filter matches, filters differing only in
+// spelling, like a query naming a skill and the matching skill refinement,
+// have the same key
+func (f JobFilter) Key() string {
+	f = f.normalize()
+	v := f.Values()
+	v.Set("l", f.Location)
+	v.Set("q", strings.ToLower(f.Query))
+	return v.Encode()
+}
+
+// IsRefined reports whether any refinement is applied on top of the location
+// and query
+func (f JobFilter) IsRefined() bool {
+	return len(f.Values()) > 0
+}
+
+// Refine toggles a refinement: a value already applied is removed, any
+// other replaces the value of its parameter or, for skills, is added
+func (f JobFilter) Refine(param, value string) JobFilter {
+	if param == JobFilterParamSkill {
+		skills := make([]string, 0, len(f.Skills)+1)
+		for _, s := range f.Skills {
+			if s != value {
+				skills = append(skills, s)
+			}
+		}
+		if len(skills) == len(f.Skills) {
+			skills = append(skills, value)
+		}
+		f.Skills = skills
+		return f
+	}
+	v := f.Values()
+	if v.Get(param) == value {
+		v.Del(param)
+	} else {
+		v.Set(param, value)
+	}
+	refined := ParseJobFilter(v)
+	refined.Location, refined.Query = f.Location, f.Query
+	if param == JobFilterParamSalary {
+		refined.SalaryCurrencyCode = f.SalaryCurrencyCode
+	}
+	return refined
+}
+
+// without drops the refinement of a parameter, facet counts of a dimension
+// ignore the value picked for it
+func (f JobFilter) without(param string) JobFilter {
+	switch param {
+	case JobFilterParamSalary:
+		f.SalaryMin = 0
+	case JobFilterParamRemote:
+		f.RemotePolicy = ""
+	case JobFilterParamPosted:
+		f.PostedWithin = 0
+	case JobFilterParamQuickApply:
+		f.QuickApply = false
+	case JobFilterParamSponsored:
+		f.Sponsored = false
+	case JobFilterParamCompany:
+		f.Company = ""
+	}
+	return f
+}
+
+// normalize turns a query naming a skill into a skill refinement, matching
+// the skill landing pages, and defaults the salary currency
+func (f JobFilter) normalize() JobFilter {
+	f.Location = strings.TrimSpace(f.Location)
+	f.Query = strings.TrimSpace(f.Query)
+	if skill, ok := SkillByName(f.Query); ok && !IsWebSearchQuery(f.Query) {
+		f.Query = ""
+		if !hasSkill(f.Skills, skill.Slug) {
+			f.Skills = append(append([]string{}, f.Skills...), skill.Slug)
+		}
+	}
+	if f.SalaryCurrencyCode == "" {
+		f.SalaryCurrencyCode = defaultSalaryCurrencyCode
+	}
+	return f
+}
+
+// exchangeRateSQL returns the latest rate of a currency against USD, NULL
+// when there is none
+func exchangeRateSQL(currencyCode string) string {
+	return fmt.Sprintf(`(CASE WHEN %s = '%s' THEN 1 ELSE (SELECT r.rate FROM exchange_rate r WHERE r.currency_code = %s AND r.effective_date <= NOW() ORDER BY r.effective_date DESC LIMIT 1) END)`, currencyCode, ExchangeRateBaseCurrency, currencyCode)
+}
+
+// jobSalarySQL is the yearly maximum salary of a job converted to the
+// currency bound to the given placeholder, it mirrors jobSalaryIn
+func jobSalarySQL(param int) string {
+	return fmt.Sprintf(`(%s / %s * %s)`, annualSalarySQL("salary_max"), exchangeRateSQL("salary_currency_code"), exchangeRateSQL(fmt.Sprintf("$%d::text", param)))
+}
+
+// jobSalaryIn is the yearly maximum salary of a job converted to a currency
+// at the latest rates, ok is false when the salary is not disclosed or
+// cannot be converted
+func jobSalaryIn(j JobPostForEdit, currencyCode string, rates ExchangeRates) (float64, bool) {
+	if j.SalaryUndisclosed {
+		return 0, false
+	}
+	salary, err := rates.Convert(float64(j.SalaryPeriod.Annualize(j.SalaryMax)), j.SalaryCurrencyCode, currencyCode, time.Now())
+	return salary, err == nil
+}
+
+// jobFilterWhere returns the tables and condition matching live jobs for the
+// filter, and their arguments. When the filter has a query it is the first
+// argument and the tables include it as `query`
+func jobFilterWhere(f JobFilter) (string, string, []interface{}) {
+	from := "job"
+	where := []string{`status = 'approved'`, `ad_type not in (2, 3)`}
+	var args []interface{}
+	if f.Query != "" {
+		args = append(args, f.Query)
+		from = `job, ` + jobSearchQuery + ` AS query`
+		where = append(where, `search_doc @@ query`)
+	}
+	if f.Location != "" {
+		locationFilter, locationArg := jobLocationFilter(f.Location, len(args)+1)
+		args = append(args, locationArg)
+		where = append(where, locationFilter)
+	}
+	if f.SalaryMin > 0 {
+		args = append(args, f.SalaryCurrencyCode, f.SalaryMin)
+		where = append(where, fmt.Sprintf(`salary_undisclosed = FALSE AND %s >= $%d`, jobSalarySQL(len(args)-1), len(args)))
+	}
+	if f.RemotePolicy != "" {
+		args = append(args, string(f.RemotePolicy))
+		where = append(where, fmt.Sprintf(`remote_policy = $%d`, len(args)))
+	}
+	if f.PostedWithin > 0 {
+		args = append(args, f.PostedWithin)
+		where = append(where, fmt.Sprintf(`created_at >= NOW() - $%d::integer * INTERVAL '1 day'`, len(args)))
+	}
+	if f.QuickApply {
+		args = append(args, quickApplyPattern)
+		where = append(where, fmt.Sprintf(`how_to_apply ~ $%d`, len(args)))
+	}
+	if f.Sponsored {
+		where = append(where, fmt.Sprintf(`ad_type = %d`, JobAdSponsoredBackground))
+	}
+	if f.Company != "" {
+		args = append(args, f.Company)
+		where = append(where, fmt.Sprintf(`company_id = (SELECT c.id FROM company c WHERE c.slug = $%d)`, len(args)))
+	}
+	for _, s := range f.Skills {
+		args = append(args, s)
+		where = append(where, fmt.Sprintf(`EXISTS (SELECT 1 FROM job_skill s WHERE s.job_id = job.id AND s.skill = $%d)`, len(args)))
+	}
+	return from, strings.Join(where, " AND "), args
+}
+
+// JobsByQuery returns up to limit live jobs matching the filter after the
+// cursor, ranked as of its time by the blend of signals weighted by w, and
+// the cursor of the last one. The returned cursor starts the listing over
+// when there are no more jobs. Searches come with a highlighted snippet of
+// the description
+func JobsByQuery(conn *sql.DB, f JobFilter, w RankingWeights, after JobCursor, limit int) ([]*JobPost, JobCursor, error) {
+	jobs := []*JobPost{}
+	f = f.normalize()
+	asOf := after.asOf()
+	from, where, args := jobFilterWhere(f)
+	text, headline, outerFrom := `0`, `''`, `AS job_`
+	if f.Query != "" {
+		// the headline is only computed for the jobs returned
+		text, headline, outerFrom = `ts_rank(search_doc, query, 32)`, jobSearchHeadline, `AS job_, `+jobSearchQuery+` AS query`
+	}
+	cursorWhere := `TRUE`
+	if !after.IsStart() {
+		var cursorArgs []interface{}
+		cursorWhere, cursorArgs = jobCursorWhere(after, len(args)+1)
+		args = append(args, cursorArgs...)
+	}
+	// one more job than asked tells whether there are more
+	args = append(args, limit+1)
+	rows, err := conn.Query(fmt.Sprintf(`
+	SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, %s, %s
+	FROM
+	(
+		SELECT * FROM
+		(
+			SELECT id, job_title, company, company_url, salary_range, location, description, perks, interview_process, how_to_apply, created_at, url_id, slug, ad_type, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, company_icon_image_id, external_id, %s
+			FROM %s
+			WHERE %s
+		) AS ranked
+		WHERE %s
+		ORDER BY %s LIMIT $%d
+	) %s
+	ORDER BY %s`, headline, rankingColumns, rankingSQL(w, text, asOf), from, where, cursorWhere, jobCursorOrder, len(args), outerFrom, jobCursorOrder), args...)
+	if err != nil {
+		return jobs, JobCursor{}, err
+	}
+	defer rows.Close()
+	var next JobCursor
+	var lastCreatedAt time.Time
+	for rows.Next() {
+		job := &JobPost{}
+		var createdAt time.Time
+		var perks, interview, companyIcon sql.NullString
+		var headline string
+		err = rows.Scan(&job.ID, &job.JobTitle, &job.Company, &job.CompanyURL, &job.SalaryRange, &job.Location, &job.JobDescription, &perks, &interview, &job.HowToApply, &createdAt, &job.CreatedAt, &job.Slug, &job.AdType, &job.SalaryMin, &job.SalaryMax, &job.SalaryCurrency, &job.SalaryCurrencyCode, &job.SalaryPeriod, &job.SalaryUndisclosed, &companyIcon, &job.ExternalID, &headline, &job.Rank.Text, &job.Rank.Recency, &job.Rank.Quality, &job.Rank.Placement, &job.Rank.Score)
+		if err != nil {
+			return jobs, JobCursor{}, err
+		}
+		if len(jobs) == limit {
+			last := jobs[limit-1]
+			next = JobCursor{AsOf: asOf, Score: last.Rank.Score, CreatedAt: lastCreatedAt, ID: last.ID}
+			break
+		}
+		if headline != "" {
+			job.SearchHighlight = searchHighlightHTML(headline)
+		}
+		job.CompanyIconID = companyIcon.String
+		job.Perks = perks.String
+		job.InterviewProcess = interview.String
+		job.TimeAgo = humanize.Time(createdAt.UTC())
+		jobs = append(jobs, job)
+		lastCreatedAt = createdAt
+	}
+	return jobs, next, rows.Err()
+}
+
+// FacetCount is the number of jobs matching a filter refined with Value for
+// Param
+type FacetCount struct {
+	Param    string
+	Value    string
+	Label    string
+	Count    int
+	Selected bool
+}
+
+// JobFacet is a dimension jobs can be refined by
+type JobFacet struct {
+	Name   string
+	Counts []FacetCount
+}
+
+type jobFacetValueCount struct {
+	Value string
+	Label string
+	Count int
+}
+
+// jobFacetCounts are the raw counts of each refinement, each dimension is
+// counted ignoring its own refinement, skills are counted on top of the
+// skills already picked
+type jobFacetCounts struct {
+	Salary       []int
+	Remote       map[RemotePolicy]int
+	PostedWithin []int
+	QuickApply   int
+	Sponsored    int
+	Companies    []jobFacetValueCount
+	Skills       []jobFacetValueCount
+}
+
+// facets labels the counts, refinements matching no job are left out
+// unless they are applied
+func (c jobFacetCounts) facets(f JobFilter) []JobFacet {
+	var salary, remote, posted, apply, companies, skills []FacetCount
+	add := func(counts []FacetCount, fc FacetCount) []FacetCount {
+		if fc.Count == 0 && !fc.Selected {
+			return counts
+		}
+		return append(counts, fc)
+	}
+	symbol := SalaryCurrencySymbol(f.SalaryCurrencyCode)
+	for i, min := range jobFacetSalaries {
+		salary = add(salary, FacetCount{JobFilterParamSalary, strconv.Itoa(min), fmt.Sprintf("%s%dk+", symbol, min/1000), c.Salary[i], f.SalaryMin == min})
+	}
+	for _, p := range []RemotePolicy{RemotePolicyRemote, RemotePolicyHybrid, RemotePolicyOnsite} {
+		remote = add(remote, FacetCount{JobFilterParamRemote, string(p), p.String(), c.Remote[p], f.RemotePolicy == p})
+	}
+	for i, days := range jobFacetPostedWithin {
+		label := fmt.Sprintf("Last %d days", days)
+		if days == 1 {
+			label = "Last 24 hours"
+		}
+		posted = add(posted, FacetCount{JobFilterParamPosted, strconv.Itoa(days), label, c.PostedWithin[i], f.PostedWithin == days})
+	}
+	apply = add(apply, FacetCount{JobFilterParamQuickApply, "1", "Quick apply", c.QuickApply, f.QuickApply})
+	apply = add(apply, FacetCount{JobFilterParamSponsored, "1", "Sponsored", c.Sponsored, f.Sponsored})
+	top := func(param string, values []jobFacetValueCount, selected func(string) bool) []FacetCount {
+		sort.SliceStable(values, func(i, j int) bool {
+			if values[i].Count == values[j].Count {
+				return values[i].Label < values[j].Label
+			}
+			return values[i].Count > values[j].Count
+		})
+		var counts []FacetCount
+		for i, v := range values {
+			if i < jobFacetMaxValues || selected(v.Value) {
+				counts = add(counts, FacetCount{param, v.Value, v.Label, v.Count, selected(v.Value)})
+			}
+		}
+		return counts
+	}
+	companies = top(JobFilterParamCompany, c.Companies, func(slug string) bool { return slug == f.Company })
+	skills = top(JobFilterParamSkill, c.Skills, func(slug string) bool { return hasSkill(f.Skills, slug) })
+	for _, s := range skillsOf(f.Skills) {
+		if !hasFacetValue(skills, s.Slug) {
+			skills = append(skills, FacetCount{JobFilterParamSkill, s.Slug, s.Name, 0, true})
+		}
+	}
+	var facets []JobFacet
+	for _, facet := range []JobFacet{
+		{"Salary", salary},
+		{"Remote", remote},
+		{"Posted", posted},
+		{"Apply", apply},
+		{"Companies", companies},
+		{"Skills", skills},
+	} {
+		if len(facet.Counts) > 0 {
+			facets = append(facets, facet)
+		}
+	}
+	return facets
+}
+
+func hasFacetValue(counts []FacetCount, value string) bool {
+	for _, c := range counts {
+		if c.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJobFacets counts the jobs each refinement of the filter would return
+func GetJobFacets(conn *sql.DB, f JobFilter) ([]JobFacet, error) {
+	f = f.normalize()
+	c := jobFacetCounts{Remote: make(map[RemotePolicy]int)}
+
+	from, where, args := jobFilterWhere(f.without(JobFilterParamSalary))
+	args = append(args, f.SalaryCurrencyCode)
+	salaryCounts := make([]string, 0, len(jobFacetSalaries))
+	for _, min := range jobFacetSalaries {
+		salaryCounts = append(salaryCounts, fmt.Sprintf(`count(*) FILTER (WHERE salary >= %d)`, min))
+	}
+	c.Salary = make([]int, len(jobFacetSalaries))
+	if err := scanFacetCounts(conn.QueryRow(fmt.Sprintf(`SELECT %s FROM (SELECT %s AS salary FROM %s WHERE %s AND salary_undisclosed = FALSE) AS job_`, strings.Join(salaryCounts, ", "), jobSalarySQL(len(args)), from, where), args...), c.Salary); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f.without(JobFilterParamRemote))
+	rows, err := conn.Query(`SELECT remote_policy, count(*) FROM `+from+` WHERE `+where+` GROUP BY remote_policy`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p RemotePolicy
+		var count int
+		if err := rows.Scan(&p, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Remote[p] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f.without(JobFilterParamPosted))
+	postedCounts := make([]string, 0, len(jobFacetPostedWithin))
+	for _, days := range jobFacetPostedWithin {
+		postedCounts = append(postedCounts, fmt.Sprintf(`count(*) FILTER (WHERE created_at >= NOW() - INTERVAL '%d days')`, days))
+	}
+	c.PostedWithin = make([]int, len(jobFacetPostedWithin))
+	if err := scanFacetCounts(conn.QueryRow(`SELECT `+strings.Join(postedCounts, ", ")+` FROM `+from+` WHERE `+where, args...), c.PostedWithin); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f.without(JobFilterParamQuickApply))
+	args = append(args, quickApplyPattern)
+	if err := conn.QueryRow(fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s AND how_to_apply ~ $%d`, from, where, len(args)), args...).Scan(&c.QuickApply); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f.without(JobFilterParamSponsored))
+	if err := conn.QueryRow(fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s AND ad_type = %d`, from, where, JobAdSponsoredBackground), args...).Scan(&c.Sponsored); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f.without(JobFilterParamCompany))
+	if c.Companies, err = queryFacetValueCounts(conn, `SELECT c.slug, c.name, count(*) FROM `+from+`, company c WHERE c.id = job.company_id AND `+where+` GROUP BY c.slug, c.name`, args...); err != nil {
+		return nil, err
+	}
+
+	from, where, args = jobFilterWhere(f)
+	if c.Skills, err = queryFacetValueCounts(conn, `SELECT js.skill, js.skill, count(*) FROM `+from+`, job_skill js WHERE js.job_id = job.id AND `+where+` GROUP BY js.skill`, args...); err != nil {
+		return nil, err
+	}
+	for i, s := range c.Skills {
+		if skill, ok := SkillBySlug(s.Value); ok {
+			c.Skills[i].Label = skill.Name
+		}
+	}
+	return c.facets(f), nil
+}
+
+func scanFacetCounts(row *sql.Row, counts []int) error {
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	return row.Scan(dest...)
+}
+
+func queryFacetValueCounts(conn *sql.DB, query string, args ...interface{}) ([]jobFacetValueCount, error) {
+	var counts []jobFacetValueCount
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c jobFacetValueCount
+		if err := rows.Scan(&c.Value, &c.Label, &c.Count); err != nil {
+			return counts, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,347 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type RemotePolicy string
+
+const (
+	RemotePolicyOnsite RemotePolicy = "onsite"
+	RemotePolicyHybrid RemotePolicy = "hybrid"
+	RemotePolicyRemote RemotePolicy = "remote"
+)
+
+var remotePolicyLabels = map[RemotePolicy]string{
+	RemotePolicyOnsite: "On-site",
+	RemotePolicyHybrid: "Hybrid",
+	RemotePolicyRemote: "Remote",
+}
+
+func (p RemotePolicy) Valid() bool {
+	_, ok := remotePolicyLabels[p]
+	return ok
+}
+
+func (p RemotePolicy) String() string {
+	return remotePolicyLabels[p]
+}
+
+// JobRemoteRegions lists the regions remote jobs can be restricted to, a
+// remote job without regions can be worked from anywhere
+var JobRemoteRegions = []string{
+	"North America",
+	"Latin America",
+	"Europe",
+	"Africa",
+	"Middle East",
+	"Asia",
+	"Oceania",
+}
+
+// JobRemoteRegion returns the canonical name of a region, matched case
+// insensitively
+func JobRemoteRegion(name string) (string, bool) {
+	for _, r := range JobRemoteRegions {
+		if strings.EqualFold(r, strings.TrimSpace(name)) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+const (
+	minUTCOffset = -12
+	maxUTCOffset = 14
+)
+
+// TimezoneWindow is the range of UTC offsets, in hours, remote employees
+// are expected to work from
+type TimezoneWindow struct {
+	From  int  `json:"from"`
+	To    int  `json:"to"`
+	Valid bool `json:"valid"`
+}
+
+func formatUTCOffset(offset int) string {
+	if offset == 0 {
+		return "UTC"
+	}
+	return fmt.Sprintf("UTC%+d", offset)
+}
+
+// String formats the window as shown on job pages, eg. `UTC-5 to UTC+2`
+func (w TimezoneWindow) String() string {
+	if !w.Valid {
+		return ""
+	}
+	if w.From == w.To {
+		return formatUTCOffset(w.From)
+	}
+	return formatUTCOffset(w.From) + " to " + formatUTCOffset(w.To)
+}
+
+func (w TimezoneWindow) nullFrom() sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(w.From), Valid: w.Valid}
+}
+
+func (w TimezoneWindow) nullTo() sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(w.To), Valid: w.Valid}
+}
+
+func timezoneWindowFromNull(from, to sql.NullInt64) TimezoneWindow {
+	if !from.Valid || !to.Valid {
+		return TimezoneWindow{}
+	}
+	return TimezoneWindow{From: int(from.Int64), To: int(to.Int64), Valid: true}
+}
+
+// remoteRegionsArray stores jobs without regions as an empty array, the
+// column is not nullable
+func remoteRegionsArray(regions []string) interface{} {
+	if regions == nil {
+		regions = []string{}
+	}
+	return pq.Array(regions)
+}
+
+// JobLocation is a place a job can be worked from. City is empty when the
+// job is open to a whole country, Country is empty when it is not known
+type JobLocation struct {
+	City    string
+	Country string
+}
+
+func (l JobLocation) String() string {
+	switch {
+	case l.City == "":
+		return l.Country
+	case l.Country == "":
+		return l.City
+	}
+	return l.City + ", " + l.Country
+}
+
+// JobRemote is where a job can be worked from besides its locations
+type JobRemote struct {
+	Policy   RemotePolicy
+	Regions  []string
+	Timezone TimezoneWindow
+}
+
+// String summarises the remote policy as shown on job pages, eg.
+// `Remote (Europe, Africa, UTC-1 to UTC+3)`
+func (r JobRemote) String() string {
+	details := append([]string{}, r.Regions...)
+	if r.Timezone.Valid {
+		details = append(details, r.Timezone.String())
+	}
+	if len(details) == 0 {
+		return r.Policy.String()
+	}
+	return fmt.Sprintf("%s (%s)", r.Policy, strings.Join(details, ", "))
+}
+
+var (
+	jobLocationSeparatorRe = regexp.MustCompile(`\s*[/;|]\s*`)
+	jobLocationRemoteRe    = regexp.MustCompile(`(?i)^(remote|anywhere)\b`)
+)
+
+// splitJobLocation splits the free text location of a job into the places
+// it lists, eg. `Berlin / London, UK / Remote`, and reports whether it
+// mentions remote work
+func splitJobLocation(location string) ([]string, bool) {
+	var parts []string
+	var remote bool
+	for _, p := range jobLocationSeparatorRe.Split(strings.TrimSpace(location), -1) {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+		case jobLocationRemoteRe.MatchString(p):
+			remote = true
+		default:
+			parts = append(parts, p)
+		}
+	}
+	return parts, remote
+}
+
+// seoLocationLookup returns the name and country of a known location
+type seoLocationLookup func(name string) (string, string, bool)
+
+// parseJobLocations normalises the places listed in the location of a job.
+// A place is either `City, Country` or a name looked up in the known
+// locations, unknown names are kept as a city
+func parseJobLocations(location string, lookup seoLocationLookup) []JobLocation {
+	parts, _ := splitJobLocation(location)
+	locations := make([]JobLocation, 0, len(parts))
+	for _, p := range parts {
+		var l JobLocation
+		l.City = p
+		if i := strings.LastIndex(p, ","); i >= 0 {
+			l.City, l.Country = strings.TrimSpace(p[:i]), strings.TrimSpace(p[i+1:])
+		}
+		if name, country, ok := lookup(l.City); ok {
+			l.City = name
+			if l.Country == "" {
+				l.Country = country
+			}
+		}
+		if l.City == "" && l.Country == "" {
+			continue
+		}
+		locations = append(locations, l)
+	}
+	return locations
+}
+
+// parseJobRemote validates the remote policy of a job request. Clients that
+// do not send a policy get one from the location, regions and timezones only
+// apply to jobs that are not on-site
+func parseJobRemote(location, policy string, regions []string, timezoneFrom, timezoneTo string) (JobRemote, error) {
+	r := JobRemote{Policy: RemotePolicy(strings.ToLower(strings.TrimSpace(policy)))}
+	if r.Policy == "" {
+		r.Policy = RemotePolicyOnsite
+		if _, remote := splitJobLocation(location); remote {
+			r.Policy = RemotePolicyRemote
+		}
+	}
+	if !r.Policy.Valid() {
+		return r, fmt.Errorf("invalid remote policy %q", policy)
+	}
+	if r.Policy == RemotePolicyOnsite {
+		return r, nil
+	}
+	seen := make(map[string]bool)
+	for _, name := range regions {
+		region, ok := JobRemoteRegion(name)
+		if !ok {
+			return r, fmt.Errorf("unknown remote region %q", name)
+		}
+		if !seen[region] {
+			seen[region] = true
+			r.Regions = append(r.Regions, region)
+		}
+	}
+	timezoneFrom, timezoneTo = strings.TrimSpace(timezoneFrom), strings.TrimSpace(timezoneTo)
+	if timezoneFrom == "" && timezoneTo == "" {
+		return r, nil
+	}
+	var err error
+	if r.Timezone.From, err = parseUTCOffset(timezoneFrom); err != nil {
+		return r, err
+	}
+	if r.Timezone.To, err = parseUTCOffset(timezoneTo); err != nil {
+		return r, err
+	}
+	if r.Timezone.From > r.Timezone.To {
+		return r, fmt.Errorf("invalid timezone window %s", TimezoneWindow{From: r.Timezone.From, To: r.Timezone.To, Valid: true})
+	}
+	r.Timezone.Valid = true
+	return r, nil
+}
+
+func parseUTCOffset(v string) (int, error) {
+	offset, err := strconv.Atoi(strings.TrimPrefix(v, "+"))
+	if err != nil {
+		return 0, err
+	}
+	if offset < minUTCOffset || offset > maxUTCOffset {
+		return 0, fmt.Errorf("invalid UTC offset %d", offset)
+	}
+	return offset, nil
+}
+
+// jobLocationFilter returns the condition matching jobs in a location and
+// its argument, bound to the given placeholder. "Remote" matches remote
+// jobs, a region remote jobs open to it and anything else the city or
+// country of one of the job locations
+func jobLocationFilter(location string, param int) (string, interface{}) {
+	if strings.EqualFold(location, string(RemotePolicyRemote)) {
+		return fmt.Sprintf("remote_policy = $%d", param), string(RemotePolicyRemote)
+	}
+	if region, ok := JobRemoteRegion(location); ok {
+		return fmt.Sprintf("(remote_policy = 'remote' AND (remote_regions = '{}' OR $%d = ANY(remote_regions)))", param), region
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM job_location l WHERE l.job_id = job.id AND (LOWER(l.city) = LOWER($%d) OR LOWER(l.country) = LOWER($%d)))", param, param), location
+}
+
+// matchesLocation mirrors jobLocationFilter
+func matchesLocation(location string, policy RemotePolicy, regions []string, locations []JobLocation) bool {
+	if strings.EqualFold(location, string(RemotePolicyRemote)) {
+		return policy == RemotePolicyRemote
+	}
+	if region, ok := JobRemoteRegion(location); ok {
+		if policy != RemotePolicyRemote {
+			return false
+		}
+		if len(regions) == 0 {
+			return true
+		}
+		for _, r := range regions {
+			if r == region {
+				return true
+			}
+		}
+		return false
+	}
+	for _, l := range locations {
+		if strings.EqualFold(l.City, location) || strings.EqualFold(l.Country, location) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceJobLocationsTx stores the normalised locations of a job in place of
+// the ones it had
+func replaceJobLocationsTx(tx *sql.Tx, jobID int, location string) error {
+	var lookupErr error
+	lookup := func(name string) (string, string, bool) {
+		var loc, country string
+		err := tx.QueryRow(`SELECT name, COALESCE(country, '') FROM seo_location WHERE LOWER(name) = LOWER($1) LIMIT 1`, name).Scan(&loc, &country)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				lookupErr = err
+			}
+			return "", "", false
+		}
+		return loc, country, true
+	}
+	locations := parseJobLocations(location, lookup)
+	if lookupErr != nil {
+		return lookupErr
+	}
+	if _, err := tx.Exec(`DELETE FROM job_location WHERE job_id = $1`, jobID); err != nil {
+		return err
+	}
+	for _, l := range locations {
+		if _, err := tx.Exec(`INSERT INTO job_location (job_id, city, country) VALUES ($1, $2, $3)`, jobID, l.City, l.Country); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getJobLocations(conn *sql.DB, jobID int) ([]JobLocation, error) {
+	var locations []JobLocation
+	rows, err := conn.Query(`SELECT city, country FROM job_location WHERE job_id = $1 ORDER BY id`, jobID)
+	if err != nil {
+		return locations, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l JobLocation
+		if err := rows.Scan(&l.City, &l.Country); err != nil {
+			return locations, err
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
@@ -0,0 +1,427 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobRevisionFields is a snapshot of the fields employers can edit.
+// SalaryCurrency is the currency symbol, revisions recorded before jobs had
+// a currency code only have that
+type JobRevisionFields struct {
+	JobTitle           string         `json:"job_title"`
+	Company            string         `json:"company"`
+	CompanyURL         string         `json:"company_url"`
+	SalaryMin          int            `json:"salary_min"`
+	SalaryMax          int            `json:"salary_max"`
+	SalaryCurrency     string         `json:"salary_currency"`
+	SalaryCurrencyCode string         `json:"salary_currency_code"`
+	SalaryPeriod       SalaryPeriod   `json:"salary_period"`
+	SalaryUndisclosed  bool           `json:"salary_undisclosed"`
+	Equity             bool           `json:"equity"`
+	EquityMin          float64        `json:"equity_min"`
+	EquityMax          float64        `json:"equity_max"`
+	Location           string         `json:"location"`
+	RemotePolicy       RemotePolicy   `json:"remote_policy"`
+	RemoteRegions      []string       `json:"remote_regions"`
+	Timezone           TimezoneWindow `json:"timezone"`
+	Description        string         `json:"description"`
+	Skills             []string       `json:"skills"`
+	Perks              string         `json:"perks"`
+	InterviewProcess   string         `json:"interview_process"`
+	HowToApply         string         `json:"how_to_apply"`
+	CompanyIconID      string         `json:"company_icon_id"`
+}
+
+// jobRevisionFieldNames lists the fields in the order they are displayed
+var jobRevisionFieldNames = []string{
+	"job_title",
+	"company",
+	"company_url",
+	"salary_min",
+	"salary_max",
+	"salary_currency_code",
+	"salary_period",
+	"salary_undisclosed",
+	"equity",
+	"equity_min",
+	"equity_max",
+	"location",
+	"remote_policy",
+	"remote_regions",
+	"timezone",
+	"description",
+	"skills",
+	"perks",
+	"interview_process",
+	"how_to_apply",
+	"company_icon_id",
+}
+
+// substantiveJobFields are the fields that change what a job is, as opposed
+// to how it is described
+var substantiveJobFields = map[string]bool{
+	"job_title":            true,
+	"company":              true,
+	"salary_min":           true,
+	"salary_max":           true,
+	"salary_currency_code": true,
+	"salary_period":        true,
+	"salary_undisclosed":   true,
+	"remote_policy":        true,
+}
+
+func (f JobRevisionFields) values() map[string]string {
+	return map[string]string{
+		"job_title":            f.JobTitle,
+		"company":              f.Company,
+		"company_url":          f.CompanyURL,
+		"salary_min":           strconv.Itoa(f.SalaryMin),
+		"salary_max":           strconv.Itoa(f.SalaryMax),
+		"salary_currency_code": f.SalaryCurrencyCode,
+		"salary_period":        string(f.SalaryPeriod),
+		"salary_undisclosed":   strconv.FormatBool(f.SalaryUndisclosed),
+		"equity":               strconv.FormatBool(f.Equity),
+		"equity_min":           formatEquity(f.EquityMin),
+		"equity_max":           formatEquity(f.EquityMax),
+		"location":             f.Location,
+		"remote_policy":        string(f.RemotePolicy),
+		"remote_regions":       strings.Join(f.RemoteRegions, ", "),
+		"timezone":             f.Timezone.String(),
+		"description":          f.Description,
+		"skills":               strings.Join(f.Skills, ", "),
+		"perks":                f.Perks,
+		"interview_process":    f.InterviewProcess,
+		"how_to_apply":         f.HowToApply,
+		"company_icon_id":      f.CompanyIconID,
+	}
+}
+
+// normalize fills in the fields missing from revisions recorded before jobs
+// had a currency code, pay period, remote policy and skills
+func (f *JobRevisionFields) normalize() {
+	if f.SalaryCurrencyCode == "" {
+		f.SalaryCurrencyCode = SalaryCurrencyCode(f.SalaryCurrency)
+	}
+	if f.SalaryPeriod == "" {
+		f.SalaryPeriod = SalaryPeriodYearly
+	}
+	f.SalaryCurrency = SalaryCurrencySymbol(f.SalaryCurrencyCode)
+	if f.RemotePolicy == "" {
+		remote, _ := parseJobRemote(f.Location, "", nil, "", "")
+		f.RemotePolicy = remote.Policy
+	}
+	if f.Skills == nil {
+		f.Skills = ExtractSkills(f.JobTitle, f.Description)
+	}
+}
+
+func (f JobRevisionFields) salary() Salary {
+	return Salary{
+		Min:          f.SalaryMin,
+		Max:          f.SalaryMax,
+		CurrencyCode: f.SalaryCurrencyCode,
+		Period:       f.SalaryPeriod,
+		Undisclosed:  f.SalaryUndisclosed,
+		Equity:       f.Equity,
+		EquityMin:    f.EquityMin,
+		EquityMax:    f.EquityMax,
+	}
+}
+
+// Changes returns the fields that differ between f and to
+func (f JobRevisionFields) Changes(to JobRevisionFields) []JobFieldChange {
+	var changes []JobFieldChange
+	before, after := f.values(), to.values()
+	for _, field := range jobRevisionFieldNames {
+		if before[field] != after[field] {
+			changes = append(changes, JobFieldChange{Field: field, Before: before[field], After: after[field]})
+		}
+	}
+	return changes
+}
+
+type JobFieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+type JobRevision struct {
+	JobID         int
+	Revision      int
+	Editor        string
+	ChangedFields []string
+	Fields        JobRevisionFields
+	RevertedFrom  int
+	CreatedAt     time.Time
+	// Changes is the field level diff against the previous revision
+	Changes []JobFieldChange
+}
+
+type JobRevertRq struct {
+	Token    string `json:"token"`
+	Revision int    `json:"revision"`
+}
+
+// IsSubstantiveEdit reports whether any of the changed fields alter the
+// title, company, salary or remote policy of a job
+func IsSubstantiveEdit(changedFields []string) bool {
+	for _, f := range changedFields {
+		if substantiveJobFields[f] {
+			return true
+		}
+	}
+	return false
+}
+
+func jobRevisionFieldsFromUpdate(job *JobRqUpdate) (JobRevisionFields, error) {
+	salary, err := job.Salary()
+	if err != nil {
+		return JobRevisionFields{}, err
+	}
+	remote, err := job.Remote()
+	if err != nil {
+		return JobRevisionFields{}, err
+	}
+	skills, err := job.SkillTags()
+	if err != nil {
+		return JobRevisionFields{}, err
+	}
+	return JobRevisionFields{
+		JobTitle:           job.JobTitle,
+		Company:            job.Company,
+		CompanyURL:         job.CompanyURL,
+		SalaryMin:          salary.Min,
+		SalaryMax:          salary.Max,
+		SalaryCurrency:     salary.CurrencySymbol(),
+		SalaryCurrencyCode: salary.CurrencyCode,
+		SalaryPeriod:       salary.Period,
+		SalaryUndisclosed:  salary.Undisclosed,
+		Equity:             salary.Equity,
+		EquityMin:          salary.EquityMin,
+		EquityMax:          salary.EquityMax,
+		Location:           job.Location,
+		RemotePolicy:       remote.Policy,
+		RemoteRegions:      remote.Regions,
+		Timezone:           remote.Timezone,
+		Description:        job.Description,
+		Skills:             skills,
+		Perks:              job.Perks,
+		InterviewProcess:   job.InterviewProcess,
+		HowToApply:         job.HowToApply,
+		CompanyIconID:      job.CompanyIconID,
+	}, nil
+}
+
+func changedFieldNames(changes []JobFieldChange) []string {
+	fields := make([]string, 0, len(changes))
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+// UpdateJob saves an edit and records it as a new revision. It returns the
+// fields that changed, nothing is recorded when the edit changes nothing
+func UpdateJob(conn *sql.DB, job *JobRqUpdate, jobID int, editor string) ([]string, error) {
+	fields, err := jobRevisionFieldsFromUpdate(job)
+	if err != nil {
+		return nil, err
+	}
+	return updateJobFields(conn, jobID, fields, editor, 0)
+}
+
+// RevertJob puts back the fields of an earlier revision, recorded as a new
+// revision
+func RevertJob(conn *sql.DB, jobID, revision int, editor string) ([]string, error) {
+	var raw []byte
+	err := conn.QueryRow(`SELECT fields FROM job_revision WHERE job_id = $1 AND revision = $2`, jobID, revision).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	var fields JobRevisionFields
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	fields.normalize()
+	return updateJobFields(conn, jobID, fields, editor, revision)
+}
+
+func updateJobFields(conn *sql.DB, jobID int, fields JobRevisionFields, editor string, revertedFrom int) ([]string, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	var current JobRevisionFields
+	var companyURL, perks, interview, companyIconID sql.NullString
+	var timezoneFrom, timezoneTo sql.NullInt64
+	var createdAt time.Time
+	err = tx.QueryRow(
+		`SELECT job_title, company, company_url, salary_min, salary_max, salary_currency, salary_currency_code, salary_period, salary_undisclosed, equity, COALESCE(equity_min, 0), COALESCE(equity_max, 0), location, remote_policy, remote_regions, timezone_from, timezone_to, description, perks, interview_process, how_to_apply, company_icon_image_id, created_at FROM job WHERE id = $1 FOR UPDATE`,
+		jobID,
+	).Scan(&current.JobTitle, &current.Company, &companyURL, &current.SalaryMin, &current.SalaryMax, &current.SalaryCurrency, &current.SalaryCurrencyCode, &current.SalaryPeriod, &current.SalaryUndisclosed, &current.Equity, &current.EquityMin, &current.EquityMax, &current.Location, &current.RemotePolicy, pq.Array(&current.RemoteRegions), &timezoneFrom, &timezoneTo, &current.Description, &perks, &interview, &current.HowToApply, &companyIconID, &createdAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	current.CompanyURL = companyURL.String
+	current.Perks = perks.String
+	current.InterviewProcess = interview.String
+	current.CompanyIconID = companyIconID.String
+	current.Timezone = timezoneWindowFromNull(timezoneFrom, timezoneTo)
+	if current.Skills, err = getJobSkills(tx, jobID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	changed := changedFieldNames(current.Changes(fields))
+	if len(changed) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+	var last int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM job_revision WHERE job_id = $1`, jobID).Scan(&last); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// the first edit also records what the job looked like when it was posted
+	if last == 0 {
+		last = 1
+		if err := insertJobRevisionTx(tx, JobRevision{JobID: jobID, Revision: last, Editor: ActorEmployer, Fields: current, CreatedAt: createdAt}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(
+		`UPDATE job SET job_title = $1, company = $2, company_url = $3, salary_min = $4, salary_max = $5, salary_currency = $6, salary_range = $7, location = $8, description = $9, perks = $10, interview_process = $11, how_to_apply = $12, company_icon_image_id = $13, salary_currency_code = $14, salary_period = $15, salary_undisclosed = $16, equity = $17, equity_min = $18, equity_max = $19, remote_policy = $20, remote_regions = $21, timezone_from = $22, timezone_to = $23 WHERE id = $24`,
+		fields.JobTitle,
+		fields.Company,
+		fields.CompanyURL,
+		fields.SalaryMin,
+		fields.SalaryMax,
+		fields.SalaryCurrency,
+		fields.salary().RangeString(),
+		fields.Location,
+		fields.Description,
+		fields.Perks,
+		fields.InterviewProcess,
+		fields.HowToApply,
+		fields.CompanyIconID,
+		fields.SalaryCurrencyCode,
+		fields.SalaryPeriod,
+		fields.SalaryUndisclosed,
+		fields.Equity,
+		nullEquity(fields.EquityMin),
+		nullEquity(fields.EquityMax),
+		fields.RemotePolicy,
+		remoteRegionsArray(fields.RemoteRegions),
+		fields.Timezone.nullFrom(),
+		fields.Timezone.nullTo(),
+		jobID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if fields.Location != current.Location {
+		if err := replaceJobLocationsTx(tx, jobID, fields.Location); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := replaceJobSkillsTx(tx, jobID, fields.Skills); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if fields.Company != current.Company || fields.CompanyURL != current.CompanyURL || fields.CompanyIconID != current.CompanyIconID {
+		if err := linkJobCompanyTx(tx, jobID, fields.Company, fields.CompanyURL, fields.CompanyIconID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	err = insertJobRevisionTx(tx, JobRevision{
+		JobID:         jobID,
+		Revision:      last + 1,
+		Editor:        editor,
+		ChangedFields: changed,
+		Fields:        fields,
+		RevertedFrom:  revertedFrom,
+		CreatedAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return changed, tx.Commit()
+}
+
+func insertJobRevisionTx(tx *sql.Tx, r JobRevision) error {
+	fields, err := json.Marshal(r.Fields)
+	if err != nil {
+		return err
+	}
+	if r.ChangedFields == nil {
+		r.ChangedFields = []string{}
+	}
+	var revertedFrom sql.NullInt64
+	if r.RevertedFrom != 0 {
+		revertedFrom = sql.NullInt64{Int64: int64(r.RevertedFrom), Valid: true}
+	}
+	_, err = tx.Exec(
+		`INSERT INTO job_revision (job_id, revision, editor, changed_fields, fields, reverted_from, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		r.JobID,
+		r.Revision,
+		r.Editor,
+		pq.Array(r.ChangedFields),
+		string(fields),
+		revertedFrom,
+		r.CreatedAt,
+	)
+	return err
+}
+
+// GetJobRevisions returns the revisions of a job, newest first, each with
+// its diff against the one before
+func GetJobRevisions(conn *sql.DB, jobID int) ([]JobRevision, error) {
+	var revisions []JobRevision
+	rows, err := conn.Query(`SELECT job_id, revision, editor, changed_fields, fields, COALESCE(reverted_from, 0), created_at FROM job_revision WHERE job_id = $1 ORDER BY revision ASC`, jobID)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r JobRevision
+		var raw []byte
+		if err := rows.Scan(&r.JobID, &r.Revision, &r.Editor, pq.Array(&r.ChangedFields), &raw, &r.RevertedFrom, &r.CreatedAt); err != nil {
+			return revisions, err
+		}
+		if err := json.Unmarshal(raw, &r.Fields); err != nil {
+			return revisions, err
+		}
+		r.Fields.normalize()
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return revisions, err
+	}
+	return withRevisionChanges(revisions), nil
+}
+
+// withRevisionChanges diffs each revision against the previous one and
+// returns them newest first
+func withRevisionChanges(revisions []JobRevision) []JobRevision {
+	for i := range revisions {
+		if i > 0 {
+			revisions[i].Changes = revisions[i-1].Fields.Changes(revisions[i].Fields)
+		}
+	}
+	for i, j := 0, len(revisions)-1; i < j; i, j = i+1, j-1 {
+		revisions[i], revisions[j] = revisions[j], revisions[i]
+	}
+	return revisions
+}
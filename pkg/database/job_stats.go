@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrJobStatsPruned is returned when rolling up a day whose events were
+// pruned, rolling it up again would lose its stats
+var ErrJobStatsPruned = errors.New("job events of the day were pruned")
+
+// ErrJobStatsDayIncomplete is returned when rolling up a day that is not
+// over yet, the events after the last day rolled up are counted live and a
+// later day would hide the rest of them
+var ErrJobStatsDayIncomplete = errors.New("job events of the day are not complete")
+
+// jobStatsDayFormat formats the days of job stats
+const jobStatsDayFormat = "2006-01-02"
+
+// jobStatsColumns are the job_stats_daily columns of the raw and unique
+// counts of an event type
+var jobStatsColumns = map[string][2]string{
+	jobEventPageView: {"page_views", "unique_page_views"},
+	jobEventClickout: {"clickouts", "unique_clickouts"},
+}
+
+// jobStatsCountsSQL counts job events into clickouts, page_views,
+// unique_clickouts, unique_page_views and applications
+var jobStatsCountsSQL = fmt.Sprintf(`count(*) FILTER (WHERE event_type = '%s'), count(*) FILTER (WHERE event_type = '%s'), %s, %s, count(*) FILTER (WHERE event_type = '%s')`,
+	jobEventClickout,
+	jobEventPageView,
+	jobEventUniqueSQL(fmt.Sprintf("event_type = '%s'", jobEventClickout)),
+	jobEventUniqueSQL(fmt.Sprintf("event_type = '%s'", jobEventPageView)),
+	jobEventApplication,
+)
+
+// jobStatsLiveSinceSQL is the live_since common table expression, the first
+// day whose events are not rolled up yet
+const jobStatsLiveSinceSQL = `live_since AS (SELECT COALESCE(max(day) + 1, '-infinity'::date) AS day FROM job_stats_rollup)`
+
+// NextJobStatsRollupDay returns the day after the last day rolled up, or the
+// day of the oldest event when none was, zero when there are no events
+func NextJobStatsRollupDay(conn *sql.DB) (time.Time, error) {
+	var day sql.NullTime
+	err := conn.QueryRow(`SELECT COALESCE((SELECT max(day) + 1 FROM job_stats_rollup), (SELECT min(created_at)::date FROM job_event))`).Scan(&day)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !day.Valid {
+		return time.Time{}, nil
+	}
+	return day.Time, nil
+}
+
+// RollupJobStats replaces the stats of a day, in UTC, with the counts of its
+// events by job and visitor country. It can run again for the same day until
+// its events are pruned. Only days before today can be rolled up
+func RollupJobStats(conn *sql.DB, day time.Time) error {
+	d := day.UTC().Format(jobStatsDayFormat)
+	if !day.UTC().Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+		return fmt.Errorf("%w: %s", ErrJobStatsDayIncomplete, d)
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	var pruned bool
+	err = tx.QueryRow(`SELECT pruned_at IS NOT NULL FROM job_stats_rollup WHERE day = $1 FOR UPDATE`, d).Scan(&pruned)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	if pruned {
+		tx.Rollback()
+		return fmt.Errorf("%w: %s", ErrJobStatsPruned, d)
+	}
+	stmts := []string{
+		`DELETE FROM job_stats_daily WHERE day = $1`,
+		`INSERT INTO job_stats_daily (job_id, day, country, clickouts, page_views, unique_clickouts, unique_page_views, applications)
+		SELECT job_id, $1::date, COALESCE(country, ''), ` + jobStatsCountsSQL + `
+		FROM job_event WHERE created_at >= $1::date AND created_at < $1::date + 1 GROUP BY job_id, COALESCE(country, '')`,
+		`INSERT INTO job_stats_rollup (day, rolled_up_at) VALUES ($1, NOW()) ON CONFLICT (day) DO UPDATE SET rolled_up_at = NOW()`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, d); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PruneJobEvents deletes the events of the days rolled up before the given
+// day and returns how many were deleted, events of days not rolled up are
+// kept
+func PruneJobEvents(conn *sql.DB, before time.Time) (int64, error) {
+	d := before.UTC().Format(jobStatsDayFormat)
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM job_event e USING job_stats_rollup r WHERE r.day < $1 AND e.created_at >= r.day AND e.created_at < r.day + 1`, d)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE job_stats_rollup SET pruned_at = NOW() WHERE day < $1 AND pruned_at IS NULL`, d); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
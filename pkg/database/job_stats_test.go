@@ -0,0 +1,17 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRollupJobStatsRejectsIncompleteDays(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	// the day is checked before connecting
+	for _, day := range []time.Time{today, today.Add(23 * time.Hour), today.AddDate(0, 0, 1)} {
+		if err := RollupJobStats(nil, day); !errors.Is(err, ErrJobStatsDayIncomplete) {
+			t.Errorf("%s: got %v, want %v", day, err, ErrJobStatsDayIncomplete)
+		}
+	}
+}
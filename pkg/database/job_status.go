@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending  JobStatus = "pending"
+	JobStatusApproved JobStatus = "approved"
+	JobStatusRejected JobStatus = "rejected"
+	JobStatusPaused   JobStatus = "paused"
+	JobStatusExpired  JobStatus = "expired"
+	JobStatusFilled   JobStatus = "filled"
+	JobStatusArchived JobStatus = "archived"
+)
+
+// Actors recorded against status transitions that are not made by a signed in user
+const (
+	ActorSystem   = "system"
+	ActorStripe   = "stripe"
+	ActorEmployer = "employer"
+)
+
+var ErrInvalidJobStatusTransition = errors.New("invalid job status transition")
+
+// jobStatusTransitions lists the states each state can move to. Only
+// approved jobs are listed on the site. Archiving and restoring are handled
+// by ArchiveJob and RestoreJob
+var jobStatusTransitions = map[JobStatus][]JobStatus{
+	JobStatusPending:  {JobStatusApproved, JobStatusRejected},
+	JobStatusApproved: {JobStatusPending, JobStatusRejected, JobStatusPaused, JobStatusFilled, JobStatusExpired},
+	JobStatusRejected: {JobStatusApproved},
+	JobStatusPaused:   {JobStatusApproved, JobStatusFilled, JobStatusExpired},
+	JobStatusExpired:  {JobStatusApproved, JobStatusFilled},
+	JobStatusFilled:   {},
+	JobStatusArchived: {},
+}
+
+func (s JobStatus) Valid() bool {
+	_, ok := jobStatusTransitions[s]
+	return ok
+}
+
+func (s JobStatus) CanTransitionTo(to JobStatus) bool {
+	for _, allowed := range jobStatusTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s JobStatus) String() string {
+	return string(s)
+}
+
+type JobStatusRq struct {
+	Token  string    `json:"token"`
+	Status JobStatus `json:"status"`
+}
+
+type JobStatusTransition struct {
+	JobID     int
+	From      JobStatus
+	To        JobStatus
+	Actor     string
+	CreatedAt time.Time
+}
+
+// TransitionJobStatus moves a job to a new state and records who did it.
+// approved_at is reset when a job goes live again after being rejected or
+// expired, kept when it is resumed or passes another review, and cleared
+// when it gets rejected
+func TransitionJobStatus(conn *sql.DB, jobID int, to JobStatus, actor string) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	var from JobStatus
+	if err := tx.QueryRow(`SELECT status FROM job WHERE id = $1 FOR UPDATE`, jobID).Scan(&from); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := transitionJobStatusTx(tx, jobID, from, to, actor); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// transitionJobStatusTx expects the job row to be locked by the caller
+func transitionJobStatusTx(tx *sql.Tx, jobID int, from, to JobStatus, actor string) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s to %s for job id %d", ErrInvalidJobStatusTransition, from, to, jobID)
+	}
+	stmt := `UPDATE job SET status = $1, status_updated_at = NOW() WHERE id = $2`
+	switch {
+	case to == JobStatusApproved && from == JobStatusPending:
+		stmt = `UPDATE job SET status = $1, status_updated_at = NOW(), approved_at = COALESCE(approved_at, NOW()) WHERE id = $2`
+	case to == JobStatusApproved && from != JobStatusPaused:
+		stmt = `UPDATE job SET status = $1, status_updated_at = NOW(), approved_at = NOW() WHERE id = $2`
+	case to == JobStatusRejected:
+		stmt = `UPDATE job SET status = $1, status_updated_at = NOW(), approved_at = NULL WHERE id = $2`
+	}
+	if _, err := tx.Exec(stmt, to, jobID); err != nil {
+		return err
+	}
+	return insertJobStatusTransitionTx(tx, jobID, from, to, actor)
+}
+
+func insertJobStatusTransitionTx(tx *sql.Tx, jobID int, from, to JobStatus, actor string) error {
+	_, err := tx.Exec(
+		`INSERT INTO job_status_transition (job_id, from_status, to_status, actor, created_at) VALUES ($1, $2, $3, $4, NOW())`,
+		jobID,
+		from,
+		to,
+		actor,
+	)
+	return err
+}
+
+func GetJobStatusTransitions(conn *sql.DB, jobID int) ([]JobStatusTransition, error) {
+	var transitions []JobStatusTransition
+	rows, err := conn.Query(`SELECT job_id, from_status, to_status, actor, created_at FROM job_status_transition WHERE job_id = $1 ORDER BY created_at ASC, id ASC`, jobID)
+	if err != nil {
+		return transitions, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t JobStatusTransition
+		if err := rows.Scan(&t.JobID, &t.From, &t.To, &t.Actor, &t.CreatedAt); err != nil {
+			return transitions, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
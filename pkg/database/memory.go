@@ -0,0 +1,1615 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/gosimple/slug"
+	"github.com/lib/pq"
+	"github.com/segmentio/ksuid"
+)
+
+// MemoryStore is an in-memory implementation of Store. It mirrors the
+// behaviour of the postgres queries closely enough to exercise the HTTP
+// handlers without a database. Lookups of missing rows return sql.ErrNoRows
+type MemoryStore struct {
+	mu            sync.RWMutex
+	nextJobID     int
+	jobs          map[int]*memJob
+	editTokens    map[string]int
+	applyTokens   map[string]*memApplyToken
+	media         map[string]Media
+	metaImages    map[string]MetaImage
+	users         map[string]User
+	signOnTokens  map[string]string
+	news          []NewsItem
+	newsComments  []NewsComment
+	purchases     []*memPurchase
+	events        []memJobEvent
+	transitions   []JobStatusTransition
+	auditEvents   []AuditEvent
+	revisions     []JobRevision
+	exchangeRates []ExchangeRate
+	seoLocations  map[string]memSEOLocation
+	nextCompanyID int
+	companies     map[int]*memCompany
+}
+
+type memJob struct {
+	JobPostForEdit
+	SalaryRange string
+	URLID       int64
+	Locations   []JobLocation
+	CompanyID   int
+}
+
+type memCompany struct {
+	Company
+	NormalizedName string
+	Domain         string
+}
+
+type memApplyToken struct {
+	JobID       int
+	CreatedAt   time.Time
+	ConfirmedAt *time.Time
+	Email       string
+	Cv          []byte
+}
+
+type memPurchase struct {
+	PurchaseEvent
+	Completed bool
+}
+
+type memJobEvent struct {
+	EventType string
+	JobID     int
+	Visitor   JobVisitor
+	CreatedAt time.Time
+}
+
+type memSEOLocation struct {
+	Name     string
+	Country  string
+	Currency string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nextJobID:     1,
+		jobs:          make(map[int]*memJob),
+		editTokens:    make(map[string]int),
+		applyTokens:   make(map[string]*memApplyToken),
+		media:         make(map[string]Media),
+		metaImages:    make(map[string]MetaImage),
+		users:         make(map[string]User),
+		signOnTokens:  make(map[string]string),
+		seoLocations:  make(map[string]memSEOLocation),
+		nextCompanyID: 1,
+		companies:     make(map[int]*memCompany),
+	}
+}
+
+func (j *memJob) isApproved() bool {
+	return j.Status == JobStatusApproved
+}
+
+func (j *memJob) post() *JobPost {
+	job := &JobPost{
+		ID:                 j.ID,
+		CreatedAt:          j.URLID,
+		TimeAgo:            humanize.Time(j.CreatedAt.UTC()),
+		JobTitle:           j.JobTitle,
+		Company:            j.Company,
+		CompanyURL:         j.CompanyURL,
+		SalaryRange:        j.SalaryRange,
+		Location:           j.Location,
+		JobDescription:     j.JobDescription,
+		Perks:              j.Perks,
+		InterviewProcess:   j.InterviewProcess,
+		HowToApply:         j.HowToApply,
+		Slug:               j.Slug,
+		SalaryCurrency:     j.SalaryCurrency,
+		SalaryCurrencyCode: j.SalaryCurrencyCode,
+		SalaryPeriod:       j.SalaryPeriod,
+		SalaryUndisclosed:  j.SalaryUndisclosed,
+		AdType:             j.AdType,
+		SalaryMin:          int64(j.SalaryMin),
+		SalaryMax:          int64(j.SalaryMax),
+		CompanyIconID:      j.CompanyIconID,
+		ExternalID:         j.ExternalID,
+		CompanyEmail:       j.CompanyEmail,
+		Status:             j.Status,
+		RemotePolicy:       j.RemotePolicy,
+		RemoteRegions:      append([]string{}, j.RemoteRegions...),
+		Timezone:           j.Timezone,
+	}
+	if j.ApprovedAt.Valid {
+		approvedAt := j.ApprovedAt.Time
+		job.ApprovedAt = &approvedAt
+	}
+	if j.ExpiresAt.Valid {
+		expiresAt := j.ExpiresAt.Time
+		job.ExpiresAt = &expiresAt
+	}
+	return job
+}
+
+func (j *memJob) edit() *JobPostForEdit {
+	job := j.JobPostForEdit
+	job.RemoteRegions = append([]string{}, j.RemoteRegions...)
+	job.Skills = append([]string{}, j.Skills...)
+	return &job
+}
+
+// postWithLocations mirrors the job page queries, the only ones loading
+// the locations and skills of a job
+func (j *memJob) postWithLocations() *JobPost {
+	job := j.post()
+	job.Locations = append([]JobLocation{}, j.Locations...)
+	job.Skills = append([]string{}, j.Skills...)
+	return job
+}
+
+func (j *memJob) inLocation(location string) bool {
+	return matchesLocation(location, j.RemotePolicy, j.RemoteRegions, j.Locations)
+}
+
+// lookupSEOLocation is the seoLocationLookup of the memory store, callers
+// hold mu
+func (m *MemoryStore) lookupSEOLocation(name string) (string, string, bool) {
+	loc, ok := m.seoLocations[strings.ToLower(name)]
+	return loc.Name, loc.Country, ok
+}
+
+// sortedJobs returns the jobs matching keep ordered by creation time, newest first
+func (m *MemoryStore) sortedJobs(keep func(j *memJob) bool) []*memJob {
+	var res []*memJob
+	for _, j := range m.jobs {
+		if keep(j) {
+			res = append(res, j)
+		}
+	}
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].CreatedAt.Equal(res[b].CreatedAt) {
+			return res[a].ID > res[b].ID
+		}
+		return res[a].CreatedAt.After(res[b].CreatedAt)
+	})
+	return res
+}
+
+func (m *MemoryStore) SaveDraft(job *JobRq) (int, error) {
+	externalID, err := ksuid.NewRandom()
+	if err != nil {
+		return 0, err
+	}
+	salary, err := job.Salary()
+	if err != nil {
+		return 0, err
+	}
+	remote, err := job.Remote()
+	if err != nil {
+		return 0, err
+	}
+	skills, err := job.SkillTags()
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	j := &memJob{
+		JobPostForEdit: JobPostForEdit{
+			ID:                 m.nextJobID,
+			JobTitle:           job.JobTitle,
+			Company:            job.Company,
+			CompanyEmail:       job.Email,
+			CompanyURL:         job.CompanyURL,
+			Location:           job.Location,
+			SalaryMin:          salary.Min,
+			SalaryMax:          salary.Max,
+			SalaryCurrency:     salary.CurrencySymbol(),
+			SalaryCurrencyCode: salary.CurrencyCode,
+			SalaryPeriod:       salary.Period,
+			SalaryUndisclosed:  salary.Undisclosed,
+			Equity:             salary.Equity,
+			EquityMin:          salary.EquityMin,
+			EquityMax:          salary.EquityMax,
+			RemotePolicy:       remote.Policy,
+			RemoteRegions:      remote.Regions,
+			Timezone:           remote.Timezone,
+			Skills:             skills,
+			JobDescription:     job.Description,
+			Perks:              job.Perks,
+			InterviewProcess:   job.InterviewProcess,
+			HowToApply:         job.HowToApply,
+			Slug:               slug.Make(fmt.Sprintf("%s %s %d", job.JobTitle, job.Company, now.Unix())),
+			CreatedAt:          time.Unix(now.Unix(), 0),
+			AdType:             job.AdType,
+			CompanyIconID:      job.CompanyIconID,
+			ExternalID:         externalID.String(),
+			Status:             JobStatusPending,
+			StatusUpdatedAt:    now,
+		},
+		SalaryRange: salary.RangeString(),
+		URLID:       now.Unix(),
+		Locations:   parseJobLocations(job.Location, m.lookupSEOLocation),
+	}
+	m.jobs[j.ID] = j
+	m.nextJobID++
+	m.linkJobCompany(j)
+	return j.ID, nil
+}
+
+func (m *MemoryStore) UpdateJob(job *JobRqUpdate, jobID int, editor string) ([]string, error) {
+	fields, err := jobRevisionFieldsFromUpdate(job)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateJobFields(jobID, fields, editor, 0)
+}
+
+func (m *MemoryStore) RevertJob(jobID, revision int, editor string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.revisions {
+		if r.JobID == jobID && r.Revision == revision {
+			return m.updateJobFields(jobID, r.Fields, editor, revision)
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) updateJobFields(jobID int, fields JobRevisionFields, editor string, revertedFrom int) ([]string, error) {
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	current := JobRevisionFields{
+		JobTitle:           j.JobTitle,
+		Company:            j.Company,
+		CompanyURL:         j.CompanyURL,
+		SalaryMin:          j.SalaryMin,
+		SalaryMax:          j.SalaryMax,
+		SalaryCurrency:     j.SalaryCurrency,
+		SalaryCurrencyCode: j.SalaryCurrencyCode,
+		SalaryPeriod:       j.SalaryPeriod,
+		SalaryUndisclosed:  j.SalaryUndisclosed,
+		Equity:             j.Equity,
+		EquityMin:          j.EquityMin,
+		EquityMax:          j.EquityMax,
+		Location:           j.Location,
+		RemotePolicy:       j.RemotePolicy,
+		RemoteRegions:      j.RemoteRegions,
+		Timezone:           j.Timezone,
+		Description:        j.JobDescription,
+		Skills:             j.Skills,
+		Perks:              j.Perks,
+		InterviewProcess:   j.InterviewProcess,
+		HowToApply:         j.HowToApply,
+		CompanyIconID:      j.CompanyIconID,
+	}
+	changed := changedFieldNames(current.Changes(fields))
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	last := 0
+	for _, r := range m.revisions {
+		if r.JobID == jobID && r.Revision > last {
+			last = r.Revision
+		}
+	}
+	if last == 0 {
+		last = 1
+		m.revisions = append(m.revisions, JobRevision{JobID: jobID, Revision: last, Editor: ActorEmployer, ChangedFields: []string{}, Fields: current, CreatedAt: j.CreatedAt})
+	}
+	relinkCompany := fields.Company != j.Company || fields.CompanyURL != j.CompanyURL || fields.CompanyIconID != j.CompanyIconID
+	j.JobTitle = fields.JobTitle
+	j.Company = fields.Company
+	j.CompanyURL = fields.CompanyURL
+	j.SalaryMin = fields.SalaryMin
+	j.SalaryMax = fields.SalaryMax
+	j.SalaryCurrency = fields.SalaryCurrency
+	j.SalaryCurrencyCode = fields.SalaryCurrencyCode
+	j.SalaryPeriod = fields.SalaryPeriod
+	j.SalaryUndisclosed = fields.SalaryUndisclosed
+	j.Equity = fields.Equity
+	j.EquityMin = fields.EquityMin
+	j.EquityMax = fields.EquityMax
+	j.SalaryRange = fields.salary().RangeString()
+	if fields.Location != j.Location {
+		j.Locations = parseJobLocations(fields.Location, m.lookupSEOLocation)
+	}
+	j.Location = fields.Location
+	j.RemotePolicy = fields.RemotePolicy
+	j.RemoteRegions = fields.RemoteRegions
+	j.Timezone = fields.Timezone
+	j.JobDescription = fields.Description
+	j.Skills = fields.Skills
+	j.Perks = fields.Perks
+	j.InterviewProcess = fields.InterviewProcess
+	j.HowToApply = fields.HowToApply
+	j.CompanyIconID = fields.CompanyIconID
+	if relinkCompany {
+		m.linkJobCompany(j)
+	}
+	m.revisions = append(m.revisions, JobRevision{
+		JobID:         jobID,
+		Revision:      last + 1,
+		Editor:        editor,
+		ChangedFields: changed,
+		Fields:        fields,
+		RevertedFrom:  revertedFrom,
+		CreatedAt:     time.Now().UTC(),
+	})
+	return changed, nil
+}
+
+func (m *MemoryStore) GetJobRevisions(jobID int) ([]JobRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var revisions []JobRevision
+	for _, r := range m.revisions {
+		if r.JobID == jobID {
+			r.Changes = nil
+			revisions = append(revisions, r)
+		}
+	}
+	sort.Slice(revisions, func(a, b int) bool { return revisions[a].Revision < revisions[b].Revision })
+	return withRevisionChanges(revisions), nil
+}
+
+func (m *MemoryStore) TransitionJobStatus(jobID int, to JobStatus, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transitionJobStatus(jobID, to, actor)
+}
+
+func (m *MemoryStore) transitionJobStatus(jobID int, to JobStatus, actor string) error {
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	from := j.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s to %s for job id %d", ErrInvalidJobStatusTransition, from, to, jobID)
+	}
+	now := time.Now().UTC()
+	switch {
+	case to == JobStatusApproved && from == JobStatusPending:
+		if !j.ApprovedAt.Valid {
+			j.ApprovedAt = pq.NullTime{Time: now, Valid: true}
+		}
+	case to == JobStatusApproved && from != JobStatusPaused:
+		j.ApprovedAt = pq.NullTime{Time: now, Valid: true}
+	case to == JobStatusRejected:
+		j.ApprovedAt = pq.NullTime{}
+	}
+	j.Status = to
+	j.StatusUpdatedAt = now
+	m.transitions = append(m.transitions, JobStatusTransition{JobID: jobID, From: from, To: to, Actor: actor, CreatedAt: now})
+	return nil
+}
+
+func (m *MemoryStore) GetJobStatusTransitions(jobID int) ([]JobStatusTransition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var transitions []JobStatusTransition
+	for _, t := range m.transitions {
+		if t.JobID == jobID {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions, nil
+}
+
+func (m *MemoryStore) SetJobExpiry(jobID int, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j, ok := m.jobs[jobID]; ok {
+		j.ExpiresAt = pq.NullTime{Time: expiresAt, Valid: true}
+	}
+	return nil
+}
+
+func (m *MemoryStore) RenewJob(jobID int, expiresAt time.Time, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	switch j.Status {
+	case JobStatusApproved, JobStatusPaused:
+	case JobStatusExpired:
+		if err := m.transitionJobStatus(jobID, JobStatusApproved, actor); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: cannot renew %s job id %d", ErrInvalidJobStatusTransition, j.Status, jobID)
+	}
+	j.ExpiresAt = pq.NullTime{Time: expiresAt, Valid: true}
+	return nil
+}
+
+// GetSimilarLiveJobs ranks live jobs by the weight of the words they share with
+// the title of the given job
+func (m *MemoryStore) GetSimilarLiveJobs(job *JobPost, max int) ([]*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := []*JobPost{}
+	q := parseWebSearchQuery(strings.ReplaceAll(similarJobsQuery(job.JobTitle), "|", " or "))
+	ranks := make(map[int]int)
+	matches := m.sortedJobs(func(j *memJob) bool {
+		if !j.isApproved() || j.ID == job.ID {
+			return false
+		}
+		ranks[j.ID] = j.searchRank(q)
+		return true
+	})
+	sort.SliceStable(matches, func(a, b int) bool {
+		return ranks[matches[a].ID] > ranks[matches[b].ID]
+	})
+	for i := 0; i < len(matches) && i < max; i++ {
+		jobs = append(jobs, matches[i].post())
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) ArchiveJob(jobID int, reason, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	from := j.Status
+	if from == JobStatusArchived {
+		return fmt.Errorf("%w: job id %d is already archived", ErrInvalidJobStatusTransition, jobID)
+	}
+	now := time.Now().UTC()
+	j.Status = JobStatusArchived
+	j.StatusUpdatedAt = now
+	j.ArchivedAt = pq.NullTime{Time: now, Valid: true}
+	j.ArchiveReason = reason
+	m.transitions = append(m.transitions, JobStatusTransition{JobID: jobID, From: from, To: JobStatusArchived, Actor: actor, CreatedAt: now})
+	return nil
+}
+
+func (m *MemoryStore) RestoreJob(jobID int, actor string) (JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	if j.Status != JobStatusArchived {
+		return "", fmt.Errorf("%w: job id %d is not archived", ErrInvalidJobStatusTransition, jobID)
+	}
+	to := JobStatusPending
+	for _, t := range m.transitions {
+		if t.JobID == jobID && t.To == JobStatusArchived {
+			to = t.From
+		}
+	}
+	now := time.Now().UTC()
+	j.Status = to
+	j.StatusUpdatedAt = now
+	j.ArchivedAt = pq.NullTime{}
+	j.ArchiveReason = ""
+	m.transitions = append(m.transitions, JobStatusTransition{JobID: jobID, From: JobStatusArchived, To: to, Actor: actor, CreatedAt: now})
+	return to, nil
+}
+
+func (m *MemoryStore) GetArchivedJobs() ([]ArchivedJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var jobs []ArchivedJob
+	for _, j := range m.jobs {
+		if j.Status != JobStatusArchived {
+			continue
+		}
+		aj := ArchivedJob{ID: j.ID, JobTitle: j.JobTitle, Company: j.Company, Slug: j.Slug, ArchivedAt: j.ArchivedAt.Time, ArchiveReason: j.ArchiveReason}
+		for token, id := range m.editTokens {
+			if id == j.ID {
+				aj.Token = token
+			}
+		}
+		jobs = append(jobs, aj)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].ArchivedAt.After(jobs[b].ArchivedAt)
+	})
+	return jobs, nil
+}
+
+func (m *MemoryStore) UpdateJobAdType(adType int, jobID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j, ok := m.jobs[jobID]; ok {
+		j.AdType = int64(adType)
+		j.ApprovedAt = pq.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SaveTokenForJob(token string, jobID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.editTokens[token]; ok {
+		return errors.New("duplicate edit token")
+	}
+	m.editTokens[token] = jobID
+	return nil
+}
+
+func (m *MemoryStore) TokenByJobID(jobID int) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for token, id := range m.editTokens {
+		if id == jobID {
+			return token, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+func (m *MemoryStore) JobPostIDByToken(token string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobID, ok := m.editTokens[token]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return jobID, nil
+}
+
+func (m *MemoryStore) JobIDByCompanyIconID(mediaID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobID := 0
+	for _, j := range m.jobs {
+		if j.CompanyIconID == mediaID && j.ID > jobID {
+			jobID = j.ID
+		}
+	}
+	if jobID == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return jobID, nil
+}
+
+func (m *MemoryStore) jobByExternalID(externalID string) (*memJob, bool) {
+	for _, j := range m.jobs {
+		if j.ExternalID == externalID {
+			return j, true
+		}
+	}
+	return nil, false
+}
+
+func (m *MemoryStore) jobBySlug(slug string) (*memJob, bool) {
+	for _, j := range m.jobs {
+		if j.Slug == slug {
+			return j, true
+		}
+	}
+	return nil, false
+}
+
+func (m *MemoryStore) GetJobByExternalID(externalID string) (JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobByExternalID(externalID)
+	if !ok {
+		return JobPost{}, sql.ErrNoRows
+	}
+	return *j.post(), nil
+}
+
+func (m *MemoryStore) JobPostByExternalIDForEdit(externalID string) (*JobPostForEdit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobByExternalID(externalID)
+	if !ok {
+		return &JobPostForEdit{}, sql.ErrNoRows
+	}
+	return j.edit(), nil
+}
+
+func (m *MemoryStore) JobPostByIDForEdit(jobID int) (*JobPostForEdit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return &JobPostForEdit{}, sql.ErrNoRows
+	}
+	return j.edit(), nil
+}
+
+func (m *MemoryStore) JobPostBySlug(slug string) (*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobBySlug(slug)
+	if !ok || !j.isApproved() {
+		return &JobPost{}, sql.ErrNoRows
+	}
+	job := j.postWithLocations()
+	job.CompanySlug = m.companySlug(j)
+	return job, nil
+}
+
+func (m *MemoryStore) JobPostBySlugAdmin(slug string) (*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	j, ok := m.jobBySlug(slug)
+	if !ok {
+		return &JobPost{}, sql.ErrNoRows
+	}
+	job := j.postWithLocations()
+	job.CompanySlug = m.companySlug(j)
+	return job, nil
+}
+
+func (m *MemoryStore) GetPendingJobs() ([]*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := []*JobPost{}
+	for _, j := range m.sortedJobs(func(j *memJob) bool { return j.Status == JobStatusPending }) {
+		jobs = append(jobs, j.post())
+	}
+	return jobs, nil
+}
+
+func isPinned(adType int64) bool {
+	return adType == JobAdSponsoredPinnedFor30Days || adType == JobAdSponsoredPinnedFor7Days
+}
+
+func (m *MemoryStore) GetPinnedJobs(w RankingWeights) ([]*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := []*JobPost{}
+	for _, j := range m.sortedJobs(func(j *memJob) bool { return j.isApproved() && isPinned(j.AdType) }) {
+		job := j.post()
+		job.Rank = rankJob(j.JobPostForEdit, w, 0, time.Now())
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(a, b int) bool {
+		return jobs[a].Rank.Score > jobs[b].Rank.Score
+	})
+	return jobs, nil
+}
+
+// searchRank approximates the ranking of job.search_doc against the query,
+// zero when the job does not match
+func (j *memJob) searchRank(q webSearchQuery) int {
+	skills := make([]string, 0, len(j.Skills))
+	for _, s := range skillsOf(j.Skills) {
+		skills = append(skills, s.Name)
+	}
+	return q.rank(j.JobTitle, strings.Join(skills, " "), j.Company, j.JobDescription)
+}
+
+// matchesFilter mirrors jobFilterWhere but for the query, callers hold mu
+func (m *MemoryStore) matchesFilter(j *memJob, f JobFilter, rates ExchangeRates) bool {
+	if !j.isApproved() || isPinned(j.AdType) {
+		return false
+	}
+	if f.Location != "" && !j.inLocation(f.Location) {
+		return false
+	}
+	if f.SalaryMin > 0 {
+		if salary, ok := jobSalaryIn(j.JobPostForEdit, f.SalaryCurrencyCode, rates); !ok || salary < float64(f.SalaryMin) {
+			return false
+		}
+	}
+	if f.RemotePolicy != "" && j.RemotePolicy != f.RemotePolicy {
+		return false
+	}
+	if f.PostedWithin > 0 && j.CreatedAt.Before(time.Now().AddDate(0, 0, -f.PostedWithin)) {
+		return false
+	}
+	if f.QuickApply && !quickApplyRe.MatchString(j.HowToApply) {
+		return false
+	}
+	if f.Sponsored && j.AdType != JobAdSponsoredBackground {
+		return false
+	}
+	if f.Company != "" && m.companySlug(j) != f.Company {
+		return false
+	}
+	for _, s := range f.Skills {
+		if !hasSkill(j.Skills, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// filteredJobs returns the jobs matching a normalized filter ranked as of
+// asOf by the blend of signals weighted by w, in the order cursors walk
+// them, callers hold mu
+func (m *MemoryStore) filteredJobs(f JobFilter, w RankingWeights, asOf time.Time, rates ExchangeRates) ([]*memJob, map[int]JobRank) {
+	q := parseWebSearchQuery(f.Query)
+	ranks := make(map[int]JobRank)
+	matches := m.sortedJobs(func(j *memJob) bool {
+		if !m.matchesFilter(j, f, rates) {
+			return false
+		}
+		var text float64
+		if f.Query != "" {
+			// mirrors the rank / (rank + 1) normalization of ts_rank
+			r := float64(j.searchRank(q))
+			if r == 0 {
+				return false
+			}
+			text = r / (r + 1)
+		}
+		ranks[j.ID] = rankJob(j.JobPostForEdit, w, text, asOf)
+		return true
+	})
+	sort.SliceStable(matches, func(a, b int) bool {
+		ja, jb := matches[a], matches[b]
+		return JobCursor{Score: ranks[ja.ID].Score, CreatedAt: ja.CreatedAt, ID: ja.ID}.after(ranks[jb.ID], jb.CreatedAt, jb.ID)
+	})
+	return matches, ranks
+}
+
+func (m *MemoryStore) JobsByQuery(f JobFilter, w RankingWeights, after JobCursor, limit int) ([]*JobPost, JobCursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	jobs := []*JobPost{}
+	f = f.normalize()
+	asOf := after.asOf()
+	q := parseWebSearchQuery(f.Query)
+	matches, ranks := m.filteredJobs(f, w, asOf, NewExchangeRates(m.exchangeRates))
+	for _, j := range matches {
+		if !after.after(ranks[j.ID], j.CreatedAt, j.ID) {
+			continue
+		}
+		if len(jobs) == limit {
+			last := jobs[limit-1]
+			return jobs, JobCursor{AsOf: asOf, Score: last.Rank.Score, CreatedAt: m.jobs[last.ID].CreatedAt, ID: last.ID}, nil
+		}
+		job := j.post()
+		job.Rank = ranks[job.ID]
+		if f.Query != "" {
+			job.SearchHighlight = searchHighlightHTML(q.headline(job.JobDescription))
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, JobCursor{}, nil
+}
+
+func (m *MemoryStore) JobCursorAt(f JobFilter, w RankingWeights, asOf time.Time, n int) (JobCursor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	matches, ranks := m.filteredJobs(f.normalize(), w, asOf, NewExchangeRates(m.exchangeRates))
+	if n < 1 || n > len(matches) {
+		return JobCursor{}, nil
+	}
+	j := matches[n-1]
+	return JobCursor{AsOf: asOf, Score: ranks[j.ID].Score, CreatedAt: j.CreatedAt, ID: j.ID}, nil
+}
+
+func (m *MemoryStore) CountJobs(f JobFilter) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.facetJobs(f.normalize(), NewExchangeRates(m.exchangeRates))), nil
+}
+
+// facetJobs returns the jobs matching a normalized filter, callers hold mu
+func (m *MemoryStore) facetJobs(f JobFilter, rates ExchangeRates) []*memJob {
+	jobs, _ := m.filteredJobs(f, RankingWeights{}, time.Now(), rates)
+	return jobs
+}
+
+func (m *MemoryStore) GetJobFacets(f JobFilter) ([]JobFacet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f = f.normalize()
+	rates := NewExchangeRates(m.exchangeRates)
+	c := jobFacetCounts{
+		Salary:       make([]int, len(jobFacetSalaries)),
+		Remote:       make(map[RemotePolicy]int),
+		PostedWithin: make([]int, len(jobFacetPostedWithin)),
+	}
+	for _, j := range m.facetJobs(f.without(JobFilterParamSalary), rates) {
+		salary, ok := jobSalaryIn(j.JobPostForEdit, f.SalaryCurrencyCode, rates)
+		for i, min := range jobFacetSalaries {
+			if ok && salary >= float64(min) {
+				c.Salary[i]++
+			}
+		}
+	}
+	for _, j := range m.facetJobs(f.without(JobFilterParamRemote), rates) {
+		c.Remote[j.RemotePolicy]++
+	}
+	now := time.Now()
+	for _, j := range m.facetJobs(f.without(JobFilterParamPosted), rates) {
+		for i, days := range jobFacetPostedWithin {
+			if !j.CreatedAt.Before(now.AddDate(0, 0, -days)) {
+				c.PostedWithin[i]++
+			}
+		}
+	}
+	for _, j := range m.facetJobs(f.without(JobFilterParamQuickApply), rates) {
+		if quickApplyRe.MatchString(j.HowToApply) {
+			c.QuickApply++
+		}
+	}
+	for _, j := range m.facetJobs(f.without(JobFilterParamSponsored), rates) {
+		if j.AdType == JobAdSponsoredBackground {
+			c.Sponsored++
+		}
+	}
+	companies := make(map[int]int)
+	for _, j := range m.facetJobs(f.without(JobFilterParamCompany), rates) {
+		if _, ok := m.companies[j.CompanyID]; ok {
+			companies[j.CompanyID]++
+		}
+	}
+	for id, count := range companies {
+		c.Companies = append(c.Companies, jobFacetValueCount{m.companies[id].Slug, m.companies[id].Name, count})
+	}
+	skills := make(map[string]int)
+	for _, j := range m.facetJobs(f, rates) {
+		for _, s := range j.Skills {
+			skills[s]++
+		}
+	}
+	for slug, count := range skills {
+		if s, ok := SkillBySlug(slug); ok {
+			c.Skills = append(c.Skills, jobFacetValueCount{s.Slug, s.Name, count})
+		}
+	}
+	return c.facets(f), nil
+}
+
+func (m *MemoryStore) GetLastNJobs(max int) ([]*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var jobs []*JobPost
+	matches := m.sortedJobs(func(j *memJob) bool { return j.isApproved() })
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].ApprovedAt.Time.After(matches[b].ApprovedAt.Time)
+	})
+	for i := 0; i < len(matches) && i < max; i++ {
+		jobs = append(jobs, matches[i].post())
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) ApplyToJob(jobID int, cv []byte, email, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[jobID]; !ok {
+		return errors.New("job not found")
+	}
+	if _, ok := m.applyTokens[token]; ok {
+		return errors.New("duplicate apply token")
+	}
+	m.applyTokens[token] = &memApplyToken{JobID: jobID, CreatedAt: time.Now(), Email: email, Cv: cv}
+	return nil
+}
+
+func (m *MemoryStore) ConfirmApplyToJob(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.applyTokens[token]; ok && t.ConfirmedAt == nil {
+		now := time.Now()
+		t.ConfirmedAt = &now
+		m.events = append(m.events, memJobEvent{EventType: jobEventApplication, JobID: t.JobID, CreatedAt: now})
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetJobByApplyToken(token string) (JobPost, Applicant, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.applyTokens[token]
+	if !ok || t.ConfirmedAt != nil || time.Since(t.CreatedAt) > 72*time.Hour {
+		return JobPost{}, Applicant{}, sql.ErrNoRows
+	}
+	j, ok := m.jobs[t.JobID]
+	if !ok || !j.isApproved() {
+		return JobPost{}, Applicant{}, sql.ErrNoRows
+	}
+	return *j.post(), Applicant{Cv: t.Cv, Email: t.Email}, nil
+}
+
+// SaveSEOLocation mirrors the postgres function of the same name so that
+// salary pages can be exercised against the memory store
+func (m *MemoryStore) SaveSEOLocation(name, country, currency string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := m.seoLocations[key]; ok {
+		return ""
+	}
+	m.seoLocations[key] = memSEOLocation{Name: name, Country: country, Currency: currency}
+	return name
+}
+
+func (m *MemoryStore) GetLocation(location string) (string, string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	loc, ok := m.seoLocations[strings.ToLower(location)]
+	if !ok {
+		return "", "", "", sql.ErrNoRows
+	}
+	return loc.Name, loc.Currency, loc.Country, nil
+}
+
+func (m *MemoryStore) salaryJobs(location string) []*memJob {
+	return m.sortedJobs(func(j *memJob) bool {
+		return j.ApprovedAt.Valid && j.Status != JobStatusArchived && !j.SalaryUndisclosed && j.inLocation(location)
+	})
+}
+
+func (m *MemoryStore) GetSalarySamplesForLocation(location string) ([]SalarySample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []SalarySample
+	for _, j := range m.salaryJobs(location) {
+		res = append(res, SalarySample{
+			Min:          int64(j.SalaryPeriod.Annualize(j.SalaryMin)),
+			Max:          int64(j.SalaryPeriod.Annualize(j.SalaryMax)),
+			CurrencyCode: j.SalaryCurrencyCode,
+			CreatedAt:    j.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) SaveExchangeRates(rates []ExchangeRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range rates {
+		replaced := false
+		for i, existing := range m.exchangeRates {
+			if existing.CurrencyCode == r.CurrencyCode && existing.EffectiveDate.Equal(r.EffectiveDate) {
+				m.exchangeRates[i] = r
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.exchangeRates = append(m.exchangeRates, r)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetExchangeRates() ([]ExchangeRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]ExchangeRate(nil), m.exchangeRates...), nil
+}
+
+// linkJobCompany mirrors linkJobCompanyTx, callers hold mu
+func (m *MemoryStore) linkJobCompany(j *memJob) {
+	normalized := normalizeCompanyName(j.Company)
+	domain := companyDomain(j.CompanyURL)
+	var byName, byDomain *memCompany
+	for _, c := range m.companies {
+		if normalized != "" && c.NormalizedName == normalized && (byName == nil || c.ID < byName.ID) {
+			byName = c
+		}
+		if domain != "" && c.Domain == domain && (byDomain == nil || c.ID < byDomain.ID) {
+			byDomain = c
+		}
+	}
+	match := byName
+	if match == nil {
+		match = byDomain
+	}
+	if match == nil {
+		base := slug.Make(j.Company)
+		if base == "" {
+			base = "company"
+		}
+		companySlug := base
+		for i := 2; m.companyBySlug(companySlug) != nil; i++ {
+			companySlug = fmt.Sprintf("%s-%d", base, i)
+		}
+		match = &memCompany{
+			Company: Company{
+				ID:          m.nextCompanyID,
+				Name:        strings.TrimSpace(j.Company),
+				Slug:        companySlug,
+				URL:         strings.TrimSpace(j.CompanyURL),
+				IconImageID: j.CompanyIconID,
+				CreatedAt:   time.Now().UTC(),
+			},
+			NormalizedName: normalized,
+			Domain:         domain,
+		}
+		m.companies[match.ID] = match
+		m.nextCompanyID++
+	}
+	if match.URL == "" {
+		match.URL = strings.TrimSpace(j.CompanyURL)
+	}
+	if match.Domain == "" {
+		match.Domain = domain
+	}
+	if match.IconImageID == "" {
+		match.IconImageID = j.CompanyIconID
+	}
+	j.CompanyID = match.ID
+}
+
+// companyBySlug returns the company with the slug or nil, callers hold mu
+func (m *MemoryStore) companyBySlug(companySlug string) *memCompany {
+	for _, c := range m.companies {
+		if c.Slug == companySlug {
+			return c
+		}
+	}
+	return nil
+}
+
+// companySlug returns the slug of the company of a job, callers hold mu
+func (m *MemoryStore) companySlug(j *memJob) string {
+	if c, ok := m.companies[j.CompanyID]; ok {
+		return c.Slug
+	}
+	return ""
+}
+
+func (m *MemoryStore) CompanyBySlug(companySlug string) (Company, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c := m.companyBySlug(companySlug)
+	if c == nil {
+		return Company{}, sql.ErrNoRows
+	}
+	return c.Company, nil
+}
+
+func (m *MemoryStore) GetCompanyJobs(companyID int) ([]*JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matched []*memJob
+	for _, j := range m.jobs {
+		if j.CompanyID == companyID && j.ApprovedAt.Valid {
+			matched = append(matched, j)
+		}
+	}
+	sort.Slice(matched, func(a, b int) bool { return matched[a].ApprovedAt.Time.After(matched[b].ApprovedAt.Time) })
+	jobs := []*JobPost{}
+	for _, j := range matched {
+		jobs = append(jobs, j.post())
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) GetCompanies() ([]CompanySummary, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byID := make(map[int]*CompanySummary)
+	for _, j := range m.jobs {
+		c, ok := m.companies[j.CompanyID]
+		if !ok || !j.ApprovedAt.Valid {
+			continue
+		}
+		s, ok := byID[c.ID]
+		if !ok {
+			s = &CompanySummary{Company: c.Company}
+			byID[c.ID] = s
+		}
+		if j.isApproved() {
+			s.LiveJobs++
+		}
+		s.TotalJobs++
+		if j.ApprovedAt.Time.After(s.LastJobAt) {
+			s.LastJobAt = j.ApprovedAt.Time
+		}
+	}
+	var companies []CompanySummary
+	for _, s := range byID {
+		companies = append(companies, *s)
+	}
+	sort.Slice(companies, func(a, b int) bool {
+		if companies[a].LiveJobs != companies[b].LiveJobs {
+			return companies[a].LiveJobs > companies[b].LiveJobs
+		}
+		return companies[a].LastJobAt.After(companies[b].LastJobAt)
+	})
+	return companies, nil
+}
+
+func (m *MemoryStore) UpdateCompany(c Company) error {
+	if err := validateCompanyProfile(c); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.companies[c.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	existing.Name = strings.TrimSpace(c.Name)
+	existing.NormalizedName = normalizeCompanyName(c.Name)
+	existing.URL = strings.TrimSpace(c.URL)
+	existing.Domain = companyDomain(c.URL)
+	existing.Description = c.Description
+	existing.HQ = strings.TrimSpace(c.HQ)
+	existing.Size = c.Size
+	return nil
+}
+
+func (m *MemoryStore) SaveMedia(media Media) (string, error) {
+	mediaID, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	media.SHA256 = MediaHash(media.Bytes)
+	m.media[mediaID.String()] = media
+	return mediaID.String(), nil
+}
+
+func (m *MemoryStore) UpdateMedia(media Media, mediaID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.media[mediaID]; ok {
+		media.SHA256 = MediaHash(media.Bytes)
+		m.media[mediaID] = media
+	}
+	return nil
+}
+
+func (m *MemoryStore) PutMedia(mediaID string, media Media) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	media.SHA256 = MediaHash(media.Bytes)
+	m.media[mediaID] = media
+	return nil
+}
+
+func (m *MemoryStore) GetMediaHash(mediaID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	media, ok := m.media[mediaID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return media.SHA256, nil
+}
+
+func (m *MemoryStore) DeleteMedia(mediaID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.media, mediaID)
+	return nil
+}
+
+func (m *MemoryStore) GetMediaIDs() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.media))
+	for id := range m.media {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *MemoryStore) GetMediaByID(mediaID string) (Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	media, ok := m.media[mediaID]
+	if !ok {
+		return Media{}, sql.ErrNoRows
+	}
+	return media, nil
+}
+
+func (m *MemoryStore) GetMetaImage(key string) (MetaImage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	meta, ok := m.metaImages[key]
+	if !ok {
+		return MetaImage{}, sql.ErrNoRows
+	}
+	return meta, nil
+}
+
+func (m *MemoryStore) SaveMetaImage(meta MetaImage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metaImages[meta.Key] = meta
+	return nil
+}
+
+func (m *MemoryStore) SaveTokenSignOn(email, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.signOnTokens[token]; ok {
+		return errors.New("duplicate sign on token")
+	}
+	m.signOnTokens[token] = hashEmail(email)
+	return nil
+}
+
+func (m *MemoryStore) ValidateSignOnToken(token string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokenEmail, ok := m.signOnTokens[token]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+	for _, u := range m.users {
+		if u.Email == tokenEmail {
+			u.CreatedAtHumanised = humanize.Time(u.CreatedAt.UTC())
+			return u, nil
+		}
+	}
+	userID, err := ksuid.NewRandom()
+	if err != nil {
+		return User{}, err
+	}
+	u := User{
+		ID:        userID.String(),
+		Email:     tokenEmail,
+		Username:  GetUsername(),
+		CreatedAt: time.Now(),
+	}
+	u.CreatedAtHumanised = humanize.Time(u.CreatedAt.UTC())
+	m.users[u.ID] = u
+	return u, nil
+}
+
+func (m *MemoryStore) withAuthor(u User) (User, bool) {
+	stored, ok := m.users[u.ID]
+	return stored, ok
+}
+
+func (m *MemoryStore) GetLatestNews(last int) ([]NewsItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var news []NewsItem
+	for i := len(m.news) - 1; i >= 0 && len(news) < last; i-- {
+		n := m.news[i]
+		author, ok := m.withAuthor(n.CreatedBy)
+		if !ok {
+			continue
+		}
+		n.CreatedBy = author
+		n.CreatedAtHumanised = humanize.Time(n.CreatedAt.UTC())
+		news = append(news, n)
+	}
+	return news, nil
+}
+
+func (m *MemoryStore) GetNewsByID(newsID string) (NewsItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, n := range m.news {
+		if n.ID != newsID {
+			continue
+		}
+		author, ok := m.withAuthor(n.CreatedBy)
+		if !ok {
+			break
+		}
+		n.CreatedBy = author
+		n.CreatedAtHumanised = humanize.Time(n.CreatedAt.UTC())
+		return n, nil
+	}
+	return NewsItem{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetNewsComments(newsID string) ([]NewsComment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var comments []NewsComment
+	for i := len(m.newsComments) - 1; i >= 0; i-- {
+		c := m.newsComments[i]
+		if c.Parent != newsID {
+			continue
+		}
+		author, ok := m.withAuthor(c.CreatedBy)
+		if !ok {
+			continue
+		}
+		c.CreatedBy = author
+		c.CreatedAtHumanised = humanize.Time(c.CreatedAt.UTC())
+		comments = append(comments, c)
+	}
+	return comments, nil
+}
+
+func (m *MemoryStore) CreateNewsItem(n NewsItem) error {
+	n, err := newNewsItem(n)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.news = append(m.news, n)
+	return nil
+}
+
+func (m *MemoryStore) CreateNewsComment(c NewsComment) error {
+	c, err := newNewsComment(c)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.newsComments = append(m.newsComments, c)
+	return nil
+}
+
+func (m *MemoryStore) InitiatePaymentEvent(sessionID string, amount int64, currency string, description string, adType int64, email string, jobID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.initiatePaymentEvent(PurchaseEvent{
+		StripeSessionID: sessionID,
+		CreatedAt:       time.Now(),
+		Amount:          int(amount),
+		Currency:        currency,
+		Description:     description,
+		AdType:          int(adType),
+		Email:           email,
+		JobID:           jobID,
+	})
+}
+
+func (m *MemoryStore) initiatePaymentEvent(p PurchaseEvent) error {
+	for _, existing := range m.purchases {
+		if existing.StripeSessionID == p.StripeSessionID {
+			return errors.New("duplicate stripe session id")
+		}
+	}
+	m.purchases = append(m.purchases, &memPurchase{PurchaseEvent: p})
+	return nil
+}
+
+func (m *MemoryStore) InitiateRenewalPaymentEvent(sessionID string, amount int64, currency string, description string, email string, jobID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[jobID]
+	if !ok {
+		return nil
+	}
+	return m.initiatePaymentEvent(PurchaseEvent{
+		StripeSessionID: sessionID,
+		CreatedAt:       time.Now(),
+		Amount:          int(amount),
+		Currency:        currency,
+		Description:     description,
+		AdType:          int(j.AdType),
+		Email:           email,
+		JobID:           jobID,
+		IsRenewal:       true,
+	})
+}
+
+func (m *MemoryStore) SaveSuccessfulPayment(sessionID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var affected int
+	for _, p := range m.purchases {
+		if p.StripeSessionID == sessionID && !p.Completed {
+			p.Completed = true
+			p.CompletedAt = time.Now()
+			affected++
+		}
+	}
+	return affected, nil
+}
+
+func (m *MemoryStore) GetPurchaseEventBySessionID(sessionID string) (PurchaseEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.purchases {
+		if p.StripeSessionID == sessionID {
+			return p.PurchaseEvent, nil
+		}
+	}
+	return PurchaseEvent{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetPurchaseEvents(jobID int) ([]PurchaseEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var purchases []PurchaseEvent
+	for _, p := range m.purchases {
+		if p.JobID == jobID && p.Completed {
+			event := p.PurchaseEvent
+			event.Amount = event.Amount / 100
+			purchases = append(purchases, event)
+		}
+	}
+	return purchases, nil
+}
+
+func (m *MemoryStore) GetJobByStripeSessionID(sessionID string) (JobPost, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.purchases {
+		if p.StripeSessionID != sessionID {
+			continue
+		}
+		j, ok := m.jobs[p.JobID]
+		if !ok {
+			break
+		}
+		return *j.post(), nil
+	}
+	return JobPost{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) trackJobEvent(eventType string, jobID int, v JobVisitor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.jobs[jobID]; !ok {
+		return errors.New("job not found")
+	}
+	m.events = append(m.events, memJobEvent{EventType: eventType, JobID: jobID, Visitor: v, CreatedAt: time.Now()})
+	return nil
+}
+
+func (m *MemoryStore) TrackJobView(job *JobPost, v JobVisitor) error {
+	return m.trackJobEvent(jobEventPageView, job.ID, v)
+}
+
+func (m *MemoryStore) TrackJobClickout(jobID int, v JobVisitor) error {
+	return m.trackJobEvent(jobEventClickout, jobID, v)
+}
+
+func (m *MemoryStore) SaveJobEvents(events []JobEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range events {
+		if _, ok := m.jobs[e.JobID]; ok {
+			m.events = append(m.events, memJobEvent{EventType: e.Type, JobID: e.JobID, Visitor: e.Visitor, CreatedAt: e.CreatedAt})
+		}
+	}
+	return nil
+}
+
+// memEventCounter mirrors jobEventUniqueSQL, visitors are counted once
+type memEventCounter struct {
+	JobEventCount
+	visitors map[string]bool
+}
+
+func (c *memEventCounter) add(e memJobEvent) {
+	c.Raw++
+	if e.Visitor.Bot {
+		return
+	}
+	if e.Visitor.Hash != "" {
+		if c.visitors == nil {
+			c.visitors = make(map[string]bool)
+		}
+		if c.visitors[e.Visitor.Hash] {
+			return
+		}
+		c.visitors[e.Visitor.Hash] = true
+	}
+	c.Unique++
+}
+
+func (m *MemoryStore) countJobEvents(eventType string, jobID int) JobEventCount {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var count memEventCounter
+	for _, e := range m.events {
+		if e.JobID == jobID && e.EventType == eventType {
+			count.add(e)
+		}
+	}
+	return count.JobEventCount
+}
+
+func (m *MemoryStore) GetViewCountForJob(jobID int) (JobEventCount, error) {
+	return m.countJobEvents(jobEventPageView, jobID), nil
+}
+
+func (m *MemoryStore) GetClickoutCountForJob(jobID int) (JobEventCount, error) {
+	return m.countJobEvents(jobEventClickout, jobID), nil
+}
+
+// GetStatsForJob counts every event live, the memory store has no rollups
+func (m *MemoryStore) GetStatsForJob(jobID int) ([]JobStat, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var stats []JobStat
+	type dayCounts struct {
+		clickouts, pageViews memEventCounter
+		applications         int
+	}
+	byDay := make(map[string]*dayCounts)
+	for _, e := range m.events {
+		if e.JobID != jobID {
+			continue
+		}
+		day := e.CreatedAt.UTC().Format("2006-01-02")
+		c, ok := byDay[day]
+		if !ok {
+			c = &dayCounts{}
+			byDay[day] = c
+		}
+		switch e.EventType {
+		case jobEventClickout:
+			c.clickouts.add(e)
+		case jobEventPageView:
+			c.pageViews.add(e)
+		case jobEventApplication:
+			c.applications++
+		}
+	}
+	for day, c := range byDay {
+		stats = append(stats, JobStat{
+			Date:            day,
+			Clickouts:       c.clickouts.Raw,
+			PageViews:       c.pageViews.Raw,
+			UniqueClickouts: c.clickouts.Unique,
+			UniquePageViews: c.pageViews.Unique,
+			Applications:    c.applications,
+		})
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Date < stats[b].Date })
+	return stats, nil
+}
+
+func (m *MemoryStore) RecordAuditEvent(e AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// round trip the diff through JSON like the jsonb column does
+	diff, err := json.Marshal(e.Diff)
+	if err != nil {
+		return err
+	}
+	e.Diff = AuditDiff{}
+	if err := json.Unmarshal(diff, &e.Diff); err != nil {
+		return err
+	}
+	e.ID = len(m.auditEvents) + 1
+	e.CreatedAt = time.Now().UTC()
+	m.auditEvents = append(m.auditEvents, e)
+	return nil
+}
+
+func (m *MemoryStore) GetAuditEvents(f AuditFilter, pageID, perPage int) ([]AuditEvent, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matching []AuditEvent
+	for i := len(m.auditEvents) - 1; i >= 0; i-- {
+		e := m.auditEvents[i]
+		e.ActorEmail = m.users[e.Actor].Email
+		if (f.Actor != "" && e.Actor != f.Actor && (e.ActorEmail == "" || e.ActorEmail != f.Actor)) || (f.Action != "" && e.Action != f.Action) || (f.JobID != 0 && e.JobID != f.JobID) {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	offset := (pageID - 1) * perPage
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(matching) {
+		return nil, len(matching), nil
+	}
+	end := offset + perPage
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[offset:end], len(matching), nil
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MetaImage records the Open Graph image generated for a page. The image is
+// kept in the media store under MediaID, it is current as long as the
+// fields it renders hash to FieldsHash
+type MetaImage struct {
+	Key         string
+	FieldsHash  string
+	MediaID     string
+	GeneratedAt time.Time
+}
+
+// JobMetaImageKey returns the key of the meta image of a job
+func JobMetaImageKey(externalID string) string {
+	return "job/" + externalID
+}
+
+// SalaryMetaImageKey returns the key of the meta image of the salary page of
+// a location
+func SalaryMetaImageKey(location string) string {
+	return "salary/" + location
+}
+
+// LandingMetaImageKey returns the key of the meta image of the jobs landing
+// page of a location and a skill
+func LandingMetaImageKey(location, skillSlug string) string {
+	return "jobs/" + location + "/" + skillSlug
+}
+
+// NewsMetaImageKey returns the key of the meta image of a news thread
+func NewsMetaImageKey(newsID string) string {
+	return "news/" + newsID
+}
+
+// GetMetaImage returns the meta image recorded for a page, sql.ErrNoRows
+// when none was generated yet
+func GetMetaImage(conn *sql.DB, key string) (MetaImage, error) {
+	m := MetaImage{Key: key}
+	err := conn.QueryRow(
+		`SELECT fields_hash, media_id, generated_at FROM meta_image WHERE key = $1`,
+		key,
+	).Scan(&m.FieldsHash, &m.MediaID, &m.GeneratedAt)
+	if err != nil {
+		return MetaImage{}, err
+	}
+	return m, nil
+}
+
+// SaveMetaImage records the meta image of a page, replacing the previous one
+func SaveMetaImage(conn *sql.DB, m MetaImage) error {
+	_, err := conn.Exec(
+		`INSERT INTO meta_image (key, fields_hash, media_id, generated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET fields_hash = EXCLUDED.fields_hash, media_id = EXCLUDED.media_id, generated_at = EXCLUDED.generated_at`,
+		m.Key,
+		m.FieldsHash,
+		m.MediaID,
+		m.GeneratedAt,
+	)
+	return err
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultMigrationsDir is where migration files live relative to the
+// working directory, the same way templates are loaded from static/views
+const DefaultMigrationsDir = "migrations"
+
+// ErrPendingMigrations is returned when the database schema is behind the
+// migration files on disk
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+// migrationLockKey is the key of the postgres advisory lock held while
+// migrating, so that two runners do not apply the same migrations at once
+const migrationLockKey = 0x676f6c616e67 // "golang"
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change loaded from
+// <version>_<name>.up.sql and its optional <version>_<name>.down.sql
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads every migration file in dir and returns them sorted by version
+func LoadMigrations(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has mismatching names %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(content)
+			sum := sha256.Sum256(content)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(content)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing its up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func ensureMigrationsTable(conn *sql.DB) error {
+	_, err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER NOT NULL,
+		name       VARCHAR(255) NOT NULL,
+		checksum   CHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (version)
+	)`)
+	return err
+}
+
+func GetAppliedMigrations(conn *sql.DB) ([]AppliedMigration, error) {
+	var applied []AppliedMigration
+	if err := ensureMigrationsTable(conn); err != nil {
+		return applied, err
+	}
+	rows, err := conn.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version ASC`)
+	if err != nil {
+		return applied, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return applied, err
+		}
+		applied = append(applied, a)
+	}
+
+	return applied, rows.Err()
+}
+
+// GetMigrationStatus matches migration files against schema_migrations. It
+// fails if an applied migration has been edited or removed from disk
+func GetMigrationStatus(conn *sql.DB, migrations []Migration) ([]MigrationStatus, error) {
+	applied, err := GetAppliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+	appliedByVersion := make(map[int]AppliedMigration, len(applied))
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Migration: m}
+		if a, ok := appliedByVersion[m.Version]; ok {
+			if a.Checksum != m.Checksum {
+				return nil, fmt.Errorf("checksum mismatch for applied migration %d_%s: database has %s, file has %s", m.Version, m.Name, a.Checksum, m.Checksum)
+			}
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			delete(appliedByVersion, m.Version)
+		}
+		status = append(status, s)
+	}
+	for _, a := range appliedByVersion {
+		return nil, fmt.Errorf("applied migration %d_%s not found on disk", a.Version, a.Name)
+	}
+
+	return status, nil
+}
+
+// PendingMigrations returns the migrations in dir that have not been applied yet
+func PendingMigrations(conn *sql.DB, dir string) ([]Migration, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	status, err := GetMigrationStatus(conn, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// withMigrationLock runs f holding the migration advisory lock, waiting for
+// any other runner to release it first. The lock belongs to the session that
+// took it, a connection is kept out of the pool until it is released
+func withMigrationLock(conn *sql.DB, f func() ([]Migration, error)) (done []Migration, err error) {
+	ctx := context.Background()
+	lockConn, err := conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lockConn.Close()
+	if _, err := lockConn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, unlockErr := lockConn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return f()
+}
+
+// MigrateUp applies up to steps pending migrations in order, all of them when
+// steps is zero. Each migration runs in its own transaction
+func MigrateUp(conn *sql.DB, dir string, steps int) ([]Migration, error) {
+	return withMigrationLock(conn, func() ([]Migration, error) {
+		return migrateUp(conn, dir, steps)
+	})
+}
+
+func migrateUp(conn *sql.DB, dir string, steps int) ([]Migration, error) {
+	pending, err := PendingMigrations(conn, dir)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	var done []Migration
+	for _, m := range pending {
+		tx, err := conn.Begin()
+		if err != nil {
+			return done, err
+		}
+		if _, err := tx.Exec(m.Up); err != nil {
+			tx.Rollback()
+			return done, fmt.Errorf("migration %d_%s up: %v", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, NOW())`, m.Version, m.Name, m.Checksum); err != nil {
+			tx.Rollback()
+			return done, err
+		}
+		if err := tx.Commit(); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first
+func MigrateDown(conn *sql.DB, dir string, steps int) ([]Migration, error) {
+	return withMigrationLock(conn, func() ([]Migration, error) {
+		return migrateDown(conn, dir, steps)
+	})
+}
+
+func migrateDown(conn *sql.DB, dir string, steps int) ([]Migration, error) {
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	status, err := GetMigrationStatus(conn, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(status) - 1; i >= 0 && len(done) < steps; i-- {
+		m := status[i]
+		if !m.Applied {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		tx, err := conn.Begin()
+		if err != nil {
+			return done, err
+		}
+		if _, err := tx.Exec(m.Down); err != nil {
+			tx.Rollback()
+			return done, fmt.Errorf("migration %d_%s down: %v", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+			tx.Rollback()
+			return done, err
+		}
+		if err := tx.Commit(); err != nil {
+			return done, err
+		}
+		done = append(done, m.Migration)
+	}
+
+	return done, nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// RankingWeights blend the signals jobs are ranked by. RecencyHalfLifeDays is
+// the age at which the recency of a job is worth half that of a job posted
+// now
+type RankingWeights struct {
+	Text                float64
+	Recency             float64
+	RecencyHalfLifeDays float64
+	Quality             float64
+	Placement           float64
+}
+
+// DefaultRankingWeights favour text relevance on searches and recency
+// otherwise, quality and paid placement nudge jobs of a similar age
+var DefaultRankingWeights = RankingWeights{
+	Text:                2,
+	Recency:             1,
+	RecencyHalfLifeDays: 14,
+	Quality:             0.3,
+	Placement:           0.5,
+}
+
+// jobQualityDescriptionLength is the description length, in characters,
+// above which a description counts as complete
+const jobQualityDescriptionLength = 2000
+
+// JobRank explains the position of a job in a listing. Text, Recency,
+// Quality and Placement are between 0 and 1, Score is their weighted sum
+type JobRank struct {
+	Text      float64
+	Recency   float64
+	Quality   float64
+	Placement float64
+	Score     float64
+}
+
+// Weighted returns the contribution of each signal to the score, in the
+// order Text, Recency, Quality, Placement
+func (r JobRank) Weighted(w RankingWeights) []float64 {
+	return []float64{r.Text * w.Text, r.Recency * w.Recency, r.Quality * w.Quality, r.Placement * w.Placement}
+}
+
+// rankingSQL returns the columns of the ranking signals and the score as of
+// a point in time, text is the relevance of the job to the search, `0` when
+// there is none
+func rankingSQL(w RankingWeights, text string, asOf time.Time) string {
+	halfLife := w.RecencyHalfLifeDays
+	if halfLife <= 0 {
+		halfLife = DefaultRankingWeights.RecencyHalfLifeDays
+	}
+	signals := []string{
+		text,
+		fmt.Sprintf(`exp(-ln(2) * GREATEST(EXTRACT(EPOCH FROM ('%s'::timestamp - created_at)), 0) / 86400 / %f)`, asOf.UTC().Format(sqlTimestampFormat), halfLife),
+		fmt.Sprintf(`(CASE WHEN salary_undisclosed THEN 0 ELSE 1 END + LEAST(length(description), %d) / %d.0 + CASE WHEN COALESCE(company_icon_image_id, '') = '' THEN 0 ELSE 1 END) / 3.0`, jobQualityDescriptionLength, jobQualityDescriptionLength),
+		fmt.Sprintf(`CASE WHEN ad_type = %d THEN 0 ELSE 1 END`, JobAdBasic),
+	}
+	weights := []float64{w.Text, w.Recency, w.Quality, w.Placement}
+	score := make([]string, len(signals))
+	for i, s := range signals {
+		score[i] = fmt.Sprintf(`%f * %s`, weights[i], s)
+	}
+	return fmt.Sprintf(`%s AS rank_text, %s AS rank_recency, %s AS rank_quality, %s AS rank_placement, %s AS rank_score`, signals[0], signals[1], signals[2], signals[3], strings.Join(score, " + "))
+}
+
+// sqlTimestampFormat formats times for TIMESTAMP columns
+const sqlTimestampFormat = "2006-01-02 15:04:05.999999"
+
+// rankingColumns are the columns of rankingSQL
+const rankingColumns = `rank_text, rank_recency, rank_quality, rank_placement, rank_score`
+
+// rankJob mirrors rankingSQL, text is the relevance of the job to the
+// search
+func rankJob(j JobPostForEdit, w RankingWeights, text float64, now time.Time) JobRank {
+	halfLife := w.RecencyHalfLifeDays
+	if halfLife <= 0 {
+		halfLife = DefaultRankingWeights.RecencyHalfLifeDays
+	}
+	r := JobRank{Text: text}
+	r.Recency = math.Exp(-math.Ln2 * math.Max(now.Sub(j.CreatedAt).Hours(), 0) / 24 / halfLife)
+	if !j.SalaryUndisclosed {
+		r.Quality++
+	}
+	r.Quality += math.Min(float64(len([]rune(j.JobDescription))), jobQualityDescriptionLength) / jobQualityDescriptionLength
+	if j.CompanyIconID != "" {
+		r.Quality++
+	}
+	r.Quality /= 3
+	if j.AdType != JobAdBasic {
+		r.Placement = 1
+	}
+	r.Score = w.Text*r.Text + w.Recency*r.Recency + w.Quality*r.Quality + w.Placement*r.Placement
+	return r
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SalaryPeriod string
+
+const (
+	SalaryPeriodHourly  SalaryPeriod = "hourly"
+	SalaryPeriodDaily   SalaryPeriod = "daily"
+	SalaryPeriodMonthly SalaryPeriod = "monthly"
+	SalaryPeriodYearly  SalaryPeriod = "yearly"
+)
+
+// salaryPeriodsPerYear is used to compare salaries paid over different
+// periods, assuming 40 hours a week and 260 working days a year
+var salaryPeriodsPerYear = map[SalaryPeriod]int{
+	SalaryPeriodHourly:  2080,
+	SalaryPeriodDaily:   260,
+	SalaryPeriodMonthly: 12,
+	SalaryPeriodYearly:  1,
+}
+
+var salaryPeriodSuffix = map[SalaryPeriod]string{
+	SalaryPeriodHourly:  "/hour",
+	SalaryPeriodDaily:   "/day",
+	SalaryPeriodMonthly: "/month",
+}
+
+var salaryPeriodSchemaUnit = map[SalaryPeriod]string{
+	SalaryPeriodHourly:  "HOUR",
+	SalaryPeriodDaily:   "DAY",
+	SalaryPeriodMonthly: "MONTH",
+	SalaryPeriodYearly:  "YEAR",
+}
+
+func (p SalaryPeriod) Valid() bool {
+	_, ok := salaryPeriodsPerYear[p]
+	return ok
+}
+
+// Annualize converts an amount paid over the period to a yearly amount
+func (p SalaryPeriod) Annualize(amount int) int {
+	if !p.Valid() {
+		return amount
+	}
+	return amount * salaryPeriodsPerYear[p]
+}
+
+// SchemaUnit returns the unitText used by schema.org for the period
+func (p SalaryPeriod) SchemaUnit() string {
+	if !p.Valid() {
+		return salaryPeriodSchemaUnit[SalaryPeriodYearly]
+	}
+	return salaryPeriodSchemaUnit[p]
+}
+
+// annualSalarySQL converts a salary column to a yearly amount, it mirrors
+// SalaryPeriod.Annualize
+func annualSalarySQL(column string) string {
+	return fmt.Sprintf(`(%s * CASE salary_period WHEN 'hourly' THEN 2080 WHEN 'daily' THEN 260 WHEN 'monthly' THEN 12 ELSE 1 END)`, column)
+}
+
+type SalaryCurrency struct {
+	Code   string
+	Symbol string
+}
+
+// SalaryCurrencies lists the ISO 4217 currencies jobs can be posted in
+var SalaryCurrencies = []SalaryCurrency{
+	{"USD", "$"},
+	{"GBP", "£"},
+	{"EUR", "€"},
+	{"AUD", "A$"},
+	{"CAD", "C$"},
+	{"SGD", "S$"},
+	{"CHF", "Fr"},
+	{"INR", "₹"},
+	{"RUB", "₽"},
+	{"JPY", "¥"},
+}
+
+const defaultSalaryCurrencyCode = "USD"
+
+// SalaryCurrencySymbol returns the symbol of an ISO 4217 currency code
+func SalaryCurrencySymbol(code string) string {
+	for _, c := range SalaryCurrencies {
+		if c.Code == code {
+			return c.Symbol
+		}
+	}
+	return code
+}
+
+// SalaryCurrencyCode returns the ISO 4217 code of a currency symbol, `$`
+// is taken to be USD
+func SalaryCurrencyCode(symbol string) string {
+	for _, c := range SalaryCurrencies {
+		if c.Symbol == symbol {
+			return c.Code
+		}
+	}
+	return defaultSalaryCurrencyCode
+}
+
+// IsSalaryCurrencyCode reports whether jobs can be posted in the currency
+func IsSalaryCurrencyCode(code string) bool {
+	for _, c := range SalaryCurrencies {
+		if c.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Salary is the pay of a job. Min and Max are paid over Period in
+// CurrencyCode, they are zero when the salary is not disclosed. EquityMin
+// and EquityMax are percentages and are optional when Equity is set
+type Salary struct {
+	Min          int
+	Max          int
+	CurrencyCode string
+	Period       SalaryPeriod
+	Undisclosed  bool
+	Equity       bool
+	EquityMin    float64
+	EquityMax    float64
+}
+
+func (s Salary) CurrencySymbol() string {
+	return SalaryCurrencySymbol(s.CurrencyCode)
+}
+
+// RangeString formats the salary as shown on job listings, eg.
+// `$100k - $130k + equity` or `€500 - €600/day`
+func (s Salary) RangeString() string {
+	var str string
+	if s.Undisclosed {
+		str = "Salary not disclosed"
+	} else {
+		str = SalaryToSalaryRangeString(s.Min, s.Max, s.CurrencySymbol()) + salaryPeriodSuffix[s.Period]
+	}
+	if !s.Equity {
+		return str
+	}
+	switch {
+	case s.EquityMin > 0 && s.EquityMax > 0 && s.EquityMin != s.EquityMax:
+		return fmt.Sprintf("%s + %s%% - %s%% equity", str, formatEquity(s.EquityMin), formatEquity(s.EquityMax))
+	case s.EquityMax > 0:
+		return fmt.Sprintf("%s + %s%% equity", str, formatEquity(s.EquityMax))
+	case s.EquityMin > 0:
+		return fmt.Sprintf("%s + %s%% equity", str, formatEquity(s.EquityMin))
+	}
+	return str + " + equity"
+}
+
+func formatEquity(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parseSalary validates the salary fields of a job request. currencySymbol
+// is only used by clients that do not send an ISO currency code yet
+func parseSalary(salaryMin, salaryMax, currencyCode, currencySymbol, period string, undisclosed, equity bool, equityMin, equityMax string) (Salary, error) {
+	s := Salary{
+		CurrencyCode: strings.ToUpper(strings.TrimSpace(currencyCode)),
+		Period:       SalaryPeriod(period),
+		Undisclosed:  undisclosed,
+		Equity:       equity,
+	}
+	if s.CurrencyCode == "" {
+		s.CurrencyCode = SalaryCurrencyCode(currencySymbol)
+	}
+	if !IsSalaryCurrencyCode(s.CurrencyCode) {
+		return s, fmt.Errorf("unsupported salary currency %q", s.CurrencyCode)
+	}
+	if s.Period == "" {
+		s.Period = SalaryPeriodYearly
+	}
+	if !s.Period.Valid() {
+		return s, fmt.Errorf("invalid salary period %q", period)
+	}
+	if !undisclosed {
+		var err error
+		if s.Min, err = strconv.Atoi(strings.TrimSpace(salaryMin)); err != nil {
+			return s, err
+		}
+		if s.Max, err = strconv.Atoi(strings.TrimSpace(salaryMax)); err != nil {
+			return s, err
+		}
+		if s.Min < 1 || s.Max < s.Min {
+			return s, fmt.Errorf("invalid salary range %d - %d", s.Min, s.Max)
+		}
+	}
+	if equity {
+		var err error
+		if s.EquityMin, err = parseEquity(equityMin); err != nil {
+			return s, err
+		}
+		if s.EquityMax, err = parseEquity(equityMax); err != nil {
+			return s, err
+		}
+		if s.EquityMax > 0 && s.EquityMin > s.EquityMax {
+			return s, fmt.Errorf("invalid equity range %v - %v", s.EquityMin, s.EquityMax)
+		}
+	}
+	return s, nil
+}
+
+func parseEquity(v string) (float64, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 || f > 100 {
+		return 0, fmt.Errorf("invalid equity percentage %v", f)
+	}
+	return f, nil
+}
+
+// nullEquity stores equity percentages that were not given as NULL
+func nullEquity(v float64) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// SalarySample is the yearly salary range of a job in the currency it was
+// posted in
+type SalarySample struct {
+	Min          int64
+	Max          int64
+	CurrencyCode string
+	CreatedAt    time.Time
+}
+
+// GetSalarySamplesForLocation returns the yearly salary ranges of jobs in
+// a location in every currency, jobs that did not disclose their salary are
+// left out
+func GetSalarySamplesForLocation(conn *sql.DB, location string) ([]SalarySample, error) {
+	var res []SalarySample
+	locationFilter, locationArg := jobLocationFilter(location, 1)
+	rows, err := conn.Query(`
+	SELECT `+annualSalarySQL("salary_min")+`, `+annualSalarySQL("salary_max")+`, salary_currency_code, created_at
+		FROM job WHERE approved_at IS NOT NULL AND status <> 'archived' AND NOT salary_undisclosed AND `+locationFilter, locationArg)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s SalarySample
+		if err := rows.Scan(&s.Min, &s.Max, &s.CurrencyCode, &s.CreatedAt); err != nil {
+			return res, err
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// SalaryDataPoints returns the salary ranges of the samples
+func SalaryDataPoints(samples []SalarySample) []SalaryDataPoint {
+	res := make([]SalaryDataPoint, 0, len(samples))
+	for _, s := range samples {
+		res = append(res, SalaryDataPoint{Min: s.Min, Max: s.Max})
+	}
+	return res
+}
+
+// SalaryTrends returns monthly percentiles of the maximum salary of the
+// samples, oldest month first
+func SalaryTrends(samples []SalarySample) []SalaryTrendDataPoint {
+	var res []SalaryTrendDataPoint
+	byMonth := make(map[string][]int64)
+	for _, s := range samples {
+		month := s.CreatedAt.Format("2006-01") + "-01"
+		byMonth[month] = append(byMonth[month], s.Max)
+	}
+	months := make([]string, 0, len(byMonth))
+	for month := range byMonth {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	for _, month := range months {
+		values := byMonth[month]
+		sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+		res = append(res, SalaryTrendDataPoint{
+			Date: month,
+			P10:  percentileDisc(values, 0.10),
+			P25:  percentileDisc(values, 0.25),
+			P50:  percentileDisc(values, 0.50),
+			P75:  percentileDisc(values, 0.75),
+			P90:  percentileDisc(values, 0.90),
+		})
+	}
+	return res
+}
+
+// percentileDisc matches postgres percentile_disc on an ascending sorted slice
+func percentileDisc(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	for i := range sorted {
+		if float64(i+1)/float64(len(sorted)) >= p {
+			return sorted[i]
+		}
+	}
+	return sorted[len(sorted)-1]
+}
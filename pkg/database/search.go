@@ -0,0 +1,224 @@
+package database
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// jobSearchQuery parses user input with websearch_to_tsquery: words are
+// ANDed, `"quoted phrases"` match in order, `-word` excludes and `or`
+// separates alternatives
+const jobSearchQuery = `websearch_to_tsquery('english', $1)`
+
+// search highlights are delimited with control characters so that the
+// snippet can be escaped before they are turned into marks
+const (
+	searchHighlightStart = "\x02"
+	searchHighlightStop  = "\x03"
+)
+
+// jobSearchHeadline returns the ts_headline snippet of the job description
+// for the parsed query
+const jobSearchHeadline = `ts_headline('english', description, query, 'StartSel=` + searchHighlightStart + `, StopSel=` + searchHighlightStop + `, MinWords=12, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "')`
+
+var (
+	searchMarkdownLinkRe = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	searchMarkdownRe     = strings.NewReplacer("*", "", "#", "", "`", "", "\\", "")
+)
+
+// searchHighlightHTML escapes a headline of a markdown description and marks
+// its highlighted terms, the markdown syntax is dropped
+func searchHighlightHTML(headline string) string {
+	headline = searchMarkdownLinkRe.ReplaceAllString(headline, "$1")
+	headline = searchMarkdownRe.Replace(headline)
+	headline = html.EscapeString(strings.Join(strings.Fields(headline), " "))
+	return strings.NewReplacer(searchHighlightStart, "<mark>", searchHighlightStop, "</mark>").Replace(headline)
+}
+
+// webSearchTerm is a word or phrase of a search query
+type webSearchTerm struct {
+	Text    string
+	Exclude bool
+}
+
+// webSearchQuery mirrors websearch_to_tsquery for the memory store, a job
+// matches when it matches any of the alternatives
+type webSearchQuery [][]webSearchTerm
+
+// parseWebSearchQuery splits a query into alternatives separated by `or`,
+// each being quoted phrases or words, optionally excluded with `-`
+func parseWebSearchQuery(q string) webSearchQuery {
+	var query webSearchQuery
+	var alt []webSearchTerm
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		exclude := false
+		if rs[i] == '-' {
+			exclude = true
+			i++
+		}
+		var text string
+		if i < len(rs) && rs[i] == '"' {
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			text = string(rs[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(rs) && !unicode.IsSpace(rs[end]) {
+				end++
+			}
+			text = string(rs[i:end])
+			i = end
+		}
+		text = strings.ToLower(strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}), " "))
+		if text == "" {
+			continue
+		}
+		if text == "or" && !exclude {
+			if len(alt) > 0 {
+				query = append(query, alt)
+			}
+			alt = nil
+			continue
+		}
+		alt = append(alt, webSearchTerm{Text: text, Exclude: exclude})
+	}
+	if len(alt) > 0 {
+		query = append(query, alt)
+	}
+	return query
+}
+
+// terms returns the words and phrases the query looks for
+func (q webSearchQuery) terms() []string {
+	var terms []string
+	for _, alt := range q {
+		for _, t := range alt {
+			if !t.Exclude {
+				terms = append(terms, t.Text)
+			}
+		}
+	}
+	return terms
+}
+
+// searchWeights mirror the weights of job.search_doc, the title counts most
+var searchWeights = []int{8, 4, 2, 1}
+
+// rank returns how well the fields of a job, most important first, match the
+// query, zero when they do not
+func (q webSearchQuery) rank(fields ...string) int {
+	for i := range fields {
+		fields[i] = strings.ToLower(fields[i])
+	}
+	contains := func(text string) bool {
+		for _, f := range fields {
+			if strings.Contains(f, text) {
+				return true
+			}
+		}
+		return false
+	}
+	best := 0
+	for _, alt := range q {
+		// an alternative made only of exclusions matches the jobs that do not
+		// mention them
+		rank, included := 1, false
+		for _, t := range alt {
+			if t.Exclude {
+				if contains(t.Text) {
+					rank = 0
+					break
+				}
+				continue
+			}
+			if !included {
+				rank, included = 0, true
+			}
+			termRank := 0
+			for i, f := range fields {
+				if strings.Contains(f, t.Text) && i < len(searchWeights) {
+					termRank += searchWeights[i]
+				}
+			}
+			if termRank == 0 {
+				rank = 0
+				break
+			}
+			rank += termRank
+		}
+		if rank > best {
+			best = rank
+		}
+	}
+	return best
+}
+
+// headline mirrors ts_headline, it returns the words around the first term
+// found in text with every term highlighted
+func (q webSearchQuery) headline(text string) string {
+	words := strings.Fields(text)
+	first := -1
+	for i, w := range words {
+		if q.mentions(w) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+	from, to := first-10, first+20
+	if from < 0 {
+		from = 0
+	}
+	if to > len(words) {
+		to = len(words)
+	}
+	snippet := words[from:to]
+	for i, w := range snippet {
+		if q.mentions(w) {
+			snippet[i] = searchHighlightStart + w + searchHighlightStop
+		}
+	}
+	return strings.Join(snippet, " ")
+}
+
+// mentions reports whether a word contains one of the words the query looks
+// for
+func (q webSearchQuery) mentions(word string) bool {
+	word = strings.ToLower(word)
+	for _, t := range q.terms() {
+		for _, tw := range strings.Fields(t) {
+			if strings.Contains(word, tw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWebSearchQuery reports whether a search uses quoted phrases or excluded
+// words, which landing page URLs cannot carry
+func IsWebSearchQuery(q string) bool {
+	if strings.Contains(q, `"`) {
+		return true
+	}
+	for _, w := range strings.Fields(q) {
+		if strings.HasPrefix(w, "-") {
+			return true
+		}
+	}
+	return false
+}
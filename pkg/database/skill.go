@@ -0,0 +1,274 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Skill is a technology or domain jobs are tagged with. Slug is what is
+// stored for a job, Name is shown on job pages and used in landing page
+// URLs, Aliases are other ways job descriptions refer to it
+type Skill struct {
+	Slug    string
+	Name    string
+	Aliases []string
+}
+
+// URLName is the skill as it appears in landing page URLs, eg.
+// `/Golang-Google-Cloud-Jobs`
+func (s Skill) URLName() string {
+	return strings.ReplaceAll(s.Name, " ", "-")
+}
+
+// Skills is the curated skill taxonomy, names only use letters, digits and
+// spaces so they survive the landing page URL cleanup
+var Skills = []Skill{
+	{"grpc", "gRPC", nil},
+	{"protobuf", "Protobuf", []string{"protocol buffers", "protocol buffer"}},
+	{"graphql", "GraphQL", nil},
+	{"rest-api", "REST API", []string{"rest apis", "restful"}},
+	{"microservices", "Microservices", []string{"microservice", "micro services", "micro-services"}},
+	{"distributed-systems", "Distributed Systems", []string{"distributed system"}},
+	{"kubernetes", "Kubernetes", []string{"k8s"}},
+	{"docker", "Docker", nil},
+	{"terraform", "Terraform", nil},
+	{"aws", "AWS", []string{"amazon web services"}},
+	{"google-cloud", "Google Cloud", []string{"gcp", "google cloud platform"}},
+	{"azure", "Azure", []string{"microsoft azure"}},
+	{"postgresql", "PostgreSQL", []string{"postgres", "psql"}},
+	{"mysql", "MySQL", []string{"mariadb"}},
+	{"mongodb", "MongoDB", []string{"mongo"}},
+	{"redis", "Redis", nil},
+	{"cassandra", "Cassandra", []string{"scylladb"}},
+	{"elasticsearch", "Elasticsearch", []string{"elastic search", "opensearch"}},
+	{"kafka", "Kafka", []string{"apache kafka"}},
+	{"rabbitmq", "RabbitMQ", nil},
+	{"nats", "NATS", nil},
+	{"prometheus", "Prometheus", nil},
+	{"linux", "Linux", nil},
+	{"devops", "DevOps", []string{"dev ops", "ci/cd", "continuous integration", "continuous delivery", "continuous deployment"}},
+	{"site-reliability", "Site Reliability", []string{"sre", "site reliability engineering", "site reliability engineer"}},
+	{"blockchain", "Blockchain", []string{"ethereum", "web3", "smart contracts"}},
+	{"fintech", "Fintech", []string{"financial technology"}},
+	{"machine-learning", "Machine Learning", []string{"ml", "deep learning"}},
+	{"python", "Python", nil},
+	{"rust", "Rust", nil},
+	{"java", "Java", nil},
+	{"javascript", "JavaScript", []string{"node.js", "nodejs"}},
+	{"typescript", "TypeScript", nil},
+	{"react", "React", []string{"react.js", "reactjs"}},
+}
+
+var skillsBySlug = make(map[string]Skill, len(Skills))
+
+// skillPatterns match any of the names of a skill as a whole word
+var skillPatterns = make(map[string]*regexp.Regexp, len(Skills))
+
+func init() {
+	for _, s := range Skills {
+		skillsBySlug[s.Slug] = s
+		names := []string{regexp.QuoteMeta(strings.ToLower(s.Name))}
+		for _, a := range s.Aliases {
+			names = append(names, regexp.QuoteMeta(a))
+		}
+		skillPatterns[s.Slug] = regexp.MustCompile(`(?i)(?:^|[^\pL\pN+#])(?:` + strings.Join(names, "|") + `)(?:$|[^\pL\pN+#])`)
+	}
+}
+
+// SkillBySlug returns the skill stored for jobs under slug
+func SkillBySlug(slug string) (Skill, bool) {
+	s, ok := skillsBySlug[slug]
+	return s, ok
+}
+
+// SkillByName finds a skill by its name, slug or one of its aliases, case
+// insensitively and treating dashes as spaces as landing page URLs do
+func SkillByName(name string) (Skill, bool) {
+	name = strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(name, "-", " ")), " "))
+	if name == "" {
+		return Skill{}, false
+	}
+	for _, s := range Skills {
+		if strings.ToLower(s.Name) == name || strings.ReplaceAll(s.Slug, "-", " ") == name {
+			return s, true
+		}
+		for _, a := range s.Aliases {
+			if a == name {
+				return s, true
+			}
+		}
+	}
+	return Skill{}, false
+}
+
+// ExtractSkills returns the slugs of the skills mentioned in any of the
+// texts, in taxonomy order
+func ExtractSkills(texts ...string) []string {
+	doc := strings.Join(texts, "\n")
+	skills := []string{}
+	for _, s := range Skills {
+		if skillPatterns[s.Slug].MatchString(doc) {
+			skills = append(skills, s.Slug)
+		}
+	}
+	return skills
+}
+
+// parseSkills validates the skills picked by an employer, when none were
+// sent they are extracted from the title and description of the job
+func parseSkills(skills []string, title, description string) ([]string, error) {
+	if skills == nil {
+		return ExtractSkills(title, description), nil
+	}
+	seen := make(map[string]bool)
+	res := []string{}
+	for _, slug := range skills {
+		if _, ok := SkillBySlug(slug); !ok {
+			return nil, fmt.Errorf("unknown skill %q", slug)
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			res = append(res, slug)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return skillIndex(res[i]) < skillIndex(res[j]) })
+	return res, nil
+}
+
+func skillIndex(slug string) int {
+	for i, s := range Skills {
+		if s.Slug == slug {
+			return i
+		}
+	}
+	return len(Skills)
+}
+
+// skillsOf returns the skills of the given slugs, unknown slugs are skipped
+func skillsOf(slugs []string) []Skill {
+	res := make([]Skill, 0, len(slugs))
+	for _, slug := range slugs {
+		if s, ok := SkillBySlug(slug); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func hasSkill(skills []string, slug string) bool {
+	for _, s := range skills {
+		if s == slug {
+			return true
+		}
+	}
+	return false
+}
+
+type skillQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getJobSkills(conn skillQueryer, jobID int) ([]string, error) {
+	skills := []string{}
+	rows, err := conn.Query(`SELECT skill FROM job_skill WHERE job_id = $1`, jobID)
+	if err != nil {
+		return skills, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return skills, err
+		}
+		skills = append(skills, s)
+	}
+	sort.Slice(skills, func(i, j int) bool { return skillIndex(skills[i]) < skillIndex(skills[j]) })
+	return skills, rows.Err()
+}
+
+// replaceJobSkillsTx tags a job with the given skills in place of the ones it
+// had
+func replaceJobSkillsTx(tx *sql.Tx, jobID int, skills []string) error {
+	if _, err := tx.Exec(`DELETE FROM job_skill WHERE job_id = $1`, jobID); err != nil {
+		return err
+	}
+	for _, s := range skills {
+		if _, err := tx.Exec(`INSERT INTO job_skill (job_id, skill) VALUES ($1, $2)`, jobID, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TagJobsWithoutSkills tags the jobs that have no skills yet with the ones
+// extracted from their title and description. It returns the number of jobs
+// tagged
+func TagJobsWithoutSkills(conn *sql.DB) (int, error) {
+	rows, err := conn.Query(`SELECT id, job_title, description FROM job WHERE NOT EXISTS (SELECT 1 FROM job_skill s WHERE s.job_id = job.id)`)
+	if err != nil {
+		return 0, err
+	}
+	type untagged struct {
+		id                 int
+		title, description string
+	}
+	var jobs []untagged
+	for rows.Next() {
+		var j untagged
+		if err := rows.Scan(&j.id, &j.title, &j.description); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	tagged := 0
+	for _, j := range jobs {
+		skills := ExtractSkills(j.title, j.description)
+		if len(skills) == 0 {
+			continue
+		}
+		tx, err := conn.Begin()
+		if err != nil {
+			return tagged, err
+		}
+		if err := replaceJobSkillsTx(tx, j.id, skills); err != nil {
+			tx.Rollback()
+			return tagged, err
+		}
+		if err := tx.Commit(); err != nil {
+			return tagged, err
+		}
+		tagged++
+	}
+	return tagged, nil
+}
+
+// SaveSEOSkills makes the skill landing pages match the skill taxonomy
+func SaveSEOSkills(conn *sql.DB) error {
+	names := make([]string, 0, len(Skills))
+	for _, s := range Skills {
+		names = append(names, s.Name)
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM seo_skill WHERE name <> ALL($1)`, pq.Array(names)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO seo_skill (name) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`, pq.Array(names)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,454 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// JobStore covers job posts, their edit and apply tokens and the salary and
+// location lookups derived from them
+type JobStore interface {
+	SaveDraft(job *JobRq) (int, error)
+	UpdateJob(job *JobRqUpdate, jobID int, editor string) ([]string, error)
+	RevertJob(jobID, revision int, editor string) ([]string, error)
+	GetJobRevisions(jobID int) ([]JobRevision, error)
+	TransitionJobStatus(jobID int, to JobStatus, actor string) error
+	GetJobStatusTransitions(jobID int) ([]JobStatusTransition, error)
+	SetJobExpiry(jobID int, expiresAt time.Time) error
+	RenewJob(jobID int, expiresAt time.Time, actor string) error
+	GetSimilarLiveJobs(job *JobPost, max int) ([]*JobPost, error)
+	ArchiveJob(jobID int, reason, actor string) error
+	RestoreJob(jobID int, actor string) (JobStatus, error)
+	GetArchivedJobs() ([]ArchivedJob, error)
+	UpdateJobAdType(adType int, jobID int) error
+	SaveTokenForJob(token string, jobID int) error
+	TokenByJobID(jobID int) (string, error)
+	JobPostIDByToken(token string) (int, error)
+	JobIDByCompanyIconID(mediaID string) (int, error)
+	GetJobByExternalID(externalID string) (JobPost, error)
+	JobPostByExternalIDForEdit(externalID string) (*JobPostForEdit, error)
+	JobPostByIDForEdit(jobID int) (*JobPostForEdit, error)
+	JobPostBySlug(slug string) (*JobPost, error)
+	JobPostBySlugAdmin(slug string) (*JobPost, error)
+	GetPendingJobs() ([]*JobPost, error)
+	GetPinnedJobs(w RankingWeights) ([]*JobPost, error)
+	JobsByQuery(f JobFilter, w RankingWeights, after JobCursor, limit int) ([]*JobPost, JobCursor, error)
+	JobCursorAt(f JobFilter, w RankingWeights, asOf time.Time, n int) (JobCursor, error)
+	CountJobs(f JobFilter) (int, error)
+	GetJobFacets(f JobFilter) ([]JobFacet, error)
+	GetLastNJobs(max int) ([]*JobPost, error)
+	ApplyToJob(jobID int, cv []byte, email, token string) error
+	ConfirmApplyToJob(token string) error
+	GetJobByApplyToken(token string) (JobPost, Applicant, error)
+	GetLocation(location string) (string, string, string, error)
+	GetSalarySamplesForLocation(location string) ([]SalarySample, error)
+}
+
+// MediaStore holds uploaded media, in the image table or in one of the
+// backends of pkg/mediastore. Lookups of missing media return sql.ErrNoRows
+type MediaStore interface {
+	SaveMedia(media Media) (string, error)
+	UpdateMedia(media Media, mediaID string) error
+	GetMediaByID(mediaID string) (Media, error)
+	GetMediaHash(mediaID string) (string, error)
+	PutMedia(mediaID string, media Media) error
+	DeleteMedia(mediaID string) error
+	GetMediaIDs() ([]string, error)
+}
+
+// MetaImageStore records the Open Graph images generated for pages, the
+// images themselves are kept in the MediaStore
+type MetaImageStore interface {
+	GetMetaImage(key string) (MetaImage, error)
+	SaveMetaImage(m MetaImage) error
+}
+
+type UserStore interface {
+	SaveTokenSignOn(email, token string) error
+	ValidateSignOnToken(token string) (User, error)
+}
+
+type NewsStore interface {
+	GetLatestNews(last int) ([]NewsItem, error)
+	GetNewsByID(newsID string) (NewsItem, error)
+	GetNewsComments(newsID string) ([]NewsComment, error)
+	CreateNewsItem(n NewsItem) error
+	CreateNewsComment(c NewsComment) error
+}
+
+type PurchaseStore interface {
+	InitiatePaymentEvent(sessionID string, amount int64, currency string, description string, adType int64, email string, jobID int) error
+	InitiateRenewalPaymentEvent(sessionID string, amount int64, currency string, description string, email string, jobID int) error
+	SaveSuccessfulPayment(sessionID string) (int, error)
+	GetPurchaseEventBySessionID(sessionID string) (PurchaseEvent, error)
+	GetPurchaseEvents(jobID int) ([]PurchaseEvent, error)
+	GetJobByStripeSessionID(sessionID string) (JobPost, error)
+}
+
+type EventStore interface {
+	TrackJobView(job *JobPost, v JobVisitor) error
+	TrackJobClickout(jobID int, v JobVisitor) error
+	SaveJobEvents(events []JobEvent) error
+	GetViewCountForJob(jobID int) (JobEventCount, error)
+	GetClickoutCountForJob(jobID int) (JobEventCount, error)
+	GetStatsForJob(jobID int) ([]JobStat, error)
+}
+
+// AuditStore is the append-only log of moderation and billing actions
+type AuditStore interface {
+	RecordAuditEvent(e AuditEvent) error
+	GetAuditEvents(f AuditFilter, pageID, perPage int) ([]AuditEvent, int, error)
+}
+
+// ExchangeRateStore holds the exchange rates salaries are normalised with
+type ExchangeRateStore interface {
+	SaveExchangeRates(rates []ExchangeRate) error
+	GetExchangeRates() ([]ExchangeRate, error)
+}
+
+// CompanyStore holds the companies jobs are linked to
+type CompanyStore interface {
+	CompanyBySlug(slug string) (Company, error)
+	GetCompanyJobs(companyID int) ([]*JobPost, error)
+	GetCompanies() ([]CompanySummary, error)
+	UpdateCompany(c Company) error
+}
+
+// Store is implemented by backends that provide every repository
+type Store interface {
+	JobStore
+	MediaStore
+	MetaImageStore
+	UserStore
+	NewsStore
+	PurchaseStore
+	EventStore
+	AuditStore
+	ExchangeRateStore
+	CompanyStore
+}
+
+// Stores holds the repositories the web server depends on. Each one can be
+// swapped independently, e.g. to serve media from a different backend
+type Stores struct {
+	Jobs       JobStore
+	Media      MediaStore
+	MetaImages MetaImageStore
+	Users      UserStore
+	News       NewsStore
+	Purchases  PurchaseStore
+	Events     EventStore
+	Audit      AuditStore
+	Rates      ExchangeRateStore
+	Companies  CompanyStore
+}
+
+// NewStores uses s for every repository
+func NewStores(s Store) Stores {
+	return Stores{
+		Jobs:       s,
+		Media:      s,
+		MetaImages: s,
+		Users:      s,
+		News:       s,
+		Purchases:  s,
+		Events:     s,
+		Audit:      s,
+		Rates:      s,
+		Companies:  s,
+	}
+}
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
+
+// PostgresStore implements Store on top of the postgres functions in this package
+type PostgresStore struct {
+	conn *sql.DB
+}
+
+func NewPostgresStore(conn *sql.DB) *PostgresStore {
+	return &PostgresStore{conn: conn}
+}
+
+func (s *PostgresStore) SaveDraft(job *JobRq) (int, error) {
+	return SaveDraft(s.conn, job)
+}
+
+func (s *PostgresStore) UpdateJob(job *JobRqUpdate, jobID int, editor string) ([]string, error) {
+	return UpdateJob(s.conn, job, jobID, editor)
+}
+
+func (s *PostgresStore) RevertJob(jobID, revision int, editor string) ([]string, error) {
+	return RevertJob(s.conn, jobID, revision, editor)
+}
+
+func (s *PostgresStore) GetJobRevisions(jobID int) ([]JobRevision, error) {
+	return GetJobRevisions(s.conn, jobID)
+}
+
+func (s *PostgresStore) TransitionJobStatus(jobID int, to JobStatus, actor string) error {
+	return TransitionJobStatus(s.conn, jobID, to, actor)
+}
+
+func (s *PostgresStore) GetJobStatusTransitions(jobID int) ([]JobStatusTransition, error) {
+	return GetJobStatusTransitions(s.conn, jobID)
+}
+
+func (s *PostgresStore) ArchiveJob(jobID int, reason, actor string) error {
+	return ArchiveJob(s.conn, jobID, reason, actor)
+}
+
+func (s *PostgresStore) RestoreJob(jobID int, actor string) (JobStatus, error) {
+	return RestoreJob(s.conn, jobID, actor)
+}
+
+func (s *PostgresStore) GetArchivedJobs() ([]ArchivedJob, error) {
+	return GetArchivedJobs(s.conn)
+}
+
+func (s *PostgresStore) SetJobExpiry(jobID int, expiresAt time.Time) error {
+	return SetJobExpiry(s.conn, jobID, expiresAt)
+}
+
+func (s *PostgresStore) RenewJob(jobID int, expiresAt time.Time, actor string) error {
+	return RenewJob(s.conn, jobID, expiresAt, actor)
+}
+
+func (s *PostgresStore) GetSimilarLiveJobs(job *JobPost, max int) ([]*JobPost, error) {
+	return GetSimilarLiveJobs(s.conn, job, max)
+}
+
+func (s *PostgresStore) UpdateJobAdType(adType int, jobID int) error {
+	return UpdateJobAdType(s.conn, adType, jobID)
+}
+
+func (s *PostgresStore) SaveTokenForJob(token string, jobID int) error {
+	return SaveTokenForJob(s.conn, token, jobID)
+}
+
+func (s *PostgresStore) TokenByJobID(jobID int) (string, error) {
+	return TokenByJobID(s.conn, jobID)
+}
+
+func (s *PostgresStore) JobPostIDByToken(token string) (int, error) {
+	return JobPostIDByToken(s.conn, token)
+}
+
+func (s *PostgresStore) JobIDByCompanyIconID(mediaID string) (int, error) {
+	return JobIDByCompanyIconID(s.conn, mediaID)
+}
+
+func (s *PostgresStore) GetJobByExternalID(externalID string) (JobPost, error) {
+	return GetJobByExternalID(s.conn, externalID)
+}
+
+func (s *PostgresStore) JobPostByExternalIDForEdit(externalID string) (*JobPostForEdit, error) {
+	return JobPostByExternalIDForEdit(s.conn, externalID)
+}
+
+func (s *PostgresStore) JobPostByIDForEdit(jobID int) (*JobPostForEdit, error) {
+	return JobPostByIDForEdit(s.conn, jobID)
+}
+
+func (s *PostgresStore) JobPostBySlug(slug string) (*JobPost, error) {
+	return JobPostBySlug(s.conn, slug)
+}
+
+func (s *PostgresStore) JobPostBySlugAdmin(slug string) (*JobPost, error) {
+	return JobPostBySlugAdmin(s.conn, slug)
+}
+
+func (s *PostgresStore) GetPendingJobs() ([]*JobPost, error) {
+	return GetPendingJobs(s.conn)
+}
+
+func (s *PostgresStore) GetPinnedJobs(w RankingWeights) ([]*JobPost, error) {
+	return GetPinnedJobs(s.conn, w)
+}
+
+func (s *PostgresStore) JobsByQuery(f JobFilter, w RankingWeights, after JobCursor, limit int) ([]*JobPost, JobCursor, error) {
+	return JobsByQuery(s.conn, f, w, after, limit)
+}
+
+func (s *PostgresStore) JobCursorAt(f JobFilter, w RankingWeights, asOf time.Time, n int) (JobCursor, error) {
+	return JobCursorAt(s.conn, f, w, asOf, n)
+}
+
+func (s *PostgresStore) CountJobs(f JobFilter) (int, error) {
+	return CountJobs(s.conn, f)
+}
+
+func (s *PostgresStore) GetJobFacets(f JobFilter) ([]JobFacet, error) {
+	return GetJobFacets(s.conn, f)
+}
+
+func (s *PostgresStore) GetLastNJobs(max int) ([]*JobPost, error) {
+	return GetLastNJobs(s.conn, max)
+}
+
+func (s *PostgresStore) ApplyToJob(jobID int, cv []byte, email, token string) error {
+	return ApplyToJob(s.conn, jobID, cv, email, token)
+}
+
+func (s *PostgresStore) ConfirmApplyToJob(token string) error {
+	return ConfirmApplyToJob(s.conn, token)
+}
+
+func (s *PostgresStore) GetJobByApplyToken(token string) (JobPost, Applicant, error) {
+	return GetJobByApplyToken(s.conn, token)
+}
+
+func (s *PostgresStore) GetLocation(location string) (string, string, string, error) {
+	return GetLocation(s.conn, location)
+}
+
+func (s *PostgresStore) GetSalarySamplesForLocation(location string) ([]SalarySample, error) {
+	return GetSalarySamplesForLocation(s.conn, location)
+}
+
+func (s *PostgresStore) SaveMedia(media Media) (string, error) {
+	return SaveMedia(s.conn, media)
+}
+
+func (s *PostgresStore) UpdateMedia(media Media, mediaID string) error {
+	return UpdateMedia(s.conn, media, mediaID)
+}
+
+func (s *PostgresStore) GetMediaByID(mediaID string) (Media, error) {
+	return GetMediaByID(s.conn, mediaID)
+}
+
+func (s *PostgresStore) GetMediaHash(mediaID string) (string, error) {
+	return GetMediaHash(s.conn, mediaID)
+}
+
+func (s *PostgresStore) PutMedia(mediaID string, media Media) error {
+	return PutMedia(s.conn, mediaID, media)
+}
+
+func (s *PostgresStore) DeleteMedia(mediaID string) error {
+	return DeleteMedia(s.conn, mediaID)
+}
+
+func (s *PostgresStore) GetMediaIDs() ([]string, error) {
+	return GetMediaIDs(s.conn)
+}
+
+func (s *PostgresStore) GetMetaImage(key string) (MetaImage, error) {
+	return GetMetaImage(s.conn, key)
+}
+
+func (s *PostgresStore) SaveMetaImage(m MetaImage) error {
+	return SaveMetaImage(s.conn, m)
+}
+
+func (s *PostgresStore) SaveTokenSignOn(email, token string) error {
+	return SaveTokenSignOn(s.conn, email, token)
+}
+
+func (s *PostgresStore) ValidateSignOnToken(token string) (User, error) {
+	return ValidateSignOnToken(s.conn, token)
+}
+
+func (s *PostgresStore) GetLatestNews(last int) ([]NewsItem, error) {
+	return GetLatestNews(s.conn, last)
+}
+
+func (s *PostgresStore) GetNewsByID(newsID string) (NewsItem, error) {
+	return GetNewsByID(s.conn, newsID)
+}
+
+func (s *PostgresStore) GetNewsComments(newsID string) ([]NewsComment, error) {
+	return GetNewsComments(s.conn, newsID)
+}
+
+func (s *PostgresStore) CreateNewsItem(n NewsItem) error {
+	return CreateNewsItem(s.conn, n)
+}
+
+func (s *PostgresStore) CreateNewsComment(c NewsComment) error {
+	return CreateNewsComment(s.conn, c)
+}
+
+func (s *PostgresStore) InitiatePaymentEvent(sessionID string, amount int64, currency string, description string, adType int64, email string, jobID int) error {
+	return InitiatePaymentEvent(s.conn, sessionID, amount, currency, description, adType, email, jobID)
+}
+
+func (s *PostgresStore) InitiateRenewalPaymentEvent(sessionID string, amount int64, currency string, description string, email string, jobID int) error {
+	return InitiateRenewalPaymentEvent(s.conn, sessionID, amount, currency, description, email, jobID)
+}
+
+func (s *PostgresStore) SaveSuccessfulPayment(sessionID string) (int, error) {
+	return SaveSuccessfulPayment(s.conn, sessionID)
+}
+
+func (s *PostgresStore) GetPurchaseEventBySessionID(sessionID string) (PurchaseEvent, error) {
+	return GetPurchaseEventBySessionID(s.conn, sessionID)
+}
+
+func (s *PostgresStore) GetPurchaseEvents(jobID int) ([]PurchaseEvent, error) {
+	return GetPurchaseEvents(s.conn, jobID)
+}
+
+func (s *PostgresStore) GetJobByStripeSessionID(sessionID string) (JobPost, error) {
+	return GetJobByStripeSessionID(s.conn, sessionID)
+}
+
+func (s *PostgresStore) TrackJobView(job *JobPost, v JobVisitor) error {
+	return TrackJobView(s.conn, job, v)
+}
+
+func (s *PostgresStore) TrackJobClickout(jobID int, v JobVisitor) error {
+	return TrackJobClickout(s.conn, jobID, v)
+}
+
+func (s *PostgresStore) GetViewCountForJob(jobID int) (JobEventCount, error) {
+	return GetViewCountForJob(s.conn, jobID)
+}
+
+func (s *PostgresStore) GetClickoutCountForJob(jobID int) (JobEventCount, error) {
+	return GetClickoutCountForJob(s.conn, jobID)
+}
+
+func (s *PostgresStore) SaveJobEvents(events []JobEvent) error {
+	return SaveJobEvents(s.conn, events)
+}
+
+func (s *PostgresStore) GetStatsForJob(jobID int) ([]JobStat, error) {
+	return GetStatsForJob(s.conn, jobID)
+}
+
+func (s *PostgresStore) RecordAuditEvent(e AuditEvent) error {
+	return RecordAuditEvent(s.conn, e)
+}
+
+func (s *PostgresStore) GetAuditEvents(f AuditFilter, pageID, perPage int) ([]AuditEvent, int, error) {
+	return GetAuditEvents(s.conn, f, pageID, perPage)
+}
+
+func (s *PostgresStore) SaveExchangeRates(rates []ExchangeRate) error {
+	return SaveExchangeRates(s.conn, rates)
+}
+
+func (s *PostgresStore) GetExchangeRates() ([]ExchangeRate, error) {
+	return GetExchangeRates(s.conn)
+}
+
+func (s *PostgresStore) CompanyBySlug(slug string) (Company, error) {
+	return CompanyBySlug(s.conn, slug)
+}
+
+func (s *PostgresStore) GetCompanyJobs(companyID int) ([]*JobPost, error) {
+	return GetCompanyJobs(s.conn, companyID)
+}
+
+func (s *PostgresStore) GetCompanies() ([]CompanySummary, error) {
+	return GetCompanies(s.conn)
+}
+
+func (s *PostgresStore) UpdateCompany(c Company) error {
+	return UpdateCompany(s.conn, c)
+}
@@ -2,6 +2,7 @@ package email
 
 import (
 	"encoding/base64"
+	"net/http"
 
 	sp "github.com/SparkPost/gosparkpost"
 )
@@ -13,8 +14,14 @@ type Client struct {
 }
 
 func NewClient(apiKey string) (Client, error) {
+	return NewClientWithBaseURL(apiKey, "https://api.eu.sparkpost.com", nil)
+}
+
+// NewClientWithBaseURL is NewClient for the SparkPost API served at baseURL,
+// called with httpClient unless it is nil
+func NewClientWithBaseURL(apiKey, baseURL string, httpClient *http.Client) (Client, error) {
 	cfg := &sp.Config{
-		BaseUrl:    "https://api.eu.sparkpost.com",
+		BaseUrl:    baseURL,
 		ApiKey:     apiKey,
 		ApiVersion: 1,
 	}
@@ -23,6 +30,9 @@ func NewClient(apiKey string) (Client, error) {
 	if err != nil {
 		return Client{}, err
 	}
+	if httpClient != nil {
+		client.Client = httpClient
+	}
 
 	return Client{client: client}, nil
 }
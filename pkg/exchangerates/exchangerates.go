@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// Imports exchange rates from a CSV file with one `date,currency,rate` row
+// per rate, e.g. `2020-06-01,EUR,0.8968`. The rate is the number of currency
+// units one USD buys from that date on. A header row is skipped.
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: %s rates.csv", os.Args[0])
+	}
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatalf("unable to open %s: %v", os.Args[1], err)
+	}
+	defer f.Close()
+	rates, err := parseRates(f)
+	if err != nil {
+		log.Fatalf("unable to parse %s: %v", os.Args[1], err)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	if err := database.SaveExchangeRates(conn, rates); err != nil {
+		log.Fatalf("unable to save exchange rates: %v", err)
+	}
+	log.Printf("imported %d exchange rates\n", len(rates))
+}
+
+func parseRates(r io.Reader) ([]database.ExchangeRate, error) {
+	var rates []database.ExchangeRate
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if line == 1 && strings.EqualFold(record[0], "date") {
+			continue
+		}
+		effectiveDate, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+		code := strings.ToUpper(record[1])
+		if len(code) != 3 {
+			return nil, fmt.Errorf("line %d: invalid currency code %q", line, record[1])
+		}
+		rate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[2])
+		}
+		rates = append(rates, database.ExchangeRate{CurrencyCode: code, Rate: rate, EffectiveDate: effectiveDate})
+	}
+}
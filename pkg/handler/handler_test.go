@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/email"
+	"github.com/0x13a/golang.cafe/pkg/ipgeolocation"
+	"github.com/0x13a/golang.cafe/pkg/server"
+	"github.com/0x13a/golang.cafe/pkg/template"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	stripe "github.com/stripe/stripe-go"
+)
+
+const testStripeEndpointSecret = "whsec_test"
+
+// TestMain runs the tests from the root of the repository, where the views
+// and fonts are loaded from
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// sentEmail is an email sent through the fake SparkPost API
+type sentEmail struct {
+	To      string
+	Subject string
+}
+
+// testEnv is a server on the memory store, with Stripe and SparkPost faked
+// by local servers
+type testEnv struct {
+	svr    server.Server
+	store  *database.MemoryStore
+	router *mux.Router
+
+	mu             sync.Mutex
+	emails         []sentEmail
+	stripeSessions int
+
+	sparkPost *httptest.Server
+	stripe    *httptest.Server
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	env := &testEnv{store: database.NewMemoryStore(), router: mux.NewRouter()}
+	env.sparkPost = httptest.NewTLSServer(http.HandlerFunc(env.serveSparkPost))
+	env.stripe = httptest.NewServer(http.HandlerFunc(env.serveStripe))
+	stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{URL: env.stripe.URL}))
+	emailClient, err := email.NewClientWithBaseURL("test", env.sparkPost.URL, env.sparkPost.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{
+		JobsPerPage:          20,
+		StripeKey:            "sk_test",
+		StripeEndpointSecret: testStripeEndpointSecret,
+	}
+	env.svr = server.NewServer(cfg, database.NewStores(env.store), env.router, template.NewTemplate(), emailClient, ipgeolocation.IPGeoLocation{}, sessions.NewCookieStore([]byte("test")))
+	return env
+}
+
+// close stops the fake services, Stripe calls fail from then on
+func (env *testEnv) close() {
+	env.sparkPost.Close()
+	env.stripe.Close()
+	stripe.SetBackend(stripe.APIBackend, nil)
+}
+
+func (env *testEnv) serveSparkPost(w http.ResponseWriter, r *http.Request) {
+	var tx struct {
+		Recipients []struct {
+			Address struct {
+				Email string `json:"email"`
+			} `json:"address"`
+		} `json:"recipients"`
+		Content struct {
+			Subject string `json:"subject"`
+		} `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	env.mu.Lock()
+	for _, to := range tx.Recipients {
+		env.emails = append(env.emails, sentEmail{To: to.Address.Email, Subject: tx.Content.Subject})
+	}
+	env.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"results":{"total_rejected_recipients":0,"total_accepted_recipients":1,"id":"1"}}`)
+}
+
+func (env *testEnv) serveStripe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/checkout/sessions" {
+		http.NotFound(w, r)
+		return
+	}
+	env.mu.Lock()
+	env.stripeSessions++
+	id := fmt.Sprintf("cs_test_%d", env.stripeSessions)
+	env.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"id":%q,"object":"checkout.session"}`, id)
+}
+
+func (env *testEnv) sentEmails() []sentEmail {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return append([]sentEmail(nil), env.emails...)
+}
+
+// serve runs a request through the router of the server
+func (env *testEnv) serve(r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, r)
+	return rec
+}
+
+// approvedJob saves a job and approves it
+func (env *testEnv) approvedJob(t *testing.T, job database.JobRq) int {
+	t.Helper()
+	id, err := env.store.SaveDraft(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.TransitionJobStatus(id, database.JobStatusApproved, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testJob returns a job in location, remote when location is Remote and
+// onsite otherwise
+func testJob(title, location string) database.JobRq {
+	policy := database.RemotePolicyOnsite
+	if location == "Remote" {
+		policy = database.RemotePolicyRemote
+	}
+	return database.JobRq{
+		JobTitle:           title,
+		Company:            "Acme",
+		Location:           location,
+		SalaryMin:          "100000",
+		SalaryMax:          "120000",
+		SalaryCurrency:     "$",
+		SalaryCurrencyCode: "USD",
+		SalaryPeriod:       "yearly",
+		Description:        "Building services in Go",
+		HowToApply:         "jobs@acme.co",
+		Email:              "hr@acme.co",
+		RemotePolicy:       string(policy),
+		AdType:             database.JobAdBasic,
+		CurrencyCode:       "USD",
+	}
+}
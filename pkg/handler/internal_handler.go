@@ -2,23 +2,29 @@ package handler
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/0x13a/golang.cafe/pkg/database"
 	"github.com/0x13a/golang.cafe/pkg/email"
 	"github.com/0x13a/golang.cafe/pkg/imagemeta"
+	"github.com/0x13a/golang.cafe/pkg/imageproc"
 	"github.com/0x13a/golang.cafe/pkg/ipgeolocation"
 	"github.com/0x13a/golang.cafe/pkg/middleware"
 	"github.com/0x13a/golang.cafe/pkg/payment"
 	"github.com/0x13a/golang.cafe/pkg/server"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"github.com/segmentio/ksuid"
 )
 
@@ -156,9 +162,9 @@ func ApplyForJobPageHandler(svr server.Server) http.HandlerFunc {
 		}
 		externalID := r.FormValue("job-id")
 		emailAddr := r.FormValue("email")
-		job, err := database.JobPostByExternalIDForEdit(svr.Conn, externalID)
+		job, err := svr.Jobs.JobPostByExternalIDForEdit(externalID)
 		if err != nil {
-			svr.Log(err, fmt.Sprintf("unable to retrieve job by externalId %d, %v", externalID, err))
+			svr.Log(err, fmt.Sprintf("unable to retrieve job by externalId %s, %v", externalID, err))
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
@@ -180,7 +186,7 @@ func ApplyForJobPageHandler(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		err = database.ApplyToJob(svr.Conn, job.ID, fileBytes, emailAddr, randomTokenStr)
+		err = svr.Jobs.ApplyToJob(job.ID, fileBytes, emailAddr, randomTokenStr)
 		if err != nil {
 			svr.Log(err, "unable to apply for job while saving to db")
 			svr.JSON(w, http.StatusBadRequest, nil)
@@ -205,7 +211,7 @@ func ApplyToJobConfirmation(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		token := vars["token"]
-		job, applicant, err := database.GetJobByApplyToken(svr.Conn, token)
+		job, applicant, err := svr.Jobs.GetJobByApplyToken(token)
 		if err != nil {
 			svr.Render(w, http.StatusBadRequest, "apply-message.html", map[string]interface{}{
 				"Title":       "Invalid Job Application",
@@ -222,7 +228,7 @@ func ApplyToJobConfirmation(svr server.Server) http.HandlerFunc {
 			})
 			return
 		}
-		err = database.ConfirmApplyToJob(svr.Conn, token)
+		err = svr.Jobs.ConfirmApplyToJob(token)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to update apply_token with successfull application for token %s", token))
 			svr.Render(w, http.StatusBadRequest, "apply-message.html", map[string]interface{}{
@@ -249,7 +255,7 @@ func SubmitJobPostWithoutPaymentHandler(svr server.Server) http.HandlerFunc {
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			jobID, err := database.SaveDraft(svr.Conn, jobRq)
+			jobID, err := svr.Jobs.SaveDraft(jobRq)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to save job request: %#v", jobRq))
 				svr.JSON(w, http.StatusBadRequest, nil)
@@ -273,7 +279,7 @@ func SubmitJobPostWithoutPaymentHandler(svr server.Server) http.HandlerFunc {
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			err = database.SaveTokenForJob(svr.Conn, randomTokenStr, jobID)
+			err = svr.Jobs.SaveTokenForJob(randomTokenStr, jobID)
 			if err != nil {
 				svr.Log(err, "unable to generate token")
 				svr.JSON(w, http.StatusBadRequest, nil)
@@ -297,7 +303,7 @@ func SubmitJobPostPaymentUpsellPageHandler(svr server.Server) http.HandlerFunc {
 		if jobRq.CurrencyCode != "USD" && jobRq.CurrencyCode != "EUR" && jobRq.CurrencyCode != "GBP" {
 			jobRq.CurrencyCode = "USD"
 		}
-		jobID, err := database.JobPostIDByToken(svr.Conn, jobRq.Token)
+		jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
 		if err != nil {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
@@ -312,7 +318,7 @@ func SubmitJobPostPaymentUpsellPageHandler(svr server.Server) http.HandlerFunc {
 			svr.Log(err, "unable to send email to admin while upgrading job ad")
 		}
 		if sess != nil {
-			err = database.InitiatePaymentEvent(svr.Conn, sess.ID, payment.AdTypeToAmount(jobRq.AdType), jobRq.CurrencyCode, payment.AdTypeToDescription(jobRq.AdType), jobRq.AdType, jobRq.Email, jobID)
+			err = svr.Purchases.InitiatePaymentEvent(sess.ID, payment.AdTypeToAmount(jobRq.AdType), jobRq.CurrencyCode, payment.AdTypeToDescription(jobRq.AdType), jobRq.AdType, jobRq.Email, jobID)
 			if err != nil {
 				svr.Log(err, "unable to save payment initiated event")
 			}
@@ -336,7 +342,7 @@ func SubmitJobPostPageHandler(svr server.Server) http.HandlerFunc {
 		if jobRq.CurrencyCode != "USD" && jobRq.CurrencyCode != "EUR" && jobRq.CurrencyCode != "GBP" {
 			jobRq.CurrencyCode = "USD"
 		}
-		jobID, err := database.SaveDraft(svr.Conn, jobRq)
+		jobID, err := svr.Jobs.SaveDraft(jobRq)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to save job request: %#v", jobRq))
 			svr.JSON(w, http.StatusBadRequest, nil)
@@ -360,7 +366,7 @@ func SubmitJobPostPageHandler(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		err = database.SaveTokenForJob(svr.Conn, randomTokenStr, jobID)
+		err = svr.Jobs.SaveTokenForJob(randomTokenStr, jobID)
 		if err != nil {
 			svr.Log(err, "unbale to generate token")
 			svr.JSON(w, http.StatusBadRequest, nil)
@@ -375,7 +381,7 @@ func SubmitJobPostPageHandler(svr server.Server) http.HandlerFunc {
 			svr.Log(err, "unable to send email to admin while posting job ad")
 		}
 		if sess != nil {
-			err = database.InitiatePaymentEvent(svr.Conn, sess.ID, payment.AdTypeToAmount(jobRq.AdType), jobRq.CurrencyCode, payment.AdTypeToDescription(jobRq.AdType), jobRq.AdType, jobRq.Email, jobID)
+			err = svr.Purchases.InitiatePaymentEvent(sess.ID, payment.AdTypeToAmount(jobRq.AdType), jobRq.CurrencyCode, payment.AdTypeToDescription(jobRq.AdType), jobRq.AdType, jobRq.Email, jobID)
 			if err != nil {
 				svr.Log(err, "unable to save payment initiated event")
 			}
@@ -387,39 +393,279 @@ func SubmitJobPostPageHandler(svr server.Server) http.HandlerFunc {
 	}
 }
 
+// ExtractSkillsHandler suggests the skills of a job while it is being written
+func ExtractSkillsHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &struct {
+			JobTitle       string `json:"job_title"`
+			JobDescription string `json:"job_description"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			svr.JSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		svr.JSON(w, http.StatusOK, database.ExtractSkills(req.JobTitle, req.JobDescription))
+	}
+}
+
 func RetrieveMediaPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		mediaID := vars["id"]
-		media, err := database.GetMediaByID(svr.Conn, mediaID)
+		w.Header().Set("Vary", "Accept")
+		if id, ok := logoRenditionID(svr, r, mediaID); ok {
+			mediaID = id
+		}
+		// revalidations are answered from the hash without loading the media
+		if r.Header.Get("If-None-Match") != "" {
+			hash, err := svr.Media.GetMediaHash(mediaID)
+			if err == nil && svr.MediaNotModified(w, r, hash) {
+				return
+			}
+		}
+		media, err := svr.Media.GetMediaByID(mediaID)
 		if err != nil {
 			svr.Log(err, "unable to retrieve media by ID")
 			svr.MEDIA(w, http.StatusNotFound, media.Bytes, media.MediaType)
 			return
 		}
-		svr.MEDIA(w, http.StatusOK, media.Bytes, media.MediaType)
+		svr.MEDIAWithETag(w, r, media.Bytes, media.MediaType, media.SHA256)
 	}
 }
 
+// RetrieveMediaMetaPageHandler serves the Open Graph image of a job, it is
+// only generated again when the fields it renders changed
 func RetrieveMediaMetaPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		jobID := vars["id"]
-		job, err := database.GetJobByExternalID(svr.Conn, jobID)
+		job, err := svr.Jobs.GetJobByExternalID(jobID)
 		if err != nil {
 			svr.Log(err, "unable to retrieve job by external ID")
 			svr.MEDIA(w, http.StatusNotFound, []byte{}, "image/png")
 			return
 		}
-		media, err := imagemeta.GenerateImageForJob(job)
-		mediaBytes, err := ioutil.ReadAll(media)
+		meta, err := svr.JobMetaImage(job)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to generate meta image for job %s", jobID))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		if svr.MediaNotModifiedSince(w, r, meta.FieldsHash, meta.GeneratedAt) {
+			return
+		}
+		media, err := svr.Media.GetMediaByID(meta.MediaID)
 		if err != nil {
-			svr.Log(err, "unable to generate media for job ID")
-			svr.MEDIA(w, http.StatusNotFound, mediaBytes, "image/png")
+			svr.Log(err, fmt.Sprintf("unable to retrieve meta image %s for job %s", meta.MediaID, jobID))
+			svr.JSON(w, http.StatusInternalServerError, nil)
 			return
 		}
-		svr.MEDIA(w, http.StatusOK, mediaBytes, "image/png")
+		svr.MEDIAWithETag(w, r, media.Bytes, media.MediaType, meta.FieldsHash)
+	}
+}
+
+// servePageMetaImage serves the meta image of a page, clients revalidate it
+// as the figures it shows change
+func servePageMetaImage(svr server.Server, w http.ResponseWriter, r *http.Request, p server.PageMetaImage) {
+	meta, err := svr.PageMetaImage(p)
+	if err != nil {
+		svr.Log(err, fmt.Sprintf("unable to generate meta image %s", p.Key))
+		svr.JSON(w, http.StatusInternalServerError, nil)
+		return
+	}
+	if svr.MediaNotModifiedSince(w, r, meta.FieldsHash, meta.GeneratedAt) {
+		return
+	}
+	media, err := svr.Media.GetMediaByID(meta.MediaID)
+	if err != nil {
+		svr.Log(err, fmt.Sprintf("unable to retrieve meta image %s of %s", meta.MediaID, p.Key))
+		svr.JSON(w, http.StatusInternalServerError, nil)
+		return
+	}
+	svr.MEDIAWithETag(w, r, media.Bytes, media.MediaType, meta.FieldsHash)
+}
+
+// RetrieveSalaryMetaImageHandler serves the meta image of the salary page of
+// a location
+func RetrieveSalaryMetaImageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		location := strings.ReplaceAll(mux.Vars(r)["location"], "-", " ")
+		p, err := svr.SalaryMetaImage(location)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to retrieve salary stats for location %s", location))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		servePageMetaImage(svr, w, r, p)
+	}
+}
+
+// RetrieveLandingMetaImageHandler serves the meta image of the landing page
+// of the location and skill in the query
+func RetrieveLandingMetaImageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		location, skill := r.URL.Query().Get("l"), r.URL.Query().Get("s")
+		p, err := svr.LandingMetaImage(location, skill)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to count jobs for location %s and skill %s", location, skill))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		servePageMetaImage(svr, w, r, p)
+	}
+}
+
+// RetrieveNewsMetaImageHandler serves the meta image of a news thread
+func RetrieveNewsMetaImageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		newsID := mux.Vars(r)["id"]
+		p, err := svr.NewsMetaImage(newsID)
+		if err == sql.ErrNoRows {
+			svr.MEDIA(w, http.StatusNotFound, []byte{}, "image/png")
+			return
+		}
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to retrieve news %s", newsID))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		servePageMetaImage(svr, w, r, p)
+	}
+}
+
+// jobByEditToken returns the job of an edit token for the admin pages
+func jobByEditToken(svr server.Server, token string) (database.JobPost, error) {
+	jobID, err := svr.Jobs.JobPostIDByToken(token)
+	if err != nil {
+		return database.JobPost{}, err
+	}
+	job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+	if err != nil {
+		return database.JobPost{}, err
+	}
+	return svr.Jobs.GetJobByExternalID(job.ExternalID)
+}
+
+// MetaImagePreviewPageHandler shows the meta image of a job drawn with every
+// template, along with the one it is currently drawn with
+func MetaImagePreviewPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			token := mux.Vars(r)["token"]
+			job, err := jobByEditToken(svr, token)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to find job by token: %s", token))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			svr.Render(w, http.StatusOK, "meta-image-preview.html", map[string]interface{}{
+				"Job":       job,
+				"Token":     token,
+				"Templates": imagemeta.Templates(),
+				"Current":   svr.JobMetaImageTemplate(job).Name(),
+			})
+		},
+	)
+}
+
+// MetaImagePreviewHandler draws the meta image of a job with a template, it
+// is not saved
+func MetaImagePreviewHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			t, ok := imagemeta.TemplateByName(vars["template"])
+			if !ok {
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			job, err := jobByEditToken(svr, vars["token"])
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to find job by token: %s", vars["token"]))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			media, err := svr.PreviewJobMetaImage(job, t)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to preview meta image %s for job %s", t.Name(), job.ExternalID))
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+			w.Write(media)
+		},
+	)
+}
+
+// logoRenditionID returns the id of the rendition of a logo closest to the
+// size requested with `s`, in WebP when the client accepts it. Logos uploaded
+// before renditions have none and are served as they are
+func logoRenditionID(svr server.Server, r *http.Request, mediaID string) (string, bool) {
+	size := 0
+	if n, err := strconv.Atoi(r.URL.Query().Get("s")); err == nil && n > 0 {
+		size = imageproc.RenditionSize(n)
+	}
+	webp := imageproc.AcceptsWebP(r.Header.Get("Accept"))
+	if size == 0 && !webp {
+		return "", false
+	}
+	if size == 0 {
+		size = imageproc.RenditionSizes[len(imageproc.RenditionSizes)-1]
+	}
+	formats := []string{imageproc.FormatPNG, imageproc.FormatJPEG}
+	if webp {
+		formats = append([]string{imageproc.FormatWebP}, formats...)
+	}
+	return svr.LogoRenditionID(mediaID, size, formats)
+}
+
+// processLogo decodes an upload and encodes its renditions, the largest one
+// in PNG or JPEG is the default media of the logo
+func processLogo(b []byte) (imageproc.Rendition, []imageproc.Rendition, error) {
+	logo, err := imageproc.DecodeLogo(b)
+	if err != nil {
+		return imageproc.Rendition{}, nil, err
+	}
+	renditions, err := logo.Renditions()
+	if err != nil {
+		return imageproc.Rendition{}, nil, err
+	}
+	var main imageproc.Rendition
+	for _, r := range renditions {
+		if r.Format == logo.Format && r.Size > main.Size {
+			main = r
+		}
+	}
+	return main, renditions, nil
+}
+
+// logoProcessingStatus returns the status of an upload that could not be
+// processed
+func logoProcessingStatus(err error) int {
+	switch {
+	case errors.Is(err, imageproc.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, imageproc.ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+// saveLogoRenditions stores the renditions of a logo under ids derived from
+// its own, replacing the previous ones
+func saveLogoRenditions(svr server.Server, mediaID string, renditions []imageproc.Rendition) error {
+	for _, r := range renditions {
+		if err := svr.Media.PutMedia(imageproc.RenditionID(mediaID, r.Size, r.Format), database.Media{Bytes: r.Bytes, MediaType: r.MediaType()}); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func UpdateMediaPageHandler(svr server.Server) http.HandlerFunc {
@@ -432,7 +678,7 @@ func UpdateMediaPageHandler(svr server.Server) http.HandlerFunc {
 
 			// limits upload form size to 5mb
 			maxMediaFileSize := 5 * 1024 * 1024
-			allowedMediaTypes := []string{"image/png", "image/jpeg", "image/jpg"}
+			allowedMediaTypes := []string{"image/png", "image/jpeg", "image/jpg", "image/webp"}
 			r.Body = http.MaxBytesReader(w, r.Body, int64(maxMediaFileSize))
 			cv, header, err := r.FormFile("image")
 			if err != nil {
@@ -464,12 +710,47 @@ func UpdateMediaPageHandler(svr server.Server) http.HandlerFunc {
 				svr.JSON(w, http.StatusRequestEntityTooLarge, nil)
 				return
 			}
-			err = database.UpdateMedia(svr.Conn, database.Media{fileBytes, contentType}, mediaID)
+			logo, renditions, err := processLogo(fileBytes)
+			if err != nil {
+				svr.Log(err, "unable to process media image")
+				svr.JSON(w, logoProcessingStatus(err), nil)
+				return
+			}
+			before, err := svr.Media.GetMediaByID(mediaID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve media %s", mediaID))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			err = svr.Media.UpdateMedia(database.Media{Bytes: logo.Bytes, MediaType: logo.MediaType()}, mediaID)
 			if err != nil {
 				svr.Log(err, "unable to update media image to db")
 				svr.JSON(w, http.StatusInternalServerError, nil)
 				return
 			}
+			if err := saveLogoRenditions(svr, mediaID, renditions); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to save renditions of media %s", mediaID))
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			jobID, err := svr.Jobs.JobIDByCompanyIconID(mediaID)
+			if err != nil && err != sql.ErrNoRows {
+				svr.Log(err, fmt.Sprintf("unable to find job for media %s", mediaID))
+			}
+			diff := database.AuditDiff{}.
+				Add("media_type", before.MediaType, logo.MediaType()).
+				Add("size", len(before.Bytes), len(logo.Bytes)).
+				Add("sha256", database.MediaHash(before.Bytes), database.MediaHash(logo.Bytes))
+			diff["media_id"] = database.AuditChange{Before: mediaID, After: mediaID}
+			recordAudit(svr, requestActor(svr, r, database.ActorSystem), database.AuditActionMediaUpdate, jobID, diff)
+			// the logo is drawn in the meta image of the job
+			if jobID != 0 {
+				if job, err := svr.Jobs.JobPostByIDForEdit(jobID); err != nil {
+					svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				} else {
+					svr.GenerateJobMetaImage(job.ExternalID)
+				}
+			}
 			svr.JSON(w, http.StatusOK, nil)
 		},
 	)
@@ -479,7 +760,7 @@ func SaveMediaPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// limits upload form size to 5mb
 		maxMediaFileSize := 5 * 1024 * 1024
-		allowedMediaTypes := []string{"image/png", "image/jpeg", "image/jpg"}
+		allowedMediaTypes := []string{"image/png", "image/jpeg", "image/jpg", "image/webp"}
 		r.Body = http.MaxBytesReader(w, r.Body, int64(maxMediaFileSize))
 		cv, header, err := r.FormFile("image")
 		if err != nil {
@@ -511,12 +792,23 @@ func SaveMediaPageHandler(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusRequestEntityTooLarge, nil)
 			return
 		}
-		id, err := database.SaveMedia(svr.Conn, database.Media{fileBytes, contentType})
+		logo, renditions, err := processLogo(fileBytes)
+		if err != nil {
+			svr.Log(err, "unable to process media image")
+			svr.JSON(w, logoProcessingStatus(err), nil)
+			return
+		}
+		id, err := svr.Media.SaveMedia(database.Media{Bytes: logo.Bytes, MediaType: logo.MediaType()})
 		if err != nil {
 			svr.Log(err, "unable to save media image to db")
 			svr.JSON(w, http.StatusInternalServerError, nil)
 			return
 		}
+		if err := saveLogoRenditions(svr, id, renditions); err != nil {
+			svr.Log(err, fmt.Sprintf("unable to save renditions of media %s", id))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
 		svr.JSON(w, http.StatusOK, map[string]interface{}{"id": id})
 	}
 }
@@ -530,22 +822,190 @@ func UpdateJobPageHandler(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		jobID, err := database.JobPostIDByToken(svr.Conn, jobRq.Token)
+		jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", jobRq.Token))
 			svr.JSON(w, http.StatusNotFound, nil)
 			return
 		}
-		err = database.UpdateJob(svr.Conn, jobRq, jobID)
+		job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+			svr.JSON(w, http.StatusNotFound, nil)
+			return
+		}
+		actor := requestActor(svr, r, database.ActorEmployer)
+		changed, err := svr.Jobs.UpdateJob(jobRq, jobID, actor)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to update job request: %#v", jobRq))
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
+		if imagemeta.JobImageChanged(changed) {
+			svr.GenerateJobMetaImage(job.ExternalID)
+		}
+		if svr.GetConfig().ReviewSubstantiveEdits && job.Status == database.JobStatusApproved && database.IsSubstantiveEdit(changed) && !isAdminRequest(svr, r) {
+			if err := svr.Jobs.TransitionJobStatus(jobID, database.JobStatusPending, actor); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to send edited job id %d back to review", jobID))
+				svr.JSON(w, http.StatusOK, nil)
+				return
+			}
+			recordAudit(svr, actor, database.AuditActionJobStatus, jobID, database.AuditDiff{}.Add("status", job.Status, database.JobStatusPending))
+			err = svr.GetEmail().SendEmail("Diego from Golang Cafe <team@golang.cafe>", email.GolangCafeEmailAddress, jobRq.Email, "Edited Job Ad on Golang Cafe", fmt.Sprintf("Hey! A live Ad on Golang Cafe has changed its %s. Please review https://golang.cafe/manage/%s", strings.Join(changed, ", "), jobRq.Token))
+			if err != nil {
+				svr.Log(err, "unable to send email to admin while sending edited job ad back to review")
+			}
+		}
 		svr.JSON(w, http.StatusOK, nil)
 	}
 }
-func PermanentlyDeleteJobByToken(svr server.Server) http.HandlerFunc {
+
+// RevertJobPageHandler puts back the content of an earlier revision of a job
+func RevertJobPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			decoder := json.NewDecoder(r.Body)
+			revertRq := &database.JobRevertRq{}
+			if err := decoder.Decode(&revertRq); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to parse job revert request: %#v", revertRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			jobID, err := svr.Jobs.JobPostIDByToken(revertRq.Token)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", revertRq.Token))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			actor := requestActor(svr, r, database.ActorSystem)
+			changed, err := svr.Jobs.RevertJob(jobID, revertRq.Revision, actor)
+			if err == sql.ErrNoRows {
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to revert job id %d to revision %d", jobID, revertRq.Revision))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			if len(changed) == 0 {
+				svr.JSON(w, http.StatusOK, nil)
+				return
+			}
+			if imagemeta.JobImageChanged(changed) {
+				if job, err := svr.Jobs.JobPostByIDForEdit(jobID); err != nil {
+					svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				} else {
+					svr.GenerateJobMetaImage(job.ExternalID)
+				}
+			}
+			diff := database.AuditDiff{"revision": {Before: nil, After: revertRq.Revision}}
+			revisions, err := svr.Jobs.GetJobRevisions(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve revisions for job id %d", jobID))
+			} else if len(revisions) > 0 {
+				for _, c := range revisions[0].Changes {
+					diff.Add(c.Field, c.Before, c.After)
+				}
+			}
+			recordAudit(svr, actor, database.AuditActionJobRevert, jobID, diff)
+			svr.JSON(w, http.StatusOK, nil)
+		},
+	)
+}
+
+// ArchiveJobPageHandler takes a job off the site and keeps it around so it
+// can be restored until it gets purged by the jobpurge command
+func ArchiveJobPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			decoder := json.NewDecoder(r.Body)
+			archiveRq := &database.JobArchiveRq{}
+			if err := decoder.Decode(&archiveRq); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to parse job request for archive: %#v", archiveRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			archiveRq.Reason = strings.TrimSpace(archiveRq.Reason)
+			if archiveRq.Reason == "" {
+				svr.JSON(w, http.StatusBadRequest, "a reason is required to archive a job")
+				return
+			}
+			jobID, err := svr.Jobs.JobPostIDByToken(archiveRq.Token)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", archiveRq.Token))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			actor := requestActor(svr, r, database.ActorSystem)
+			err = svr.Jobs.ArchiveJob(jobID, archiveRq.Reason, actor)
+			if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+				svr.JSON(w, http.StatusConflict, nil)
+				return
+			}
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to archive job: %#v", archiveRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			recordAudit(svr, actor, database.AuditActionJobArchive, jobID, database.AuditDiff{}.
+				Add("status", job.Status, database.JobStatusArchived).
+				Add("archive_reason", job.ArchiveReason, archiveRq.Reason))
+			svr.JSON(w, http.StatusOK, nil)
+		},
+	)
+}
+
+// UpdateCompanyPageHandler edits the profile shown on a company page
+func UpdateCompanyPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			companyRq := &struct {
+				Slug        string `json:"slug"`
+				Name        string `json:"name"`
+				URL         string `json:"company_url"`
+				Description string `json:"description"`
+				HQ          string `json:"hq"`
+				Size        string `json:"size"`
+			}{}
+			if err := json.NewDecoder(r.Body).Decode(companyRq); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to parse company request: %#v", companyRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			company, err := svr.Companies.CompanyBySlug(companyRq.Slug)
+			if err != nil {
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			company.Name = companyRq.Name
+			company.URL = companyRq.URL
+			company.Description = companyRq.Description
+			company.HQ = companyRq.HQ
+			company.Size = companyRq.Size
+			if err := svr.Companies.UpdateCompany(company); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to update company %s", companyRq.Slug))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			svr.JSON(w, http.StatusOK, nil)
+		},
+	)
+}
+
+func RestoreJobPageHandler(svr server.Server) http.HandlerFunc {
 	return middleware.AdminAuthenticatedMiddleware(
 		svr.SessionStore,
 		svr.GetJWTSigningKey(),
@@ -553,23 +1013,207 @@ func PermanentlyDeleteJobByToken(svr server.Server) http.HandlerFunc {
 			decoder := json.NewDecoder(r.Body)
 			jobRq := &database.JobRqUpdate{}
 			if err := decoder.Decode(&jobRq); err != nil {
-				svr.Log(err, fmt.Sprintf("unable to parse job request for delete: %#v", jobRq))
+				svr.Log(err, fmt.Sprintf("unable to parse job request for restore: %#v", jobRq))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			jobID, err := database.JobPostIDByToken(svr.Conn, jobRq.Token)
+			jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", jobRq.Token))
 				svr.JSON(w, http.StatusNotFound, nil)
 				return
 			}
-			err = database.DeleteJobCascade(svr.Conn, jobID)
+			job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			actor := requestActor(svr, r, database.ActorSystem)
+			status, err := svr.Jobs.RestoreJob(jobID, actor)
+			if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+				svr.JSON(w, http.StatusConflict, nil)
+				return
+			}
 			if err != nil {
-				svr.Log(err, fmt.Sprintf("unable to permanently delete job: %#v", jobRq))
+				svr.Log(err, fmt.Sprintf("unable to restore job id %d", jobID))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			svr.JSON(w, http.StatusOK, nil)
+			recordAudit(svr, actor, database.AuditActionJobRestore, jobID, database.AuditDiff{}.
+				Add("status", job.Status, status).
+				Add("archive_reason", job.ArchiveReason, ""))
+			svr.JSON(w, http.StatusOK, map[string]interface{}{"status": status})
+		},
+	)
+}
+
+func ListArchivedJobsPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			jobs, err := svr.Jobs.GetArchivedJobs()
+			if err != nil {
+				svr.Log(err, "unable to retrieve archived jobs")
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			svr.Render(w, http.StatusOK, "list-archived-jobs-admin.html", map[string]interface{}{
+				"Jobs":          jobs,
+				"RetentionDays": svr.GetConfig().JobArchiveRetentionDays,
+			})
+		},
+	)
+}
+
+func AuditLogPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			const eventsPerPage = 50
+			q := r.URL.Query()
+			filter := database.AuditFilter{
+				Actor:  strings.TrimSpace(q.Get("actor")),
+				Action: q.Get("action"),
+			}
+			if jobID, err := strconv.Atoi(q.Get("job")); err == nil && jobID > 0 {
+				filter.JobID = jobID
+			}
+			page, err := strconv.Atoi(q.Get("p"))
+			if err != nil || page < 1 {
+				page = 1
+			}
+			events, total, err := svr.Audit.GetAuditEvents(filter, page, eventsPerPage)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve audit events for %#v", filter))
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			pageQuery := url.Values{}
+			if filter.Actor != "" {
+				pageQuery.Set("actor", filter.Actor)
+			}
+			if filter.Action != "" {
+				pageQuery.Set("action", filter.Action)
+			}
+			if filter.JobID != 0 {
+				pageQuery.Set("job", strconv.Itoa(filter.JobID))
+			}
+			var prevPage, nextPage string
+			if page > 1 {
+				pageQuery.Set("p", strconv.Itoa(page-1))
+				prevPage = "/manage/audit?" + pageQuery.Encode()
+			}
+			if page*eventsPerPage < total {
+				pageQuery.Set("p", strconv.Itoa(page+1))
+				nextPage = "/manage/audit?" + pageQuery.Encode()
+			}
+			svr.Render(w, http.StatusOK, "audit.html", map[string]interface{}{
+				"Events":   events,
+				"Total":    total,
+				"Filter":   filter,
+				"Actions":  database.AuditActions,
+				"Page":     page,
+				"PrevPage": prevPage,
+				"NextPage": nextPage,
+			})
+		},
+	)
+}
+
+// rankedJob is a row of the ranking debug view, Weighted holds the
+// contribution of each signal to the score
+type rankedJob struct {
+	Position int
+	Job      *database.JobPost
+	Weighted []float64
+}
+
+func RankingDebugPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			filter := database.ParseJobFilter(q)
+			filter.Query = strings.TrimSpace(q.Get("t"))
+			filter.Location = strings.TrimSpace(q.Get("l"))
+			// the listing is walked with cursors, o is the number of jobs
+			// before the cursor
+			after, err := database.ParseJobCursor(q.Get("c"))
+			if err != nil {
+				after = database.JobCursor{}
+			}
+			offset, err := strconv.Atoi(q.Get("o"))
+			if err != nil || offset < 0 || after.IsStart() {
+				offset = 0
+			}
+			weights := svr.RankingWeights()
+			pinned, err := svr.Jobs.GetPinnedJobs(weights)
+			if err != nil {
+				svr.Log(err, "unable to get pinned jobs")
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			jobs, next, err := svr.Jobs.JobsByQuery(filter, weights, after, svr.GetConfig().JobsPerPage)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to rank jobs for %#v", filter))
+				svr.JSON(w, http.StatusInternalServerError, nil)
+				return
+			}
+			rank := func(jobs []*database.JobPost, offset int) []rankedJob {
+				rows := make([]rankedJob, 0, len(jobs))
+				for i, j := range jobs {
+					rows = append(rows, rankedJob{Position: offset + i + 1, Job: j, Weighted: j.Rank.Weighted(weights)})
+				}
+				return rows
+			}
+			pageQuery := filter.Values()
+			if filter.Query != "" {
+				pageQuery.Set("t", filter.Query)
+			}
+			if filter.Location != "" {
+				pageQuery.Set("l", filter.Location)
+			}
+			var firstPage, nextPage string
+			if !after.IsStart() {
+				firstPage = "/manage/ranking?" + pageQuery.Encode()
+			}
+			if !next.IsStart() {
+				pageQuery.Set("c", next.String())
+				pageQuery.Set("o", strconv.Itoa(offset+len(jobs)))
+				nextPage = "/manage/ranking?" + pageQuery.Encode()
+			}
+			svr.Render(w, http.StatusOK, "ranking-debug.html", map[string]interface{}{
+				"Weights":   weights,
+				"Filter":    filter,
+				"Pinned":    rank(pinned, 0),
+				"Jobs":      rank(jobs, offset),
+				"FirstPage": firstPage,
+				"NextPage":  nextPage,
+			})
+		},
+	)
+}
+
+func ListingCacheStatsHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			svr.JSON(w, http.StatusOK, svr.ListingCacheStats())
+		},
+	)
+}
+
+func EventIngesterStatsHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			svr.JSON(w, http.StatusOK, svr.EventIngesterStats())
 		},
 	)
 }
@@ -586,18 +1230,43 @@ func ApproveJobPageHandler(svr server.Server) http.HandlerFunc {
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			jobID, err := database.JobPostIDByToken(svr.Conn, jobRq.Token)
+			jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", jobRq.Token))
 				svr.JSON(w, http.StatusNotFound, nil)
 				return
 			}
-			err = database.ApproveJob(svr.Conn, jobID)
+			job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			actor := requestActor(svr, r, database.ActorSystem)
+			err = svr.Jobs.TransitionJobStatus(jobID, database.JobStatusApproved, actor)
+			if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+				svr.JSON(w, http.StatusConflict, nil)
+				return
+			}
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to update job request: %#v", jobRq))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
+			diff := database.AuditDiff{}.Add("status", job.Status, database.JobStatusApproved)
+			// resuming a paused job or approving an edit to a live job keeps
+			// its expiry date
+			keepExpiry := (job.Status == database.JobStatusPaused || job.Status == database.JobStatusPending) && job.ExpiresAt.Valid && job.ExpiresAt.Time.After(time.Now())
+			if !keepExpiry {
+				expiresAt := time.Now().UTC().AddDate(0, 0, svr.GetConfig().JobExpiryDays)
+				if err := svr.Jobs.SetJobExpiry(jobID, expiresAt); err != nil {
+					svr.Log(err, fmt.Sprintf("unable to set expiry for job id %d", jobID))
+				} else {
+					diff.Add("expires_at", auditTime(job.ExpiresAt), expiresAt)
+				}
+			}
+			recordAudit(svr, actor, database.AuditActionJobApprove, jobID, diff)
+			svr.GenerateJobMetaImage(job.ExternalID)
 			err = svr.GetEmail().SendEmail("Diego from Golang Cafe <team@golang.cafe>", jobRq.Email, email.GolangCafeEmailAddress, "Your Job Ad on Golang Cafe", fmt.Sprintf("Your Job Ad has been approved and it's currently live on Golang Cafe - https://golang.cafe. You can edit the Job Ad at any time and check page views and clickouts by following this link https://golang.cafe/edit/%s", jobRq.Token))
 			if err != nil {
 				svr.Log(err, "unable to send email while approving job ad")
@@ -608,28 +1277,221 @@ func ApproveJobPageHandler(svr server.Server) http.HandlerFunc {
 }
 
 func DisapproveJobPageHandler(svr server.Server) http.HandlerFunc {
+	return middleware.AdminAuthenticatedMiddleware(
+		svr.SessionStore,
+		svr.GetJWTSigningKey(),
+		func(w http.ResponseWriter, r *http.Request) {
+			decoder := json.NewDecoder(r.Body)
+			jobRq := &database.JobRqUpdate{}
+			if err := decoder.Decode(&jobRq); err != nil {
+				svr.Log(err, fmt.Sprintf("unable to parse job request for update: %#v", jobRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", jobRq.Token))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+				svr.JSON(w, http.StatusNotFound, nil)
+				return
+			}
+			actor := requestActor(svr, r, database.ActorSystem)
+			err = svr.Jobs.TransitionJobStatus(jobID, database.JobStatusRejected, actor)
+			if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+				svr.JSON(w, http.StatusConflict, nil)
+				return
+			}
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to update job request: %#v", jobRq))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			recordAudit(svr, actor, database.AuditActionJobReject, jobID, database.AuditDiff{}.
+				Add("status", job.Status, database.JobStatusRejected).
+				Add("approved_at", auditTime(job.ApprovedAt), nil))
+			svr.JSON(w, http.StatusOK, nil)
+		},
+	)
+}
+
+// UpdateJobStatusPageHandler lets employers pause, resume or mark their job
+// as filled from the edit page. Approval stays with admins, so the only way
+// back to approved from here is resuming a paused job
+func UpdateJobStatusPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
-		jobRq := &database.JobRqUpdate{}
+		statusRq := &database.JobStatusRq{}
+		if err := decoder.Decode(&statusRq); err != nil {
+			svr.Log(err, fmt.Sprintf("unable to parse job status request: %#v", statusRq))
+			svr.JSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		jobID, err := svr.Jobs.JobPostIDByToken(statusRq.Token)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", statusRq.Token))
+			svr.JSON(w, http.StatusNotFound, nil)
+			return
+		}
+		job, err := svr.Jobs.JobPostByIDForEdit(jobID)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+			svr.JSON(w, http.StatusNotFound, nil)
+			return
+		}
+		switch statusRq.Status {
+		case database.JobStatusPaused, database.JobStatusFilled:
+		case database.JobStatusApproved:
+			if job.Status != database.JobStatusPaused {
+				svr.JSON(w, http.StatusForbidden, nil)
+				return
+			}
+		default:
+			svr.JSON(w, http.StatusForbidden, nil)
+			return
+		}
+		actor := requestActor(svr, r, database.ActorEmployer)
+		err = svr.Jobs.TransitionJobStatus(jobID, statusRq.Status, actor)
+		if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+			svr.JSON(w, http.StatusConflict, nil)
+			return
+		}
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to update job status: %#v", statusRq))
+			svr.JSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		recordAudit(svr, actor, database.AuditActionJobStatus, jobID, database.AuditDiff{}.Add("status", job.Status, statusRq.Status))
+		svr.JSON(w, http.StatusOK, nil)
+	}
+}
+
+// RenewJobPageHandler renews a job from the edit page. Renewals are free
+// unless a renewal price is configured, in which case a checkout session is
+// returned and the job is renewed by the stripe webhook
+func RenewJobPageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		jobRq := &database.JobRqUpsell{}
 		if err := decoder.Decode(&jobRq); err != nil {
-			svr.Log(err, fmt.Sprintf("unable to parse job request for update: %#v", jobRq))
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		jobID, err := database.JobPostIDByToken(svr.Conn, jobRq.Token)
+		// validate currency
+		if jobRq.CurrencyCode != "USD" && jobRq.CurrencyCode != "EUR" && jobRq.CurrencyCode != "GBP" {
+			jobRq.CurrencyCode = "USD"
+		}
+		jobID, err := svr.Jobs.JobPostIDByToken(jobRq.Token)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", jobRq.Token))
 			svr.JSON(w, http.StatusNotFound, nil)
 			return
 		}
-		err = database.DisapproveJob(svr.Conn, jobID)
+		job, err := svr.Jobs.JobPostByIDForEdit(jobID)
 		if err != nil {
-			svr.Log(err, fmt.Sprintf("unable to update job request: %#v", jobRq))
+			svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
+			svr.JSON(w, http.StatusNotFound, nil)
+			return
+		}
+		if !isRenewable(job) {
+			svr.JSON(w, http.StatusConflict, nil)
+			return
+		}
+		price := svr.GetConfig().JobRenewalPrice
+		if price == 0 {
+			actor := requestActor(svr, r, database.ActorEmployer)
+			expiresAt := renewalExpiry(svr, job)
+			err := svr.Jobs.RenewJob(jobID, expiresAt, actor)
+			if errors.Is(err, database.ErrInvalidJobStatusTransition) {
+				svr.JSON(w, http.StatusConflict, nil)
+				return
+			}
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to renew job id %d", jobID))
+				svr.JSON(w, http.StatusBadRequest, nil)
+				return
+			}
+			recordAudit(svr, actor, database.AuditActionJobRenew, jobID, renewalAuditDiff(job, expiresAt))
+			svr.JSON(w, http.StatusOK, nil)
+			return
+		}
+		sess, err := payment.CreateRenewalSession(svr.GetConfig().StripeKey, price, jobRq.CurrencyCode, jobRq.Email, jobRq.Token)
+		if err != nil {
+			svr.Log(err, "unable to create renewal payment session")
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		svr.JSON(w, http.StatusOK, nil)
+		err = svr.Purchases.InitiateRenewalPaymentEvent(sess.ID, price, jobRq.CurrencyCode, payment.RenewalDescription, jobRq.Email, jobID)
+		if err != nil {
+			svr.Log(err, "unable to save renewal payment initiated event")
+		}
+		svr.JSON(w, http.StatusOK, map[string]string{"s_id": sess.ID})
+	}
+}
+
+func isRenewable(job *database.JobPostForEdit) bool {
+	return job.Status == database.JobStatusApproved || job.Status == database.JobStatusPaused || job.Status == database.JobStatusExpired
+}
+
+// renewalExpiry extends a job by a full expiry period, counted from its
+// current expiry date when that is still in the future
+func renewalExpiry(svr server.Server, job *database.JobPostForEdit) time.Time {
+	from := time.Now().UTC()
+	if job.ExpiresAt.Valid && job.ExpiresAt.Time.After(from) {
+		from = job.ExpiresAt.Time
+	}
+	return from.AddDate(0, 0, svr.GetConfig().JobExpiryDays)
+}
+
+// formatPrice formats an amount in cents, e.g. 1900 as 19 and 1950 as 19.50
+func formatPrice(cents int64) string {
+	if cents%100 == 0 {
+		return fmt.Sprintf("%d", cents/100)
+	}
+	return fmt.Sprintf("%.2f", float64(cents)/100)
+}
+
+func renewalAuditDiff(job *database.JobPostForEdit, expiresAt time.Time) database.AuditDiff {
+	diff := database.AuditDiff{}.Add("expires_at", auditTime(job.ExpiresAt), expiresAt)
+	if job.Status == database.JobStatusExpired {
+		diff.Add("status", job.Status, database.JobStatusApproved)
+	}
+	return diff
+}
+
+// requestActor identifies who is making a change, the user ID of the signed
+// on user or fallback for anonymous requests
+func requestActor(svr server.Server, r *http.Request, fallback string) string {
+	claims, ok := middleware.GetClaims(r, svr.SessionStore, svr.GetJWTSigningKey())
+	if !ok || claims.UserID == "" {
+		return fallback
 	}
+	return claims.UserID
+}
+
+func isAdminRequest(svr server.Server, r *http.Request) bool {
+	claims, ok := middleware.GetClaims(r, svr.SessionStore, svr.GetJWTSigningKey())
+	return ok && claims.IsAdmin
+}
+
+// recordAudit appends to the audit log. The action has already happened by
+// the time it gets recorded, so failures are only logged
+func recordAudit(svr server.Server, actor, action string, jobID int, diff database.AuditDiff) {
+	err := svr.Audit.RecordAuditEvent(database.AuditEvent{Actor: actor, Action: action, JobID: jobID, Diff: diff})
+	if err != nil {
+		svr.Log(err, fmt.Sprintf("unable to record audit event %s for job id %d", action, jobID))
+	}
+}
+
+func auditTime(t pq.NullTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time
 }
 
 func TrackJobClickoutPageHandler(svr server.Server) http.HandlerFunc {
@@ -641,13 +1503,13 @@ func TrackJobClickoutPageHandler(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		job, err := database.GetJobByExternalID(svr.Conn, externalID)
+		job, err := svr.Jobs.GetJobByExternalID(externalID)
 		if err != nil {
 			svr.Log(err, "unable to get JobID from externalID")
 			svr.JSON(w, http.StatusInternalServerError, nil)
 			return
 		}
-		if err := database.TrackJobClickout(svr.Conn, job.ID); err != nil {
+		if err := svr.Events.TrackJobClickout(job.ID, svr.JobVisitor(r)); err != nil {
 			svr.Log(err, fmt.Sprintf("unable to save job clickout for job id %d. %v", job.ID, err))
 			svr.JSON(w, http.StatusOK, nil)
 			return
@@ -665,13 +1527,13 @@ func TrackJobClickoutAndRedirectToJobPage(svr server.Server) http.HandlerFunc {
 			return
 		}
 		reg, _ := regexp.Compile("[^a-zA-Z0-9 ]+")
-		job, err := database.GetJobByExternalID(svr.Conn, reg.ReplaceAllString(externalID, ""))
+		job, err := svr.Jobs.GetJobByExternalID(reg.ReplaceAllString(externalID, ""))
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to get HowToApply from externalID %s", externalID))
 			svr.JSON(w, http.StatusInternalServerError, nil)
 			return
 		}
-		if err := database.TrackJobClickout(svr.Conn, job.ID); err != nil {
+		if err := svr.Events.TrackJobClickout(job.ID, svr.JobVisitor(r)); err != nil {
 			svr.Log(err, fmt.Sprintf("unable to save job clickout for job id %d. %v", job.ID, err))
 			svr.JSON(w, http.StatusOK, nil)
 			return
@@ -680,6 +1542,21 @@ func TrackJobClickoutAndRedirectToJobPage(svr server.Server) http.HandlerFunc {
 	}
 }
 
+// jobEventCounts returns the views and clickouts of a job shown to its
+// poster, unique visitors unless raw counts are asked for, and the click
+// through rate between them
+func jobEventCounts(views, clickouts database.JobEventCount, raw bool) (int, int, string) {
+	viewCount, clickoutCount := views.Unique, clickouts.Unique
+	if raw {
+		viewCount, clickoutCount = views.Raw, clickouts.Raw
+	}
+	conversionRate := ""
+	if clickoutCount > 0 && viewCount > 0 {
+		conversionRate = fmt.Sprintf("%.2f", float64(float64(clickoutCount)/float64(viewCount)*100))
+	}
+	return viewCount, clickoutCount, conversionRate
+}
+
 func EditJobViewPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -687,35 +1564,33 @@ func EditJobViewPageHandler(svr server.Server) http.HandlerFunc {
 		isCallback := r.URL.Query().Get("callback")
 		paymentSuccess := r.URL.Query().Get("payment")
 		expiredUpsell := r.URL.Query().Get("expired")
-		jobID, err := database.JobPostIDByToken(svr.Conn, token)
+		jobID, err := svr.Jobs.JobPostIDByToken(token)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", token))
 			svr.JSON(w, http.StatusNotFound, nil)
 			return
 		}
-		job, err := database.JobPostByIDForEdit(svr.Conn, jobID)
+		job, err := svr.Jobs.JobPostByIDForEdit(jobID)
 		if err != nil || job == nil {
 			svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
 			svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Job for golang.cafe/edit/%s not found", token))
 			return
 		}
-		clickoutCount, err := database.GetClickoutCountForJob(svr.Conn, jobID)
+		clickouts, err := svr.Events.GetClickoutCountForJob(jobID)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to retrieve job clickout count for job id %d", jobID))
 		}
-		viewCount, err := database.GetViewCountForJob(svr.Conn, jobID)
+		views, err := svr.Events.GetViewCountForJob(jobID)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to retrieve job view count for job id %d", jobID))
 		}
-		conversionRate := ""
-		if clickoutCount > 0 && viewCount > 0 {
-			conversionRate = fmt.Sprintf("%.2f", float64(float64(clickoutCount)/float64(viewCount)*100))
-		}
-		purchaseEvents, err := database.GetPurchaseEvents(svr.Conn, jobID)
+		rawCounts := r.URL.Query().Get("counts") == "raw"
+		viewCount, clickoutCount, conversionRate := jobEventCounts(views, clickouts, rawCounts)
+		purchaseEvents, err := svr.Purchases.GetPurchaseEvents(jobID)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to retrieve job payment events for job id %d", jobID))
 		}
-		stats, err := database.GetStatsForJob(svr.Conn, jobID)
+		stats, err := svr.Events.GetStatsForJob(jobID)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to retrieve stats for job id %d", jobID))
 		}
@@ -724,7 +1599,7 @@ func EditJobViewPageHandler(svr server.Server) http.HandlerFunc {
 			svr.Log(err, fmt.Sprintf("unable to marshal stats for job id %d", jobID))
 		}
 		ipAddrs := strings.Split(r.Header.Get("x-forwarded-for"), ", ")
-		currency := ipgeolocation.Currency{ipgeolocation.CurrencyUSD, "$"}
+		currency := ipgeolocation.Currency{Code: ipgeolocation.CurrencyUSD, Symbol: "$"}
 		if len(ipAddrs) > 0 {
 			currency, err = svr.GetCurrencyForIP(ipAddrs[0])
 			if err != nil {
@@ -744,12 +1619,22 @@ func EditJobViewPageHandler(svr server.Server) http.HandlerFunc {
 			"ViewCount":                  viewCount,
 			"ClickoutCount":              clickoutCount,
 			"ConversionRate":             conversionRate,
+			"Views":                      views,
+			"Clickouts":                  clickouts,
+			"RawCounts":                  rawCounts,
 			"IsCallback":                 isCallback,
 			"PaymentSuccess":             paymentSuccess,
 			"IsUpsell":                   expiredUpsell,
 			"Currency":                   currency,
 			"StripePublishableKey":       svr.GetConfig().StripePublishableKey,
-			"IsUnpinned":                 job.AdType != database.JobAdSponsoredPinnedFor30Days && job.AdType != database.JobAdSponsoredPinnedFor30Days,
+			"IsUnpinned":                 job.AdType != database.JobAdSponsoredPinnedFor30Days && job.AdType != database.JobAdSponsoredPinnedFor7Days,
+			"IsRenewable":                isRenewable(job),
+			"IsExpiringSoon":             job.ExpiresAt.Valid && time.Until(job.ExpiresAt.Time) < time.Duration(svr.GetConfig().JobExpiryWarningDays)*24*time.Hour,
+			"RenewalPrice":               formatPrice(svr.GetConfig().JobRenewalPrice),
+			"IsFreeRenewal":              svr.GetConfig().JobRenewalPrice == 0,
+			"RenewalExpiresAt":           renewalExpiry(svr, job),
+			"ReviewSubstantiveEdits":     svr.GetConfig().ReviewSubstantiveEdits && job.Status == database.JobStatusApproved,
+			"Skills":                     database.Skills,
 		})
 	}
 }
@@ -761,12 +1646,12 @@ func ManageJobBySlugViewPageHandler(svr server.Server) http.HandlerFunc {
 		func(w http.ResponseWriter, r *http.Request) {
 			vars := mux.Vars(r)
 			slug := vars["slug"]
-			jobPost, err := database.JobPostBySlugAdmin(svr.Conn, slug)
+			jobPost, err := svr.Jobs.JobPostBySlugAdmin(slug)
 			if err != nil {
 				svr.JSON(w, http.StatusNotFound, nil)
 				return
 			}
-			jobPostToken, err := database.TokenByJobID(svr.Conn, jobPost.ID)
+			jobPostToken, err := svr.Jobs.TokenByJobID(jobPost.ID)
 			if err != nil {
 				svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Job for golang.cafe/manage/job/%s not found", slug))
 				return
@@ -783,32 +1668,39 @@ func ManageJobViewPageHandler(svr server.Server) http.HandlerFunc {
 		func(w http.ResponseWriter, r *http.Request) {
 			vars := mux.Vars(r)
 			token := vars["token"]
-			jobID, err := database.JobPostIDByToken(svr.Conn, token)
+			jobID, err := svr.Jobs.JobPostIDByToken(token)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to find job post ID by token: %s", token))
 				svr.JSON(w, http.StatusNotFound, nil)
 				return
 			}
-			job, err := database.JobPostByIDForEdit(svr.Conn, jobID)
+			job, err := svr.Jobs.JobPostByIDForEdit(jobID)
 			if err != nil || job == nil {
 				svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d", jobID))
 				svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Job for golang.cafe/edit/%s not found", token))
 				return
 			}
-			clickoutCount, err := database.GetClickoutCountForJob(svr.Conn, jobID)
+			clickouts, err := svr.Events.GetClickoutCountForJob(jobID)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to retrieve job clickout count for job id %d", jobID))
 			}
-			viewCount, err := database.GetViewCountForJob(svr.Conn, jobID)
+			views, err := svr.Events.GetViewCountForJob(jobID)
 			if err != nil {
 				svr.Log(err, fmt.Sprintf("unable to retrieve job view count for job id %d", jobID))
 			}
-			conversionRate := ""
-			if clickoutCount > 0 && viewCount > 0 {
-				conversionRate = fmt.Sprintf("%.2f", float64(float64(clickoutCount)/float64(viewCount)*100))
+			viewCount, clickoutCount, conversionRate := jobEventCounts(views, clickouts, false)
+			transitions, err := svr.Jobs.GetJobStatusTransitions(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve status transitions for job id %d", jobID))
+			}
+			revisions, err := svr.Jobs.GetJobRevisions(jobID)
+			if err != nil {
+				svr.Log(err, fmt.Sprintf("unable to retrieve revisions for job id %d", jobID))
 			}
 			svr.Render(w, http.StatusOK, "manage.html", map[string]interface{}{
 				"Job":                        job,
+				"StatusTransitions":          transitions,
+				"Revisions":                  revisions,
 				"JobPerksEscaped":            svr.JSEscapeString(job.Perks),
 				"JobInterviewProcessEscaped": svr.JSEscapeString(job.InterviewProcess),
 				"JobDescriptionEscaped":      svr.JSEscapeString(job.JobDescription),
@@ -816,6 +1708,9 @@ func ManageJobViewPageHandler(svr server.Server) http.HandlerFunc {
 				"ViewCount":                  viewCount,
 				"ClickoutCount":              clickoutCount,
 				"ConversionRate":             conversionRate,
+				"Views":                      views,
+				"Clickouts":                  clickouts,
+				"Skills":                     database.Skills,
 			})
 		},
 	)
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/email"
+)
+
+func TestSubmitJobPostPageHandler(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/x/s", SubmitJobPostPageHandler(env.svr)).Methods("POST")
+
+	if rec := env.serve(httptest.NewRequest("POST", "/x/s", strings.NewReader("{"))); rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed body: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	job := testJob("Go Engineer", "London")
+	job.AdType = database.JobAdSponsoredPinnedFor30Days
+	job.CurrencyCode = "CHF"
+	body, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := env.serve(httptest.NewRequest("POST", "/x/s", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	var res struct {
+		SessionID string `json:"s_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.SessionID != "cs_test_1" {
+		t.Fatalf("got stripe session %q, want cs_test_1", res.SessionID)
+	}
+
+	pending, err := env.store.GetPendingJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].JobTitle != "Go Engineer" {
+		t.Fatalf("got pending jobs %+v, want the submitted job", pending)
+	}
+	if _, err := env.store.TokenByJobID(pending[0].ID); err != nil {
+		t.Errorf("no edit token for the submitted job: %v", err)
+	}
+	purchase, err := env.store.GetPurchaseEventBySessionID(res.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// currencies other than USD, EUR and GBP are charged in USD
+	if purchase.JobID != pending[0].ID || purchase.AdType != database.JobAdSponsoredPinnedFor30Days || purchase.Currency != "USD" {
+		t.Errorf("got purchase event %+v, want one for job %d in USD", purchase, pending[0].ID)
+	}
+	emails := env.sentEmails()
+	if len(emails) != 1 || emails[0].To != email.GolangCafeEmailAddress {
+		t.Errorf("got emails %+v, want the approval request to %s", emails, email.GolangCafeEmailAddress)
+	}
+}
+
+// applyRequest returns the form of an application to a job with a CV
+func applyRequest(t *testing.T, externalID string, cv []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	f, err := form.CreateFormFile("cv", "cv.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(cv)
+	form.WriteField("job-id", externalID)
+	form.WriteField("email", "gopher@example.com")
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/x/a/e", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestApplyForJobPageHandler(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/x/a/e", ApplyForJobPageHandler(env.svr)).Methods("POST")
+
+	jobID := env.approvedJob(t, testJob("Go Engineer", "London"))
+	job, err := env.store.JobPostByIDForEdit(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv := []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\ntrailer\n<<>>\n%%EOF\n")
+
+	for _, tc := range []struct {
+		name       string
+		externalID string
+		cv         []byte
+		status     int
+	}{
+		{"not a pdf", job.ExternalID, []byte("hello"), http.StatusUnsupportedMediaType},
+		{"unknown job", "unknown", cv, http.StatusBadRequest},
+	} {
+		if rec := env.serve(applyRequest(t, tc.externalID, tc.cv)); rec.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.name, rec.Code, tc.status)
+		}
+	}
+	if emails := env.sentEmails(); len(emails) != 0 {
+		t.Fatalf("got emails %+v for rejected applications", emails)
+	}
+
+	if rec := env.serve(applyRequest(t, job.ExternalID, cv)); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	emails := env.sentEmails()
+	if len(emails) != 1 || emails[0].To != "gopher@example.com" || !strings.Contains(emails[0].Subject, "Acme") {
+		t.Errorf("got emails %+v, want the confirmation to gopher@example.com", emails)
+	}
+}
@@ -20,31 +20,31 @@ type SubscribeRqMailerlite struct {
 
 func ViewNewsletterPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		svr.RenderPageForLocationAndTag(w, "", "", "", "newsletter.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", "", "newsletter.html")
 	}
 }
 
 func ViewShopPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		svr.RenderPageForLocationAndTag(w, "", "", "", "shop.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", "", "shop.html")
 	}
 }
 
 func ViewCommunityNewsletterPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		svr.RenderPageForLocationAndTag(w, "", "", "", "news.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", "", "news.html")
 	}
 }
 
 func ViewSlackPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		svr.RenderPageForLocationAndTag(w, "", "", "", "slack.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", "", "slack.html")
 	}
 }
 
 func ViewSupportPageHandler(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		svr.RenderPageForLocationAndTag(w, "", "", "", "support.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", "", "support.html")
 	}
 }
 
@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"net/url"
@@ -27,6 +28,12 @@ func IndexPageHandler(svr server.Server) http.HandlerFunc {
 		tag := r.URL.Query().Get("t")
 		page := r.URL.Query().Get("p")
 
+		// quoted phrases and excluded words do not survive the landing page
+		// URLs so these searches are served here
+		if database.IsWebSearchQuery(tag) {
+			svr.RenderPageForLocationAndTag(w, r, location, tag, page, "landing.html")
+			return
+		}
 		var dst string
 		if location != "" && tag != "" {
 			dst = fmt.Sprintf("/Golang-%s-Jobs-In-%s", tag, location)
@@ -35,14 +42,23 @@ func IndexPageHandler(svr server.Server) http.HandlerFunc {
 		} else if tag != "" {
 			dst = fmt.Sprintf("/Golang-%s-Jobs", tag)
 		}
-		if dst != "" && page != "" {
-			dst += fmt.Sprintf("?p=%s", page)
+		// refinements are kept on the landing page
+		v := database.ParseJobFilter(r.URL.Query()).Values()
+		if page != "" {
+			v.Set("p", page)
+		}
+		if c := r.URL.Query().Get("c"); c != "" {
+			v.Set("c", c)
+		}
+		if dst != "" && len(v) > 0 {
+			dst += "?" + v.Encode()
 		}
 		if dst != "" {
 			svr.Redirect(w, r, http.StatusMovedPermanently, dst)
+			return
 		}
 
-		svr.RenderPageForLocationAndTag(w, "", "", page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, "", "", page, "landing.html")
 	}
 }
 
@@ -63,7 +79,9 @@ func PostAJobWithoutPaymentPageHandler(svr server.Server) http.HandlerFunc {
 		svr.SessionStore,
 		svr.GetJWTSigningKey(),
 		func(w http.ResponseWriter, r *http.Request) {
-			svr.Render(w, http.StatusOK, "post-a-job-without-payment.html", nil)
+			svr.Render(w, http.StatusOK, "post-a-job-without-payment.html", map[string]interface{}{
+				"Skills": database.Skills,
+			})
 		},
 	)
 }
@@ -88,7 +106,7 @@ func RequestTokenSignOn(svr server.Server) http.HandlerFunc {
 			svr.JSON(w, http.StatusBadRequest, nil)
 			return
 		}
-		err = database.SaveTokenSignOn(svr.Conn, req.Email, k.String())
+		err = svr.Users.SaveTokenSignOn(req.Email, k.String())
 		if err != nil {
 			svr.Log(err, "unable to save sign on token")
 			svr.JSON(w, http.StatusBadRequest, nil)
@@ -108,7 +126,7 @@ func VerifyTokenSignOn(svr server.Server, adminEmail string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		token := vars["token"]
-		user, err := database.ValidateSignOnToken(svr.Conn, token)
+		user, err := svr.Users.ValidateSignOnToken(token)
 		if err != nil {
 			svr.Log(err, fmt.Sprintf("unable to validate signon token %s", token))
 			svr.TEXT(w, http.StatusBadRequest, "Invalid or expired token")
@@ -180,7 +198,7 @@ func PostNewsItem(svr server.Server) http.HandlerFunc {
 				return
 			}
 			newsItem.CreatedBy = database.User{ID: claims.UserID, Username: claims.Username, Email: claims.Email, CreatedAt: claims.CreatedAt}
-			if err := database.CreateNewsItem(svr.Conn, newsItem); err != nil {
+			if err := svr.News.CreateNewsItem(newsItem); err != nil {
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
@@ -228,7 +246,7 @@ func PostNewsComment(svr server.Server) http.HandlerFunc {
 				return
 			}
 			newsComment.CreatedBy = database.User{ID: claims.UserID, Username: claims.Username, Email: claims.Email, CreatedAt: claims.CreatedAt}
-			if err := database.CreateNewsComment(svr.Conn, newsComment); err != nil {
+			if err := svr.News.CreateNewsComment(newsComment); err != nil {
 				svr.Log(err, "unable to save news comment into db")
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
@@ -241,7 +259,7 @@ func PostNewsComment(svr server.Server) http.HandlerFunc {
 func ListNewsItems(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// list latest news items
-		news, err := database.GetLatestNews(svr.Conn, 10)
+		news, err := svr.News.GetLatestNews(10)
 		if err != nil {
 			svr.Log(err, "unable to retrieve latest news")
 			svr.JSON(w, http.StatusInternalServerError, nil)
@@ -259,13 +277,13 @@ func ListNewsComments(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		newsID := vars["id"]
-		news, err := database.GetNewsByID(svr.Conn, newsID)
+		news, err := svr.News.GetNewsByID(newsID)
 		if err != nil {
 			svr.Log(err, "unable to retrieve latest news")
 			svr.JSON(w, http.StatusInternalServerError, nil)
 			return
 		}
-		comments, err := database.GetNewsComments(svr.Conn, newsID)
+		comments, err := svr.News.GetNewsComments(newsID)
 		if err != nil {
 			svr.Log(err, "unable to retrieve latest news")
 			svr.JSON(w, http.StatusInternalServerError, nil)
@@ -323,15 +341,30 @@ func JobBySlugPageHandler(svr server.Server) http.HandlerFunc {
 		vars := mux.Vars(r)
 		slug := vars["slug"]
 		location := vars["l"]
-		job, err := database.JobPostBySlug(svr.Conn, slug)
+		job, err := svr.Jobs.JobPostBySlug(slug)
 		if err != nil || job == nil {
+			gone, err := svr.Jobs.JobPostBySlugAdmin(slug)
+			if err == nil && (gone.Status == database.JobStatusExpired || gone.Status == database.JobStatusFilled) {
+				similarJobs, err := svr.Jobs.GetSimilarLiveJobs(gone, 10)
+				if err != nil {
+					svr.Log(err, fmt.Sprintf("unable to retrieve similar jobs for %s", slug))
+				}
+				svr.Render(w, http.StatusGone, "job-expired.html", map[string]interface{}{
+					"Job":         gone,
+					"SimilarJobs": similarJobs,
+				})
+				return
+			}
 			svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Job golang.cafe/job/%s not found", slug))
 			return
 		}
-		if err := database.TrackJobView(svr.Conn, job); err != nil {
+		validThrough := time.Unix(job.CreatedAt, 0).AddDate(0, 5, 0)
+		if job.ExpiresAt != nil {
+			validThrough = *job.ExpiresAt
+		}
+		if err := svr.Events.TrackJobView(job, svr.JobVisitor(r)); err != nil {
 			svr.Log(err, fmt.Sprintf("unable to track job view for %s: %v", slug, err))
 		}
-		jobLocations := strings.Split(job.Location, "/")
 		var isQuickApply bool
 		emailRe := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 		if emailRe.MatchString(job.HowToApply) {
@@ -346,18 +379,63 @@ func JobBySlugPageHandler(svr server.Server) http.HandlerFunc {
 			"HTMLJobInterviewProcess": svr.MarkdownToHTML(job.InterviewProcess),
 			"LocationFilter":          location,
 			"ExternalJobId":           job.ExternalID,
+			"MetaImageVersion":        svr.JobMetaImageVersion(*job),
 			"GoogleJobCreatedAt":      time.Unix(job.CreatedAt, 0).Format(time.RFC3339),
-			"GoogleJobValidThrough":   time.Unix(job.CreatedAt, 0).AddDate(0, 5, 0),
-			"GoogleJobLocation":       jobLocations[0],
+			"GoogleJobValidThrough":   validThrough,
 			"GoogleJobDescription":    strconv.Quote(strings.ReplaceAll(string(svr.MarkdownToHTML(job.JobDescription)), "\n", "")),
 		})
 	}
 }
 
+// CompanyPageHandler shows the profile of a company with the jobs it posted,
+// companies whose jobs never went live have no page
+func CompanyPageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := mux.Vars(r)["slug"]
+		company, err := svr.Companies.CompanyBySlug(slug)
+		if err != nil {
+			svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Company golang.cafe/company/%s not found", slug))
+			return
+		}
+		jobs, err := svr.Companies.GetCompanyJobs(company.ID)
+		if err != nil {
+			svr.Log(err, fmt.Sprintf("unable to retrieve jobs for company %s", slug))
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		if len(jobs) == 0 {
+			svr.JSON(w, http.StatusNotFound, fmt.Sprintf("Company golang.cafe/company/%s not found", slug))
+			return
+		}
+		svr.Render(w, http.StatusOK, "company.html", map[string]interface{}{
+			"Company":                   database.NewCompanyProfile(company, jobs),
+			"HTMLCompanyDescription":    svr.MarkdownToHTML(company.Description),
+			"CompanyDescriptionEscaped": svr.JSEscapeString(company.Description),
+			"CompanySizes":              database.CompanySizes,
+			"IsAdmin":                   isAdminRequest(svr, r),
+		})
+	}
+}
+
+// CompaniesPageHandler lists the companies that posted Go jobs
+func CompaniesPageHandler(svr server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		companies, err := svr.Companies.GetCompanies()
+		if err != nil {
+			svr.Log(err, "unable to retrieve companies")
+			svr.JSON(w, http.StatusInternalServerError, nil)
+			return
+		}
+		svr.Render(w, http.StatusOK, "companies.html", map[string]interface{}{
+			"Companies": companies,
+		})
+	}
+}
+
 func LandingPageForLocationHandler(svr server.Server, location string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		page := r.URL.Query().Get("p")
-		svr.RenderPageForLocationAndTag(w, location, "", page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, location, "", page, "landing.html")
 	}
 }
 
@@ -366,7 +444,7 @@ func LandingPageForLocationAndSkillPlaceholderHandler(svr server.Server, locatio
 		vars := mux.Vars(r)
 		skill := strings.ReplaceAll(vars["skill"], "-", " ")
 		page := r.URL.Query().Get("p")
-		svr.RenderPageForLocationAndTag(w, location, skill, page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, location, skill, page, "landing.html")
 	}
 }
 
@@ -375,7 +453,7 @@ func LandingPageForLocationPlaceholderHandler(svr server.Server) http.HandlerFun
 		vars := mux.Vars(r)
 		loc := strings.ReplaceAll(vars["location"], "-", " ")
 		page := r.URL.Query().Get("p")
-		svr.RenderPageForLocationAndTag(w, loc, "", page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, loc, "", page, "landing.html")
 	}
 }
 
@@ -384,7 +462,7 @@ func LandingPageForSkillPlaceholderHandler(svr server.Server) http.HandlerFunc {
 		vars := mux.Vars(r)
 		skill := strings.ReplaceAll(vars["skill"], "-", " ")
 		page := r.URL.Query().Get("p")
-		svr.RenderPageForLocationAndTag(w, "", skill, page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, "", skill, page, "landing.html")
 	}
 }
 
@@ -394,13 +472,22 @@ func LandingPageForSkillAndLocationPlaceholderHandler(svr server.Server) http.Ha
 		loc := strings.ReplaceAll(vars["location"], "-", " ")
 		skill := strings.ReplaceAll(vars["skill"], "-", " ")
 		page := r.URL.Query().Get("p")
-		svr.RenderPageForLocationAndTag(w, loc, skill, page, "landing.html")
+		svr.RenderPageForLocationAndTag(w, r, loc, skill, page, "landing.html")
+	}
+}
+
+// rssJobDescription puts the salary, when disclosed, above the job description
+func rssJobDescription(svr server.Server, j *database.JobPost) string {
+	description := string(svr.MarkdownToHTML(j.JobDescription))
+	if j.SalaryUndisclosed {
+		return description
 	}
+	return fmt.Sprintf("<p><b>Salary</b> %s</p>%s", html.EscapeString(j.SalaryRange), description)
 }
 
 func ServeRSSFeed(svr server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		jobs, err := database.GetLastNJobs(svr.Conn, 20)
+		jobs, err := svr.Jobs.GetLastNJobs(20)
 		if err != nil {
 			svr.Log(err, "unable to retrieve jobs for RSS Feed")
 			svr.XML(w, http.StatusInternalServerError, []byte{})
@@ -419,7 +506,7 @@ func ServeRSSFeed(svr server.Server) http.HandlerFunc {
 			feed.Items = append(feed.Items, &feeds.Item{
 				Title:       fmt.Sprintf("%s with %s - %s", j.JobTitle, j.Company, j.Location),
 				Link:        &feeds.Link{Href: fmt.Sprintf("https://golang.cafe/job/%s", j.Slug)},
-				Description: string(svr.MarkdownToHTML(j.JobDescription)),
+				Description: rssJobDescription(svr, j),
 				Author:      &feeds.Author{Name: "Golang Cafe", Email: "team@golang.cafe"},
 				Created:     *j.ApprovedAt,
 			})
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+func TestLandingPageForLocation(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/Golang-Jobs-In-{location}", LandingPageForLocationPlaceholderHandler(env.svr)).Methods("GET")
+	env.router.HandleFunc("/Golang-{skill}-Jobs-In-{location}", LandingPageForSkillAndLocationPlaceholderHandler(env.svr)).Methods("GET")
+
+	env.approvedJob(t, testJob("Go Engineer London", "London"))
+	kubernetes := testJob("Go Kubernetes Engineer London", "London")
+	kubernetes.Description = "Operating Kubernetes clusters with Go"
+	kubernetes.Skills = []string{"kubernetes"}
+	env.approvedJob(t, kubernetes)
+	env.approvedJob(t, testJob("Go Engineer Berlin", "Berlin"))
+	env.approvedJob(t, testJob("Go Engineer Remote", "Remote"))
+	// jobs waiting for approval are not listed
+	pending := testJob("Go Pending Engineer London", "London")
+	if _, err := env.store.SaveDraft(&pending); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path    string
+		listed  []string
+		omitted []string
+	}{
+		{
+			path:    "/Golang-Jobs-In-London",
+			listed:  []string{"Go Engineer London", "Go Kubernetes Engineer London"},
+			omitted: []string{"Go Engineer Berlin", "Go Pending Engineer London"},
+		},
+		{
+			path:    "/Golang-Kubernetes-Jobs-In-London",
+			listed:  []string{"Go Kubernetes Engineer London"},
+			omitted: []string{"Go Engineer London", "Go Engineer Berlin"},
+		},
+		// locations without jobs list remote jobs instead
+		{
+			path:    "/Golang-Jobs-In-Atlantis",
+			listed:  []string{"Go Engineer Remote"},
+			omitted: []string{"Go Engineer Berlin"},
+		},
+	} {
+		rec := env.serve(httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d", tc.path, rec.Code, http.StatusOK)
+			continue
+		}
+		body := rec.Body.String()
+		for _, title := range tc.listed {
+			if !strings.Contains(body, title) {
+				t.Errorf("%s: %q is not listed", tc.path, title)
+			}
+		}
+		for _, title := range tc.omitted {
+			if strings.Contains(body, title) {
+				t.Errorf("%s: %q is listed", tc.path, title)
+			}
+		}
+	}
+}
+
+func TestLandingPageRendersMarkdown(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/Golang-Jobs-In-{location}", LandingPageForLocationPlaceholderHandler(env.svr)).Methods("GET")
+
+	job := testJob("Go Engineer London", "London")
+	job.Description = "Building **services** in Go"
+	env.approvedJob(t, job)
+
+	// the second request is served from the listing cache
+	for i := 0; i < 2; i++ {
+		rec := env.serve(httptest.NewRequest("GET", "/Golang-Jobs-In-London", nil))
+		if body := rec.Body.String(); !strings.Contains(body, "<strong>services</strong>") {
+			t.Fatalf("request %d: the description is not rendered", i+1)
+		}
+	}
+	jobs, _, _, err := env.svr.JobsForPage(database.JobFilter{Location: "London"}, 1, database.JobCursor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].JobDescription != job.Description {
+		t.Errorf("got cached jobs %+v, want the markdown of the description kept", jobs)
+	}
+}
+
+func TestLandingPagePagination(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/Golang-Jobs-In-{location}", LandingPageForLocationPlaceholderHandler(env.svr)).Methods("GET")
+	for i := 0; i < 45; i++ {
+		env.approvedJob(t, testJob(fmt.Sprintf("Go Engineer %02d", i), "London"))
+	}
+
+	// pages read by number and from the cursor ending the previous one match
+	f := database.JobFilter{Location: "London"}
+	var after database.JobCursor
+	seen := make(map[int]bool)
+	for page, want := range []int{20, 20, 5} {
+		byCursor, next, total, err := env.svr.JobsForPage(f, page+1, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byNumber, _, _, err := env.svr.JobsForPage(f, page+1, database.JobCursor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 45 || len(byCursor) != want || len(byNumber) != want {
+			t.Fatalf("page %d: got %d and %d of %d jobs, want %d of 45", page+1, len(byCursor), len(byNumber), total, want)
+		}
+		for i, j := range byCursor {
+			if byNumber[i].ID != j.ID {
+				t.Fatalf("page %d: job %d is %d by cursor and %d by number", page+1, i, j.ID, byNumber[i].ID)
+			}
+			if seen[j.ID] {
+				t.Fatalf("page %d: job %d is listed twice", page+1, j.ID)
+			}
+			seen[j.ID] = true
+		}
+		after = next
+	}
+	if !after.IsStart() {
+		t.Errorf("got cursor %v after the last page, want the start", after)
+	}
+	if jobs, _, _, err := env.svr.JobsForPage(f, 4, database.JobCursor{}); err != nil || len(jobs) != 0 {
+		t.Errorf("got %d jobs, %v past the last page, want none", len(jobs), err)
+	}
+
+	// the next page link carries the cursor
+	rec := env.serve(httptest.NewRequest("GET", "/Golang-Jobs-In-London", nil))
+	m := regexp.MustCompile(`\?p=2&c=([A-Za-z0-9_-]+)`).FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatal("no link to the next page with a cursor")
+	}
+	second, _, _, _ := env.svr.JobsForPage(f, 2, database.JobCursor{})
+	for _, path := range []string{"/Golang-Jobs-In-London?p=2&c=" + m[1], "/Golang-Jobs-In-London?p=2&c=invalid"} {
+		rec := env.serve(httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", path, rec.Code, http.StatusOK)
+		}
+		for _, j := range second {
+			if !strings.Contains(rec.Body.String(), j.JobTitle) {
+				t.Errorf("%s: %q is not listed", path, j.JobTitle)
+			}
+		}
+	}
+}
+
+// jobPostingRe matches the JSON-LD of a job page
+var jobPostingRe = regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`)
+
+func TestJobPageJSONLD(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/job/{slug}", JobBySlugPageHandler(env.svr)).Methods("GET")
+	// quotes and angle brackets must not break out of the JSON-LD
+	env.store.SaveSEOLocation(`Berlin "Mitte"`, "Germany</script>", "EUR")
+
+	onsite := testJob("Go Platform Engineer", `Berlin "Mitte"`)
+	remote := testJob("Go Remote Engineer", "Remote")
+	remote.RemoteRegions = []string{"Europe", "Middle East"}
+	for _, tc := range []struct {
+		job database.JobRq
+		// check is given the decoded JobPosting
+		check func(posting map[string]interface{}) error
+	}{
+		{onsite, func(posting map[string]interface{}) error {
+			address := posting["jobLocation"].([]interface{})[0].(map[string]interface{})["address"].(map[string]interface{})
+			if address["addressLocality"] != `Berlin "Mitte"` || address["addressCountry"] != "Germany</script>" {
+				return fmt.Errorf("got address %v, want Berlin \"Mitte\", Germany</script>", address)
+			}
+			if posting["title"] != onsite.JobTitle {
+				return fmt.Errorf("got title %v, want %s", posting["title"], onsite.JobTitle)
+			}
+			return nil
+		}},
+		{remote, func(posting map[string]interface{}) error {
+			var regions []interface{}
+			for _, r := range posting["applicantLocationRequirements"].([]interface{}) {
+				regions = append(regions, r.(map[string]interface{})["name"])
+			}
+			if len(regions) != 2 || regions[0] != "Europe" || regions[1] != "Middle East" {
+				return fmt.Errorf("got regions %v, want Europe and Middle East", regions)
+			}
+			return nil
+		}},
+	} {
+		id := env.approvedJob(t, tc.job)
+		job, err := env.store.JobPostByIDForEdit(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := env.serve(httptest.NewRequest("GET", "/job/"+job.Slug, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", job.Slug, rec.Code, http.StatusOK)
+		}
+		m := jobPostingRe.FindStringSubmatch(rec.Body.String())
+		if m == nil {
+			t.Fatalf("%s: no JSON-LD", job.Slug)
+		}
+		var posting map[string]interface{}
+		if err := json.Unmarshal([]byte(m[1]), &posting); err != nil {
+			t.Fatalf("%s: invalid JSON-LD: %v\n%s", job.Slug, err, m[1])
+		}
+		if err := tc.check(posting); err != nil {
+			t.Errorf("%s: %v\n%s", job.Slug, err, m[1])
+		}
+	}
+}
@@ -31,7 +31,7 @@ func StripePaymentConfirmationWebookHandler(svr server.Server) http.HandlerFunc
 			return
 		}
 		if sess != nil {
-			affectedRows, err := database.SaveSuccessfulPayment(svr.Conn, sess.ID)
+			affectedRows, err := svr.Purchases.SaveSuccessfulPayment(sess.ID)
 			if err != nil {
 				svr.Log(err, "error while saving successful payment")
 				svr.JSON(w, http.StatusBadRequest, nil)
@@ -42,31 +42,58 @@ func StripePaymentConfirmationWebookHandler(svr server.Server) http.HandlerFunc
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			job, err := database.GetJobByStripeSessionID(svr.Conn, sess.ID)
+			job, err := svr.Purchases.GetJobByStripeSessionID(sess.ID)
 			if err != nil {
 				svr.Log(errors.New("unable to find job by stripe session id"), fmt.Sprintf("session id %s", sess.ID))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			purchaseEvent, err := database.GetPurchaseEventBySessionID(svr.Conn, sess.ID)
+			purchaseEvent, err := svr.Purchases.GetPurchaseEventBySessionID(sess.ID)
 			if err != nil {
 				svr.Log(errors.New("unable to find purchase event by stripe session id"), fmt.Sprintf("session id %s", sess.ID))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			jobToken, err := database.TokenByJobID(svr.Conn, job.ID)
+			jobToken, err := svr.Jobs.TokenByJobID(job.ID)
 			if err != nil {
 				svr.Log(errors.New("unable to find token for job id"), fmt.Sprintf("session id %s job id %d", sess.ID, job.ID))
 				svr.JSON(w, http.StatusBadRequest, nil)
 				return
 			}
-			if job.ApprovedAt != nil && job.AdType != database.JobAdSponsoredPinnedFor30Days && job.AdType != database.JobAdSponsoredPinnedFor7Days && (purchaseEvent.AdType == database.JobAdSponsoredPinnedFor7Days || job.AdType != database.JobAdSponsoredPinnedFor30Days) {
-				err := database.UpdateJobAdType(svr.Conn, purchaseEvent.AdType, job.ID)
+			if purchaseEvent.IsRenewal {
+				jobForEdit, err := svr.Jobs.JobPostByIDForEdit(job.ID)
+				if err != nil {
+					svr.Log(err, fmt.Sprintf("unable to retrieve job by ID %d for renewal", job.ID))
+					svr.JSON(w, http.StatusBadRequest, nil)
+					return
+				}
+				expiresAt := renewalExpiry(svr, jobForEdit)
+				if err := svr.Jobs.RenewJob(job.ID, expiresAt, database.ActorStripe); err != nil {
+					svr.Log(err, fmt.Sprintf("unable to renew job id %d for session id %s", job.ID, sess.ID))
+					svr.JSON(w, http.StatusBadRequest, nil)
+					return
+				}
+				diff := renewalAuditDiff(jobForEdit, expiresAt)
+				diff["stripe_session_id"] = database.AuditChange{Before: nil, After: sess.ID}
+				recordAudit(svr, database.ActorStripe, database.AuditActionJobRenew, job.ID, diff)
+				err = svr.GetEmail().SendEmail("Diego from Golang Cafe <team@golang.cafe>", purchaseEvent.Email, email.GolangCafeEmailAddress, "Your Job Ad on Golang Cafe", fmt.Sprintf("Your Job Ad has been renewed successfully and it's live on Golang Cafe. You can edit the Job Ad at any time and check page views and clickouts by following this link https://golang.cafe/edit/%s", jobToken))
+				if err != nil {
+					svr.Log(err, "unable to send email while renewing job ad")
+				}
+				svr.JSON(w, http.StatusOK, nil)
+				return
+			}
+			if job.Status == database.JobStatusApproved && job.AdType != database.JobAdSponsoredPinnedFor30Days && job.AdType != database.JobAdSponsoredPinnedFor7Days && (purchaseEvent.AdType == database.JobAdSponsoredPinnedFor7Days || job.AdType != database.JobAdSponsoredPinnedFor30Days) {
+				err := svr.Jobs.UpdateJobAdType(purchaseEvent.AdType, job.ID)
 				if err != nil {
 					svr.Log(errors.New("unable to update job to new ad type"), fmt.Sprintf("unable to update job id %d to new ad type %d for session id %s", job.ID, purchaseEvent.AdType, sess.ID))
 					svr.JSON(w, http.StatusBadRequest, nil)
 					return
 				}
+				recordAudit(svr, database.ActorStripe, database.AuditActionJobAdType, job.ID, database.AuditDiff{
+					"ad_type":           {Before: job.AdType, After: purchaseEvent.AdType},
+					"stripe_session_id": {Before: nil, After: sess.ID},
+				})
 				err = svr.GetEmail().SendEmail("Diego from Golang Cafe <team@golang.cafe>", purchaseEvent.Email, email.GolangCafeEmailAddress, "Your Job Ad on Golang Cafe", fmt.Sprintf("Your Job Ad has been upgraded successfully and it's now pinned to the home page. You can edit the Job Ad at any time and check page views and clickouts by following this link https://golang.cafe/edit/%s", jobToken))
 				if err != nil {
 					svr.Log(err, "unable to send email while upgrading job ad")
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/stripe/stripe-go/webhook"
+)
+
+// checkoutCompleted returns the webhook request Stripe sends when the
+// checkout session completes, signed with secret
+func checkoutCompleted(sessionID, secret string) *http.Request {
+	payload := []byte(fmt.Sprintf(`{"id":"evt_test","object":"event","type":"checkout.session.completed","data":{"object":{"id":%q,"object":"checkout.session"}}}`, sessionID))
+	now := time.Now()
+	r := httptest.NewRequest("POST", "/x/stripe/checkout/completed", bytes.NewReader(payload))
+	r.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), hex.EncodeToString(webhook.ComputeSignature(now, payload, secret))))
+	return r
+}
+
+func TestStripePaymentConfirmationWebookHandler(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/x/stripe/checkout/completed", StripePaymentConfirmationWebookHandler(env.svr)).Methods("POST")
+
+	jobID := env.approvedJob(t, testJob("Go Engineer", "Remote"))
+	if err := env.store.SaveTokenForJob("token", jobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.InitiatePaymentEvent("cs_upgrade", 5900, "USD", "Sponsored Ad Pinned For 7 Days", database.JobAdSponsoredPinnedFor7Days, "hr@acme.co", jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := env.serve(checkoutCompleted("cs_upgrade", "whsec_wrong")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("forged signature: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := env.serve(checkoutCompleted("cs_unknown", testStripeEndpointSecret)); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown session: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if rec := env.serve(checkoutCompleted("cs_upgrade", testStripeEndpointSecret)); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	job, err := env.store.JobPostByIDForEdit(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.AdType != database.JobAdSponsoredPinnedFor7Days {
+		t.Errorf("got ad type %d, want %d", job.AdType, database.JobAdSponsoredPinnedFor7Days)
+	}
+	purchases, err := env.store.GetPurchaseEvents(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purchases) != 1 {
+		t.Errorf("got %d completed purchases, want 1", len(purchases))
+	}
+	emails := env.sentEmails()
+	if len(emails) != 1 || emails[0].To != "hr@acme.co" {
+		t.Errorf("got emails %+v, want the upgrade confirmation to hr@acme.co", emails)
+	}
+
+	// Stripe retries webhooks, a completed session is not applied twice
+	if rec := env.serve(checkoutCompleted("cs_upgrade", testStripeEndpointSecret)); rec.Code != http.StatusBadRequest {
+		t.Errorf("retry: got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStripePaymentConfirmationWebookHandlerRenewal(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.router.HandleFunc("/x/stripe/checkout/completed", StripePaymentConfirmationWebookHandler(env.svr)).Methods("POST")
+
+	jobID := env.approvedJob(t, testJob("Go Engineer", "Remote"))
+	if err := env.store.SaveTokenForJob("token", jobID); err != nil {
+		t.Fatal(err)
+	}
+	before, err := env.store.JobPostByIDForEdit(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.store.InitiateRenewalPaymentEvent("cs_renewal", 1900, "USD", "Golang Cafe Job Ad Renewal", "hr@acme.co", jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := env.serve(checkoutCompleted("cs_renewal", testStripeEndpointSecret)); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	after, err := env.store.JobPostByIDForEdit(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ExpiresAt.Time.After(before.ExpiresAt.Time) {
+		t.Errorf("expiry moved from %v to %v, want it later", before.ExpiresAt.Time, after.ExpiresAt.Time)
+	}
+}
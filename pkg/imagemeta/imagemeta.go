@@ -2,71 +2,127 @@ package imagemeta
 
 import (
 	"bytes"
-	"fmt"
-	"image/color"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/jpeg"
 	"image/png"
-	"io"
+	"io/ioutil"
 	"path/filepath"
+	"sync"
 
 	"github.com/0x13a/golang.cafe/pkg/database"
 	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
 	"github.com/pkg/errors"
+	_ "golang.org/x/image/webp"
 )
 
 const (
 	backgroundImageFilename = "static/assets/img/meta-bg.jpg"
-	outputFilename          = "output.jpg"
+	imageWidth              = 1200
+	imageHeight             = 628
 )
 
-func GenerateImageForJob(job database.JobPost) (io.ReadWriter, error) {
-	dc := gg.NewContext(1200, 628)
-	backgroundImage, err := gg.LoadImage(backgroundImageFilename)
-	w := bytes.NewBuffer([]byte{})
+// jobImageVersion changes whenever GenerateImageForJob draws differently, so
+// that images generated before are not served anymore
+const jobImageVersion = "2"
+
+// jobImageFields are the revision fields GenerateImageForJob renders
+var jobImageFields = map[string]bool{
+	"job_title":            true,
+	"company":              true,
+	"location":             true,
+	"salary_min":           true,
+	"salary_max":           true,
+	"salary_currency_code": true,
+	"salary_period":        true,
+	"salary_undisclosed":   true,
+	"company_icon_id":      true,
+}
+
+// assets are the fonts and the background image, parsed on first use
+var assets struct {
+	once       sync.Once
+	err        error
+	regular    *truetype.Font
+	bold       *truetype.Font
+	background image.Image
+}
+
+func loadAssets() error {
+	assets.once.Do(func() {
+		fontDir := filepath.Join("static", "assets", "fonts", "Courier_Prime")
+		if assets.regular, assets.err = loadFont(filepath.Join(fontDir, "CourierPrime-Regular.ttf")); assets.err != nil {
+			return
+		}
+		if assets.bold, assets.err = loadFont(filepath.Join(fontDir, "CourierPrime-Bold.ttf")); assets.err != nil {
+			return
+		}
+		if assets.background, assets.err = gg.LoadImage(backgroundImageFilename); assets.err != nil {
+			assets.err = errors.Wrap(assets.err, "load background image")
+		}
+	})
+	return assets.err
+}
+
+func loadFont(path string) (*truetype.Font, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		return w, errors.Wrap(err, "load background image")
+		return nil, errors.Wrapf(err, "load font %s", path)
 	}
-	// draw background image
-	dc.DrawImage(backgroundImage, 0, 0)
-
-	// draw job link text
-	textColor := color.Black
-	fontPath := filepath.Join("static", "assets", "fonts", "Courier_Prime", "CourierPrime-Regular.ttf")
-	if err := dc.LoadFontFace(fontPath, 16); err != nil {
-		return w, errors.Wrap(err, "load Courier_Prime for job link")
+	f, err := truetype.Parse(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse font %s", path)
 	}
-	dc.SetColor(textColor)
-	var marginY float64
-	marginY = 80
-	s := fmt.Sprintf("https://golang.cafe/job/%s", job.Slug)
-	_, textHeight := dc.MeasureString(s)
-	var x, y float64
-	x = 70
-	y = float64(dc.Height()) - textHeight - marginY
-	dc.DrawString(s, x, y)
+	return f, nil
+}
 
-	// draw job title and description
-	title := fmt.Sprintf("%s with %s\n\n %s\n\n %s", job.JobTitle, job.Company, job.Location, job.SalaryRange)
-	mainTextColor := color.RGBA{
-		R: uint8(0),
-		G: uint8(0),
-		B: uint8(144),
-		A: uint8(255),
+// JobImageHash returns the hash of what GenerateImageForJob renders for a
+// job with a template and a logo, the image only has to be generated again
+// when it changes. logoHash is empty when the job has no logo
+func JobImageHash(t Template, job database.JobPost, logoHash string) string {
+	h := sha256.New()
+	for _, f := range []string{jobImageVersion, t.Name(), logoHash, job.Slug, job.JobTitle, job.Company, job.Location, job.SalaryRange} {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
 	}
-	fontPath = filepath.Join("static", "assets", "fonts", "Courier_Prime", "CourierPrime-Bold.ttf")
-	if err := dc.LoadFontFace(fontPath, 60); err != nil {
-		return w, errors.Wrap(err, "load Courier_Prime for job link")
-	}
-	textRightMargin := 80.0
-	textTopMargin := 90.0
-	x = textRightMargin
-	y = textTopMargin
-	maxWidth := float64(dc.Width()) - textRightMargin - textRightMargin
-	dc.SetColor(mainTextColor)
-	dc.DrawStringWrapped(title, x, y, 0, 0, maxWidth, 1.5, gg.AlignLeft)
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	if err := png.Encode(w, dc.Image()); err != nil {
-		return w, err
+// JobImageChanged reports whether any of the changed revision fields of a
+// job are rendered in its image
+func JobImageChanged(changedFields []string) bool {
+	for _, f := range changedFields {
+		if jobImageFields[f] {
+			return true
+		}
 	}
+	return false
+}
+
+// MediaID returns the id a meta image with the given hash is stored under
+func MediaID(hash string) string {
+	return "meta_" + hash[:40]
+}
 
-	return w, nil
+// DecodeLogo decodes a company logo from the media store
+func DecodeLogo(b []byte) (image.Image, error) {
+	m, _, err := image.Decode(bytes.NewReader(b))
+	return m, err
+}
+
+// GenerateImageForJob draws the meta image of a job with a template as a
+// PNG, logo is nil when the job has none
+func GenerateImageForJob(t Template, job database.JobPost, logo image.Image) ([]byte, error) {
+	if err := loadAssets(); err != nil {
+		return nil, err
+	}
+	dc := gg.NewContext(imageWidth, imageHeight)
+	t.draw(dc, job, logo)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dc.Image()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,184 @@
+package imagemeta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"net/url"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+)
+
+// pageImageVersion changes whenever GeneratePageImage draws differently
+const pageImageVersion = "1"
+
+// PageImage is the meta image of a page other than a job: a title over a
+// figure and its caption
+type PageImage struct {
+	Kicker  string
+	Title   string
+	Figure  string
+	Caption string
+	Link    string
+	Theme   Theme
+}
+
+// Hash returns the hash of what GeneratePageImage renders for the page
+func (p PageImage) Hash() string {
+	h := sha256.New()
+	for _, f := range []string{pageImageVersion, p.Theme.Name, p.Kicker, p.Title, p.Figure, p.Caption, p.Link} {
+		h.Write([]byte(f))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func pageLink(path string) string {
+	return "https://golang.cafe" + path
+}
+
+func urlName(s string) string {
+	return url.PathEscape(strings.ReplaceAll(s, " ", "-"))
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// SalaryImage is the image of the salary page of a location, with the median
+// of the minimum and maximum salaries of its jobs. remote is set when the
+// location has no salaries and the page shows those of remote jobs
+func SalaryImage(location, country, currencySymbol string, p50Min, p50Max int64, samples int, remote bool) PageImage {
+	title := location
+	if country != "" {
+		title += ", " + country
+	}
+	p := PageImage{
+		Kicker: "Go Developer Salary",
+		Title:  title,
+		Link:   pageLink("/Golang-Developer-Salary-" + urlName(location)),
+		Theme:  ThemePinned,
+	}
+	if location == "Remote" {
+		p.Link = pageLink("/Remote-Golang-Developer-Salary")
+	}
+	if samples == 0 {
+		p.Caption = "No salaries published yet"
+		return p
+	}
+	p.Figure = fmt.Sprintf("%s%s - %s%s", currencySymbol, humanize.Comma(p50Min), currencySymbol, humanize.Comma(p50Max))
+	jobs := plural(samples, "job", "jobs")
+	if remote {
+		jobs = plural(samples, "remote job", "remote jobs")
+	}
+	p.Caption = fmt.Sprintf("median salary of %d %s", samples, jobs)
+	return p
+}
+
+// LandingImage is the image of the jobs landing page of a location and a
+// skill, either can be empty, with the number of jobs it lists
+func LandingImage(location, skill string, jobs int) PageImage {
+	p := PageImage{
+		Kicker:  "Golang Cafe",
+		Figure:  humanize.Comma(int64(jobs)),
+		Caption: plural(jobs, "job open now", "jobs open now"),
+		Theme:   ThemeDefault,
+	}
+	title := []string{"Golang"}
+	path := []string{"Golang"}
+	if location == "Remote" {
+		title = []string{"Remote", "Golang"}
+		path = []string{"Remote", "Golang"}
+	}
+	if skill != "" {
+		title = append(title, skill)
+		path = append(path, urlName(skill))
+	}
+	title = append(title, "Jobs")
+	path = append(path, "Jobs")
+	if location != "" && location != "Remote" {
+		title = append(title, "in", location)
+		path = append(path, "In", urlName(location))
+	}
+	p.Title = strings.Join(title, " ")
+	p.Link = pageLink("/" + strings.Join(path, "-"))
+	if jobs == 0 {
+		p.Figure = ""
+		p.Caption = "New jobs are posted every week"
+	}
+	return p
+}
+
+// NewsImage is the image of a news thread with the number of its comments
+func NewsImage(newsID, title string, comments int) PageImage {
+	return PageImage{
+		Kicker:  "Golang Cafe News",
+		Title:   title,
+		Figure:  humanize.Comma(int64(comments)),
+		Caption: plural(comments, "comment", "comments"),
+		Link:    pageLink("/news/" + url.PathEscape(newsID)),
+		Theme:   ThemeSponsored,
+	}
+}
+
+// GeneratePageImage draws the meta image of a page as a PNG
+func GeneratePageImage(p PageImage) ([]byte, error) {
+	if err := loadAssets(); err != nil {
+		return nil, err
+	}
+	dc := gg.NewContext(imageWidth, imageHeight)
+	p.draw(dc)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dc.Image()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p PageImage) draw(dc *gg.Context) {
+	t := p.Theme
+	dc.SetColor(t.Background)
+	dc.Clear()
+	dc.SetColor(t.Accent)
+	dc.DrawRectangle(0, 0, imageWidth, 16)
+	dc.Fill()
+
+	x, width := 80.0, 1040.0
+	kicker := fitText(dc, assets.regular, p.Kicker, textBox{Width: width, Height: 50}, 32, 24)
+	dc.SetColor(t.Text)
+	kicker.draw(dc, textBox{X: x, Y: 70, Width: width}, gg.AlignLeft)
+
+	// the title, figure and caption are centred between the kicker and the
+	// link, the title shrinks first to leave room for the figure
+	title := fitText(dc, assets.bold, p.Title, textBox{Width: width, Height: 150}, 64, 32)
+	figure := fitText(dc, assets.bold, p.Figure, textBox{Width: width, Height: 130}, 96, 48)
+	caption := fitText(dc, assets.regular, p.Caption, textBox{Width: width, Height: 50}, 36, 24)
+	gap := 24.0
+	total := title.height() + gap + figure.height() + caption.height()
+	if figure.height() > 0 {
+		total += gap
+	}
+	top, bottom := 70+kicker.height()+gap, float64(imageHeight-100)
+	y := top + (bottom-top-total)/2
+	dc.SetColor(t.Title)
+	title.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+	y += title.height() + gap
+	if figure.height() > 0 {
+		dc.SetColor(t.Accent)
+		figure.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+		y += figure.height() + gap
+	}
+	dc.SetColor(t.Text)
+	caption.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+
+	dc.SetFontFace(truetype.NewFace(assets.regular, &truetype.Options{Size: 20}))
+	dc.DrawStringAnchored(p.Link, x, imageHeight-50, 0, 0)
+}
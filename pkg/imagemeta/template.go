@@ -0,0 +1,236 @@
+package imagemeta
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/draw"
+)
+
+// Layouts place the fields of a job on the image
+const (
+	// LayoutClassic is the job in Courier Prime over meta-bg.jpg
+	LayoutClassic = "classic"
+	// LayoutLogo puts the company logo on the left and the job on the right
+	LayoutLogo = "logo"
+	// LayoutHeadline centres the title over the colour of the theme
+	LayoutHeadline = "headline"
+)
+
+var layouts = []string{LayoutClassic, LayoutLogo, LayoutHeadline}
+
+// Theme colours a layout
+type Theme struct {
+	Name       string
+	Background color.RGBA
+	Title      color.RGBA
+	Text       color.RGBA
+	Accent     color.RGBA
+}
+
+var (
+	ThemeDefault = Theme{
+		Name:       "default",
+		Background: color.RGBA{R: 0xf7, G: 0xf7, B: 0xf7, A: 0xff},
+		Title:      color.RGBA{B: 0x90, A: 0xff},
+		Text:       color.RGBA{R: 0x1a, G: 0x19, B: 0x19, A: 0xff},
+		Accent:     color.RGBA{B: 0x90, A: 0xff},
+	}
+	// ThemeSponsored is for jobs with a sponsored background
+	ThemeSponsored = Theme{
+		Name:       "sponsored",
+		Background: color.RGBA{R: 0xff, G: 0xf8, B: 0xdc, A: 0xff},
+		Title:      color.RGBA{B: 0x90, A: 0xff},
+		Text:       color.RGBA{R: 0x1a, G: 0x19, B: 0x19, A: 0xff},
+		Accent:     color.RGBA{R: 0xb3, G: 0x6b, B: 0x00, A: 0xff},
+	}
+	// ThemePinned is for jobs pinned to the top of the listings
+	ThemePinned = Theme{
+		Name:       "pinned",
+		Background: color.RGBA{B: 0x90, A: 0xff},
+		Title:      color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Text:       color.RGBA{R: 0xdf, G: 0xe3, B: 0xff, A: 0xff},
+		Accent:     color.RGBA{R: 0xff, G: 0xcc, A: 0xff},
+	}
+)
+
+var themes = []Theme{ThemeDefault, ThemeSponsored, ThemePinned}
+
+// Template is a layout drawn in a theme
+type Template struct {
+	Layout string
+	Theme  Theme
+}
+
+// Name identifies the template, e.g. `logo-pinned`
+func (t Template) Name() string {
+	return t.Layout + "-" + t.Theme.Name
+}
+
+// Templates returns every layout in every theme
+func Templates() []Template {
+	var templates []Template
+	for _, layout := range layouts {
+		for _, theme := range themes {
+			templates = append(templates, Template{Layout: layout, Theme: theme})
+		}
+	}
+	return templates
+}
+
+// TemplateByName returns the template with the given name
+func TemplateByName(name string) (Template, bool) {
+	for _, t := range Templates() {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// TemplateForJob picks the template of a job. Sponsored jobs get the theme
+// of their ad type and the headline layout, jobs with a logo get the logo
+// layout
+func TemplateForJob(job database.JobPost, hasLogo bool) Template {
+	t := Template{Layout: LayoutClassic, Theme: ThemeDefault}
+	switch job.AdType {
+	case database.JobAdSponsoredPinnedFor30Days, database.JobAdSponsoredPinnedFor7Days:
+		t = Template{Layout: LayoutHeadline, Theme: ThemePinned}
+	case database.JobAdSponsoredBackground:
+		t = Template{Layout: LayoutHeadline, Theme: ThemeSponsored}
+	}
+	if hasLogo {
+		t.Layout = LayoutLogo
+	}
+	return t
+}
+
+func (t Template) draw(dc *gg.Context, job database.JobPost, logo image.Image) {
+	switch t.Layout {
+	case LayoutLogo:
+		t.drawLogo(dc, job, logo)
+	case LayoutHeadline:
+		t.drawHeadline(dc, job)
+	default:
+		t.drawClassic(dc, job)
+	}
+}
+
+func jobLink(job database.JobPost) string {
+	return fmt.Sprintf("https://golang.cafe/job/%s", job.Slug)
+}
+
+// jobDetails is the location and salary of a job on one line
+func jobDetails(job database.JobPost) string {
+	details := []string{}
+	for _, s := range []string{job.Location, job.SalaryRange} {
+		if s = strings.TrimSpace(s); s != "" {
+			details = append(details, s)
+		}
+	}
+	return strings.Join(details, " | ")
+}
+
+func (t Template) drawClassic(dc *gg.Context, job database.JobPost) {
+	dc.DrawImage(assets.background, 0, 0)
+	if t.Theme.Name != ThemeDefault.Name {
+		dc.SetColor(t.Theme.Accent)
+		dc.DrawRectangle(0, 0, imageWidth, 16)
+		dc.Fill()
+	}
+	// the title shrinks to leave room for the details below it, which stay
+	// clear of the logo in the bottom right corner of the background
+	box := textBox{X: 80, Y: 90, Width: 1040, Height: 260}
+	title := fitText(dc, assets.bold, fmt.Sprintf("%s with %s", job.JobTitle, job.Company), box, 60, 32)
+	dc.SetColor(t.Theme.Title)
+	title.draw(dc, box, gg.AlignLeft)
+
+	y := box.Y + title.height() + 30
+	details := fitText(dc, assets.regular, jobDetails(job), textBox{Width: 880, Height: 100}, 40, 24)
+	details.draw(dc, textBox{X: box.X, Y: y, Width: 880}, gg.AlignLeft)
+
+	dc.SetFontFace(truetype.NewFace(assets.regular, &truetype.Options{Size: 20}))
+	dc.SetColor(color.Black)
+	dc.DrawStringAnchored(jobLink(job), 70, imageHeight-80, 0, 1)
+}
+
+func (t Template) drawLogo(dc *gg.Context, job database.JobPost, logo image.Image) {
+	dc.SetColor(t.Theme.Background)
+	dc.Clear()
+	dc.SetColor(t.Theme.Accent)
+	dc.DrawRectangle(0, imageHeight-20, imageWidth, 20)
+	dc.Fill()
+
+	// the logo sits on a white tile so that transparent logos made for light
+	// backgrounds stay readable on dark themes
+	tile := 320.0
+	tileX, tileY := 80.0, (imageHeight-tile)/2-10
+	dc.SetColor(color.White)
+	dc.DrawRoundedRectangle(tileX, tileY, tile, tile, 24)
+	dc.Fill()
+	if logo != nil {
+		side := 256
+		fitted := image.NewRGBA(image.Rect(0, 0, side, side))
+		draw.CatmullRom.Scale(fitted, fitted.Bounds(), logo, logo.Bounds(), draw.Over, nil)
+		dc.DrawImageAnchored(fitted, int(tileX+tile/2), int(tileY+tile/2), 0.5, 0.5)
+	} else if initial := []rune(strings.TrimSpace(job.Company)); len(initial) > 0 {
+		// previews of jobs without a logo get the initial of the company, the
+		// tile is white in every theme
+		dc.SetColor(ThemeDefault.Title)
+		dc.SetFontFace(truetype.NewFace(assets.bold, &truetype.Options{Size: 180}))
+		dc.DrawStringAnchored(strings.ToUpper(string(initial[0])), tileX+tile/2, tileY+tile/2, 0.5, 0.35)
+	}
+
+	x, width := tileX+tile+60, imageWidth-(tileX+tile+60)-80
+	company := fitText(dc, assets.regular, job.Company, textBox{Width: width, Height: 50}, 36, 24)
+	title := fitText(dc, assets.bold, job.JobTitle, textBox{Width: width, Height: 260}, 64, 30)
+	details := fitText(dc, assets.regular, jobDetails(job), textBox{Width: width, Height: 90}, 32, 22)
+	// the block of text is centred next to the tile
+	gap := 24.0
+	total := company.height() + gap + title.height() + gap + details.height()
+	y := tileY + (tile-total)/2
+	dc.SetColor(t.Theme.Text)
+	company.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+	y += company.height() + gap
+	dc.SetColor(t.Theme.Title)
+	title.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+	y += title.height() + gap
+	dc.SetColor(t.Theme.Text)
+	details.draw(dc, textBox{X: x, Y: y, Width: width}, gg.AlignLeft)
+
+	dc.SetFontFace(truetype.NewFace(assets.regular, &truetype.Options{Size: 20}))
+	dc.DrawStringAnchored(jobLink(job), x, imageHeight-60, 0, 0)
+}
+
+func (t Template) drawHeadline(dc *gg.Context, job database.JobPost) {
+	dc.SetColor(t.Theme.Background)
+	dc.Clear()
+	dc.SetColor(t.Theme.Accent)
+	dc.DrawRectangle(0, 0, imageWidth, 16)
+	dc.Fill()
+
+	box := textBox{X: 80, Y: 80, Width: 1040, Height: 320}
+	title := fitText(dc, assets.bold, job.JobTitle, box, 80, 36)
+	company := fitText(dc, assets.regular, job.Company, textBox{Width: box.Width, Height: 50}, 40, 24)
+	details := fitText(dc, assets.regular, jobDetails(job), textBox{Width: box.Width, Height: 50}, 32, 20)
+	gap := 30.0
+	total := title.height() + gap + company.height() + gap + details.height()
+	y := 40 + (imageHeight-80-total)/2
+	dc.SetColor(t.Theme.Title)
+	title.draw(dc, textBox{X: box.X, Y: y, Width: box.Width}, gg.AlignCenter)
+	y += title.height() + gap
+	dc.SetColor(t.Theme.Text)
+	company.draw(dc, textBox{X: box.X, Y: y, Width: box.Width}, gg.AlignCenter)
+	y += company.height() + gap
+	dc.SetColor(t.Theme.Accent)
+	details.draw(dc, textBox{X: box.X, Y: y, Width: box.Width}, gg.AlignCenter)
+
+	dc.SetColor(t.Theme.Text)
+	dc.SetFontFace(truetype.NewFace(assets.regular, &truetype.Options{Size: 20}))
+	dc.DrawStringAnchored(jobLink(job), imageWidth/2, imageHeight-50, 0.5, 0)
+}
@@ -0,0 +1,119 @@
+package imagemeta
+
+import (
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+)
+
+const (
+	lineSpacing = 1.3
+	// fontSizeStep is how much text shrinks at a time until it fits
+	fontSizeStep = 4
+	ellipsis     = "..."
+)
+
+// textBox is the area text is drawn in, from its top left corner
+type textBox struct {
+	X, Y, Width, Height float64
+}
+
+// fittedText is text wrapped into lines at a font size that fits its box
+type fittedText struct {
+	font  *truetype.Font
+	size  float64
+	lines []string
+}
+
+func (t fittedText) height() float64 {
+	if len(t.lines) == 0 {
+		return 0
+	}
+	return float64(len(t.lines)) * t.size * lineSpacing
+}
+
+func (t fittedText) draw(dc *gg.Context, box textBox, align gg.Align) {
+	dc.SetFontFace(truetype.NewFace(t.font, &truetype.Options{Size: t.size}))
+	for i, line := range t.lines {
+		// lines are anchored on their baseline, a line height below the top
+		y := box.Y + float64(i)*t.size*lineSpacing + t.size
+		switch align {
+		case gg.AlignCenter:
+			dc.DrawStringAnchored(line, box.X+box.Width/2, y, 0.5, 0)
+		case gg.AlignRight:
+			dc.DrawStringAnchored(line, box.X+box.Width, y, 1, 0)
+		default:
+			dc.DrawString(line, box.X, y)
+		}
+	}
+}
+
+// fitText wraps s to the width of box at the largest size from maxSize down
+// to minSize at which it fits its height. Text still too long at minSize is
+// cut with an ellipsis
+func fitText(dc *gg.Context, f *truetype.Font, s string, box textBox, maxSize, minSize float64) fittedText {
+	s = strings.Join(strings.Fields(s), " ")
+	for size := maxSize; ; size -= fontSizeStep {
+		if size < minSize {
+			size = minSize
+		}
+		dc.SetFontFace(truetype.NewFace(f, &truetype.Options{Size: size}))
+		t := fittedText{font: f, size: size, lines: wrapText(dc, s, box.Width)}
+		if t.height() <= box.Height {
+			return t
+		}
+		if size == minSize {
+			maxLines := int(box.Height / (size * lineSpacing))
+			if maxLines < 1 {
+				maxLines = 1
+			}
+			t.lines = t.lines[:maxLines]
+			last := t.lines[maxLines-1]
+			for last != "" && textWidth(dc, last+ellipsis) > box.Width {
+				last = strings.TrimRight(string([]rune(last)[:len([]rune(last))-1]), " ")
+			}
+			t.lines[maxLines-1] = last + ellipsis
+			return t
+		}
+	}
+}
+
+func textWidth(dc *gg.Context, s string) float64 {
+	w, _ := dc.MeasureString(s)
+	return w
+}
+
+// wrapText breaks s into lines no wider than width with the current font
+// face, on spaces when possible and within words longer than a line
+func wrapText(dc *gg.Context, s string, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(dc, candidate) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		for len([]rune(line)) > 1 && textWidth(dc, line) > width {
+			runes := []rune(line)
+			n := len(runes) - 1
+			for n > 1 && textWidth(dc, string(runes[:n])) > width {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			line = string(runes[n:])
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
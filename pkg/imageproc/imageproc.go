@@ -0,0 +1,193 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Formats renditions are encoded in
+const (
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+)
+
+var mediaTypes = map[string]string{
+	FormatPNG:  "image/png",
+	FormatJPEG: "image/jpeg",
+	FormatWebP: "image/webp",
+}
+
+// RenditionSizes are the sides, in pixels, of the square renditions of a
+// logo, smallest first
+var RenditionSizes = []int{64, 128, 256}
+
+// MaxPixels is the largest number of pixels an upload may decode to, images
+// are rejected from their header before decoding so that a small file
+// claiming huge dimensions cannot exhaust memory
+const MaxPixels = 25 * 1000 * 1000
+
+var (
+	ErrUnsupportedImage = errors.New("image format is not supported or the image is corrupt")
+	ErrImageTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Rendition is a logo encoded at one of RenditionSizes
+type Rendition struct {
+	Size   int
+	Format string
+	Bytes  []byte
+}
+
+// MediaType returns the content type of the rendition
+func (r Rendition) MediaType() string {
+	return mediaTypes[r.Format]
+}
+
+// Logo is an upload decoded, turned upright and fitted into a square of the
+// largest rendition size, padded with white for JPEGs and with transparency
+// otherwise. Re-encoding drops EXIF and any other metadata
+type Logo struct {
+	// Format is the format of the PNG or JPEG renditions, JPEG only when the
+	// upload was one
+	Format string
+	square *image.RGBA
+}
+
+// DecodeLogo decodes a PNG, JPEG or WebP upload
+func DecodeLogo(b []byte) (Logo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return Logo{}, ErrUnsupportedImage
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return Logo{}, ErrUnsupportedImage
+	}
+	if cfg.Width > MaxPixels || cfg.Height > MaxPixels || cfg.Width*cfg.Height > MaxPixels {
+		return Logo{}, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	m, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return Logo{}, ErrUnsupportedImage
+	}
+	logo := Logo{Format: FormatPNG}
+	var background image.Image = image.Transparent
+	orientation := 1
+	if format == "jpeg" {
+		logo.Format = FormatJPEG
+		background = image.White
+		orientation = exifOrientation(b)
+	}
+	side := RenditionSizes[len(RenditionSizes)-1]
+	// scale before turning upright so that large photos are only copied once
+	// they are small, orientations from 5 are transposed
+	w, h := cfg.Width, cfg.Height
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	fw, fh := side, side
+	if w > h {
+		fh = maxInt(1, h*side/w)
+	} else {
+		fw = maxInt(1, w*side/h)
+	}
+	if orientation >= 5 {
+		fw, fh = fh, fw
+	}
+	fitted := image.NewRGBA(image.Rect(0, 0, fw, fh))
+	draw.CatmullRom.Scale(fitted, fitted.Bounds(), m, m.Bounds(), draw.Src, nil)
+	upright := orient(fitted, orientation)
+
+	logo.square = image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(logo.square, logo.square.Bounds(), background, image.Point{}, draw.Src)
+	ub := upright.Bounds()
+	offset := image.Pt((side-ub.Dx())/2, (side-ub.Dy())/2)
+	draw.Draw(logo.square, ub.Sub(ub.Min).Add(offset), upright, ub.Min, draw.Over)
+	return logo, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Renditions encodes the logo at every size in its format and in WebP. The
+// lossless WebP of a photo is larger than its JPEG, it is only kept when it
+// is smaller
+func (l Logo) Renditions() ([]Rendition, error) {
+	var renditions []Rendition
+	for _, size := range RenditionSizes {
+		m := image.Image(l.square)
+		if size != l.square.Bounds().Dx() {
+			scaled := image.NewRGBA(image.Rect(0, 0, size, size))
+			draw.CatmullRom.Scale(scaled, scaled.Bounds(), l.square, l.square.Bounds(), draw.Src, nil)
+			m = scaled
+		}
+		var buf bytes.Buffer
+		var err error
+		if l.Format == FormatJPEG {
+			err = jpeg.Encode(&buf, m, &jpeg.Options{Quality: 85})
+		} else {
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, m)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r := Rendition{Size: size, Format: l.Format, Bytes: buf.Bytes()}
+		renditions = append(renditions, r)
+		var webp bytes.Buffer
+		if err := EncodeWebP(&webp, m); err != nil {
+			return nil, err
+		}
+		if webp.Len() < len(r.Bytes) {
+			renditions = append(renditions, Rendition{Size: size, Format: FormatWebP, Bytes: webp.Bytes()})
+		}
+	}
+	return renditions, nil
+}
+
+// RenditionID returns the media id a rendition of a logo is stored under
+func RenditionID(mediaID string, size int, format string) string {
+	return fmt.Sprintf("%s_%d%s", mediaID, size, format)
+}
+
+// RenditionSize returns the smallest rendition size at least as large as
+// the requested one, the largest when none is
+func RenditionSize(requested int) int {
+	for _, size := range RenditionSizes {
+		if size >= requested {
+			return size
+		}
+	}
+	return RenditionSizes[len(RenditionSizes)-1]
+}
+
+// AcceptsWebP reports whether an Accept header lists WebP
+func AcceptsWebP(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if strings.TrimSpace(params[0]) != mediaTypes[FormatWebP] {
+			continue
+		}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
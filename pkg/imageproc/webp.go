@@ -0,0 +1,408 @@
+package imageproc
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// The standard library and golang.org/x/image only decode WebP, EncodeWebP
+// writes lossless WebP (VP8L) so that logos can be served in it without cgo.
+// The encoder is deliberately simple: the subtract green transform, runs of
+// the pixel on the left or above as backward references and one set of
+// Huffman codes for the whole image. See RFC 9649 for the bitstream.
+
+const (
+	vp8lMaxSize        = 1 << 14
+	vp8lLiteralCodes   = 256
+	vp8lLengthCodes    = 24
+	vp8lDistanceCodes  = 40
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLCodeLen   = 7
+	vp8lMinCopyLength  = 3
+	vp8lMaxCopyLength  = 4096
+	vp8lSubtractGreen  = 2
+	vp8lDistanceLeft   = 2 // the distance code of the pixel on the left
+	vp8lDistanceAbove  = 1 // the distance code of the pixel above
+	vp8lCodeLengthZero = 17
+	vp8lCodeLengthRun  = 18
+)
+
+// vp8lCodeLengthOrder is the order the lengths of the code length code are
+// written in
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// EncodeWebP writes m as a lossless WebP image
+func EncodeWebP(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return errors.New("webp: image size out of range")
+	}
+	// pixels as ARGB after subtracting green from red and blue
+	pix := make([]uint32, 0, width*height)
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A != 0xff {
+				opaque = false
+			}
+			r, g, bl := uint32(c.R-c.G), uint32(c.G), uint32(c.B-c.G)
+			pix = append(pix, uint32(c.A)<<24|r<<16|g<<8|bl)
+		}
+	}
+	symbols := vp8lBackwardRefs(pix, width)
+
+	var histograms [5][]int
+	for i, size := range []int{vp8lLiteralCodes + vp8lLengthCodes, vp8lLiteralCodes, vp8lLiteralCodes, vp8lLiteralCodes, vp8lDistanceCodes} {
+		histograms[i] = make([]int, size)
+	}
+	for _, s := range symbols {
+		if s.length > 0 {
+			lengthCode, _, _ := vp8lPrefix(s.length)
+			distanceCode, _, _ := vp8lPrefix(s.distance)
+			histograms[0][vp8lLiteralCodes+lengthCode]++
+			histograms[4][distanceCode]++
+			continue
+		}
+		histograms[0][s.argb>>8&0xff]++
+		histograms[1][s.argb>>16&0xff]++
+		histograms[2][s.argb&0xff]++
+		histograms[3][s.argb>>24]++
+	}
+	var codes [5]*huffmanCode
+	for i, h := range histograms {
+		codes[i] = newHuffmanCode(h, vp8lMaxCodeLength)
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3)
+	// one transform, subtract green
+	bw.write(1, 1)
+	bw.write(vp8lSubtractGreen, 2)
+	bw.write(0, 1)
+	// no color cache, no meta prefix codes
+	bw.write(0, 1)
+	bw.write(0, 1)
+	for _, c := range codes {
+		c.writeLengths(bw)
+	}
+	for _, s := range symbols {
+		if s.length > 0 {
+			lengthCode, lengthBits, lengthExtra := vp8lPrefix(s.length)
+			distanceCode, distanceBits, distanceExtra := vp8lPrefix(s.distance)
+			codes[0].writeSymbol(bw, vp8lLiteralCodes+lengthCode)
+			bw.write(lengthExtra, lengthBits)
+			codes[4].writeSymbol(bw, distanceCode)
+			bw.write(distanceExtra, distanceBits)
+			continue
+		}
+		codes[0].writeSymbol(bw, int(s.argb>>8&0xff))
+		codes[1].writeSymbol(bw, int(s.argb>>16&0xff))
+		codes[2].writeSymbol(bw, int(s.argb&0xff))
+		codes[3].writeSymbol(bw, int(s.argb>>24))
+	}
+	data := bw.bytes()
+
+	chunkSize := len(data)
+	padding := chunkSize % 2
+	var header [20]byte
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+chunkSize+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding > 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// vp8lSymbol is a literal pixel, or a copy of length pixels from distance,
+// a distance code, when length is positive
+type vp8lSymbol struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// vp8lBackwardRefs turns runs of the pixel on the left or of the row above
+// into copies, whichever is longer
+func vp8lBackwardRefs(pix []uint32, width int) []vp8lSymbol {
+	var symbols []vp8lSymbol
+	for i := 0; i < len(pix); {
+		left, above := 0, 0
+		if i >= 1 {
+			for left < vp8lMaxCopyLength && i+left < len(pix) && pix[i+left] == pix[i+left-1] {
+				left++
+			}
+		}
+		if i >= width {
+			for above < vp8lMaxCopyLength && i+above < len(pix) && pix[i+above] == pix[i+above-width] {
+				above++
+			}
+		}
+		switch {
+		case left >= vp8lMinCopyLength && left >= above:
+			symbols = append(symbols, vp8lSymbol{length: left, distance: vp8lDistanceLeft})
+			i += left
+		case above >= vp8lMinCopyLength:
+			symbols = append(symbols, vp8lSymbol{length: above, distance: vp8lDistanceAbove})
+			i += above
+		default:
+			symbols = append(symbols, vp8lSymbol{argb: pix[i]})
+			i++
+		}
+	}
+	return symbols
+}
+
+// vp8lPrefix returns the prefix code, extra bits and their value of a copy
+// length or distance code
+func vp8lPrefix(v int) (int, uint, uint32) {
+	x := v - 1
+	if x < 4 {
+		return x, 0, 0
+	}
+	high := 0
+	for x>>uint(high+1) != 0 {
+		high++
+	}
+	second := x >> uint(high-1) & 1
+	extraBits := uint(high - 1)
+	return 2*high + second, extraBits, uint32(x & (1<<extraBits - 1))
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf.Bytes()
+}
+
+// huffmanCode is a canonical Huffman code. A code with a single symbol
+// takes no bits, the decoder knows it from its lengths alone
+type huffmanCode struct {
+	lengths []int
+	codes   []uint32
+	single  bool
+}
+
+// newHuffmanCode builds a code of at most maxLength bits from symbol counts,
+// counts are halved until the code fits
+func newHuffmanCode(counts []int, maxLength int) *huffmanCode {
+	c := &huffmanCode{lengths: make([]int, len(counts)), codes: make([]uint32, len(counts))}
+	used := 0
+	last := 0
+	for s, n := range counts {
+		if n > 0 {
+			used++
+			last = s
+		}
+	}
+	if used <= 1 {
+		c.lengths[last] = 1
+		c.single = true
+		return c
+	}
+	scaled := append([]int(nil), counts...)
+	for {
+		huffmanLengths(scaled, c.lengths)
+		longest := 0
+		for _, l := range c.lengths {
+			if l > longest {
+				longest = l
+			}
+		}
+		if longest <= maxLength {
+			break
+		}
+		for s, n := range scaled {
+			if n > 0 {
+				scaled[s] = (n + 1) / 2
+			}
+		}
+	}
+	// canonical codes, shorter first then by symbol
+	var next [vp8lMaxCodeLength + 2]uint32
+	var perLength [vp8lMaxCodeLength + 2]uint32
+	for _, l := range c.lengths {
+		perLength[l]++
+	}
+	perLength[0] = 0
+	code := uint32(0)
+	for l := 1; l < len(next); l++ {
+		code = (code + perLength[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range c.lengths {
+		if l > 0 {
+			c.codes[s] = next[l]
+			next[l]++
+		}
+	}
+	return c
+}
+
+type huffmanNode struct {
+	count   int
+	symbol  int
+	left    *huffmanNode
+	right   *huffmanNode
+	isLeaf  bool
+	ordinal int
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].ordinal < h[j].ordinal
+}
+func (h huffmanHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x interface{}) { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths sets the Huffman code length of every symbol with a count
+func huffmanLengths(counts []int, lengths []int) {
+	for i := range lengths {
+		lengths[i] = 0
+	}
+	h := &huffmanHeap{}
+	ordinal := 0
+	for s, n := range counts {
+		if n > 0 {
+			*h = append(*h, &huffmanNode{count: n, symbol: s, isLeaf: true, ordinal: ordinal})
+			ordinal++
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 1 {
+		a := heap.Pop(h).(*huffmanNode)
+		b := heap.Pop(h).(*huffmanNode)
+		heap.Push(h, &huffmanNode{count: a.count + b.count, left: a, right: b, ordinal: ordinal})
+		ordinal++
+	}
+	var walk func(n *huffmanNode, depth int)
+	walk = func(n *huffmanNode, depth int) {
+		if n.isLeaf {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(heap.Pop(h).(*huffmanNode), 0)
+}
+
+// writeSymbol writes the code of a symbol most significant bit first
+func (c *huffmanCode) writeSymbol(w *bitWriter, s int) {
+	if c.single {
+		return
+	}
+	l := c.lengths[s]
+	code := c.codes[s]
+	var reversed uint32
+	for i := 0; i < l; i++ {
+		reversed = reversed<<1 | code>>uint(i)&1
+	}
+	w.write(reversed, uint(l))
+}
+
+// writeLengths writes the code as a normal prefix code: its lengths coded
+// with a code length code, runs of zeros are collapsed
+func (c *huffmanCode) writeLengths(w *bitWriter) {
+	type token struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var tokens []token
+	for i := 0; i < len(c.lengths); {
+		if c.lengths[i] != 0 {
+			tokens = append(tokens, token{symbol: c.lengths[i]})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(c.lengths) && c.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{symbol: vp8lCodeLengthRun, extra: uint32(run - 11), bits: 7})
+		case run >= 3:
+			tokens = append(tokens, token{symbol: vp8lCodeLengthZero, extra: uint32(run - 3), bits: 3})
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{symbol: 0})
+			}
+		}
+		i += run
+	}
+	counts := make([]int, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	clCode := newHuffmanCode(counts, vp8lMaxCLCodeLen)
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && clCode.lengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(0, 1)
+	w.write(uint32(n-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:n] {
+		w.write(uint32(clCode.lengths[s]), 3)
+	}
+	// lengths of every symbol follow, no max symbol
+	w.write(0, 1)
+	for _, t := range tokens {
+		clCode.writeSymbol(w, t.symbol)
+		w.write(t.extra, t.bits)
+	}
+}
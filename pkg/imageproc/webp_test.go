@@ -0,0 +1,85 @@
+package imageproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// webpTestImages returns images of a size exercising literals, backward
+// references and transparency
+func webpTestImages(size int, rnd *rand.Rand) map[string]*image.NRGBA {
+	fill := func(f func(x, y int) color.NRGBA) *image.NRGBA {
+		m := image.NewNRGBA(image.Rect(0, 0, size, size))
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				m.SetNRGBA(x, y, f(x, y))
+			}
+		}
+		return m
+	}
+	return map[string]*image.NRGBA{
+		"random": fill(func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256))}
+		}),
+		"solid": fill(func(x, y int) color.NRGBA {
+			return color.NRGBA{0x00, 0xad, 0xd8, 0xff}
+		}),
+		"transparent": fill(func(x, y int) color.NRGBA {
+			return color.NRGBA{}
+		}),
+		// a logo on a transparent background, with repeated rows and runs
+		"logo": fill(func(x, y int) color.NRGBA {
+			if (x-size/2)*(x-size/2)+(y-size/2)*(y-size/2) < size*size/9 {
+				return color.NRGBA{0x00, 0xad, 0xd8, uint8(255 - x%3)}
+			}
+			if x%7 == 0 {
+				return color.NRGBA{0xff, 0xff, 0xff, 0x80}
+			}
+			return color.NRGBA{}
+		}),
+	}
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	sizes := append([]int{1, 2, 3, 17}, RenditionSizes...)
+	for _, size := range sizes {
+		for name, m := range webpTestImages(size, rnd) {
+			t.Run(fmt.Sprintf("%s %d", name, size), func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := EncodeWebP(&buf, m); err != nil {
+					t.Fatal(err)
+				}
+				decoded, err := webp.Decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded.Bounds() != m.Bounds() {
+					t.Fatalf("got bounds %v, want %v", decoded.Bounds(), m.Bounds())
+				}
+				for y := 0; y < size; y++ {
+					for x := 0; x < size; x++ {
+						got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+						if want := m.NRGBAAt(x, y); got != want {
+							t.Fatalf("pixel %d,%d: got %v, want %v", x, y, got, want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeWebPSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 1, 0), image.Rect(0, 0, vp8lMaxSize+1, 1)} {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(r)); err == nil {
+			t.Errorf("encoded an image of %v", r)
+		}
+	}
+}
@@ -54,17 +54,11 @@ func NewIPGeoLocation(geoliteLocation, country2currencyLocation string) (IPGeoLo
 }
 
 func (i IPGeoLocation) GetCurrencyForIP(ip string) (Currency, error) {
-	ipNet := net.ParseIP(ip)
-	var record struct {
-		Country struct {
-			ISOCode string `maxminddb:"iso_code"`
-		} `maxminddb:"country"`
-	}
-	err := i.db.Lookup(ipNet, &record)
+	country, err := i.GetCountryForIP(ip)
 	if err != nil {
 		return Currency{CurrencyUSD, "$"}, err
 	}
-	currencyCode := i.c2c[record.Country.ISOCode]
+	currencyCode := i.c2c[country]
 	if currencyCode == "" {
 		return Currency{CurrencyUSD, "$"}, nil
 	}
@@ -74,6 +68,23 @@ func (i IPGeoLocation) GetCurrencyForIP(ip string) (Currency, error) {
 	return Currency{currencyCode, supportedCurrencies[currencyCode]}, nil
 }
 
+// GetCountryForIP returns the ISO code of the country of an IP address, empty
+// when it is unknown or no database is loaded
+func (i IPGeoLocation) GetCountryForIP(ip string) (string, error) {
+	if i.db == nil {
+		return "", nil
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := i.db.Lookup(net.ParseIP(ip), &record); err != nil {
+		return "", err
+	}
+	return record.Country.ISOCode, nil
+}
+
 func (i IPGeoLocation) Close() {
 	i.db.Close()
 }
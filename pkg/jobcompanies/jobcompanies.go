@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+func main() {
+	log.Println("linking job ads to companies")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	linked, err := database.LinkJobsToCompanies(conn)
+	if err != nil {
+		log.Fatalf("unable to link job ads to companies after linking %d: %v", linked, err)
+	}
+	log.Printf("linked %d job ads to companies\n", linked)
+}
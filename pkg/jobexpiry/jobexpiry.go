@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/email"
+)
+
+func main() {
+	log.Println("expiring job ads")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	emailClient, err := email.NewClient(cfg.EmailAPIKey)
+	if err != nil {
+		log.Fatalf("unable to connect to sparkpost API: %v", err)
+	}
+
+	scheduled, err := database.ScheduleMissingJobExpiry(conn, cfg.JobExpiryDays)
+	if err != nil {
+		log.Fatalf("unable to schedule expiry for live job ads: %v", err)
+	}
+	log.Printf("scheduled expiry for %d live job ads without one\n", scheduled)
+
+	log.Printf("attempting to warn job ads expiring in the next %d days\n", cfg.JobExpiryWarningDays)
+	jobs, err := database.GetJobsToWarnBeforeExpiry(conn, time.Now().AddDate(0, 0, cfg.JobExpiryWarningDays))
+	if err != nil {
+		log.Fatalf("unable to retrieve job ads expiring soon: %v", err)
+	}
+	for _, j := range jobs {
+		jobToken, err := database.TokenByJobID(conn, j.ID)
+		if err != nil {
+			log.Printf("unable to retrieve token for job id %d for email %s: %v", j.ID, j.CompanyEmail, err)
+			continue
+		}
+		err = emailClient.SendEmail("Diego from Golang Cafe <team@golang.cafe>", j.CompanyEmail, email.GolangCafeEmailAddress, "Your Job Ad on Golang Cafe Expires Soon", fmt.Sprintf("Your Job Ad %s at %s expires on %s. If you are still hiring you can renew it in a few clicks on the Job Edit Page by following this link https://golang.cafe/edit/%s?renew=1", j.JobTitle, j.Company, j.ExpiresAt.Format("Jan 02, 2006"), jobToken))
+		if err != nil {
+			log.Printf("unable to send expiry warning email for job id %d: %v", j.ID, err)
+			continue
+		}
+		if err := database.MarkJobExpiryWarningSent(conn, j.ID); err != nil {
+			log.Printf("unable to mark expiry warning as sent for job id %d: %v", j.ID, err)
+			continue
+		}
+		log.Printf("warned job id %d expiring on %s\n", j.ID, j.ExpiresAt.Format(time.RFC3339))
+	}
+
+	log.Printf("attempting to expire job ads\n")
+	jobs, err = database.GetJobsToExpire(conn)
+	if err != nil {
+		log.Fatalf("unable to retrieve expired job ads: %v", err)
+	}
+	for _, j := range jobs {
+		if err := database.TransitionJobStatus(conn, j.ID, database.JobStatusExpired, database.ActorSystem); err != nil {
+			log.Printf("unable to expire job id %d: %v", j.ID, err)
+			continue
+		}
+		err = database.RecordAuditEvent(conn, database.AuditEvent{
+			Actor:  database.ActorSystem,
+			Action: database.AuditActionJobExpire,
+			JobID:  j.ID,
+			Diff:   database.AuditDiff{}.Add("status", j.Status, database.JobStatusExpired),
+		})
+		if err != nil {
+			log.Printf("unable to record audit event for expired job id %d: %v", j.ID, err)
+		}
+		log.Printf("expired job id %d\n", j.ID)
+		jobToken, err := database.TokenByJobID(conn, j.ID)
+		if err != nil {
+			log.Printf("unable to retrieve token for job id %d for email %s: %v", j.ID, j.CompanyEmail, err)
+			continue
+		}
+		err = emailClient.SendEmail("Diego from Golang Cafe <team@golang.cafe>", j.CompanyEmail, email.GolangCafeEmailAddress, "Your Job Ad on Golang Cafe Has Expired", fmt.Sprintf("Your Job Ad %s at %s has expired and it's no longer listed on Golang Cafe. If you are still hiring you can renew it in a few clicks on the Job Edit Page by following this link https://golang.cafe/edit/%s?renew=1", j.JobTitle, j.Company, jobToken))
+		if err != nil {
+			log.Printf("unable to send expired email for job id %d: %v", j.ID, err)
+		}
+	}
+	log.Printf("finished expiring job ads")
+}
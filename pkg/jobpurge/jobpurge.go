@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/imageproc"
+	"github.com/0x13a/golang.cafe/pkg/mediastore"
+)
+
+func main() {
+	log.Println("purging archived job ads")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	media, err := mediastore.New(cfg.MediaStorage, cfg, conn)
+	if err != nil {
+		log.Fatalf("unable to create %s media store: %v", cfg.MediaStorage, err)
+	}
+	log.Printf("attempting to purge job ads archived more than %d days ago\n", cfg.JobArchiveRetentionDays)
+	ids, err := database.GetJobsToPurge(conn, time.Now().AddDate(0, 0, -cfg.JobArchiveRetentionDays))
+	if err != nil {
+		log.Fatalf("unable to retrieve archived job ads to purge: %v", err)
+	}
+	for _, id := range ids {
+		job, err := database.JobPostByIDForEdit(conn, id)
+		if err != nil {
+			log.Printf("unable to retrieve job id %d: %v", id, err)
+			continue
+		}
+		meta, err := database.GetMetaImage(conn, database.JobMetaImageKey(job.ExternalID))
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("unable to retrieve meta image of job id %d: %v", id, err)
+			continue
+		}
+		if err := database.PurgeJob(conn, id, database.ActorSystem); err != nil {
+			log.Printf("unable to purge job id %d: %v", id, err)
+			continue
+		}
+		// the media of the job is only deleted once nothing refers to it, it
+		// lives in the media store which can be outside of postgres
+		for _, mediaID := range jobMediaIDs(job, meta) {
+			if err := media.DeleteMedia(mediaID); err != nil {
+				log.Printf("unable to delete media %s of job id %d: %v", mediaID, id, err)
+			}
+		}
+		log.Printf("purged job id %d\n", id)
+	}
+	log.Printf("finished purging archived job ads")
+}
+
+// jobMediaIDs returns the ids of the media of a job: its meta image, its
+// logo and every rendition the logo can have
+func jobMediaIDs(job *database.JobPostForEdit, meta database.MetaImage) []string {
+	var ids []string
+	if meta.MediaID != "" {
+		ids = append(ids, meta.MediaID)
+	}
+	if job.CompanyIconID != "" {
+		ids = append(ids, job.CompanyIconID)
+		for _, size := range imageproc.RenditionSizes {
+			for _, format := range []string{imageproc.FormatPNG, imageproc.FormatJPEG, imageproc.FormatWebP} {
+				ids = append(ids, imageproc.RenditionID(job.CompanyIconID, size, format))
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+func main() {
+	log.Println("tagging job ads with skills")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	tagged, err := database.TagJobsWithoutSkills(conn)
+	if err != nil {
+		log.Fatalf("unable to tag job ads with skills after tagging %d: %v", tagged, err)
+	}
+	log.Printf("tagged %d job ads with skills\n", tagged)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// jobstats rolls up the job events of every complete day since the last run
+// and prunes the events past the retention window. Given a day as
+// YYYY-MM-DD it rolls up that day again instead, it must be before today
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	if len(os.Args) > 1 {
+		day, err := time.Parse("2006-01-02", os.Args[1])
+		if err != nil {
+			log.Fatalf("invalid day %s, expected YYYY-MM-DD", os.Args[1])
+		}
+		if !day.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+			log.Fatalf("invalid day %s, only days before today can be rolled up", os.Args[1])
+		}
+		if err := database.RollupJobStats(conn, day); err != nil {
+			log.Fatalf("unable to roll up job stats of %s: %v", os.Args[1], err)
+		}
+		log.Printf("rolled up job stats of %s\n", os.Args[1])
+		return
+	}
+	log.Println("rolling up job stats")
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day, err := database.NextJobStatsRollupDay(conn)
+	if err != nil {
+		log.Fatalf("unable to retrieve the next day to roll up: %v", err)
+	}
+	// days are rolled up in order so that the days after the last one can be
+	// counted live, today is left for the next run
+	for ; !day.IsZero() && day.Before(today); day = day.AddDate(0, 0, 1) {
+		if err := database.RollupJobStats(conn, day); err != nil {
+			log.Fatalf("unable to roll up job stats of %s: %v", day.Format("2006-01-02"), err)
+		}
+		log.Printf("rolled up job stats of %s\n", day.Format("2006-01-02"))
+	}
+	log.Printf("attempting to prune job events older than %d days\n", cfg.JobEventRetentionDays)
+	n, err := database.PruneJobEvents(conn, today.AddDate(0, 0, -cfg.JobEventRetentionDays))
+	if err != nil {
+		log.Fatalf("unable to prune job events: %v", err)
+	}
+	log.Printf("finished pruning %d job events\n", n)
+}
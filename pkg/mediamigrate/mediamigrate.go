@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/mediastore"
+)
+
+const usage = `usage: mediamigrate <from> <to>
+
+copies every media from one storage to another under the same id, media
+already copied with the same hash is skipped and nothing is deleted from
+the source. Storages are postgres, fs and s3, configured with MEDIA_DIR and
+the MEDIA_S3_* variables`
+
+func main() {
+	if len(os.Args) != 3 || os.Args[1] == os.Args[2] {
+		log.Fatal(usage)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("unable to load config %v", err)
+	}
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+	from, err := mediastore.New(os.Args[1], cfg, conn)
+	if err != nil {
+		log.Fatalf("unable to create %s media store: %v\n%s", os.Args[1], err, usage)
+	}
+	to, err := mediastore.New(os.Args[2], cfg, conn)
+	if err != nil {
+		log.Fatalf("unable to create %s media store: %v\n%s", os.Args[2], err, usage)
+	}
+	log.Printf("migrating media from %s to %s\n", os.Args[1], os.Args[2])
+	copied, skipped, failed, err := migrate(from, to)
+	if err != nil {
+		log.Fatalf("unable to list media of %s: %v", os.Args[1], err)
+	}
+	log.Printf("finished migrating media: %d copied, %d already there, %d failed\n", copied, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrate copies the media of from to to under the same ids and returns how
+// many were copied, already there with the same hash and failed. A copy only
+// counts when to reads back the hash of the bytes that were copied
+func migrate(from, to database.MediaStore) (copied, skipped, failed int, err error) {
+	ids, err := from.GetMediaIDs()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	log.Printf("found %d media\n", len(ids))
+	for _, id := range ids {
+		hash, err := from.GetMediaHash(id)
+		if err != nil {
+			log.Printf("unable to retrieve hash of media %s: %v", id, err)
+			failed++
+			continue
+		}
+		if existing, err := to.GetMediaHash(id); err == nil && existing == hash {
+			skipped++
+			continue
+		}
+		media, err := from.GetMediaByID(id)
+		if err != nil {
+			log.Printf("unable to retrieve media %s: %v", id, err)
+			failed++
+			continue
+		}
+		if err := to.PutMedia(id, media); err != nil {
+			log.Printf("unable to save media %s: %v", id, err)
+			failed++
+			continue
+		}
+		want := database.MediaHash(media.Bytes)
+		if got, err := to.GetMediaHash(id); err != nil || got != want {
+			log.Printf("media %s was not copied intact, hash %s instead of %s: %v", id, got, want, err)
+			failed++
+			continue
+		}
+		copied++
+	}
+	return copied, skipped, failed, nil
+}
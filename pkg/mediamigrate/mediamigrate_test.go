@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/mediastore"
+	"github.com/0x13a/golang.cafe/pkg/mediastore/s3test"
+)
+
+// corruptingMediaStore flips the bytes of the media put in it
+type corruptingMediaStore struct {
+	database.MediaStore
+}
+
+func (s corruptingMediaStore) PutMedia(mediaID string, media database.Media) error {
+	media.Bytes = append([]byte{^media.Bytes[0]}, media.Bytes[1:]...)
+	return s.MediaStore.PutMedia(mediaID, media)
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mediamigrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	from, err := mediastore.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := s3test.NewServer("golang-cafe", "test")
+	defer fake.Close()
+	to, err := mediastore.NewS3(fake.URL, "eu-west-1", "golang-cafe", "media/", "test", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media := map[string]database.Media{}
+	for _, b := range []string{"logo", "other logo", "changed logo"} {
+		m := database.Media{Bytes: []byte(b), MediaType: "image/png"}
+		id, err := from.SaveMedia(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		media[id] = m
+	}
+	ids, err := from.GetMediaIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one media is already there, another is there with other bytes
+	if err := to.PutMedia(ids[0], media[ids[0]]); err != nil {
+		t.Fatal(err)
+	}
+	if err := to.PutMedia(ids[1], database.Media{Bytes: []byte("stale"), MediaType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+	puts := fake.Requests(http.MethodPut)
+
+	copied, skipped, failed, err := migrate(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != 2 || skipped != 1 || failed != 0 {
+		t.Errorf("got %d copied, %d skipped and %d failed, want 2, 1 and 0", copied, skipped, failed)
+	}
+	if n := fake.Requests(http.MethodPut) - puts; n != 2 {
+		t.Errorf("got %d uploads, want 2", n)
+	}
+	for id, want := range media {
+		got, err := to.GetMediaByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes, want.Bytes) || got.MediaType != want.MediaType {
+			t.Errorf("media %s: got %q, want %q", id, got.Bytes, want.Bytes)
+		}
+	}
+
+	// running again copies nothing
+	if copied, skipped, failed, err := migrate(from, to); err != nil || copied != 0 || skipped != 3 || failed != 0 {
+		t.Errorf("got %d copied, %d skipped, %d failed, %v, want everything skipped", copied, skipped, failed, err)
+	}
+
+	// copies reading back another hash fail
+	dst, err := mediastore.NewFS(dir + "/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied, _, failed, err := migrate(from, corruptingMediaStore{dst}); err != nil || copied != 0 || failed != 3 {
+		t.Errorf("got %d copied, %d failed, %v, want every copy to fail", copied, failed, err)
+	}
+}
@@ -0,0 +1,168 @@
+package mediastore
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/segmentio/ksuid"
+)
+
+// FS stores each media in a file of a directory named after its id. The
+// file starts with a line of JSON holding the media type and hash followed
+// by the bytes, it is replaced atomically on updates
+type FS struct {
+	dir string
+}
+
+type fsMediaHeader struct {
+	MediaType string `json:"media_type"`
+	SHA256    string `json:"sha256"`
+}
+
+// NewFS creates the directory when it does not exist
+func NewFS(dir string) (*FS, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FS{dir: dir}, nil
+}
+
+func (s *FS) path(mediaID string) (string, error) {
+	if err := validateMediaID(mediaID); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, mediaID), nil
+}
+
+func (s *FS) SaveMedia(media database.Media) (string, error) {
+	mediaID, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	if err := s.PutMedia(mediaID.String(), media); err != nil {
+		return "", err
+	}
+	return mediaID.String(), nil
+}
+
+// UpdateMedia does nothing when the media does not exist, like the postgres
+// store
+func (s *FS) UpdateMedia(media database.Media, mediaID string) error {
+	if _, err := s.GetMediaHash(mediaID); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.PutMedia(mediaID, media)
+}
+
+func (s *FS) PutMedia(mediaID string, media database.Media) error {
+	path, err := s.path(mediaID)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(fsMediaHeader{MediaType: media.MediaType, SHA256: database.MediaHash(media.Bytes)})
+	if err != nil {
+		return err
+	}
+	// temporary files start with a dot so that GetMediaIDs skips them
+	f, err := ioutil.TempFile(s.dir, "."+mediaID+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(header, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(media.Bytes); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// open returns the header of a media and a reader of its bytes
+func (s *FS) open(mediaID string) (fsMediaHeader, *bufio.Reader, io.Closer, error) {
+	var header fsMediaHeader
+	path, err := s.path(mediaID)
+	if err != nil {
+		return header, nil, nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return header, nil, nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return header, nil, nil, err
+	}
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		f.Close()
+		return header, nil, nil, err
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		f.Close()
+		return header, nil, nil, err
+	}
+	return header, r, f, nil
+}
+
+func (s *FS) GetMediaByID(mediaID string) (database.Media, error) {
+	header, r, f, err := s.open(mediaID)
+	if err != nil {
+		return database.Media{}, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return database.Media{}, err
+	}
+	return database.Media{Bytes: b, MediaType: header.MediaType, SHA256: header.SHA256}, nil
+}
+
+func (s *FS) GetMediaHash(mediaID string) (string, error) {
+	header, _, f, err := s.open(mediaID)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return header.SHA256, nil
+}
+
+func (s *FS) DeleteMedia(mediaID string) error {
+	path, err := s.path(mediaID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FS) GetMediaIDs() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || validateMediaID(f.Name()) != nil {
+			continue
+		}
+		ids = append(ids, f.Name())
+	}
+	return ids, nil
+}
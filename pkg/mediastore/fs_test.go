@@ -0,0 +1,25 @@
+package mediastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mediastore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFS(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// leftovers of interrupted writes are not media
+	if err := ioutil.WriteFile(filepath.Join(dir, "media", ".1wFvcVyEzNEO8XQcm6P8IwM4Ubb-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testMediaStore(t, s)
+}
@@ -0,0 +1,36 @@
+package mediastore
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// New returns the media store of a backend, one of the config.MediaStorage
+// values, configured from cfg. The postgres backend stores media in the
+// image table
+func New(backend string, cfg config.Config, conn *sql.DB) (database.MediaStore, error) {
+	switch backend {
+	case config.MediaStoragePostgres:
+		return database.NewPostgresStore(conn), nil
+	case config.MediaStorageFS:
+		return NewFS(cfg.MediaDir)
+	case config.MediaStorageS3:
+		return NewS3(cfg.MediaS3Endpoint, cfg.MediaS3Region, cfg.MediaS3Bucket, cfg.MediaS3Prefix, cfg.MediaS3AccessKeyID, cfg.MediaS3SecretAccessKey)
+	}
+	return nil, fmt.Errorf("unknown media storage %s", backend)
+}
+
+// mediaIDRe matches media ids, ksuids optionally followed by the suffix of a
+// logo rendition, they end up in file names and object keys
+var mediaIDRe = regexp.MustCompile(`^[0-9A-Za-z_]{1,64}$`)
+
+func validateMediaID(mediaID string) error {
+	if !mediaIDRe.MatchString(mediaID) {
+		return fmt.Errorf("invalid media id %q", mediaID)
+	}
+	return nil
+}
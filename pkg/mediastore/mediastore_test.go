@@ -0,0 +1,85 @@
+package mediastore
+
+import (
+	"bytes"
+	"database/sql"
+	"sort"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// testMediaStore checks the behaviour every backend shares with the postgres
+// store on an empty store
+func testMediaStore(t *testing.T, s database.MediaStore) {
+	t.Helper()
+	logo := database.Media{Bytes: []byte("\x89PNG logo"), MediaType: "image/png"}
+	id, err := s.SaveMedia(logo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := s.GetMediaByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(media.Bytes, logo.Bytes) || media.MediaType != logo.MediaType || media.SHA256 != database.MediaHash(logo.Bytes) {
+		t.Errorf("got media %+v, want the saved logo", media)
+	}
+	if hash, err := s.GetMediaHash(id); err != nil || hash != database.MediaHash(logo.Bytes) {
+		t.Errorf("got hash %q, %v, want the hash of the saved logo", hash, err)
+	}
+
+	updated := database.Media{Bytes: []byte("\xff\xd8 jpeg logo"), MediaType: "image/jpeg"}
+	if err := s.UpdateMedia(updated, id); err != nil {
+		t.Fatal(err)
+	}
+	if media, err := s.GetMediaByID(id); err != nil || !bytes.Equal(media.Bytes, updated.Bytes) || media.MediaType != updated.MediaType {
+		t.Errorf("got media %+v, %v, want the updated logo", media, err)
+	}
+	if hash, err := s.GetMediaHash(id); err != nil || hash != database.MediaHash(updated.Bytes) {
+		t.Errorf("got hash %q, %v, want the hash of the updated logo", hash, err)
+	}
+
+	// updating missing media does nothing
+	missing := "1wFvcVyEzNEO8XQcm6P8IwM4Ubb"
+	if err := s.UpdateMedia(updated, missing); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{
+		"media": func() error { _, err := s.GetMediaByID(missing); return err }(),
+		"hash":  func() error { _, err := s.GetMediaHash(missing); return err }(),
+	} {
+		if err != sql.ErrNoRows {
+			t.Errorf("got %v for the %s of missing media, want %v", err, name, sql.ErrNoRows)
+		}
+	}
+
+	rendition := id + "_64webp"
+	if err := s.PutMedia(rendition, database.Media{Bytes: []byte("webp"), MediaType: "image/webp"}); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := s.GetMediaIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if want := []string{id, rendition}; len(ids) != 2 || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("got media ids %v, want %v", ids, want)
+	}
+
+	for _, invalid := range []string{"", "../etc/passwd", "a/b", "a.png"} {
+		if err := s.PutMedia(invalid, logo); err == nil {
+			t.Errorf("media stored under invalid id %q", invalid)
+		}
+	}
+
+	if err := s.DeleteMedia(rendition); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetMediaHash(rendition); err != sql.ErrNoRows {
+		t.Errorf("got %v for deleted media, want %v", err, sql.ErrNoRows)
+	}
+	if err := s.DeleteMedia(rendition); err != nil {
+		t.Errorf("deleting missing media: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package mediastore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/segmentio/ksuid"
+)
+
+// s3HashHeader holds the hash of media in the object metadata, S3 ETags are
+// not content hashes for every upload
+const s3HashHeader = "X-Amz-Meta-Sha256"
+
+// S3 stores media as objects of an S3 compatible bucket, addressed in path
+// style so that it works against MinIO and other stand-ins. Requests are
+// signed with AWS signature version 4
+type S3 struct {
+	endpoint        string
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+}
+
+// NewS3 stores media under prefix in bucket, endpoint is the base URL of the
+// S3 API
+func NewS3(endpoint, region, bucket, prefix, accessKeyID, secretAccessKey string) (*S3, error) {
+	if endpoint == "" || region == "" || bucket == "" || accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("the S3 endpoint, region, bucket and credentials cannot be empty")
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %s: %v", endpoint, err)
+	}
+	return &S3{
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		region:          region,
+		bucket:          bucket,
+		prefix:          prefix,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3) SaveMedia(media database.Media) (string, error) {
+	mediaID, err := ksuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	if err := s.PutMedia(mediaID.String(), media); err != nil {
+		return "", err
+	}
+	return mediaID.String(), nil
+}
+
+// UpdateMedia does nothing when the media does not exist, like the postgres
+// store
+func (s *S3) UpdateMedia(media database.Media, mediaID string) error {
+	if _, err := s.GetMediaHash(mediaID); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return s.PutMedia(mediaID, media)
+}
+
+func (s *S3) PutMedia(mediaID string, media database.Media) error {
+	if err := validateMediaID(mediaID); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", media.MediaType)
+	header.Set(s3HashHeader, database.MediaHash(media.Bytes))
+	res, err := s.do(http.MethodPut, s.prefix+mediaID, nil, header, media.Bytes)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) GetMediaByID(mediaID string) (database.Media, error) {
+	if err := validateMediaID(mediaID); err != nil {
+		return database.Media{}, err
+	}
+	res, err := s.do(http.MethodGet, s.prefix+mediaID, nil, nil, nil)
+	if err != nil {
+		return database.Media{}, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return database.Media{}, err
+	}
+	hash := res.Header.Get(s3HashHeader)
+	if hash == "" {
+		hash = database.MediaHash(b)
+	}
+	return database.Media{Bytes: b, MediaType: res.Header.Get("Content-Type"), SHA256: hash}, nil
+}
+
+func (s *S3) GetMediaHash(mediaID string) (string, error) {
+	if err := validateMediaID(mediaID); err != nil {
+		return "", err
+	}
+	res, err := s.do(http.MethodHead, s.prefix+mediaID, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return res.Header.Get(s3HashHeader), nil
+}
+
+func (s *S3) DeleteMedia(mediaID string) error {
+	if err := validateMediaID(mediaID); err != nil {
+		return err
+	}
+	res, err := s.do(http.MethodDelete, s.prefix+mediaID, nil, nil, nil)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3) GetMediaIDs() ([]string, error) {
+	var ids []string
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+	for {
+		res, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var list s3ListBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range list.Contents {
+			id := strings.TrimPrefix(c.Key, s.prefix)
+			if validateMediaID(id) == nil {
+				ids = append(ids, id)
+			}
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return ids, nil
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for an object of the bucket, or for the bucket
+// itself when key is empty. Missing objects return sql.ErrNoRows, other non
+// 2xx responses an error with the body S3 replied with
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint + "/" + s.bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body, time.Now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, sql.ErrNoRows
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, key, res.Status, msg)
+	}
+	return res, nil
+}
+
+// s3Query encodes a query string the way it is canonicalised for signing,
+// sorted with spaces as %20
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// sign adds the AWS signature version 4 of the request, every header set is
+// signed
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, part := range []string{now.Format("20060102"), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
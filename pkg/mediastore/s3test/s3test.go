@@ -0,0 +1,152 @@
+// Package s3test fakes the subset of the S3 API the S3 media store uses, so
+// that it can be tested without MinIO
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PageSize is the number of keys listed per page, small so that listings
+// are paginated
+const PageSize = 2
+
+type object struct {
+	body        []byte
+	contentType string
+	meta        http.Header
+}
+
+// Server is an S3 API serving one bucket from memory. Requests must carry
+// a signature version 4 Authorization header for the access key and the
+// hash of their payload, signatures themselves are not verified
+type Server struct {
+	*httptest.Server
+	bucket      string
+	accessKeyID string
+
+	mu      sync.Mutex
+	objects map[string]object
+	// Requests counts the requests by method
+	requests map[string]int
+}
+
+// NewServer starts a server, it must be closed
+func NewServer(bucket, accessKeyID string) *Server {
+	s := &Server{bucket: bucket, accessKeyID: accessKeyID, objects: make(map[string]object), requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Requests returns the number of requests received with method
+func (s *Server) Requests(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// Put stores an object the way another client would
+func (s *Server) Put(key string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = object{body: body, contentType: "application/octet-stream", meta: http.Header{}}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.Method]++
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/") || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/"+s.bucket)
+	if path == r.URL.Path {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(path, "/")
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		s.list(w, r)
+	case key == "":
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	case r.Method == http.MethodPut:
+		meta := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				meta[k] = v
+			}
+		}
+		s.objects[key] = object{body: body, contentType: r.Header.Get("Content-Type"), meta: meta}
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		o, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		for k, v := range o.meta {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Type", o.contentType)
+		if r.Method == http.MethodGet {
+			w.Write(o.body)
+		}
+	case r.Method == http.MethodDelete:
+		// S3 deletes missing objects without complaining
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type listBucketResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+// list lists the keys with a prefix in order, continuing after the key the
+// continuation token names
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) && k > q.Get("continuation-token") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var res listBucketResult
+	if len(keys) > PageSize {
+		keys = keys[:PageSize]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[PageSize-1]
+	}
+	for _, k := range keys {
+		res.Contents = append(res.Contents, struct{ Key string }{k})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+}
@@ -141,3 +141,23 @@ func IsSignedOn(r *http.Request, sessionStore *sessions.CookieStore, jwtKey []by
 		}
 		return true
 }
+
+// GetClaims returns the jwt claims of the signed on user, if any
+func GetClaims(r *http.Request, sessionStore *sessions.CookieStore, jwtKey []byte) (*MyCustomClaims, bool) {
+	sess, err := sessionStore.Get(r, "____gc")
+	if err != nil {
+		return nil, false
+	}
+	tk, ok := sess.Values["jwt"].(string)
+	if !ok {
+		return nil, false
+	}
+	token, err := jwt.ParseWithClaims(tk, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	claims, ok := token.Claims.(*MyCustomClaims)
+	return claims, ok
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+const usage = `usage: migrate <command> [n]
+
+commands:
+  up [n]     apply the next n pending migrations (all when n is omitted)
+  down [n]   revert the last n applied migrations (1 when n is omitted)
+  status     list migrations and whether they have been applied
+
+environment:
+  HEROKU_POSTGRESQL_PINK_URL  postgres connection string
+  MIGRATIONS_DIR              migration files directory (default "migrations")`
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	databaseURL := os.Getenv("HEROKU_POSTGRESQL_PINK_URL")
+	if databaseURL == "" {
+		log.Fatalf("HEROKU_POSTGRESQL_PINK_URL cannot be empty")
+	}
+	dir := os.Getenv("MIGRATIONS_DIR")
+	if dir == "" {
+		dir = database.DefaultMigrationsDir
+	}
+	var steps int
+	if len(os.Args) > 2 {
+		n, err := strconv.Atoi(os.Args[2])
+		if err != nil || n < 1 {
+			log.Fatalf("invalid number of steps %s\n%s", os.Args[2], usage)
+		}
+		steps = n
+	}
+	conn, err := database.GetDbConn(databaseURL, "")
+	if err != nil {
+		log.Fatalf("unable to connect to postgres: %v", err)
+	}
+	defer database.CloseDbConn(conn)
+
+	switch os.Args[1] {
+	case "up":
+		done, err := database.MigrateUp(conn, dir, steps)
+		for _, m := range done {
+			log.Printf("applied migration %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("unable to apply migrations: %v", err)
+		}
+		log.Printf("applied %d migrations\n", len(done))
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		done, err := database.MigrateDown(conn, dir, steps)
+		for _, m := range done {
+			log.Printf("reverted migration %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("unable to revert migrations: %v", err)
+		}
+		log.Printf("reverted %d migrations\n", len(done))
+	case "status":
+		migrations, err := database.LoadMigrations(dir)
+		if err != nil {
+			log.Fatalf("unable to load migrations from %s: %v", dir, err)
+		}
+		status, err := database.GetMigrationStatus(conn, migrations)
+		if err != nil {
+			log.Fatalf("unable to retrieve migration status: %v", err)
+		}
+		for _, s := range status {
+			if s.Applied {
+				fmt.Printf("%04d_%s\tapplied %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -33,7 +33,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to load config %v", err)
 	}
-	conn, err := database.GetDbConn(cfg.DatabaseURL)
+	conn, err := database.GetDbConn(cfg.DatabaseURL, cfg.MigrationsDir)
 	if err != nil {
 		log.Fatalf("unable to connect to postgres: %v", err)
 	}
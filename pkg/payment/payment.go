@@ -14,6 +14,8 @@ import (
 	"strings"
 )
 
+const RenewalDescription = "Golang Cafe Job Ad Renewal"
+
 func AdTypeToAmount(adType int64) int64 {
 	switch adType {
 	case database.JobAdBasic:
@@ -98,6 +100,34 @@ func CreateSession(stripeKey string, jobRq *database.JobRq, jobToken string) (*s
 	return session, nil
 }
 
+// CreateRenewalSession creates a checkout session to renew an existing job ad
+func CreateRenewalSession(stripeKey string, amount int64, currencyCode, email, jobToken string) (*stripe.CheckoutSession, error) {
+	stripe.Key = stripeKey
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{
+			"card",
+		}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			&stripe.CheckoutSessionLineItemParams{
+				Name:     stripe.String(RenewalDescription),
+				Amount:   stripe.Int64(amount),
+				Currency: stripe.String(strings.ToLower(currencyCode)),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		SuccessURL:    stripe.String(fmt.Sprintf("https://golang.cafe/edit/%s?payment=1&callback=1", jobToken)),
+		CancelURL:     stripe.String(fmt.Sprintf("https://golang.cafe/edit/%s?payment=0&callback=1", jobToken)),
+		CustomerEmail: &email,
+	}
+
+	session, err := session.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stripe session: %+v", err)
+	}
+
+	return session, nil
+}
+
 func HandleCheckoutSessionComplete(body []byte, endpointSecret, stripeSig string) (*stripe.CheckoutSession, error) {
 	event, err := webhook.ConstructEvent(body, stripeSig, endpointSecret)
 	if err != nil {
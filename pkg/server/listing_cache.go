@@ -0,0 +1,144 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// ListingCacheStats counts the lookups of the listing cache since the server
+// started
+type ListingCacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+	Entries       int   `json:"entries"`
+}
+
+type listingCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// listingCache is a read-through cache of listing results, keyed by
+// normalized filters. Values are shared between requests and must not be
+// modified once cached
+type listingCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]listingCacheEntry
+	stats   ListingCacheStats
+	// generation changes on every invalidation, values loaded across one are
+	// not cached
+	generation int64
+}
+
+// newListingCache returns a cache keeping values for ttl, values are never
+// kept when ttl is zero
+func newListingCache(ttl time.Duration) *listingCache {
+	return &listingCache{ttl: ttl, entries: make(map[string]listingCacheEntry)}
+}
+
+// get returns the value cached for key, it is loaded and cached when missing
+// or expired. Loading errors are not cached, neither are values loaded while
+// the cache was invalidated as they can be stale
+func (c *listingCache) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expiresAt) {
+		c.stats.Hits++
+		c.mu.Unlock()
+		return e.value, nil
+	}
+	c.stats.Misses++
+	generation := c.generation
+	c.mu.Unlock()
+	v, err := load()
+	if err != nil || c.ttl <= 0 {
+		return v, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return v, nil
+	}
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = listingCacheEntry{value: v, expiresAt: now.Add(c.ttl)}
+	return v, nil
+}
+
+// invalidate drops every cached value
+func (c *listingCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]listingCacheEntry)
+	c.generation++
+	c.stats.Invalidations++
+}
+
+func (c *listingCache) Stats() ListingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// invalidatingJobStore drops the cached listings whenever a job changes in a
+// way that can show in them
+type invalidatingJobStore struct {
+	database.JobStore
+	listings *listingCache
+}
+
+func (s invalidatingJobStore) UpdateJob(job *database.JobRqUpdate, jobID int, editor string) ([]string, error) {
+	defer s.listings.invalidate()
+	return s.JobStore.UpdateJob(job, jobID, editor)
+}
+
+func (s invalidatingJobStore) RevertJob(jobID, revision int, editor string) ([]string, error) {
+	defer s.listings.invalidate()
+	return s.JobStore.RevertJob(jobID, revision, editor)
+}
+
+func (s invalidatingJobStore) TransitionJobStatus(jobID int, to database.JobStatus, actor string) error {
+	defer s.listings.invalidate()
+	return s.JobStore.TransitionJobStatus(jobID, to, actor)
+}
+
+func (s invalidatingJobStore) RenewJob(jobID int, expiresAt time.Time, actor string) error {
+	defer s.listings.invalidate()
+	return s.JobStore.RenewJob(jobID, expiresAt, actor)
+}
+
+func (s invalidatingJobStore) ArchiveJob(jobID int, reason, actor string) error {
+	defer s.listings.invalidate()
+	return s.JobStore.ArchiveJob(jobID, reason, actor)
+}
+
+func (s invalidatingJobStore) RestoreJob(jobID int, actor string) (database.JobStatus, error) {
+	defer s.listings.invalidate()
+	return s.JobStore.RestoreJob(jobID, actor)
+}
+
+func (s invalidatingJobStore) UpdateJobAdType(adType int, jobID int) error {
+	defer s.listings.invalidate()
+	return s.JobStore.UpdateJobAdType(adType, jobID)
+}
+
+// invalidatingCompanyStore drops the cached listings when a company changes,
+// their names label the company refinements
+type invalidatingCompanyStore struct {
+	database.CompanyStore
+	listings *listingCache
+}
+
+func (s invalidatingCompanyStore) UpdateCompany(c database.Company) error {
+	defer s.listings.invalidate()
+	return s.CompanyStore.UpdateCompany(c)
+}
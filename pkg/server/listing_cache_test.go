@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListingCacheGet(t *testing.T) {
+	c := newListingCache(time.Minute)
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := c.get("k", load); err != nil || v != 1 {
+			t.Fatalf("got %v, %v, want 1", v, err)
+		}
+	}
+	c.invalidate()
+	if v, _ := c.get("k", load); v != 2 {
+		t.Fatalf("got %v after invalidation, want 2", v)
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 2 || stats.Invalidations != 1 || stats.Entries != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestListingCacheInvalidateDuringLoad(t *testing.T) {
+	c := newListingCache(time.Minute)
+	// the job changes while the listing is read, what was read is stale
+	v, err := c.get("k", func() (interface{}, error) {
+		c.invalidate()
+		return "stale", nil
+	})
+	if err != nil || v != "stale" {
+		t.Fatalf("got %v, %v, want the loaded value", v, err)
+	}
+	v, _ = c.get("k", func() (interface{}, error) {
+		return "fresh", nil
+	})
+	if v != "fresh" {
+		t.Errorf("got %v, want the value loaded after the invalidation", v)
+	}
+}
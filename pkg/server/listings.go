@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+var quickApplyRe = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// jobListing is a listing as of the time it was first read, its jobs are
+// ranked as of that time so that they do not move between pages while it is
+// cached
+type jobListing struct {
+	asOf  time.Time
+	total int
+}
+
+// jobPage is a page of rendered jobs and the cursor ending it
+type jobPage struct {
+	jobs []*database.JobPost
+	next database.JobCursor
+}
+
+// renderJobs renders the markdown of listed jobs, once per cached listing
+func (s Server) renderJobs(jobs []*database.JobPost) []*database.JobPost {
+	for i, j := range jobs {
+		jobs[i].HTMLJobDescription = string(s.tmpl.MarkdownToHTML(j.JobDescription))
+		jobs[i].HTMLPerks = string(s.tmpl.MarkdownToHTML(j.Perks))
+		jobs[i].HTMLInterviewProcess = string(s.tmpl.MarkdownToHTML(j.InterviewProcess))
+		if quickApplyRe.MatchString(j.HowToApply) {
+			jobs[i].IsQuickApply = true
+		}
+	}
+	return jobs
+}
+
+// PinnedJobs returns the rendered pinned jobs, they must not be modified
+func (s Server) PinnedJobs() ([]*database.JobPost, error) {
+	v, err := s.listings.get("pinned", func() (interface{}, error) {
+		jobs, err := s.Jobs.GetPinnedJobs(s.RankingWeights())
+		return s.renderJobs(jobs), err
+	})
+	jobs, _ := v.([]*database.JobPost)
+	return jobs, err
+}
+
+// JobsForPage returns the rendered jobs on a numbered page of the listing
+// matching the filter, they must not be modified, the cursor ending the page
+// and the number of jobs the listing has. The page is read after the cursor
+// ending the previous one, when after does not give it only the cursor of
+// that page is looked up. The returned cursor starts the listing over on the
+// last page
+func (s Server) JobsForPage(f database.JobFilter, page int, after database.JobCursor) ([]*database.JobPost, database.JobCursor, int, error) {
+	w := s.RankingWeights()
+	key := fmt.Sprintf("%s|%d", f.Key(), s.cfg.JobsPerPage)
+	v, err := s.listings.get("listing|"+key, func() (interface{}, error) {
+		l := jobListing{asOf: time.Now().UTC().Truncate(time.Second)}
+		var err error
+		l.total, err = s.Jobs.CountJobs(f)
+		return l, err
+	})
+	if err != nil {
+		return nil, database.JobCursor{}, 0, err
+	}
+	l := v.(jobListing)
+	load := func(after database.JobCursor) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			jobs, next, err := s.Jobs.JobsByQuery(f, w, after, s.cfg.JobsPerPage)
+			return jobPage{jobs: s.renderJobs(jobs), next: next}, err
+		}
+	}
+	switch {
+	case !after.IsStart() && !after.AsOf.Equal(l.asOf):
+		// cursors of a listing no longer cached are followed without caching
+		// the page, clients choose them
+		v, err = load(after)()
+	case !after.IsStart():
+		v, err = s.listings.get(fmt.Sprintf("jobs|%s|%s", key, after), load(after))
+	default:
+		after = database.JobCursor{AsOf: l.asOf}
+		if page > 1 {
+			v, err := s.listings.get(fmt.Sprintf("cursor|%s|%d|%d", key, l.asOf.Unix(), page), func() (interface{}, error) {
+				return s.Jobs.JobCursorAt(f, w, l.asOf, (page-1)*s.cfg.JobsPerPage)
+			})
+			if err != nil {
+				return nil, database.JobCursor{}, 0, err
+			}
+			if after = v.(database.JobCursor); after.IsStart() {
+				return []*database.JobPost{}, database.JobCursor{}, l.total, nil
+			}
+		}
+		v, err = s.listings.get(fmt.Sprintf("jobs|%s|%s", key, after), load(after))
+	}
+	if err != nil {
+		return nil, database.JobCursor{}, 0, err
+	}
+	p := v.(jobPage)
+	return p.jobs, p.next, l.total, nil
+}
+
+// jobFacets returns the refinements of the listing matching the filter
+func (s Server) jobFacets(f database.JobFilter) ([]database.JobFacet, error) {
+	v, err := s.listings.get("facets|"+f.Key(), func() (interface{}, error) {
+		return s.Jobs.GetJobFacets(f)
+	})
+	facets, _ := v.([]database.JobFacet)
+	return facets, err
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/imageproc"
+)
+
+// logoRenditionsTTL bounds how long another server can serve a logo from
+// renditions it no longer has, they only change when the logo is replaced
+const logoRenditionsTTL = time.Hour
+
+// maxLogoRenditions bounds the number of logos remembered, requests can name
+// any media id
+const maxLogoRenditions = 10000
+
+type logoRenditionsEntry struct {
+	formats   []string
+	expiresAt time.Time
+}
+
+// logoRenditions remembers the formats each logo has renditions in, so that
+// serving a logo does not look them up in the media store on every request.
+// Logos uploaded before renditions have none, which is remembered too
+type logoRenditions struct {
+	mu      sync.Mutex
+	entries map[string]logoRenditionsEntry
+	// generation changes whenever a logo is forgotten, lookups made across
+	// one are not remembered as they can be stale
+	generation int64
+}
+
+func newLogoRenditions() *logoRenditions {
+	return &logoRenditions{entries: make(map[string]logoRenditionsEntry)}
+}
+
+// get returns the formats of the renditions of a logo, they are looked up
+// when unknown or expired
+func (c *logoRenditions) get(mediaID string, lookup func() []string) []string {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[mediaID]; ok && now.Before(e.expiresAt) {
+		c.mu.Unlock()
+		return e.formats
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	formats := lookup()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return formats
+	}
+	if len(c.entries) >= maxLogoRenditions {
+		c.entries = make(map[string]logoRenditionsEntry)
+	}
+	c.entries[mediaID] = logoRenditionsEntry{formats: formats, expiresAt: now.Add(logoRenditionsTTL)}
+	return formats
+}
+
+// forget drops what is known of the renditions of the logo a media id, or
+// the id of one of its renditions, belongs to
+func (c *logoRenditions) forget(mediaID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, strings.SplitN(mediaID, "_", 2)[0])
+	c.generation++
+}
+
+// LogoRenditionID returns the id of the rendition of a logo at one of
+// imageproc.RenditionSizes in the first of formats it has renditions in
+func (s Server) LogoRenditionID(mediaID string, size int, formats []string) (string, bool) {
+	available := s.renditions.get(mediaID, func() []string {
+		// renditions are saved at every size, the largest tells the formats
+		largest := imageproc.RenditionSizes[len(imageproc.RenditionSizes)-1]
+		var available []string
+		for _, format := range []string{imageproc.FormatWebP, imageproc.FormatPNG, imageproc.FormatJPEG} {
+			if _, err := s.Media.GetMediaHash(imageproc.RenditionID(mediaID, largest, format)); err == nil {
+				available = append(available, format)
+			}
+		}
+		return available
+	})
+	for _, format := range formats {
+		for _, f := range available {
+			if f == format {
+				return imageproc.RenditionID(mediaID, size, format), true
+			}
+		}
+	}
+	return "", false
+}
+
+// renditionTrackingMediaStore forgets the renditions known of a logo when it
+// or one of its renditions is written
+type renditionTrackingMediaStore struct {
+	database.MediaStore
+	renditions *logoRenditions
+}
+
+func (s renditionTrackingMediaStore) UpdateMedia(media database.Media, mediaID string) error {
+	defer s.renditions.forget(mediaID)
+	return s.MediaStore.UpdateMedia(media, mediaID)
+}
+
+func (s renditionTrackingMediaStore) PutMedia(mediaID string, media database.Media) error {
+	defer s.renditions.forget(mediaID)
+	return s.MediaStore.PutMedia(mediaID, media)
+}
+
+func (s renditionTrackingMediaStore) DeleteMedia(mediaID string) error {
+	defer s.renditions.forget(mediaID)
+	return s.MediaStore.DeleteMedia(mediaID)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/imageproc"
+)
+
+// hashCountingMediaStore counts the hash lookups, HEAD requests on S3
+type hashCountingMediaStore struct {
+	database.MediaStore
+	hashes *int
+}
+
+func (s hashCountingMediaStore) GetMediaHash(mediaID string) (string, error) {
+	*s.hashes++
+	return s.MediaStore.GetMediaHash(mediaID)
+}
+
+func TestLogoRenditionID(t *testing.T) {
+	var hashes int
+	renditions := newLogoRenditions()
+	media := hashCountingMediaStore{MediaStore: database.NewMemoryStore(), hashes: &hashes}
+	s := Server{Media: renditionTrackingMediaStore{MediaStore: media, renditions: renditions}, renditions: renditions}
+	formats := []string{imageproc.FormatWebP, imageproc.FormatPNG, imageproc.FormatJPEG}
+
+	// logos uploaded before renditions are looked up once
+	id, err := s.Media.SaveMedia(database.Media{Bytes: []byte("logo"), MediaType: "image/png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if rendition, ok := s.LogoRenditionID(id, 64, formats); ok {
+			t.Fatalf("got rendition %s of a logo without renditions", rendition)
+		}
+	}
+	if hashes != 3 {
+		t.Fatalf("got %d hash lookups, want 3", hashes)
+	}
+
+	// replacing the logo with renditions forgets it had none
+	for _, size := range imageproc.RenditionSizes {
+		if err := s.Media.PutMedia(imageproc.RenditionID(id, size, imageproc.FormatPNG), database.Media{Bytes: []byte("png"), MediaType: "image/png"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashes = 0
+	for i := 0; i < 3; i++ {
+		rendition, ok := s.LogoRenditionID(id, 64, formats)
+		if want := imageproc.RenditionID(id, 64, imageproc.FormatPNG); !ok || rendition != want {
+			t.Fatalf("got rendition %s, %v, want %s", rendition, ok, want)
+		}
+	}
+	if hashes != 3 {
+		t.Errorf("got %d hash lookups, want 3", hashes)
+	}
+	if rendition, ok := s.LogoRenditionID(id, 64, []string{imageproc.FormatJPEG}); ok {
+		t.Errorf("got rendition %s in a format the logo does not have", rendition)
+	}
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+	"github.com/0x13a/golang.cafe/pkg/imagemeta"
+)
+
+type metaImageCall struct {
+	done chan struct{}
+	meta database.MetaImage
+	err  error
+}
+
+// metaImages generates meta images once per page at a time, crawlers fetch
+// the image of a shared page together. It also keeps track of the images
+// generated in the background so that shutdown can wait for them
+type metaImages struct {
+	mu       sync.Mutex
+	inflight map[string]*metaImageCall
+	wg       sync.WaitGroup
+}
+
+func newMetaImages() *metaImages {
+	return &metaImages{inflight: make(map[string]*metaImageCall)}
+}
+
+// do runs generate for key, callers arriving while it runs get its result
+func (g *metaImages) do(key string, generate func() (database.MetaImage, error)) (database.MetaImage, error) {
+	g.mu.Lock()
+	if c, ok := g.inflight[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.meta, c.err
+	}
+	c := &metaImageCall{done: make(chan struct{})}
+	g.inflight[key] = c
+	g.mu.Unlock()
+
+	c.meta, c.err = generate()
+	g.mu.Lock()
+	delete(g.inflight, key)
+	g.mu.Unlock()
+	close(c.done)
+	return c.meta, c.err
+}
+
+// jobLogoHash returns the hash of the logo of a job, empty when it has none
+// or it is missing from the media store
+func (s Server) jobLogoHash(job database.JobPost) string {
+	if job.CompanyIconID == "" {
+		return ""
+	}
+	hash, err := s.Media.GetMediaHash(job.CompanyIconID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.Log(err, fmt.Sprintf("unable to retrieve hash of logo %s", job.CompanyIconID))
+		}
+		return ""
+	}
+	return hash
+}
+
+// jobLogo returns the decoded logo of a job, nil when it has none or it
+// cannot be decoded
+func (s Server) jobLogo(job database.JobPost) image.Image {
+	if job.CompanyIconID == "" {
+		return nil
+	}
+	media, err := s.Media.GetMediaByID(job.CompanyIconID)
+	if err != nil {
+		s.Log(err, fmt.Sprintf("unable to retrieve logo %s", job.CompanyIconID))
+		return nil
+	}
+	logo, err := imagemeta.DecodeLogo(media.Bytes)
+	if err != nil {
+		s.Log(err, fmt.Sprintf("unable to decode logo %s", job.CompanyIconID))
+		return nil
+	}
+	return logo
+}
+
+func (s Server) jobMetaImageTemplate(job database.JobPost) (imagemeta.Template, string) {
+	logoHash := s.jobLogoHash(job)
+	return imagemeta.TemplateForJob(job, logoHash != ""), logoHash
+}
+
+// JobMetaImageTemplate returns the template the meta image of a job is drawn
+// with
+func (s Server) JobMetaImageTemplate(job database.JobPost) imagemeta.Template {
+	t, _ := s.jobMetaImageTemplate(job)
+	return t
+}
+
+// JobMetaImageVersion returns a short hash of the current meta image of a
+// job, for its URL to change whenever the image does
+func (s Server) JobMetaImageVersion(job database.JobPost) string {
+	t, logoHash := s.jobMetaImageTemplate(job)
+	return imagemeta.JobImageHash(t, job, logoHash)[:12]
+}
+
+// metaImage returns the meta image saved under key, it is drawn with
+// generate and saved to the media store when missing or when what it renders
+// no longer hashes to hash. The image it replaces is deleted
+func (s Server) metaImage(key, hash string, generate func() ([]byte, error)) (database.MetaImage, error) {
+	return s.metaImages.do(key, func() (database.MetaImage, error) {
+		current, err := s.MetaImages.GetMetaImage(key)
+		if err == nil && current.FieldsHash == hash {
+			return current, nil
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return database.MetaImage{}, err
+		}
+		mediaBytes, err := generate()
+		if err != nil {
+			return database.MetaImage{}, err
+		}
+		meta := database.MetaImage{
+			Key:         key,
+			FieldsHash:  hash,
+			MediaID:     imagemeta.MediaID(hash),
+			GeneratedAt: time.Now().UTC(),
+		}
+		if err := s.Media.PutMedia(meta.MediaID, database.Media{Bytes: mediaBytes, MediaType: "image/png"}); err != nil {
+			return database.MetaImage{}, err
+		}
+		if err := s.MetaImages.SaveMetaImage(meta); err != nil {
+			return database.MetaImage{}, err
+		}
+		if current.MediaID != "" && current.MediaID != meta.MediaID {
+			if err := s.Media.DeleteMedia(current.MediaID); err != nil {
+				s.Log(err, fmt.Sprintf("unable to delete previous meta image %s of %s", current.MediaID, key))
+			}
+		}
+		return meta, nil
+	})
+}
+
+// JobMetaImage returns the meta image of a job, it is generated again when
+// the fields, template or logo it renders changed
+func (s Server) JobMetaImage(job database.JobPost) (database.MetaImage, error) {
+	t, logoHash := s.jobMetaImageTemplate(job)
+	hash := imagemeta.JobImageHash(t, job, logoHash)
+	return s.metaImage(database.JobMetaImageKey(job.ExternalID), hash, func() ([]byte, error) {
+		var logo image.Image
+		if logoHash != "" {
+			logo = s.jobLogo(job)
+		}
+		return imagemeta.GenerateImageForJob(t, job, logo)
+	})
+}
+
+// PageMetaImage is the meta image of a salary, landing or news page and the
+// key it is saved under
+type PageMetaImage struct {
+	Key   string
+	Image imagemeta.PageImage
+}
+
+// PageMetaImage returns the meta image of a page, it is generated again when
+// the figures it renders changed
+func (s Server) PageMetaImage(p PageMetaImage) (database.MetaImage, error) {
+	return s.metaImage(p.Key, p.Image.Hash(), func() ([]byte, error) {
+		return imagemeta.GeneratePageImage(p.Image)
+	})
+}
+
+// SalaryMetaImage returns the meta image of the salary page of a location,
+// with the median salary in the currency of the location
+func (s Server) SalaryMetaImage(location string) (PageMetaImage, error) {
+	st, err := s.salaryStats(location, "")
+	if err != nil {
+		return PageMetaImage{}, err
+	}
+	// the image is the same for every unknown location, they all show the
+	// salaries of remote jobs
+	key := database.SalaryMetaImageKey(st.Location)
+	p50Min, p50Max := st.p50()
+	remote := st.ComplimentaryRemote && st.Location != "Remote"
+	return PageMetaImage{
+		Key:   key,
+		Image: imagemeta.SalaryImage(st.Location, st.Country, database.SalaryCurrencySymbol(st.CurrencyCode), p50Min, p50Max, len(st.Set), remote),
+	}, nil
+}
+
+// LandingMetaImage returns the meta image of the landing page of a location
+// and a skill with the number of jobs it lists. Unknown locations and
+// skills are left out, so that there is one image per known page
+func (s Server) LandingMetaImage(location, skill string) (PageMetaImage, error) {
+	location = strings.TrimSpace(location)
+	if strings.EqualFold(location, "Remote") {
+		location = "Remote"
+	} else if location != "" {
+		loc, _, _, err := s.Jobs.GetLocation(location)
+		if err != nil && err != sql.ErrNoRows {
+			return PageMetaImage{}, err
+		}
+		location = loc
+	}
+	sk, _ := database.SkillByName(skill)
+	_, _, total, err := s.JobsForPage(database.JobFilter{Location: location, Query: sk.Name}, 1, database.JobCursor{})
+	if err != nil {
+		return PageMetaImage{}, err
+	}
+	return PageMetaImage{
+		Key:   database.LandingMetaImageKey(location, sk.Slug),
+		Image: imagemeta.LandingImage(location, sk.Name, total),
+	}, nil
+}
+
+// NewsMetaImage returns the meta image of a news thread with the number of
+// its comments
+func (s Server) NewsMetaImage(newsID string) (PageMetaImage, error) {
+	news, err := s.News.GetNewsByID(newsID)
+	if err != nil {
+		return PageMetaImage{}, err
+	}
+	comments, err := s.News.GetNewsComments(newsID)
+	if err != nil {
+		return PageMetaImage{}, err
+	}
+	return PageMetaImage{
+		Key:   database.NewsMetaImageKey(news.ID),
+		Image: imagemeta.NewsImage(news.ID, news.Title, len(comments)),
+	}, nil
+}
+
+// PreviewJobMetaImage draws the meta image of a job with any template,
+// without saving it
+func (s Server) PreviewJobMetaImage(job database.JobPost, t imagemeta.Template) ([]byte, error) {
+	return imagemeta.GenerateImageForJob(t, job, s.jobLogo(job))
+}
+
+// GenerateJobMetaImage generates the meta image of a job in the background
+// so that it is ready before the job gets shared
+func (s Server) GenerateJobMetaImage(externalID string) {
+	s.metaImages.wg.Add(1)
+	go func() {
+		defer s.metaImages.wg.Done()
+		job, err := s.Jobs.GetJobByExternalID(externalID)
+		if err != nil {
+			s.Log(err, fmt.Sprintf("unable to retrieve job %s to generate its meta image", externalID))
+			return
+		}
+		if _, err := s.JobMetaImage(job); err != nil {
+			s.Log(err, fmt.Sprintf("unable to generate meta image of job %s", externalID))
+		}
+	}()
+}
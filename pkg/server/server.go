@@ -2,7 +2,7 @@ package server
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,9 +10,12 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	stdtemplate "html/template"
@@ -33,17 +36,32 @@ import (
 
 type Server struct {
 	cfg           config.Config
-	Conn          *sql.DB
+	Jobs          database.JobStore
+	Media         database.MediaStore
+	MetaImages    database.MetaImageStore
+	Users         database.UserStore
+	News          database.NewsStore
+	Purchases     database.PurchaseStore
+	Events        database.EventStore
+	Audit         database.AuditStore
+	Rates         database.ExchangeRateStore
+	Companies     database.CompanyStore
 	router        *mux.Router
 	tmpl          *template.Template
 	emailClient   email.Client
 	ipGeoLocation ipgeolocation.IPGeoLocation
 	SessionStore  *sessions.CookieStore
+	listings      *listingCache
+	eventIngester *database.EventIngester
+	metaImages    *metaImages
+	// renditions is shared with the Media store, which forgets the
+	// renditions of logos written through it
+	renditions *logoRenditions
 }
 
 func NewServer(
 	cfg config.Config,
-	conn *sql.DB,
+	stores database.Stores,
 	r *mux.Router,
 	t *template.Template,
 	emailClient email.Client,
@@ -53,14 +71,44 @@ func NewServer(
 	// todo: move somewhere else
 	raven.SetDSN(cfg.SentryDSN)
 
+	listings := newListingCache(time.Duration(cfg.ListingCacheTTLSeconds) * time.Second)
+	renditions := newLogoRenditions()
+	// events are tracked on the request path when there is no buffer
+	var eventIngester *database.EventIngester
+	if cfg.EventBufferSize > 0 {
+		eventIngester = database.NewEventIngester(
+			stores.Events,
+			cfg.EventBufferSize,
+			cfg.EventBatchSize,
+			time.Duration(cfg.EventFlushIntervalSeconds)*time.Second,
+			func(err error) {
+				raven.CaptureError(err, map[string]string{"ctx": "unable to save job events"})
+				log.Printf("unable to save job events: %+v", err)
+			},
+		)
+		stores.Events = eventIngester
+	}
 	return Server{
 		cfg:           cfg,
-		Conn:          conn,
+		Jobs:          invalidatingJobStore{JobStore: stores.Jobs, listings: listings},
+		Media:         renditionTrackingMediaStore{MediaStore: stores.Media, renditions: renditions},
+		MetaImages:    stores.MetaImages,
+		Users:         stores.Users,
+		News:          stores.News,
+		Purchases:     stores.Purchases,
+		Events:        stores.Events,
+		Audit:         stores.Audit,
+		Rates:         stores.Rates,
+		Companies:     invalidatingCompanyStore{CompanyStore: stores.Companies, listings: listings},
 		router:        r,
 		tmpl:          t,
 		emailClient:   emailClient,
 		ipGeoLocation: ipGeoLocation,
 		SessionStore:  sessionStore,
+		listings:      listings,
+		eventIngester: eventIngester,
+		metaImages:    newMetaImages(),
+		renditions:    renditions,
 	}
 }
 
@@ -88,41 +136,93 @@ func (s Server) GetConfig() config.Config {
 	return s.cfg
 }
 
-func (s Server) RenderSalaryForLocation(w http.ResponseWriter, r *http.Request, location string) {
-	loc, currency, country, err := database.GetLocation(s.Conn, location)
-	complimentaryRemote := false
+// RankingWeights returns the configured weights listings are ranked by
+func (s Server) RankingWeights() database.RankingWeights {
+	return database.RankingWeights{
+		Text:                s.cfg.RankTextWeight,
+		Recency:             s.cfg.RankRecencyWeight,
+		RecencyHalfLifeDays: s.cfg.RankRecencyHalfLifeDays,
+		Quality:             s.cfg.RankQualityWeight,
+		Placement:           s.cfg.RankPlacementWeight,
+	}
+}
+
+// ListingCacheStats returns the counters of the listing cache
+func (s Server) ListingCacheStats() ListingCacheStats {
+	return s.listings.Stats()
+}
+
+// salaryStats are the salaries of the jobs in a location converted to one
+// currency, those of remote jobs when the location has none
+type salaryStats struct {
+	Location            string
+	Country             string
+	CurrencyCode        string
+	ComplimentaryRemote bool
+	Samples             []database.SalarySample
+	Set                 []database.SalaryDataPoint
+	Min                 stats.Sample
+	Max                 stats.Sample
+}
+
+// p50 returns the medians of the minimum and maximum salaries
+func (st salaryStats) p50() (int64, int64) {
+	return int64(math.Round(st.Min.Quantile(0.5))), int64(math.Round(st.Max.Quantile(0.5)))
+}
+
+// salaryStats returns the salaries of a location in currencyCode, or in the
+// currency of the location when currencyCode is not a salary currency
+func (s Server) salaryStats(location, currencyCode string) (salaryStats, error) {
+	var st salaryStats
+	loc, currency, country, err := s.Jobs.GetLocation(location)
 	if err != nil {
-		complimentaryRemote = true
+		st.ComplimentaryRemote = true
 		loc = "Remote"
 		currency = "$"
 	}
-	set, err := database.GetSalaryDataForLocationAndCurrency(s.Conn, loc, currency)
+	st.Location, st.Country = loc, country
+	// locations store the currency symbol, salaries are shown in its ISO
+	// code unless the visitor picked another currency
+	st.CurrencyCode = database.SalaryCurrencyCode(currency)
+	if database.IsSalaryCurrencyCode(currencyCode) {
+		st.CurrencyCode = currencyCode
+	}
+	rateSet, err := s.Rates.GetExchangeRates()
 	if err != nil {
-		s.Log(err, fmt.Sprintf("unable to retrieve salary stats for location %s and currency %s, err: %#v", location, currency, err))
-		s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
-		return
+		return salaryStats{}, fmt.Errorf("unable to retrieve exchange rates: %w", err)
 	}
-	trendSet, err := database.GetSalaryTrendsForLocationAndCurrency(s.Conn, loc, currency)
+	rates := database.NewExchangeRates(rateSet)
+	samples, err := s.Jobs.GetSalarySamplesForLocation(loc)
 	if err != nil {
-		s.Log(err, fmt.Sprintf("unable to retrieve salary trends for location %s and currency %s, err: %#v", location, currency, err))
-		s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
-		return
+		return salaryStats{}, err
 	}
-	if len(set) < 1 {
-		complimentaryRemote = true
-		set, err = database.GetSalaryDataForLocationAndCurrency(s.Conn, "Remote", "$")
-		if err != nil {
-			s.Log(err, fmt.Sprintf("unable to retrieve salary stats for location %s and currency %s, err: %#v", location, currency, err))
-			s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
-			return
-		}
-		trendSet, err = database.GetSalaryTrendsForLocationAndCurrency(s.Conn, "Remote", "$")
+	samples, _ = rates.NormalizeSalaries(samples, st.CurrencyCode)
+	if len(samples) < 1 {
+		st.ComplimentaryRemote = true
+		samples, err = s.Jobs.GetSalarySamplesForLocation("Remote")
 		if err != nil {
-			s.Log(err, fmt.Sprintf("unable to retrieve salary stats for location %s and currency %s, err: %#v", location, currency, err))
-			s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
-			return
+			return salaryStats{}, err
 		}
+		samples, _ = rates.NormalizeSalaries(samples, st.CurrencyCode)
+	}
+	st.Samples = samples
+	st.Set = database.SalaryDataPoints(samples)
+	for _, x := range st.Set {
+		st.Min.Xs = append(st.Min.Xs, float64(x.Min))
+		st.Max.Xs = append(st.Max.Xs, float64(x.Max))
+	}
+	return st, nil
+}
+
+func (s Server) RenderSalaryForLocation(w http.ResponseWriter, r *http.Request, location string) {
+	st, err := s.salaryStats(location, strings.ToUpper(r.URL.Query().Get("currency")))
+	if err != nil {
+		s.Log(err, fmt.Sprintf("unable to retrieve salary stats for location %s, err: %#v", location, err))
+		s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
+		return
 	}
+	currencyCode, set, sampleMin, sampleMax := st.CurrencyCode, st.Set, st.Min, st.Max
+	trendSet := database.SalaryTrends(st.Samples)
 	jsonRes, err := json.Marshal(set)
 	if err != nil {
 		s.Log(err, fmt.Sprintf("unable to marshal data set %v, err: %#v", set, err))
@@ -135,11 +235,6 @@ func (s Server) RenderSalaryForLocation(w http.ResponseWriter, r *http.Request,
 		s.JSON(w, http.StatusInternalServerError, map[string]string{"status": "error"})
 		return
 	}
-	var sampleMin, sampleMax stats.Sample
-	for _, x := range set {
-		sampleMin.Xs = append(sampleMin.Xs, float64(x.Min))
-		sampleMax.Xs = append(sampleMax.Xs, float64(x.Max))
-	}
 	min, _ := sampleMin.Bounds()
 	_, max := sampleMax.Bounds()
 	min = min - 30000
@@ -150,7 +245,9 @@ func (s Server) RenderSalaryForLocation(w http.ResponseWriter, r *http.Request,
 	s.Render(w, http.StatusOK, "salary-explorer.html", map[string]interface{}{
 		"Location":            strings.ReplaceAll(location, "-", " "),
 		"LocationURIEncoded":  url.QueryEscape(strings.ReplaceAll(location, "-", " ")),
-		"Currency":            currency,
+		"Currency":            database.SalaryCurrencySymbol(currencyCode),
+		"CurrencyCode":        currencyCode,
+		"Currencies":          database.SalaryCurrencies,
 		"DataSet":             string(jsonRes),
 		"DataSetTrends":       string(jsonTrendRes),
 		"P10Max":              humanize.Comma(int64(math.Round(sampleMax.Quantile(0.1)))),
@@ -164,15 +261,48 @@ func (s Server) RenderSalaryForLocation(w http.ResponseWriter, r *http.Request,
 		"StdDevMin":           humanize.Comma(int64(math.Round(sampleMin.StdDev()))),
 		"StdDevMax":           humanize.Comma(int64(math.Round(sampleMax.StdDev()))),
 		"Count":               len(set),
-		"Country":             country,
+		"Country":             st.Country,
 		"Min":                 int64(math.Round(min)),
 		"Max":                 int64(math.Round(max)),
-		"ComplimentaryRemote": complimentaryRemote,
+		"ComplimentaryRemote": st.ComplimentaryRemote,
+		"MetaImageURL":        "/x/s/m/meta/salary/" + url.PathEscape(strings.ReplaceAll(location, " ", "-")),
 		"MonthAndYear":        time.Now().UTC().Format("January 2006"),
 	})
 }
 
-func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, location, tag, page, htmlView string) {
+// searchQueryRe keeps the quotes and dashes of a search, the tag shown on the
+// page keeps neither
+var searchQueryRe = regexp.MustCompile(`[^a-zA-Z0-9\s"-]+`)
+
+// facetLink is a refinement of the jobs listed on a landing page
+type facetLink struct {
+	database.FacetCount
+	URL string
+}
+
+type facetGroup struct {
+	Name  string
+	Links []facetLink
+}
+
+// landingMetaImageURL returns the URL of the meta image of a landing page
+func landingMetaImageURL(location, tag string) string {
+	v := url.Values{}
+	if location != "" {
+		v.Set("l", location)
+	}
+	if tag != "" {
+		v.Set("s", tag)
+	}
+	if len(v) == 0 {
+		return "/x/s/m/meta/jobs"
+	}
+	return "/x/s/m/meta/jobs?" + v.Encode()
+}
+
+// RenderPageForLocationAndTag renders the jobs in a location matching a tag,
+// refined by the facets picked in the request URL
+func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, r *http.Request, location, tag, page, htmlView string) {
 	showPage := true
 	if page == "" {
 		page = "1"
@@ -184,30 +314,45 @@ func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, location, tag
 	if err != nil {
 		s.Log(err, "unable to compile regex (this should never happen)")
 	}
+	query := searchQueryRe.ReplaceAllString(tag, "")
 	tag = reg.ReplaceAllString(tag, "")
 	location = reg.ReplaceAllString(location, "")
+	var pageSkill string
+	if skill, ok := database.SkillByName(tag); ok && !database.IsWebSearchQuery(query) {
+		tag = skill.Name
+		query = skill.Name
+		pageSkill = skill.Slug
+	}
+	filter := database.ParseJobFilter(r.URL.Query())
+	filter.Location, filter.Query = location, query
 	pageID, err := strconv.Atoi(page)
 	if err != nil {
 		pageID = 1
 		showPage = false
 	}
-	var pinnedJobs []*database.JobPost
-	pinnedJobs, err = database.GetPinnedJobs(s.Conn)
+	pinnedJobs, err := s.PinnedJobs()
 	if err != nil {
 		s.Log(err, "unable to get pinned jobs")
 	}
-	jobsForPage, totalJobCount, err := database.JobsByQuery(s.Conn, location, tag, pageID, s.cfg.JobsPerPage)
+	// c is the cursor ending the previous page, it is only a shortcut to the
+	// page so invalid ones are ignored
+	after, err := database.ParseJobCursor(r.URL.Query().Get("c"))
+	if err != nil || pageID < 2 {
+		after = database.JobCursor{}
+	}
+	jobsForPage, nextCursor, totalJobCount, err := s.JobsForPage(filter, pageID, after)
 	if err != nil {
 		s.Log(err, "unable to get jobs by query")
 		s.JSON(w, http.StatusInternalServerError, "Oops! An internal error has occurred")
 		return
 	}
+	// refinements matching nothing are left for the user to undo
 	var complementaryRemote bool
-	if len(jobsForPage) == 0 {
+	if len(jobsForPage) == 0 && !filter.IsRefined() {
 		complementaryRemote = true
-		jobsForPage, totalJobCount, err = database.JobsByQuery(s.Conn, "Remote", tag, pageID, s.cfg.JobsPerPage)
+		jobsForPage, nextCursor, totalJobCount, err = s.JobsForPage(database.JobFilter{Location: "Remote", Query: query}, pageID, after)
 		if len(jobsForPage) == 0 {
-			jobsForPage, totalJobCount, err = database.JobsByQuery(s.Conn, "Remote", "", pageID, s.cfg.JobsPerPage)
+			jobsForPage, nextCursor, totalJobCount, err = s.JobsForPage(database.JobFilter{Location: "Remote"}, pageID, after)
 		}
 	}
 	if err != nil {
@@ -215,6 +360,50 @@ func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, location, tag
 		s.JSON(w, http.StatusInternalServerError, "Oops! An internal error has occurred")
 		return
 	}
+	// searches using quotes or exclusions are not redirected to a landing
+	// page URL, which cannot carry them, so links have to keep them
+	searchQuery := url.Values{}
+	if database.IsWebSearchQuery(query) {
+		searchQuery = url.Values{"t": {query}, "l": {location}}
+	}
+	refinedURL := func(f database.JobFilter) string {
+		v := f.Values()
+		for k, vs := range searchQuery {
+			v[k] = vs
+		}
+		if len(v) == 0 {
+			return r.URL.Path
+		}
+		return r.URL.Path + "?" + v.Encode()
+	}
+	var pageQuery string
+	if v := refinedURL(filter); v != r.URL.Path {
+		pageQuery = strings.TrimPrefix(v, r.URL.Path+"?") + "&"
+	}
+	var facets []facetGroup
+	if htmlView == "landing.html" {
+		jobFacets, err := s.jobFacets(filter)
+		if err != nil {
+			s.Log(err, "unable to get job facets")
+		}
+		for _, facet := range jobFacets {
+			group := facetGroup{Name: facet.Name}
+			for _, c := range facet.Counts {
+				// the skill of a skill landing page is not a refinement
+				if c.Param == database.JobFilterParamSkill && c.Value == pageSkill {
+					continue
+				}
+				group.Links = append(group.Links, facetLink{FacetCount: c, URL: refinedURL(filter.Refine(c.Param, c.Value))})
+			}
+			if len(group.Links) > 0 {
+				facets = append(facets, group)
+			}
+		}
+	}
+	var clearFacetsURL string
+	if filter.IsRefined() {
+		clearFacetsURL = refinedURL(database.JobFilter{})
+	}
 	pages := []int{}
 	pageLinksPerPage := 8
 	pageLinkShift := ((pageLinksPerPage / 2) + 1)
@@ -225,23 +414,10 @@ func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, location, tag
 	for i, j := firstPage, 1; i <= totalJobCount/s.cfg.JobsPerPage+1 && j <= pageLinksPerPage; i, j = i+1, j+1 {
 		pages = append(pages, i)
 	}
-	for i, j := range jobsForPage {
-		jobsForPage[i].JobDescription = string(s.tmpl.MarkdownToHTML(j.JobDescription))
-		jobsForPage[i].Perks = string(s.tmpl.MarkdownToHTML(j.Perks))
-		jobsForPage[i].InterviewProcess = string(s.tmpl.MarkdownToHTML(j.InterviewProcess))
-		emailRe := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if emailRe.MatchString(j.HowToApply) {
-			jobsForPage[i].IsQuickApply = true
-		}
-	}
-	for i, j := range pinnedJobs {
-		pinnedJobs[i].JobDescription = string(s.tmpl.MarkdownToHTML(j.JobDescription))
-		pinnedJobs[i].Perks = string(s.tmpl.MarkdownToHTML(j.Perks))
-		pinnedJobs[i].InterviewProcess = string(s.tmpl.MarkdownToHTML(j.InterviewProcess))
-		emailRe := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if emailRe.MatchString(j.HowToApply) {
-			pinnedJobs[i].IsQuickApply = true
-		}
+	// the next page is read from the cursor ending this one
+	var nextPageCursor string
+	if !nextCursor.IsStart() {
+		nextPageCursor = nextCursor.String()
 	}
 
 	s.Render(w, http.StatusOK, htmlView, map[string]interface{}{
@@ -250,10 +426,16 @@ func (s Server) RenderPageForLocationAndTag(w http.ResponseWriter, location, tag
 		"JobsMinusOne":        len(jobsForPage) - 1,
 		"LocationFilter":      location,
 		"TagFilter":           tag,
+		"SearchQuery":         query,
+		"PageQuery":           pageQuery,
+		"Facets":              facets,
+		"ClearFacetsURL":      clearFacetsURL,
+		"MetaImageURL":        landingMetaImageURL(location, tag),
 		"CurrentPage":         pageID,
 		"ShowPage":            showPage,
 		"PageSize":            s.cfg.JobsPerPage,
 		"PageIndexes":         pages,
+		"NextPageCursor":      nextPageCursor,
 		"TotalJobCount":       totalJobCount,
 		"ComplementaryRemote": complementaryRemote,
 		"MonthAndYear":        time.Now().UTC().Format("January 2006"),
@@ -272,24 +454,28 @@ func (s Server) RenderPageForLocationAndTagAdmin(w http.ResponseWriter, location
 	if err != nil {
 		s.Log(err, "unable to compile regex (this should never happen)")
 	}
+	query := searchQueryRe.ReplaceAllString(tag, "")
 	tag = reg.ReplaceAllString(tag, "")
 	location = reg.ReplaceAllString(location, "")
+	if skill, ok := database.SkillByName(tag); ok && !database.IsWebSearchQuery(query) {
+		tag = skill.Name
+		query = skill.Name
+	}
 	pageID, err := strconv.Atoi(page)
 	if err != nil {
 		pageID = 1
 		showPage = false
 	}
-	var pinnedJobs []*database.JobPost
-	pinnedJobs, err = database.GetPinnedJobs(s.Conn)
+	pinnedJobs, err := s.PinnedJobs()
 	if err != nil {
 		s.Log(err, "unable to get pinned jobs")
 	}
 	var pendingJobs []*database.JobPost
-	pendingJobs, err = database.GetPendingJobs(s.Conn)
+	pendingJobs, err = s.Jobs.GetPendingJobs()
 	if err != nil {
 		s.Log(err, "unable to get pending jobs")
 	}
-	jobsForPage, totalJobCount, err := database.JobsByQuery(s.Conn, location, tag, pageID, s.cfg.JobsPerPage)
+	jobsForPage, _, totalJobCount, err := s.JobsForPage(database.JobFilter{Location: location, Query: query}, pageID, database.JobCursor{})
 	if err != nil {
 		s.Log(err, "unable to get jobs by query")
 		s.JSON(w, http.StatusInternalServerError, "Oops! An internal error has occurred")
@@ -298,9 +484,9 @@ func (s Server) RenderPageForLocationAndTagAdmin(w http.ResponseWriter, location
 	var complementaryRemote bool
 	if len(jobsForPage) == 0 {
 		complementaryRemote = true
-		jobsForPage, totalJobCount, err = database.JobsByQuery(s.Conn, "Remote", tag, pageID, s.cfg.JobsPerPage)
+		jobsForPage, _, totalJobCount, err = s.JobsForPage(database.JobFilter{Location: "Remote", Query: query}, pageID, database.JobCursor{})
 		if len(jobsForPage) == 0 {
-			jobsForPage, totalJobCount, err = database.JobsByQuery(s.Conn, "Remote", "", pageID, s.cfg.JobsPerPage)
+			jobsForPage, _, totalJobCount, err = s.JobsForPage(database.JobFilter{Location: "Remote"}, pageID, database.JobCursor{})
 		}
 	}
 	if err != nil {
@@ -318,24 +504,6 @@ func (s Server) RenderPageForLocationAndTagAdmin(w http.ResponseWriter, location
 	for i, j := firstPage, 1; i <= totalJobCount/s.cfg.JobsPerPage+1 && j <= pageLinksPerPage; i, j = i+1, j+1 {
 		pages = append(pages, i)
 	}
-	for i, j := range jobsForPage {
-		jobsForPage[i].JobDescription = string(s.tmpl.MarkdownToHTML(j.JobDescription))
-		jobsForPage[i].Perks = string(s.tmpl.MarkdownToHTML(j.Perks))
-		jobsForPage[i].InterviewProcess = string(s.tmpl.MarkdownToHTML(j.InterviewProcess))
-		emailRe := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if emailRe.MatchString(j.HowToApply) {
-			jobsForPage[i].IsQuickApply = true
-		}
-	}
-	for i, j := range pinnedJobs {
-		pinnedJobs[i].JobDescription = string(s.tmpl.MarkdownToHTML(j.JobDescription))
-		pinnedJobs[i].Perks = string(s.tmpl.MarkdownToHTML(j.Perks))
-		pinnedJobs[i].InterviewProcess = string(s.tmpl.MarkdownToHTML(j.InterviewProcess))
-		emailRe := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-		if emailRe.MatchString(j.HowToApply) {
-			pinnedJobs[i].IsQuickApply = true
-		}
-	}
 
 	s.Render(w, http.StatusOK, htmlView, map[string]interface{}{
 		"Jobs":                jobsForPage,
@@ -344,6 +512,7 @@ func (s Server) RenderPageForLocationAndTagAdmin(w http.ResponseWriter, location
 		"JobsMinusOne":        len(jobsForPage) - 1,
 		"LocationFilter":      location,
 		"TagFilter":           tag,
+		"SearchQuery":         query,
 		"CurrentPage":         pageID,
 		"ShowPage":            showPage,
 		"PageSize":            s.cfg.JobsPerPage,
@@ -356,7 +525,7 @@ func (s Server) RenderPageForLocationAndTagAdmin(w http.ResponseWriter, location
 
 func (s Server) RenderPostAJobForLocation(w http.ResponseWriter, r *http.Request, location string) {
 	ipAddrs := strings.Split(r.Header.Get("x-forwarded-for"), ", ")
-	currency := ipgeolocation.Currency{ipgeolocation.CurrencyUSD, "$"}
+	currency := ipgeolocation.Currency{Code: ipgeolocation.CurrencyUSD, Symbol: "$"}
 	var err error
 	if len(ipAddrs) > 0 {
 		currency, err = s.ipGeoLocation.GetCurrencyForIP(ipAddrs[0])
@@ -370,6 +539,7 @@ func (s Server) RenderPostAJobForLocation(w http.ResponseWriter, r *http.Request
 		"Location":             location,
 		"Currency":             currency,
 		"StripePublishableKey": s.GetConfig().StripePublishableKey,
+		"Skills":               database.Skills,
 	})
 }
 
@@ -450,6 +620,54 @@ func (s Server) MEDIA(w http.ResponseWriter, status int, media []byte, mediaType
 	w.Write(media)
 }
 
+// mediaRevalidateCacheControl lets clients keep media that can change under
+// the same URL for an hour before revalidating it
+const mediaRevalidateCacheControl = "public, max-age=3600"
+
+// MediaNotModified sets the ETag of media with the given content hash and
+// replies 304 Not Modified when the request already has it
+func (s Server) MediaNotModified(w http.ResponseWriter, r *http.Request, hash string) bool {
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", mediaRevalidateCacheControl)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// MediaNotModifiedSince is MediaNotModified for media that also has a
+// modification time, If-Modified-Since is only looked at when the request
+// has no If-None-Match
+func (s Server) MediaNotModifiedSince(w http.ResponseWriter, r *http.Request, hash string, modified time.Time) bool {
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == "" {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !modified.Truncate(time.Second).After(since) {
+			w.Header().Set("ETag", `"`+hash+`"`)
+			w.Header().Set("Cache-Control", mediaRevalidateCacheControl)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return s.MediaNotModified(w, r, hash)
+}
+
+// MEDIAWithETag serves media that can change under the same URL, clients
+// revalidate it with its content hash
+func (s Server) MEDIAWithETag(w http.ResponseWriter, r *http.Request, media []byte, mediaType, hash string) {
+	if s.MediaNotModified(w, r, hash) {
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(media)
+}
+
 func (s Server) Log(err error, msg string) {
 	raven.CaptureErrorAndWait(err, map[string]string{"ctx": msg})
 	log.Printf("%s: %+v", msg, err)
@@ -463,19 +681,56 @@ func (s Server) Redirect(w http.ResponseWriter, r *http.Request, status int, dst
 	http.Redirect(w, r, dst, status)
 }
 
+// shutdownTimeout bounds the wait for requests in flight on shutdown, Heroku
+// kills dynos 30 seconds after asking them to stop
+const shutdownTimeout = 20 * time.Second
+
+// Run serves requests until the process is asked to stop, it then waits for
+// the requests in flight and the meta images being generated and saves the
+// buffered events before returning
 func (s Server) Run() error {
 	addr := fmt.Sprintf("0.0.0.0:%s", s.cfg.Port)
 	if s.cfg.Env != "dev" {
 		addr = fmt.Sprintf(":%s", s.cfg.Port)
 	}
-	return http.ListenAndServe(
-		addr,
-		middleware.HTTPSMiddleware(
-			middleware.GzipMiddleware(
-				middleware.HeadersMiddleware(s.router, s.cfg.Env),
-			),
-			s.cfg.Env,
+	srv := &http.Server{Addr: addr, Handler: s.Handler()}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	s.metaImages.wg.Wait()
+	if s.eventIngester != nil {
+		s.eventIngester.Close()
+	}
+	return err
+}
+
+// EventIngesterStats returns the counters of the event ingester, they are
+// zero when events are tracked on the request path
+func (s Server) EventIngesterStats() database.EventIngesterStats {
+	if s.eventIngester == nil {
+		return database.EventIngesterStats{}
+	}
+	return s.eventIngester.Stats()
+}
+
+// Handler returns the router wrapped in the global middlewares
+func (s Server) Handler() http.Handler {
+	return middleware.HTTPSMiddleware(
+		middleware.GzipMiddleware(
+			middleware.HeadersMiddleware(s.router, s.cfg.Env),
 		),
+		s.cfg.Env,
 	)
 }
 
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/0x13a/golang.cafe/pkg/database"
+)
+
+// botUserAgents are lowercase fragments of the user agents of crawlers,
+// link previewers, monitors and HTTP libraries, keep them sorted
+var botUserAgents = []string{
+	"ahrefs",
+	"applebot",
+	"axios/",
+	"baiduspider",
+	"bingpreview",
+	"bot",
+	"bytespider",
+	"crawl",
+	"curl/",
+	"datadog",
+	"discord",
+	"embedly",
+	"facebookexternalhit",
+	"feedfetcher",
+	"go-http-client",
+	"google-inspectiontool",
+	"googleother",
+	"headlesschrome",
+	"http_request",
+	"httpclient",
+	"httpie",
+	"java/",
+	"libwww",
+	"lighthouse",
+	"linkedinbot",
+	"mastodon",
+	"node-fetch",
+	"okhttp",
+	"phantomjs",
+	"pingdom",
+	"preview",
+	"python",
+	"quora link preview",
+	"ruby",
+	"scrapy",
+	"semrush",
+	"skypeuripreview",
+	"slack",
+	"slurp",
+	"spider",
+	"statuscake",
+	"telegram",
+	"uptime",
+	"vkshare",
+	"wget",
+	"whatsapp",
+	"yandex",
+}
+
+// isBotUserAgent reports whether a user agent is a known bot, requests
+// without one are assumed to come from scripts
+func isBotUserAgent(ua string) bool {
+	ua = strings.ToLower(strings.TrimSpace(ua))
+	if ua == "" {
+		return true
+	}
+	for _, b := range botUserAgents {
+		if strings.Contains(ua, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client. Heroku appends it last to
+// X-Forwarded-For, the entries before it are sent by the client and can be
+// anything
+func clientIP(r *http.Request) string {
+	if fwd := r.Header["X-Forwarded-For"]; len(fwd) > 0 {
+		ips := strings.Split(fwd[len(fwd)-1], ",")
+		return strings.TrimSpace(ips[len(ips)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// JobVisitor identifies the client of a request for job analytics. The IP
+// address is only kept in a hash salted with a secret and the current day,
+// so that visitors cannot be followed from one day to the next, and in the
+// country it is located in
+func (s Server) JobVisitor(r *http.Request) database.JobVisitor {
+	ua := r.UserAgent()
+	ip := clientIP(r)
+	h := sha256.New()
+	h.Write(s.cfg.VisitorHashSalt)
+	h.Write([]byte(time.Now().UTC().Format("2006-01-02")))
+	h.Write([]byte{0})
+	h.Write([]byte(ip))
+	h.Write([]byte{0})
+	h.Write([]byte(ua))
+	// visitors that cannot be located are counted without a country
+	country, _ := s.ipGeoLocation.GetCountryForIP(ip)
+	return database.JobVisitor{Hash: hex.EncodeToString(h.Sum(nil)), Bot: isBotUserAgent(ua), Country: country}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x13a/golang.cafe/pkg/config"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		forwardedFor []string
+		want         string
+	}{
+		{nil, "192.0.2.1"},
+		{[]string{"203.0.113.7"}, "203.0.113.7"},
+		// entries sent by the client come before the one the router appends
+		{[]string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{[]string{"198.51.100.1,203.0.113.7"}, "203.0.113.7"},
+		{[]string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+	} {
+		r := httptest.NewRequest("GET", "/job/go-engineer", nil)
+		for _, v := range tc.forwardedFor {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r); got != tc.want {
+			t.Errorf("X-Forwarded-For %q: got %s, want %s", tc.forwardedFor, got, tc.want)
+		}
+	}
+}
+
+func TestJobVisitorIgnoresForgedForwardedFor(t *testing.T) {
+	s := Server{cfg: config.Config{VisitorHashSalt: []byte("salt")}}
+	visitor := func(forwardedFor string) string {
+		r := httptest.NewRequest("GET", "/job/go-engineer", nil)
+		r.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/115.0")
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		return s.JobVisitor(r).Hash
+	}
+	if visitor("198.51.100.1, 203.0.113.7") != visitor("198.51.100.2, 203.0.113.7") {
+		t.Error("a forged X-Forwarded-For entry counts as another visitor")
+	}
+}
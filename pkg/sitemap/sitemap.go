@@ -91,15 +91,18 @@ var pages = []string{
 	"news",
 	"support",
 	"ksuid",
+	"companies",
 }
 
 func main() {
 	databaseURL := os.Getenv("HEROKU_POSTGRESQL_PINK_URL")
-	conn, err := database.GetDbConn(databaseURL)
+	conn, err := database.GetDbConn(databaseURL, "")
 	if err != nil {
 		log.Fatalf("unable to connect to postgres: %v", err)
 	}
-	database.SaveSEOSkillFromCompany(conn)
+	if err := database.SaveSEOSkills(conn); err != nil {
+		log.Fatalf("unable to save seo skills %v", err)
+	}
 	landingPages, err := seo.GenerateSearchSEOLandingPages(conn)
 	if err != nil {
 		log.Fatalf("unable to generate landing pages %v", err)
@@ -116,6 +119,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to retrieve jobs from db: %#v", err)
 	}
+	companies, err := database.GetCompanies(conn)
+	if err != nil {
+		log.Fatalf("unable to retrieve companies from db: %#v", err)
+	}
 	index := sitemap.NewSitemapIndex()
 	n := time.Now().UTC()
 
@@ -175,6 +182,14 @@ func main() {
 			ChangeFreq: sitemap.Daily,
 		})
 	}
+	for _, c := range companies {
+		lastJobAt := c.LastJobAt
+		pagesSm.Add(&sitemap.URL{
+			Loc:        fmt.Sprintf(`https://golang.cafe/company/%s`, c.Slug),
+			LastMod:    &lastJobAt,
+			ChangeFreq: sitemap.Weekly,
+		})
+	}
 	err = SaveSitemap(pagesSm, "static/sitemap-3.xml")
 	if err != nil {
 		log.Fatalf("unable to save pages sitemap-3.xml: %v", err)
@@ -183,8 +198,8 @@ func main() {
 		Loc:     `https://golang.cafe/sitemap-3.xml`,
 		LastMod: &n,
 	})
-	fmt.Printf("generated %d entries for pages sitemap\n", len(pages)+1)
-	total = total + len(pages) + 1
+	fmt.Printf("generated %d entries for pages sitemap\n", len(pages)+len(companies)+1)
+	total = total + len(pages) + len(companies) + 1
 
 	// post a job landing sitemap
 	last := 4
@@ -1,6 +1,7 @@
 package template
 
 import (
+	"encoding/json"
 	"net/http"
 
 	stdtemplate "html/template"
@@ -28,6 +29,12 @@ func NewTemplate() *Template {
 			}
 			return a[len(a)-1]
 		},
+		// json encodes a value for JSON-LD, views are not escaped for the
+		// context they are rendered in
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
 	}
 	return &Template{
 		templates: customtemplate.Must(customtemplate.New("stdtmpl").Funcs(funcMap).ParseGlob("static/views/*.html")),
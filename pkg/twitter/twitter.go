@@ -18,7 +18,7 @@ func main() {
 		log.Fatalf("unable to load config: %+v", err)
 	}
 	fmt.Printf("running twitter script to post last %d jobs\n", cfg.JobsToPost)
-	conn, err := database.GetDbConn(cfg.DatabaseURL)
+	conn, err := database.GetDbConn(cfg.DatabaseURL, "")
 	if err != nil {
 		log.Fatalf("unable to connect to postgres: %v", err)
 	}
@@ -39,12 +39,12 @@ func main() {
 	api := anaconda.NewTwitterApiWithCredentials(cfg.AccessToken, cfg.AccessTokenSecret, cfg.ClientKey, cfg.ClientSecret)
 	fmt.Printf("initialised twitter client\n")
 	for _, j := range jobs {
-		_, err := api.PostTweet(fmt.Sprintf("%s with %s - %s | %s\n\n#golang #golangjobs\n\nhttps://golang.cafe/job/%s", j.JobTitle, j.Company, j.Location, j.SalaryRange, j.Slug), url.Values{})
+		_, err := api.PostTweet(tweetText(j), url.Values{})
 		if err != nil {
 			// TODO: add some warning to email/sentry
 			log.Fatalf("unable to post tweet got error %v", err)
 		}
-		fmt.Printf(fmt.Sprintf("%s with %s - %s | %s\n\n#golang #golangjobs\n\nhttps://golang.cafe/job/%s\n", j.JobTitle, j.Company, j.Location, j.SalaryRange, j.Slug))
+		fmt.Println(tweetText(j))
 		lastJobID = j.ID
 	}
 	lastJobIDStr := strconv.Itoa(lastJobID)
@@ -55,3 +55,12 @@ func main() {
 	fmt.Printf("updated last twitted job id to %s\n", lastJobIDStr)
 	fmt.Printf("posted last %d jobs to twitter", len(jobs))
 }
+
+// tweetText leaves out the salary of jobs that do not disclose it
+func tweetText(j *database.JobPost) string {
+	var salary string
+	if !j.SalaryUndisclosed {
+		salary = " | " + j.SalaryRange
+	}
+	return fmt.Sprintf("%s with %s - %s%s\n\n#golang #golangjobs\n\nhttps://golang.cafe/job/%s", j.JobTitle, j.Company, j.Location, salary, j.Slug)
+}